@@ -0,0 +1,128 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// --------------------
+// Audit log
+// --------------------
+
+// Actions recorded in the audit log
+const (
+	AUDIT_SUBMIT = "submit"
+	AUDIT_START  = "start"
+	AUDIT_CANCEL = "cancel"
+	AUDIT_FINISH = "finish"
+)
+
+// Limits a job was submitted with, as in the request to the API
+type auditQuota struct {
+	MaxPages    int    `json:"max_pages,omitempty"`
+	MaxBytes    int64  `json:"max_bytes,omitempty"`
+	MaxDuration string `json:"max_duration,omitempty"`
+	MaxMemoryMB uint64 `json:"max_memory_mb,omitempty"`
+}
+
+// Line of the audit log
+type AuditEvent struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+
+	// Name of the API key the request was made with, empty without keys
+	Key string `json:"key,omitempty"`
+
+	Job    string `json:"job"`
+	URL    string `json:"url"`
+	Domain string `json:"domain"`
+
+	// Set on submit
+	Quota *auditQuota `json:"quota,omitempty"`
+
+	// Set on finish
+	State  string `json:"state,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Pages  int    `json:"pages,omitempty"`
+	Errors int    `json:"errors,omitempty"`
+}
+
+// Returns the event of the given action on job
+func newAuditEvent(action string, key string, job *Job) AuditEvent {
+	e := AuditEvent{Time: time.Now(), Action: action, Key: key, Job: job.ID, URL: job.URL}
+	if u, err := url.Parse(job.URL); err == nil {
+		e.Domain = u.Hostname()
+	}
+	switch action {
+	case AUDIT_SUBMIT:
+		e.Quota = &auditQuota{MaxPages: job.quota.Pages, MaxBytes: job.quota.Bytes, MaxMemoryMB: job.quota.Memory >> 20}
+		if job.quota.Duration > 0 {
+			e.Quota.MaxDuration = job.quota.Duration.String()
+		}
+	case AUDIT_FINISH:
+		e.State, e.Reason, e.Error, e.Pages, e.Errors = job.State, job.Reason, job.Error, job.Pages, job.Errors
+	}
+	return e
+}
+
+// Append-only file of AuditEvents, one JSON object per line.
+// Lines are never rewritten, so the file can be shipped elsewhere as it grows.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// Returns the audit log at path, created if missing
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{path: path, f: f}, nil
+}
+
+// Appends e to the log
+func (l *AuditLog) Record(e AuditEvent) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// A single write, so that lines of concurrent servers appending to the same file never interleave
+	_, err = l.f.Write(append(line, '\n'))
+	return err
+}
+
+// Returns the events recorded at or after since, oldest first
+func (l *AuditLog) Events(since time.Time) ([]AuditEvent, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	events := []AuditEvent{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("Malformed line in audit log (%s): %s", scanner.Text(), err)
+		}
+		if !e.Time.Before(since) {
+			events = append(events, e)
+		}
+	}
+	return events, scanner.Err()
+}
+
+func (l *AuditLog) Close() error {
+	return l.f.Close()
+}
@@ -0,0 +1,78 @@
+package crawler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test that who submitted which crawl, and how it ended, is recorded and served
+func TestJobQueue_audit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-audit-")
+	if err != nil {
+		t.Fatalf("Failed to create audit directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	ts := httptest.NewServer(&SyntheticSite{Depth: 1, Branching: 2})
+	defer ts.Close()
+
+	q := NewJobQueue(1, 0)
+	if q.Audit, err = OpenAuditLog(filepath.Join(dir, "audit.ndjson")); err != nil {
+		t.Fatalf("Failed to open audit log: %s", err)
+	}
+	defer q.Audit.Close()
+	api := httptest.NewServer(NewAuthenticator([]APIKey{{Key: "s3cr3t", Name: "ci"}, {Key: "0th3r", Name: "other"}}, q))
+	defer api.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, api.URL+"/jobs", strings.NewReader(`{"url": "`+ts.URL+`", "max_pages": 50}`))
+	req.Header.Set("X-API-Key", "s3cr3t")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Failed to submit job: %v %v", err, resp)
+	}
+	var job Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	waitForJob(t, q, job.ID)
+
+	events := getAuditEvents(t, api.URL, "s3cr3t")
+	actions := []string{AUDIT_SUBMIT, AUDIT_START, AUDIT_FINISH}
+	if len(events) != len(actions) {
+		t.Fatalf("Expecting (%d) events, got (%+v)", len(actions), events)
+	}
+	for i, e := range events {
+		if e.Action != actions[i] || e.Key != "ci" || e.Job != job.ID || e.URL != ts.URL {
+			t.Errorf("Expecting (%s) of job (%s) by (ci), got (%+v)", actions[i], job.ID, e)
+		}
+	}
+	if events[0].Quota == nil || events[0].Quota.MaxPages != 50 {
+		t.Errorf("Expecting the quota to be recorded on submit, got (%+v)", events[0].Quota)
+	}
+	if events[2].State != JOB_DONE || events[2].Pages != 3 {
+		t.Errorf("Expecting the outcome to be recorded on finish, got (%+v)", events[2])
+	}
+
+	// Another key only sees its own submissions
+	if events := getAuditEvents(t, api.URL, "0th3r"); len(events) != 0 {
+		t.Errorf("Expecting no events for another key, got (%+v)", events)
+	}
+}
+
+// Returns the audit events served to the given API key
+func getAuditEvents(t *testing.T, api string, key string) []AuditEvent {
+	req, _ := http.NewRequest(http.MethodGet, api+"/audit", nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Failed to get audit log: %v %v", err, resp)
+	}
+	defer resp.Body.Close()
+	var events []AuditEvent
+	json.NewDecoder(resp.Body).Decode(&events)
+	return events
+}
@@ -0,0 +1,149 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------
+// API keys
+// --------------------
+
+// Key allowed to use the server API
+type APIKey struct {
+
+	// Secret sent by clients, as "Authorization: Bearer <key>" or "X-API-Key: <key>"
+	Key string `json:"key"`
+
+	// Who the key was given to, for logs
+	Name string `json:"name"`
+
+	// Maximum number of requests per minute, unlimited when zero
+	RatePerMinute int `json:"rate_per_minute"`
+}
+
+// Token bucket holding up to a minute worth of requests
+type keyLimiter struct {
+	key    APIKey
+	tokens float64
+	last   time.Time
+}
+
+// Returns true and takes a token if one is available at now, otherwise returns false
+// with the time until the next one is
+func (l *keyLimiter) take(now time.Time) (bool, time.Duration) {
+	if l.key.RatePerMinute <= 0 {
+		return true, 0
+	}
+	rate := float64(l.key.RatePerMinute) / float64(time.Minute)
+	l.tokens = math.Min(float64(l.key.RatePerMinute), l.tokens+rate*float64(now.Sub(l.last)))
+	l.last = now
+	if l.tokens < 1 {
+		return false, time.Duration((1 - l.tokens) / rate)
+	}
+	l.tokens--
+	return true, 0
+}
+
+// Handler only passing requests with a known API key on to next, at most at the rate of the key.
+// Crawling any URL asked for makes the server a way into the network it runs in, so it should
+// never be reachable without keys.
+type Authenticator struct {
+	mu     sync.Mutex
+	keys   map[string]*keyLimiter
+	next   http.Handler
+	nowFun func() time.Time
+}
+
+// Returns an Authenticator letting the given keys through to next
+func NewAuthenticator(keys []APIKey, next http.Handler) *Authenticator {
+	a := &Authenticator{keys: make(map[string]*keyLimiter), next: next, nowFun: time.Now}
+	now := a.nowFun()
+	for _, k := range keys {
+		a.keys[k.Key] = &keyLimiter{key: k, tokens: float64(k.RatePerMinute), last: now}
+	}
+	return a
+}
+
+// Returns the keys read from the JSON file at path, e.g.
+//
+//	{"keys": [{"key": "s3cr3t", "name": "ci", "rate_per_minute": 60}]}
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Keys []APIKey `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("Malformed keys (%s): %s", path, err)
+	}
+	for _, k := range file.Keys {
+		if len(k.Key) == 0 {
+			return nil, fmt.Errorf("Empty key in (%s)", path)
+		}
+	}
+	return file.Keys, nil
+}
+
+// Key of the request context holding the name of the API key used
+type apiKeyName struct{}
+
+// Returns the name of the API key the request was let through with, empty if none
+func requestKeyName(r *http.Request) string {
+	name, _ := r.Context().Value(apiKeyName{}).(string)
+	return name
+}
+
+// Returns the API key sent with the request, empty if none
+func requestAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+func (a *Authenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	l, ok := a.keys[requestAPIKey(r)]
+	var allowed bool
+	var retry time.Duration
+	if ok {
+		allowed, retry = l.take(a.nowFun())
+	}
+	a.mu.Unlock()
+
+	switch {
+	case !ok:
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSONError(w, http.StatusUnauthorized, "Missing or unknown API key")
+	case !allowed:
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		writeJSONError(w, http.StatusTooManyRequests, fmt.Sprintf("Rate limit of key (%s) exceeded", l.key.Name))
+	default:
+		a.next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyName{}, l.key.Name)))
+	}
+}
+
+// Returns true if addr only listens on the loopback interface
+func IsLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
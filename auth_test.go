@@ -0,0 +1,67 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Test that only requests with a known key get through, at most at the rate of the key
+func TestAuthenticator(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	a := NewAuthenticator([]APIKey{{Key: "limited", Name: "ci", RatePerMinute: 2}, {Key: "unlimited"}}, ok)
+	now := time.Now()
+	a.nowFun = func() time.Time { return now }
+
+	status := func(header string, value string) int {
+		r := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+		if len(header) > 0 {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	tests := []struct {
+		header string
+		value  string
+		want   int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"X-API-Key", "wrong", http.StatusUnauthorized},
+		{"Authorization", "Bearer limited", http.StatusOK},
+		{"X-API-Key", "limited", http.StatusOK},
+		{"X-API-Key", "limited", http.StatusTooManyRequests},
+		{"X-API-Key", "unlimited", http.StatusOK},
+		{"X-API-Key", "unlimited", http.StatusOK},
+	}
+	for _, test := range tests {
+		if got := status(test.header, test.value); got != test.want {
+			t.Errorf("Expecting (%d) for (%s: %s), got (%d)", test.want, test.header, test.value, got)
+		}
+	}
+
+	// A token comes back every 30 seconds
+	now = now.Add(30 * time.Second)
+	if got := status("X-API-Key", "limited"); got != http.StatusOK {
+		t.Errorf("Expecting the rate limit to let a request through after a while, got (%d)", got)
+	}
+}
+
+func TestIsLoopbackAddr(t *testing.T) {
+	tests := map[string]bool{
+		"localhost:8081": true,
+		"127.0.0.1:8081": true,
+		"[::1]:8081":     true,
+		":8081":          false,
+		"0.0.0.0:8081":   false,
+		"10.0.0.1:8081":  false,
+	}
+	for addr, want := range tests {
+		if got := IsLoopbackAddr(addr); got != want {
+			t.Errorf("Expecting (%v) for (%s), got (%v)", want, addr, got)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// --------------------
+// Backpressure
+// --------------------
+
+// Number of sites crawled at the same time, each by its own goroutine, unless told otherwise
+const DEFAULT_MAX_GOROUTINES int64 = 10000
+
+// Takes one of the 'maxGoroutines' slots for a new Crawl() goroutine.
+// Returns false when all are taken, the frontier is saturated then.
+func (c *Crawler) reserveGoroutine() bool {
+	for {
+		n := atomic.LoadInt64(&c.goroutines)
+		if c.maxGoroutines > 0 && n >= c.maxGoroutines {
+			c.setSaturated(true)
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&c.goroutines, n, n+1) {
+			return true
+		}
+	}
+}
+
+// Returns true when 'maxGoroutines' sites already wait for a worker, the frontier is saturated then
+func (c *Crawler) frontierFull() bool {
+	if c.maxGoroutines > 0 && int64(c.frontier.len()) >= c.maxGoroutines {
+		c.setSaturated(true)
+		return true
+	}
+	return false
+}
+
+// Gives back the slot of a Crawl() goroutine that is done, waking up the spill if it waits for one
+func (c *Crawler) releaseGoroutine() {
+	atomic.AddInt64(&c.goroutines, -1)
+	select {
+	case c.slotFreed <- struct{}{}:
+	default:
+	}
+}
+
+// Records whether new sites wait on disk because 'maxGoroutines' sites are being crawled, or
+// wait for a worker, logging when that starts and stops like the throttle does
+func (c *Crawler) setSaturated(saturated bool) {
+	if saturated && atomic.CompareAndSwapInt32(&c.saturated, 0, 1) {
+		log.Printf("Frontier saturated, %d sites are being crawled or queued. New sites wait on disk.\n", c.maxGoroutines)
+	} else if !saturated && atomic.CompareAndSwapInt32(&c.saturated, 1, 0) {
+		log.Printf("Frontier no longer saturated.\n")
+	}
+}
@@ -0,0 +1,49 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Without workers, no more than maxGoroutines pages are crawled at once, the others wait until slots are freed
+func TestRun_maxGoroutines(t *testing.T) {
+	site := &SyntheticSite{Depth: 2, Branching: 8, Latency: 2 * time.Millisecond}
+	var mu sync.Mutex
+	current, peak := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		current++
+		if current > peak {
+			peak = current
+		}
+		mu.Unlock()
+		site.ServeHTTP(w, r)
+		mu.Lock()
+		current--
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.workers = 0
+	c.maxGoroutines = 4
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(res.Pages) != site.Pages() {
+		t.Errorf("Expecting all (%d) pages to be crawled, got (%d)", site.Pages(), len(res.Pages))
+	}
+	if peak > 4 {
+		t.Errorf("Expecting at most (4) pages to be fetched at once, got (%d)", peak)
+	}
+	if c.goroutines != 0 || c.saturated != 0 {
+		t.Errorf("Expecting all slots to be free once done, got (%d) taken", c.goroutines)
+	}
+}
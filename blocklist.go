@@ -0,0 +1,79 @@
+package crawler
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// --------------------
+// Blocklist
+// --------------------
+
+// URLs that must never be requested, such as logout links or GET endpoints changing state
+// (/delete?id=), which matters when crawling an authenticated app. Enforced by the "blocklist" filter.
+type Blocklist struct {
+
+	// URLs blocked, without fragment
+	exact map[string]bool
+
+	// Prefixes of the URLs blocked
+	prefixes []string
+}
+
+// Returns the blocklist read from r, one entry per line:
+//
+//	# Comments and empty lines are skipped
+//	https://app.example.com/logout    exact URL
+//	https://app.example.com/admin/*   any URL starting with the entry
+//	/delete?id=*                      entries starting with / match the path and query of URLs on any host
+func ParseBlocklist(r io.Reader) (*Blocklist, error) {
+	b := &Blocklist{exact: make(map[string]bool)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasSuffix(line, "*") {
+			b.prefixes = append(b.prefixes, strings.TrimSuffix(line, "*"))
+		} else {
+			b.exact[line] = true
+		}
+	}
+	return b, scanner.Err()
+}
+
+// Returns the blocklist read from the file at path, see ParseBlocklist
+func LoadBlocklist(path string) (*Blocklist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseBlocklist(f)
+}
+
+// Returns true if the given site must not be requested
+func (b *Blocklist) Blocked(site string) bool {
+	if i := strings.Index(site, "#"); i >= 0 {
+		site = site[:i]
+	}
+	candidates := []string{site}
+	if u, err := url.Parse(site); err == nil {
+		candidates = append(candidates, u.RequestURI())
+	}
+	for _, s := range candidates {
+		if b.exact[s] {
+			return true
+		}
+		for _, prefix := range b.prefixes {
+			if strings.HasPrefix(s, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
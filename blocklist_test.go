@@ -0,0 +1,73 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBlocklist_Blocked(t *testing.T) {
+	b, err := ParseBlocklist(strings.NewReader(`
+# Never log out
+https://monzo.com/logout
+https://monzo.com/admin/*
+/delete?id=*
+`))
+	if err != nil {
+		t.Fatalf("ParseBlocklist failed: %v", err)
+	}
+	tests := map[string]bool{
+		"https://monzo.com/logout":          true,
+		"https://monzo.com/logout#now":      true,
+		"https://monzo.com/logout/confirm":  false,
+		"https://monzo.com/admin/users":     true,
+		"https://monzo.com/admin":           false,
+		"https://monzo.com/delete?id=4":     true,
+		"https://app.monzo.com/delete?id=4": true,
+		"https://monzo.com/deleted":         false,
+		"https://monzo.com/about":           false,
+	}
+	for site, want := range tests {
+		if got := b.Blocked(site); got != want {
+			t.Errorf("Expecting (%v) for (%s), got (%v)", want, site, got)
+		}
+	}
+}
+
+// Blocked links are never requested, even when linked from every page
+func TestRun_blocklist(t *testing.T) {
+	var deletes int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/delete" {
+			atomic.AddInt32(&deletes, 1)
+		}
+		io.WriteString(w, `<html><a href="/about">About</a><a href="http://`+r.Host+`/delete?id=1">Delete</a><a href="/logout">Log out</a></html>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.blocklist, _ = ParseBlocklist(strings.NewReader("/delete*\n" + ts.URL + "/logout"))
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if n := atomic.LoadInt32(&deletes); n != 0 {
+		t.Errorf("Expecting the blocked endpoint to never be requested, got (%d) requests", n)
+	}
+	if len(res.Pages) != 2 {
+		t.Errorf("Expecting the base site and (/about) to be crawled, got (%v)", res.Pages)
+	}
+	for _, p := range res.NotCrawled {
+		if p.Reason != SKIP_BLOCKLIST {
+			t.Errorf("Expecting (%s) to be skipped for (%s), got (%s)", p.URL, SKIP_BLOCKLIST, p.Reason)
+		}
+	}
+	if len(res.NotCrawled) != 2 {
+		t.Errorf("Expecting the (2) blocked links to be reported, got (%+v)", res.NotCrawled)
+	}
+}
@@ -0,0 +1,113 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --------------------
+// Caching audit
+// --------------------
+
+// Time to live under which a cached response is reported as too short lived
+const MIN_CACHE_TTL time.Duration = time.Minute
+
+// Returns the directives of the given Cache-Control header values, lowercased.
+// Directives without a value (no-store) map to an empty string.
+func cacheDirectives(values []string) map[string][]string {
+	directives := make(map[string][]string)
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg := strings.TrimSpace(directive), ""
+			if i := strings.Index(name, "="); i >= 0 {
+				name, arg = strings.TrimSpace(name[:i]), strings.Trim(strings.TrimSpace(name[i+1:]), "\"")
+			}
+			if len(name) > 0 {
+				name = strings.ToLower(name)
+				directives[name] = append(directives[name], arg)
+			}
+		}
+	}
+	return directives
+}
+
+// Returns the problems with the caching policy of a response with the given headers:
+// no policy at all, directives contradicting each other, or a time to live under minTTL.
+func auditCaching(header http.Header, minTTL time.Duration) []string {
+	var problems []string
+	directives := cacheDirectives(header.Values("Cache-Control"))
+	expires := header.Get("Expires")
+	if len(directives) == 0 && len(expires) == 0 {
+		return []string{"no Cache-Control or Expires"}
+	}
+
+	_, noStore := directives["no-store"]
+	_, public := directives["public"]
+	_, private := directives["private"]
+	if public && private {
+		problems = append(problems, "both public and private")
+	}
+
+	// Time to live from max-age, falling back on Expires as caches do
+	ttl, hasTTL := time.Duration(0), false
+	for _, name := range []string{"max-age", "s-maxage"} {
+		args := directives[name]
+		for _, arg := range args {
+			if arg != args[0] {
+				problems = append(problems, fmt.Sprintf("conflicting %s values (%s)", name, strings.Join(args, ", ")))
+				break
+			}
+		}
+		if len(args) > 0 && name == "max-age" {
+			seconds, err := strconv.Atoi(args[0])
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("invalid max-age (%s)", args[0]))
+				continue
+			}
+			ttl, hasTTL = time.Duration(seconds)*time.Second, true
+		}
+	}
+	if !hasTTL && len(expires) > 0 {
+		if t, err := http.ParseTime(expires); err == nil {
+			date := time.Now()
+			if d, err := http.ParseTime(header.Get("Date")); err == nil {
+				date = d
+			}
+			ttl, hasTTL = t.Sub(date), true
+		}
+	}
+
+	if noStore && hasTTL && ttl > 0 {
+		problems = append(problems, fmt.Sprintf("no-store along with a time to live of %s", ttl))
+	} else if !noStore && hasTTL && ttl > 0 && ttl < minTTL {
+		problems = append(problems, fmt.Sprintf("time to live of %s", ttl))
+	}
+	return problems
+}
+
+// Returns the problems with the caching policy of each URL fetched, from the headers captured.
+// Cache-Control, Expires and Date must be in 'captureHeaders' for the audit to be meaningful.
+func (c *Crawler) cachingProblems() map[string][]string {
+	problems := make(map[string][]string)
+	c.headers.Range(func(k, v interface{}) bool {
+		if p := auditCaching(v.(http.Header), c.minCacheTTL); len(p) > 0 {
+			problems[k.(string)] = p
+		}
+		return true
+	})
+	return problems
+}
+
+// Returns the keys of the given map sorted
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,35 @@
+package crawler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditCaching(t *testing.T) {
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header   http.Header
+		expected string
+	}{
+		{http.Header{}, "no Cache-Control or Expires"},
+		{http.Header{"Cache-Control": {"public, max-age=3600"}}, ""},
+		{http.Header{"Cache-Control": {"no-cache"}}, ""},
+		{http.Header{"Cache-Control": {"max-age=0, must-revalidate"}}, ""},
+		{http.Header{"Cache-Control": {"max-age=10"}}, "time to live of 10s"},
+		{http.Header{"Cache-Control": {"no-store, max-age=600"}}, "no-store along with a time to live of 10m0s"},
+		{http.Header{"Cache-Control": {"public, private, max-age=600"}}, "both public and private"},
+		{http.Header{"Cache-Control": {"max-age=600", "max-age=60"}}, "conflicting max-age values (600, 60)"},
+		{http.Header{"Cache-Control": {"max-age=forever"}}, "invalid max-age (forever)"},
+		{http.Header{"Expires": {date.Add(30 * time.Second).Format(http.TimeFormat)},
+			"Date": {date.Format(http.TimeFormat)}}, "time to live of 30s"},
+		{http.Header{"Expires": {date.Add(time.Hour).Format(http.TimeFormat)},
+			"Date": {date.Format(http.TimeFormat)}}, ""},
+	}
+	for _, test := range tests {
+		if problems := strings.Join(auditCaching(test.header, time.Minute), "; "); problems != test.expected {
+			t.Errorf("Expecting (%s) for (%v), got (%s)", test.expected, test.header, problems)
+		}
+	}
+}
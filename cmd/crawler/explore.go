@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	crawler "github.com/skfarhat/go-web-crawler"
+)
+
+// Entry point of the explore subcommand, navigates a crawl saved with -stream
+func exploreMain(args []string) {
+	flags := flag.NewFlagSet("explore", flag.ExitOnError)
+	stream := flags.String("stream", "crawl.ndjson", "NDJSON stream of the crawl to explore, as written with -stream.")
+	flags.Parse(args)
+
+	pages, err := crawler.LoadStream(*stream)
+	if err != nil {
+		log.Fatalf("Failed to load crawl (%s): %s\n", *stream, err)
+	}
+	e := crawler.NewExplorer(pages, os.Stdout)
+	if err := e.Run(os.Stdin, true); err != nil {
+		log.Fatalf("Failed to read commands: %s\n", err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	crawler "github.com/skfarhat/go-web-crawler"
+)
+
+// Entry point of the import subcommand, converts the exports of other tools to an NDJSON
+// stream that explore and query read like the stream of a crawl
+func importMain(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	output := flags.String("output", "crawl.ndjson", "NDJSON stream the imported pages are written to.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: import [flags] internal_all.csv all_outlinks.csv sitemap.xml ...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ci := crawler.NewCrawlImport()
+	for _, path := range flags.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Failed to open (%s): %s\n", path, err)
+		}
+		if strings.HasSuffix(path, ".csv") {
+			err = ci.ImportScreamingFrog(f)
+		} else {
+			var sitemaps []string
+			if sitemaps, err = ci.ImportSitemap(f); len(sitemaps) > 0 {
+				log.Printf("(%s) is a sitemap index, import the %d sitemaps it lists too: %s\n", path, len(sitemaps), strings.Join(sitemaps, " "))
+			}
+		}
+		f.Close()
+		if err != nil {
+			log.Fatalf("Failed to import (%s): %s\n", path, err)
+		}
+	}
+	ci.DedupChildren()
+
+	// The stream only replaces an existing one once fully written
+	out, err := crawler.OpenOutput(*output, false)
+	if err != nil {
+		log.Fatalf("Failed to create (%s): %s\n", *output, err)
+	}
+	enc := json.NewEncoder(out)
+	pages := ci.Pages()
+	for _, p := range pages {
+		if err = enc.Encode(p); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = out.Commit()
+	} else {
+		out.Abort()
+	}
+	if err != nil {
+		log.Fatalf("Failed to write (%s): %s\n", *output, err)
+	}
+	log.Printf("Imported %d pages to (%s).\n", len(pages), *output)
+}
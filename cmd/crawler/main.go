@@ -0,0 +1,411 @@
+// Command crawler crawls a site and prints its sitemap, or runs one of its subcommands:
+// testsite, serve, multi, trends, explore, query, import and monitor.
+//
+//	crawler [flags] URL
+//	crawler <subcommand> [flags]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"runtime/trace"
+	"strings"
+	"time"
+
+	"github.com/pkg/profile"
+	crawler "github.com/skfarhat/go-web-crawler"
+)
+
+// Subcommands by name, each parsing its own flags from the arguments following its name
+var subcommands = map[string]func(args []string){
+	"testsite": testsiteMain,
+	"serve":    serveMain,
+	"multi":    multiMain,
+	"trends":   trendsMain,
+	"explore":  exploreMain,
+	"query":    queryMain,
+	"import":   importMain,
+	"monitor":  monitorMain,
+}
+
+func main() {
+	// Secrets of the crawl never make it to the logs
+	log.SetOutput(crawler.NewRedactingWriter(os.Stderr))
+
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			subcommand(os.Args[2:])
+			return
+		}
+	}
+	crawlMain()
+}
+
+// Returns option, failing with the name of the flag it was set from when it does not apply
+func flagOption(name string, option crawler.Option) crawler.Option {
+	return func(c *crawler.Crawler) error {
+		if err := option(c); err != nil {
+			return fmt.Errorf("Invalid -%s: %s", name, err)
+		}
+		return nil
+	}
+}
+
+// Returns the non empty values of the given comma separated list, trimmed
+func splitList(list string) []string {
+	var values []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Crawls the site given on the command line and prints its sitemap
+func crawlMain() {
+	site := flag.String("url", "", "Site to crawl, e.g. https://monzo.com (may also be given as the first argument).")
+	verbose := flag.Bool("verbose", false, "Provides versbose output.")
+	format := flag.String("format", "", "Same as -printmode, e.g. txt (takes precedence when set).")
+	printMode := flag.String("printmode", "mode1", "options: mode1 (flattest), mode2 (flat), mode3 (external links), txt (sorted URLs, one per line), xml (sitemap.xml), junit (findings as JUnit XML), sarif (findings as SARIF)")
+	fast := flag.Bool("fast", false, "Use httpfast")
+	counts := flag.Bool("counts", false, "Keep the number of times each child is linked from its parent (shown in mode2).")
+	strictScheme := flag.Bool("strictscheme", false, "Crawl http:// and https:// variants of a URL as different pages, even when the site redirects from one to the other.")
+	strictPaths := flag.Bool("strictpaths", false, "Crawl /dir, /dir/ and /dir/index.html as different pages.")
+	wwwAlias := flag.Bool("wwwalias", true, "Treat www.<domain> and <domain> as the same site, following links to the one the first site redirects to.")
+	anyPort := flag.Bool("anyport", false, "Treat all ports of the crawled domain as the same site (by default only its default ports are).")
+	ignoreCase := flag.Bool("ignorecase", false, "Treat URL paths as case insensitive when deciding whether a page was visited.")
+	metaRefresh := flag.String("metarefresh", "follow", "options: follow (crawl the target of meta refresh redirects), report (only report them)")
+	spaFragments := flag.Bool("spafragments", false, "Crawl URLs with hash routes (/#/products/1) as distinct pages.")
+	timeout := flag.Duration("timeout", 15*time.Second, "Maximum time allowed to fetch a single page (0 for no limit).")
+	maxPages := flag.Int("maxpages", 0, "Stop the crawl once the given number of pages were fetched (0 for no limit).")
+	maxBytes := flag.Int64("maxbytes", 0, "Stop the crawl once the given number of bytes were fetched (0 for no limit).")
+	maxTime := flag.Duration("maxtime", 0, "Stop fetching new pages after the given time, pages left are listed in the report (0 for no limit).")
+	politenessConfig := flag.String("politeness", "", "JSON file of politeness profiles (rate, concurrency, delay, jitter, user agent) and the hosts they apply to.")
+	etagAliases := flag.Bool("etagaliases", false, "Record URLs of a host serving the same ETag and size as another as its aliases, without fetching their body again.")
+	maintenance503s := flag.Int("maintenance503s", crawler.DEFAULT_MAINTENANCE_503S, "Consecutive 503 responses after which the site is taken for down for maintenance and the crawl pauses (0 to never pause for them).")
+	maintenanceSignature := flag.String("maintenancesignature", "", "Text of the site's maintenance page, e.g. \"We'll be back soon\", pausing the crawl when a page contains it.")
+	maintenanceBackoff := flag.Duration("maintenancebackoff", crawler.DEFAULT_MAINTENANCE_BACKOFF, "Time the crawl pauses for when the site is down for maintenance, unless it sends a longer Retry-After.")
+	depth := flag.Int("depth", 0, "Maximum number of links followed from the site, pages further away are listed but not fetched (0 for no limit).")
+	rate := flag.Float64("rate", 0, "Maximum requests per second sent to each host (0 for no limit).")
+	burst := flag.Int("burst", crawler.DEFAULT_RATE_BURST, "Requests sent to a host at once after a pause, see -rate.")
+	jitterMin := flag.Duration("jittermin", 0, "Minimum random delay added before each request, see -jittermax.")
+	jitterMax := flag.Duration("jittermax", 0, "Maximum random delay added before each request, so that requests do not come at a fixed pace (0 for none).")
+	window := flag.String("window", "", "Time of day pages are fetched, e.g. 01:00-05:00, the crawl pauses outside of it (empty for any time).")
+	windowZone := flag.String("windowtz", "UTC", "Time zone of -window, e.g. Europe/London.")
+	rampDuration := flag.Duration("rampup", 0, "Start with few requests at once and allow more over the given time, holding while the error rate is high (0 to start at full speed).")
+	rampFrom := flag.Int("rampfrom", crawler.DEFAULT_RAMP_FROM, "Number of requests sent at once when -rampup starts.")
+	rampTo := flag.Int("rampto", crawler.DEFAULT_RAMP_TO, "Number of requests sent at once when -rampup ends, after which there is no limit.")
+	backoff := flag.Float64("backoff", 0.5, "Error rate above which requests are slowed down (0 to never slow down).")
+	workers := flag.Int("workers", crawler.DEFAULT_WORKERS, "Number of pages crawled at the same time by a pool of workers (0 for a goroutine per page, up to -maxgoroutines).")
+	maxGoroutines := flag.Int64("maxgoroutines", crawler.DEFAULT_MAX_GOROUTINES, "Number of pages crawled at the same time without -workers, or waiting for a worker with them, above which new pages wait on disk (0 for no limit).")
+	maxMemory := flag.Uint64("maxmemory", 0, "Heap size in MB above which newly found pages are spilled to disk until it goes back down (0 for no limit).")
+	pprofAddr := flag.String("pprof", "", "Serve net/http/pprof on the given address (e.g. localhost:6060) during the crawl.")
+	traceFile := flag.String("trace", "", "Write a runtime trace of the crawl to the given file (e.g. trace.out).")
+	record := flag.String("record", "", "Record every response of the crawl to the given fixture directory.")
+	replay := flag.String("replay", "", "Serve responses from the given fixture directory instead of the network.")
+	timings := flag.Bool("timings", false, "Record the DNS, connect, TLS, TTFB and body read times of each request, in the report and -stream (not supported with -fast).")
+	probeBytes := flag.Int64("probebytes", 0, "Fetch the first bytes of resources skipped for their suffix (pdf, png..) with a Range request, to report their type and size (0 to never fetch them).")
+	crawlID := flag.Bool("crawlid", false, "Send X-Crawl-Id and X-Request-Id headers with every request, so that the site can find the crawl in its logs.")
+	requestHeaders := flag.String("requestheaders", "", "Semicolon separated headers sent with every request, e.g. \"Authorization: Bearer s3cr3t; X-Tenant: monzo\". Secrets are redacted from logs and exports.")
+	cookie := flag.String("cookie", "", "Cookie header sent with every request, e.g. \"session=abc123\". Redacted from logs and exports.")
+	headers := flag.String("headers", strings.Join(crawler.DEFAULT_CAPTURE_HEADERS, ","), "Comma separated response headers kept for each page (empty to keep none).")
+	minCacheTTL := flag.Duration("mincachettl", crawler.MIN_CACHE_TTL, "Time to live of cached responses under which they are reported.")
+	minCompressSize := flag.Int("mincompresssize", crawler.MIN_COMPRESS_SIZE, "Size in bytes above which text responses served uncompressed are reported.")
+	priorities := flag.Bool("priorities", false, "Estimate <priority> and <changefreq> of each page in sitemap.xml (printmode xml), <changefreq> from the crawls recorded in -history if any.")
+	issues := flag.String("issues", "", "Open or update an issue listing newly broken links in github:owner/repo or gitlab:group/project, with GITHUB_TOKEN or GITLAB_TOKEN (none when empty).")
+	issuesAPI := flag.String("issuesapi", "", "API of the issue tracker of -issues, for self-hosted instances (github.com or gitlab.com by default).")
+	ping := flag.String("ping", "", "Comma separated search engines (google, bing) or ping URLs containing %s told about sitemap.xml once written (printmode xml, none when empty).")
+	sitemapURL := flag.String("sitemapurl", "", "Location sitemap.xml is published at, sent with -ping (by default /sitemap.xml of the site crawled).")
+	probe404 := flag.Bool("probe404", true, "Request a missing page before crawling to detect pages answering broken links with a 200.")
+	robotsCache := flag.String("robotscache", "", "Directory robots.txt are cached in across runs (none when empty).")
+	robotsTTL := flag.Duration("robotsttl", crawler.DEFAULT_ROBOTS_TTL, "Time a cached robots.txt is used for before being fetched again.")
+	filters := flag.String("filters", strings.Join(crawler.DEFAULT_FILTERS, ","), "Comma separated filters deciding which of the links found are crawled, in order: blocklist, trap, scope, depth, robots, under, suffix, pattern, sample. blocklist, scope and robots are added when left out, see -blocklist and -ignore-robots.")
+	stayUnder := flag.Bool("stay-under", false, "Only crawl URLs under the path of the first site, e.g. /docs/ when crawling https://monzo.com/docs/.")
+	parentLinks := flag.String("parentlinks", crawler.ESCAPE_SKIP, "options for links leaving the path of -stay-under, including ../ links: skip (list them as not crawled), follow (crawl them but not their links), external (report them as external links), drop (ignore them)")
+	sampleSize := flag.Int("samplesize", crawler.DEFAULT_SAMPLE_SIZE, "Number of URLs of each search page or parameterized endpoint template crawled, the others are reported instead (0 for no limit).")
+	trapWords := flag.String("trapwords", strings.Join(crawler.DEFAULT_TRAP_WORDS, ","), "Comma separated words of URLs that are never followed as they likely change state, e.g. logout (empty to follow every link).")
+	stripParams := flag.String("stripparams", "", "Comma separated session or tracking parameters removed from links on top of the built-in ones, ending with * to match a prefix (e.g. ref,mc_*).")
+	stripBuiltin := flag.Bool("stripbuiltin", true, "Remove the built-in session and tracking parameters from links: "+strings.Join(crawler.DEFAULT_STRIPPED_PARAMS, ", ")+" (false to keep them).")
+	blocklist := flag.String("blocklist", "", "File of URLs never to fetch, one per line, ending with * to block a prefix (e.g. /logout*).")
+	include := flag.String("include", "", "Only crawl URLs matching the given regular expression.")
+	exclude := flag.String("exclude", "", "Do not crawl URLs matching the given regular expression.")
+	extract := flag.String("extract", "", "Semicolon separated name=selector values captured on each page, e.g. \"price=span.price;author=meta[name=author]@content\".")
+	followIn := flag.String("followin", "", "Comma separated selectors links are only followed inside of, e.g. \"nav,main\".")
+	ignoreIn := flag.String("ignorein", "", "Comma separated selectors links are never followed inside of, e.g. \"footer,.comments\".")
+	lint := flag.Bool("lint", false, "Check the syntax of robots.txt, and that the sitemaps are well-formed, within the limits of the protocol and only list URLs under them.")
+	icons := flag.Bool("icons", false, "Check that /favicon.ico and the icons and web app manifests declared by pages resolve, and that manifests are valid JSON.")
+	ignoreRobots := flag.Bool("ignore-robots", false, "Crawl the paths robots.txt disallows and ignore its Crawl-delay.")
+	sitemaps := flag.Bool("sitemaps", false, "Also crawl the pages listed in the sitemaps declared in robots.txt or linked from pages.")
+	history := flag.String("history", "", "Record a summary of the crawl in the given directory, see the trends subcommand.")
+	historyRuns := flag.Int("historyruns", crawler.DEFAULT_HISTORY_RUNS, "Number of crawls of a site kept in -history.")
+	report := flag.Bool("report", false, "Print a report of the findings after the sitemap.")
+	output := flag.String("output", "", "Write the sitemap and report to the given file, or upload them to s3://bucket/key or gs://bucket/key with credentials from the environment, instead of stdout.")
+	stream := flag.String("stream", "", "Write each page to the given .ndjson or .csv file as soon as it is crawled.")
+	compress := flag.Bool("compress", false, "Gzip the output (implied when the -output file name ends in .gz).")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] URL\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if len(*format) > 0 {
+		*printMode = *format
+	}
+
+	// The site is checked before anything else is set up
+	switch {
+	case flag.NArg() > 1:
+		log.Fatalf("Expecting a single URL to crawl, got (%s).\n", strings.Join(flag.Args(), " "))
+	case flag.NArg() == 1 && len(*site) > 0 && flag.Arg(0) != *site:
+		log.Fatalf("Conflicting URLs to crawl (%s) and (%s), expecting -url or an argument.\n", *site, flag.Arg(0))
+	case flag.NArg() == 1:
+		*site = flag.Arg(0)
+	case len(*site) == 0:
+		flag.Usage()
+		os.Exit(2)
+	}
+	seed, err := crawler.ParseSeed(*site)
+	if err != nil {
+		log.Fatalf("%s.\n", err)
+	}
+
+	defer profile.Start().Stop()
+
+	// Handlers registered on http.DefaultServeMux by importing net/http/pprof
+	if len(*pprofAddr) > 0 {
+		go func() {
+			log.Println(http.ListenAndServe(*pprofAddr, nil))
+		}()
+	}
+
+	// Options of the crawl, in the order they depend on each other
+	strippedParams := splitList(*stripParams)
+	if *stripBuiltin {
+		strippedParams = append(append([]string{}, crawler.DEFAULT_STRIPPED_PARAMS...), strippedParams...)
+	}
+	options := []crawler.Option{
+		crawler.WithVerbose(*verbose),
+		crawler.WithFast(*fast),
+		crawler.WithLinkCounts(*counts),
+		crawler.WithStrictScheme(*strictScheme),
+		crawler.WithStrictPaths(*strictPaths),
+		crawler.WithIgnoreCase(*ignoreCase),
+		crawler.WithStayUnder(*stayUnder),
+		flagOption("parentlinks", crawler.WithParentLinks(*parentLinks)),
+		crawler.WithAnyPort(*anyPort),
+		crawler.WithWWWAlias(*wwwAlias),
+		crawler.WithRouteFragments(*spaFragments),
+		crawler.WithSitemaps(*sitemaps),
+		flagOption("depth", crawler.WithMaxDepth(*depth)),
+		crawler.WithRobots(!*ignoreRobots),
+		crawler.WithIcons(*icons),
+		crawler.WithLint(*lint),
+		crawler.WithTrapWords(splitList(*trapWords)),
+		crawler.WithStrippedParams(strippedParams),
+		flagOption("samplesize", crawler.WithSampleSize(*sampleSize)),
+		crawler.WithCrawlID(*crawlID),
+		flagOption("probebytes", crawler.WithProbeBytes(*probeBytes)),
+		crawler.WithFingerprints(len(*history) > 0),
+		crawler.WithTimings(*timings),
+	}
+	if len(*blocklist) > 0 {
+		b, err := crawler.LoadBlocklist(*blocklist)
+		if err != nil {
+			log.Fatalf("Invalid -blocklist: %s\n", err)
+		}
+		options = append(options, crawler.WithBlocklist(b))
+	}
+	options = append(options, flagOption("filters", crawler.WithFilters(strings.Split(*filters, ",")...)))
+	for _, e := range strings.Split(*extract, ";") {
+		if name := strings.SplitN(e, "=", 2); len(name) == 2 {
+			options = append(options, flagOption("extract", crawler.WithExtractor(strings.TrimSpace(name[0]), name[1])))
+		} else if len(strings.TrimSpace(e)) > 0 {
+			log.Fatalf("Invalid -extract (%s), expecting name=selector\n", e)
+		}
+	}
+	requestHeader, err := crawler.ParseRequestHeaders(*requestHeaders)
+	if err != nil {
+		log.Fatalf("Invalid -requestheaders: %s\n", err)
+	}
+	if len(*cookie) > 0 {
+		requestHeader.Set("Cookie", *cookie)
+	}
+	options = append(options,
+		flagOption("followin", crawler.WithFollowIn(*followIn)),
+		flagOption("ignorein", crawler.WithIgnoreIn(*ignoreIn)),
+		flagOption("include", crawler.WithInclude(*include)),
+		flagOption("exclude", crawler.WithExclude(*exclude)),
+		crawler.WithRobotsCache(crawler.NewRobotsCache(*robotsCache, *robotsTTL)),
+		crawler.WithSitemapPriorities(*priorities),
+		crawler.WithProbeNotFound(*probe404),
+		crawler.WithMinCacheTTL(*minCacheTTL),
+		crawler.WithMinCompressSize(*minCompressSize),
+		crawler.WithRequestHeader(requestHeader),
+		crawler.WithCaptureHeaders(splitList(*headers)),
+		flagOption("timeout", crawler.WithFetchTimeout(*timeout)),
+		crawler.WithQuota(crawler.Quota{Pages: *maxPages, Bytes: *maxBytes}),
+		crawler.WithMaxMemory(*maxMemory<<20),
+		flagOption("maxgoroutines", crawler.WithMaxGoroutines(*maxGoroutines)),
+		flagOption("workers", crawler.WithWorkers(*workers)),
+		crawler.WithBackoff(*backoff),
+		crawler.WithETagAliases(*etagAliases),
+		flagOption("maintenance503s", crawler.WithMaintenance(*maintenance503s, *maintenanceSignature, *maintenanceBackoff)),
+		flagOption("rate", crawler.WithRate(*rate, *burst)),
+		flagOption("jittermin and -jittermax", crawler.WithJitter(*jitterMin, *jitterMax)),
+		flagOption("rampfrom and -rampto", crawler.WithRampUp(*rampDuration, *rampFrom, *rampTo)),
+	)
+	if len(*politenessConfig) > 0 {
+		pc, err := crawler.LoadPolitenessConfig(*politenessConfig)
+		if err != nil {
+			log.Fatalf("Invalid -politeness: %s\n", err)
+		}
+		options = append(options, crawler.WithPoliteness(pc))
+	}
+	if len(*window) > 0 {
+		w, err := crawler.ParseCrawlWindow(*window, *windowZone)
+		if err != nil {
+			log.Fatalf("Invalid -window: %s\n", err)
+		}
+		options = append(options, crawler.WithWindow(w))
+	}
+	switch *metaRefresh {
+	case "follow", "report":
+		options = append(options, crawler.WithMetaRefresh(*metaRefresh == "follow"))
+	default:
+		log.Fatalf("Unknown metarefresh (%s).\n", *metaRefresh)
+	}
+	if len(*replay) > 0 {
+		fetcher, err := crawler.NewReplayFetcher(*replay)
+		if err != nil {
+			log.Fatalf("Failed to load fixture (%s): %s\n", *replay, err)
+		}
+		options = append(options, crawler.WithFetcher(fetcher))
+	}
+	if len(*stream) > 0 {
+		sink, err := crawler.NewStreamWriter(*stream)
+		if err != nil {
+			log.Fatalf("Failed to create stream file (%s): %s\n", *stream, err)
+		}
+		defer func() {
+			if err := sink.Close(); err != nil {
+				log.Printf("Failed to write stream file (%s): %s\n", *stream, err)
+			}
+		}()
+		options = append(options, crawler.WithSink(sink))
+	}
+
+	// Crawl and measure time taken
+	start := time.Now()
+	c, err := crawler.New(seed, options...)
+	if err != nil {
+		log.Fatalf("%s\n", err)
+	}
+	if len(*record) > 0 {
+		recorder, err := c.Record(*record)
+		if err != nil {
+			log.Fatalf("Failed to record fixture (%s): %s\n", *record, err)
+		}
+		defer recorder.Close()
+	}
+
+	// Tracker broken links are reported to after the crawl
+	var tracker crawler.IssueTracker
+	if len(*issues) > 0 {
+		if tracker, err = crawler.NewIssueTracker(*issues, *issuesAPI, os.Getenv); err != nil {
+			log.Fatalf("%s\n", err)
+		}
+	}
+
+	// Search engines told about sitemap.xml once written
+	pingEndpoints, err := crawler.ParsePingEndpoints(*ping)
+	if err != nil {
+		log.Fatalf("%s\n", err)
+	} else if len(pingEndpoints) > 0 && *printMode != "xml" {
+		log.Fatalf("Pinging search engines needs printmode xml, not (%s).\n", *printMode)
+	}
+
+	// Trace the crawl only, not the printing
+	if len(*traceFile) > 0 {
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			log.Fatalf("Failed to create trace file (%s): %s\n", *traceFile, err)
+		}
+		defer f.Close()
+		if err := trace.Start(f); err != nil {
+			log.Fatalf("Failed to start trace: %s\n", err)
+		}
+	}
+	// Interrupting the crawl (Ctrl+C) stops it, the pages crawled so far are printed
+	ctx, stopSignal := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stopSignal()
+	if *maxTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *maxTime)
+		defer cancel()
+	}
+	res, err := c.Run(ctx)
+	if _, quota := err.(crawler.QuotaExceeded); quota {
+		log.Printf("Crawl stopped early: %s\n", err)
+	} else if err == context.Canceled {
+		log.Printf("Crawl interrupted, printing the pages crawled so far.\n")
+	} else if err != nil && err != context.DeadlineExceeded {
+		log.Printf("Crawl failed: %s\n", err)
+	}
+	if len(*history) > 0 {
+		if err := c.RecordContentChanges(*history); err != nil {
+			log.Printf("Failed to compare the crawl to the previous one (%s): %s\n", *history, err)
+		}
+		if err := crawler.AppendHistory(*history, c.Summary(start, res), *historyRuns); err != nil {
+			log.Printf("Failed to record the crawl in history (%s): %s\n", *history, err)
+		}
+	}
+	if len(*traceFile) > 0 {
+		trace.Stop()
+	}
+	if tracker != nil {
+		reported, err := c.ReportBrokenLinks(tracker)
+		if err != nil {
+			log.Printf("Failed to report broken links to (%s): %s\n", *issues, err)
+		} else {
+			log.Printf("Reported %d new broken links to (%s).\n", len(reported), *issues)
+		}
+	}
+
+	// The output file only replaces an existing one once fully written
+	out, err := crawler.OpenOutput(*output, *compress)
+	if err != nil {
+		log.Fatalf("Failed to create output file (%s): %s\n", *output, err)
+	}
+
+	err = c.WritePrintMode(out, *printMode)
+	if err == nil && *report {
+		err = c.WriteReport(out)
+	}
+	if err == nil {
+		err = out.Commit()
+	}
+	if err != nil {
+		out.Abort()
+		log.Fatalf("Failed to write output: %s\n", err)
+	}
+
+	if len(pingEndpoints) > 0 {
+		// The site may have redirected to another host while crawling
+		if len(*sitemapURL) == 0 {
+			*sitemapURL = c.SitemapURL()
+		}
+		failed := crawler.PingSitemap(nil, pingEndpoints, *sitemapURL)
+		for endpoint, err := range failed {
+			log.Printf("Failed to ping (%s): %s\n", endpoint, err)
+		}
+		log.Printf("Pinged %d of %d search engines with (%s).\n", len(pingEndpoints)-len(failed), len(pingEndpoints), *sitemapURL)
+	}
+
+	log.Printf("Crawler done. Exiting main.")
+}
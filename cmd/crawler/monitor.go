@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	crawler "github.com/skfarhat/go-web-crawler"
+)
+
+// Entry point of the monitor subcommand, checks a list of URLs periodically
+func monitorMain(args []string) {
+	flags := flag.NewFlagSet("monitor", flag.ExitOnError)
+	urlsFile := flags.String("urls", "urls.txt", "File listing the URLs to check, one per line.")
+	historyFile := flags.String("history", "linkrot.json", "File the history of each URL is kept in across runs.")
+	interval := flags.Duration("interval", 0, "Time between two checks of the URLs (0 to check them once).")
+	maxChecks := flags.Int("maxchecks", crawler.DEFAULT_MONITOR_CHECKS, "Number of checks kept per URL in -history.")
+	concurrency := flags.Int("concurrency", crawler.DEFAULT_MONITOR_CONCURRENCY, "Number of URLs checked at the same time.")
+	timeout := flags.Duration("timeout", 15*time.Second, "Maximum time allowed to check a single URL (0 for no limit).")
+	flags.Parse(args)
+
+	f, err := os.Open(*urlsFile)
+	if err != nil {
+		log.Fatalf("Failed to open URL list (%s): %s\n", *urlsFile, err)
+	}
+	urls, err := crawler.ParseURLList(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("Failed to read URL list (%s): %s\n", *urlsFile, err)
+	}
+
+	m := crawler.NewLinkMonitor(&crawler.HTTPFetcher{Timeout: *timeout}, *concurrency, *maxChecks)
+	if err := m.LoadHistory(*historyFile); err != nil {
+		log.Fatalf("%s\n", err)
+	}
+	for {
+		m.Check(urls)
+		if err := m.SaveHistory(*historyFile); err != nil {
+			log.Printf("Failed to save history (%s): %s\n", *historyFile, err)
+		}
+		if err := m.WriteReport(os.Stdout, urls); err != nil {
+			log.Fatalf("Failed to write report: %s\n", err)
+		}
+		if *interval <= 0 {
+			return
+		}
+		time.Sleep(*interval)
+	}
+}
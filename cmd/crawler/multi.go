@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	crawler "github.com/skfarhat/go-web-crawler"
+)
+
+// Entry point of the multi subcommand, crawls the sites of a config file concurrently
+// and writes each to its own output, followed by a summary of all on stdout
+func multiMain(args []string) {
+	flags := flag.NewFlagSet("multi", flag.ExitOnError)
+	config := flags.String("config", "sites.json", "JSON file listing the sites to crawl.")
+	outDir := flags.String("outdir", ".", "Directory the output of each site is written to, unless the config names a file.")
+	flags.Parse(args)
+
+	cfg, err := crawler.LoadMultiConfig(*config)
+	if err != nil {
+		log.Fatalf("Failed to load config (%s): %s\n", *config, err)
+	}
+
+	start := time.Now()
+	crawlers, results, errs := crawler.CrawlSites(context.Background(), cfg)
+
+	summaries := make([]crawler.RunSummary, len(cfg.Sites))
+	for i, site := range cfg.Sites {
+		summaries[i] = crawler.RunSummary{Site: site.URL}
+		if results[i] == nil {
+			continue
+		}
+		summaries[i] = crawlers[i].Summary(start, results[i])
+
+		mode := site.PrintMode
+		if len(mode) == 0 {
+			mode = "mode1"
+		}
+		out, err := crawler.OpenOutput(crawler.SiteOutput(*outDir, site), false)
+		if err == nil {
+			err = crawlers[i].WritePrintMode(out, mode)
+		}
+		if err == nil {
+			err = out.Commit()
+		} else if out != nil {
+			out.Abort()
+		}
+		if err != nil {
+			log.Printf("Failed to write output of (%s): %s\n", site.URL, err)
+		}
+	}
+	if err := crawler.WriteMultiSummary(os.Stdout, summaries, errs); err != nil {
+		log.Fatalf("Failed to write summary: %s\n", err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	crawler "github.com/skfarhat/go-web-crawler"
+)
+
+// Entry point of the query subcommand, prints the pages of a crawl saved with -stream matching a query
+func queryMain(args []string) {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	stream := flags.String("stream", "crawl.ndjson", "NDJSON stream of the crawl to query, as written with -stream.")
+	fields := flags.String("fields", "url", "Comma separated fields printed for each page matching, e.g. url,referrer.")
+	asJSON := flags.Bool("json", false, "Print the pages matching as NDJSON instead of -fields.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: query [flags] 'category = \"not found\" and path ^= /docs and referrer ~ /blog'\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	q, err := crawler.ParseQuery(flags.Arg(0))
+	if err != nil {
+		log.Fatalf("%s\n", err)
+	}
+	pages, err := crawler.LoadStream(*stream)
+	if err != nil {
+		log.Fatalf("Failed to load crawl (%s): %s\n", *stream, err)
+	}
+	if _, err := crawler.WriteQueryResults(os.Stdout, pages, q, *fields, *asJSON); err != nil {
+		log.Fatalf("Failed to write results: %s\n", err)
+	}
+}
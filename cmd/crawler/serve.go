@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	crawler "github.com/skfarhat/go-web-crawler"
+)
+
+// Entry point of the serve subcommand, runs crawl jobs submitted over HTTP until killed
+func serveMain(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8081", "Address to serve the API on.")
+	jobs := flags.Int("jobs", 2, "Maximum number of crawls running at the same time.")
+	retention := flags.Duration("retention", 24*time.Hour, "Time finished jobs are kept for (0 to keep them forever).")
+	maxPages := flags.Int("maxpages", 10000, "Maximum number of pages fetched by a job (0 for no limit).")
+	maxBytes := flags.Int64("maxbytes", 1<<30, "Maximum number of bytes fetched by a job (0 for no limit).")
+	maxDuration := flags.Duration("maxduration", time.Hour, "Maximum time taken by a job (0 for no limit).")
+	maxMemory := flags.Uint64("maxmemory", 0, "Heap size in MB of the server above which running jobs are stopped (0 for no limit).")
+	audit := flags.String("audit", "", "File every job submitted, started, cancelled and finished is appended to as JSON lines.")
+	verify := flags.String("verify", "", "Secret ownership tokens are derived from. When set, only domains proven to be owned by whoever submits the crawl are crawled.")
+	keys := flags.String("keys", "", "JSON file of the API keys allowed to use the API, required unless serving on localhost.")
+	window := flags.String("window", "", "Time of day jobs fetch pages, e.g. 01:00-05:00, they pause outside of it and the pause counts towards -maxduration (empty for any time).")
+	windowZone := flags.String("windowtz", "UTC", "Time zone of -window, e.g. Europe/London.")
+	flags.Parse(args)
+
+	var apiKeys []crawler.APIKey
+	if len(*keys) > 0 {
+		var err error
+		if apiKeys, err = crawler.LoadAPIKeys(*keys); err != nil {
+			log.Fatalf("Failed to load API keys (%s): %s\n", *keys, err)
+		}
+	} else if !crawler.IsLoopbackAddr(*addr) {
+		log.Fatalf("Refusing to serve on (%s) without API keys, see -keys.\n", *addr)
+	}
+
+	q := crawler.NewJobQueue(*jobs, *retention)
+	q.Quota = crawler.Quota{Pages: *maxPages, Bytes: *maxBytes, Duration: *maxDuration, Memory: *maxMemory << 20}
+	if len(*audit) > 0 {
+		var err error
+		if q.Audit, err = crawler.OpenAuditLog(*audit); err != nil {
+			log.Fatalf("Failed to open audit log (%s): %s\n", *audit, err)
+		}
+	}
+	if len(*verify) > 0 {
+		q.Verifier = crawler.NewDomainVerifier(*verify)
+	}
+	if len(*window) > 0 {
+		w, err := crawler.ParseCrawlWindow(*window, *windowZone)
+		if err != nil {
+			log.Fatalf("Invalid -window: %s\n", err)
+		}
+		q.Options = append(q.Options, crawler.WithWindow(w))
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/jobs", q)
+	mux.Handle("/jobs/", q)
+	mux.Handle("/audit", q)
+	mux.Handle("/verify", q)
+	var handler http.Handler = mux
+	if len(*keys) > 0 {
+		handler = crawler.NewAuthenticator(apiKeys, mux)
+	}
+	log.Printf("Serving the crawl API on http://%s\n", *addr)
+	log.Fatal(http.ListenAndServe(*addr, handler))
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	crawler "github.com/skfarhat/go-web-crawler"
+)
+
+// Entry point of the testsite subcommand, serves a SyntheticSite until killed
+func testsiteMain(args []string) {
+	flags := flag.NewFlagSet("testsite", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8080", "Address to serve the site on.")
+	depth := flags.Int("depth", 3, "Number of levels below the home page.")
+	branching := flags.Int("branching", 5, "Number of links from each page to pages one level down.")
+	latency := flags.Duration("latency", 0, "Time taken to respond to each request.")
+	errorRate := flags.Float64("errors", 0, "Fraction of pages responding with 500 (e.g. 0.05).")
+	flags.Parse(args)
+
+	site := &crawler.SyntheticSite{Depth: *depth, Branching: *branching, Latency: *latency, ErrorRate: *errorRate}
+	log.Printf("Serving a site of %d pages on http://%s\n", site.Pages(), *addr)
+	log.Fatal(http.ListenAndServe(*addr, site))
+}
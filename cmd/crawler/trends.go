@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	crawler "github.com/skfarhat/go-web-crawler"
+)
+
+// Entry point of the trends subcommand, prints the history of a site
+func trendsMain(args []string) {
+	flags := flag.NewFlagSet("trends", flag.ExitOnError)
+	dir := flags.String("history", "history", "Directory the history of crawls is kept in.")
+	site := flags.String("site", "https://monzo.com", "Site to print the trends of.")
+	flags.Parse(args)
+
+	runs, err := crawler.LoadHistory(*dir, *site)
+	if err != nil {
+		log.Fatalf("Failed to load history of (%s): %s\n", *site, err)
+	}
+	if len(runs) == 0 {
+		log.Fatalf("No crawl of (%s) recorded in (%s).\n", *site, *dir)
+	}
+	if err := crawler.WriteTrends(os.Stdout, runs); err != nil {
+		log.Fatalf("Failed to write trends: %s\n", err)
+	}
+}
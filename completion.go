@@ -0,0 +1,66 @@
+package crawler
+
+import (
+	"sync"
+)
+
+// --------------------
+// Completion
+// --------------------
+
+// Number of sites scheduled and background tasks started that are not done yet.
+// A crawl is complete when it drops to zero, which only happens once nothing is left to do if:
+//   - work is added before it is published, e.g. a site before it is sent on 'urls'
+//   - work adds what it finds before it is done, e.g. a page schedules its children first
+//
+// The zero value is ready to use.
+type pendingWork struct {
+	mu sync.Mutex
+	n  int64
+
+	// Closed when n drops to zero, nil until someone waits
+	idle chan struct{}
+}
+
+// Adds a unit of work, it must be matched by a call to Done
+func (p *pendingWork) Add() {
+	p.mu.Lock()
+	p.n++
+	p.mu.Unlock()
+}
+
+// Marks a unit of work as done
+func (p *pendingWork) Done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.n--
+	if p.n < 0 {
+		panic("pendingWork: Done called more times than Add")
+	}
+	if p.n == 0 && p.idle != nil {
+		close(p.idle)
+		p.idle = nil
+	}
+}
+
+// Returns the number of units of work not done yet
+func (p *pendingWork) Count() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.n
+}
+
+// Blocks until there is no work left
+func (p *pendingWork) Wait() {
+	p.mu.Lock()
+	if p.n == 0 {
+		p.mu.Unlock()
+		return
+	}
+	if p.idle == nil {
+		p.idle = make(chan struct{})
+	}
+	idle := p.idle
+	p.mu.Unlock()
+	<-idle
+}
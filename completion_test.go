@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPendingWork(t *testing.T) {
+	var p pendingWork
+	p.Wait()
+
+	// Work adding work before it is done keeps Wait blocked until the last of it
+	const workers, depth = 50, 20
+	var wg sync.WaitGroup
+	var work func(level int)
+	work = func(level int) {
+		defer p.Done()
+		if level < depth {
+			p.Add()
+			go work(level + 1)
+		}
+	}
+	for i := 0; i < workers; i++ {
+		p.Add()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work(0)
+		}()
+	}
+	p.Wait()
+	if n := p.Count(); n != 0 {
+		t.Errorf("Expecting no work left once Wait returns, got (%d)", n)
+	}
+	wg.Wait()
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expecting Done without Add to panic")
+		}
+	}()
+	p.Done()
+}
+
+// Run only returns once every page was crawled, however the goroutines are scheduled
+func TestRun_completesDeterministically(t *testing.T) {
+	site := &SyntheticSite{Depth: 3, Branching: 5}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	for run := 0; run < 10; run++ {
+		var c Crawler
+		c.Init(ts.URL)
+		c.probeNotFound = false
+		c.throttle.windowSize = 0
+		res, err := c.Run(context.Background())
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		if len(res.Pages) != site.Pages() {
+			t.Fatalf("Expecting (%d) pages once Run returns, got (%d) on run (%d)", site.Pages(), len(res.Pages), run)
+		}
+		if n := c.pending.Count(); n != 0 {
+			t.Errorf("Expecting no work left once Run returns, got (%d)", n)
+		}
+
+		// Nothing is crawled after the crawl is complete
+		time.Sleep(10 * time.Millisecond)
+		if n := len(c.Result().Pages); n != len(res.Pages) {
+			t.Errorf("Expecting no page to be crawled after Run returned, got (%d) more", n-len(res.Pages))
+		}
+	}
+}
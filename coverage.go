@@ -0,0 +1,116 @@
+package crawler
+
+import (
+	"math"
+	"sync"
+)
+
+// --------------------
+// Crawl coverage
+// --------------------
+
+// Pages that must be crawled before the size of the site is estimated from the discovery curve
+const MIN_COVERAGE_PAGES int = 20
+
+// Number of distinct URLs found after each page crawled, see EstimateSiteSize
+type discoveryCurve struct {
+	mu    sync.Mutex
+	found int
+	curve []int
+}
+
+// Records a URL found for the first time
+func (d *discoveryCurve) discover() {
+	d.mu.Lock()
+	d.found++
+	d.mu.Unlock()
+}
+
+// Records a page crawled, with the URLs found so far
+func (d *discoveryCurve) crawled() {
+	d.mu.Lock()
+	d.curve = append(d.curve, d.found)
+	d.mu.Unlock()
+}
+
+func (d *discoveryCurve) points() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]int(nil), d.curve...)
+}
+
+// Returns the number of URLs the site likely has from the given discovery curve, the number
+// of distinct URLs found after each page crawled, and false if it cannot tell.
+//
+// New URLs get rarer as the crawl goes, the curve is taken to saturate as D(n) = T(1 - e^-an).
+// Then D(n) / D(n/2) = 1 + e^-an/2, which gives T from the last point and the one halfway.
+// When URLs are found as fast in the second half as in the first, the site is still growing
+// and its size is unknown.
+func EstimateSiteSize(curve []int) (float64, bool) {
+	n := len(curve)
+	if n < MIN_COVERAGE_PAGES {
+		return 0, false
+	}
+	last, half := float64(curve[n-1]), float64(curve[n/2-1])
+	if half <= 0 {
+		return 0, false
+	}
+	y := last/half - 1
+	if y >= 1 {
+		return 0, false
+	}
+	if y <= 0 {
+		return last, true
+	}
+	return last / (1 - y*y), true
+}
+
+// How much of the site a crawl likely covered
+type Coverage struct {
+	// Pages crawled, and distinct URLs found
+	Crawled    int `json:"crawled"`
+	Discovered int `json:"discovered"`
+
+	// Whether pages were left out as a limit of the crawl was reached, or it was cancelled
+	Truncated bool `json:"truncated"`
+
+	// Estimated number of URLs of the site, zero when it could not be estimated
+	Estimated float64 `json:"estimated"`
+}
+
+// Returns the fraction of the estimated URLs of the site that were crawled, one for a
+// complete crawl and zero when the size of the site could not be estimated
+func (cv Coverage) Rate() float64 {
+	if !cv.Truncated {
+		return 1
+	}
+	if cv.Estimated <= 0 {
+		return 0
+	}
+	if rate := float64(cv.Crawled) / cv.Estimated; rate < 1 {
+		return rate
+	}
+	return 1
+}
+
+// Returns the coverage of the crawl so far
+func (c *Crawler) Coverage() Coverage {
+	curve := c.discoveries.points()
+	cv := Coverage{Crawled: len(curve)}
+	if len(curve) > 0 {
+		cv.Discovered = curve[len(curve)-1]
+	}
+	for _, p := range c.uncrawledPages() {
+		if p.Reason == SKIP_BUDGET {
+			cv.Truncated = true
+			break
+		}
+	}
+	if cv.Truncated {
+		// The site has at least the URLs found already
+		if estimated, ok := EstimateSiteSize(curve); ok {
+			cv.Estimated = math.Max(estimated, float64(cv.Discovered))
+		}
+	}
+	return cv
+}
@@ -0,0 +1,79 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEstimateSiteSize(t *testing.T) {
+	// A site of 200 URLs, new ones getting rarer as the crawl goes
+	var saturating []int
+	for n := 1; n <= 40; n++ {
+		saturating = append(saturating, int(math.Round(200*(1-math.Exp(-0.05*float64(n))))))
+	}
+	if got, ok := EstimateSiteSize(saturating); !ok || math.Abs(got-200) > 10 {
+		t.Errorf("Expecting (200) URLs estimated, got (%.0f, %v)", got, ok)
+	}
+
+	// As many URLs found in the second half as in the first
+	var growing []int
+	for n := 1; n <= 40; n++ {
+		growing = append(growing, 10*n)
+	}
+	if got, ok := EstimateSiteSize(growing); ok {
+		t.Errorf("Expecting no estimate of a growing site, got (%.0f)", got)
+	}
+
+	if got, ok := EstimateSiteSize(saturating[:MIN_COVERAGE_PAGES-1]); ok {
+		t.Errorf("Expecting no estimate from too few pages, got (%.0f)", got)
+	}
+}
+
+// A crawl stopped by its quota covers part of the site, at least all the URLs found
+func TestCrawlCoverage(t *testing.T) {
+	site := &SyntheticSite{Depth: 3, Branching: 5, Latency: 10 * time.Millisecond}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.quota = Quota{Pages: 10}
+	c.Run(context.Background())
+
+	cv := c.Coverage()
+	if !cv.Truncated || cv.Crawled >= cv.Discovered {
+		t.Errorf("Expecting a truncated crawl, got (%+v)", cv)
+	}
+	if cv.Estimated > 0 && cv.Estimated < float64(cv.Discovered) || cv.Rate() >= 1 {
+		t.Errorf("Expecting more URLs estimated than found, if any, got (%+v)", cv)
+	}
+	var report bytes.Buffer
+	c.WriteReport(&report)
+	if want := fmt.Sprintf("  %d pages crawled", cv.Crawled); !strings.Contains(report.String(), want) {
+		t.Errorf("Expecting (%s) in the report, got (%s)", want, report.String())
+	}
+}
+
+func TestCrawlCoverageComplete(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><a href="/about">About</a></html>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.Run(context.Background())
+
+	if cv := c.Coverage(); cv.Truncated || cv.Rate() != 1 {
+		t.Errorf("Expecting a complete crawl, got (%+v)", cv)
+	}
+}
@@ -1,17 +1,27 @@
-package main
+package crawler
 
 import (
-	"flag"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"github.com/pkg/profile"
 	"github.com/valyala/fasthttp"
+	htmlutil "html"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"os"
 	"regexp"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,8 +29,23 @@ import (
 // Globals
 // ---------------------
 
-var verbose *bool
-var fast *bool
+// Regexes used for link handling, compiled once
+// Absolute links depend on the domain and are matched with a LinkMatcher instead
+var relativeLinkRe = regexp.MustCompile("href=\"(/[-\\w\\d_/\\.%~#!]+)\"")
+var dotRelativeLinkRe = regexp.MustCompile("href=\"(\\.\\.?/[^\"\\s]*)\"")
+var frameSourceRe = regexp.MustCompile("<iframe[^>]*\\ssrc=\"([^\"]+)\"")
+var frameSrcdocRe = regexp.MustCompile("<iframe[^>]*\\ssrcdoc=\"([^\"]*)\"")
+var metaTagRe = regexp.MustCompile("(?i)<meta[^>]*>")
+var metaRefreshRe = regexp.MustCompile("(?i)http-equiv\\s*=\\s*[\"']?refresh")
+var metaRefreshURLRe = regexp.MustCompile("(?i)content\\s*=\\s*[\"']\\s*\\d*\\s*[;,]\\s*url\\s*=\\s*['\"]?([^\"'>\\s]+)")
+
+// Matches absolute links to any domain
+var anyDomainLinks = NewLinkMatcher(nil)
+
+// Buffers response bodies are read into, reused across fetches to cut allocations
+var bodyPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
 
 // ---------------------
 // Error implementations
@@ -29,17 +54,58 @@ var fast *bool
 type Http404Error string
 type InvalidHTMLContent string
 type InvalidURL string
+type FetchTimeout string
+type HttpServerError string
+type QuotaExceeded string
+type OffScopeRedirect string
 
 func (e Http404Error) Error() string {
-	return fmt.Sprintf("Failed to find for URL (%s).", e)
+	return fmt.Sprintf("Failed to find for URL (%s).", string(e))
 }
 
 func (e InvalidHTMLContent) Error() string {
-	return fmt.Sprintf("Could not parse HTML content for URL (%s).", e)
+	return fmt.Sprintf("Could not parse HTML content for URL (%s).", string(e))
 }
 
 func (e InvalidURL) Error() string {
-	return fmt.Sprintf("Failed to parse URL (%s)", e)
+	return fmt.Sprintf("Failed to parse URL (%s)", string(e))
+}
+
+func (e FetchTimeout) Error() string {
+	return fmt.Sprintf("Timed out fetching URL (%s).", string(e))
+}
+
+func (e HttpServerError) Error() string {
+	return fmt.Sprintf("Server error for URL (%s).", string(e))
+}
+
+func (e QuotaExceeded) Error() string {
+	return fmt.Sprintf("Quota of %s exceeded.", string(e))
+}
+
+func (e OffScopeRedirect) Error() string {
+	return fmt.Sprintf("Refused to follow redirect outside of the crawl to (%s).", string(e))
+}
+
+// Returns the category under which the given error is grouped in the report
+func errorCategory(err error) string {
+	switch err.(type) {
+	case FetchTimeout:
+		return "timeout"
+	case HttpServerError, ServiceUnavailable:
+		return "server error"
+	case Http404Error:
+		return "not found"
+	case InvalidHTMLContent:
+		return "invalid content"
+	case InvalidURL:
+		return "invalid url"
+	case QuotaExceeded:
+		return "quota exceeded"
+	case OffScopeRedirect:
+		return "off-scope redirect"
+	}
+	return "other"
 }
 
 // --------------------
@@ -50,11 +116,55 @@ func (e InvalidURL) Error() string {
 type CrawlStat struct {
 	getTime   time.Duration
 	totalTime time.Duration
+
+	// When the URL was fetched
+	fetchedAt time.Time
+
+	// Time the URL waited in the frontier once found, then behind the throttle and for a
+	// free fetch slot. High values mean the crawler, not the site, is slowing the crawl down.
+	queueTime    time.Duration
+	throttleTime time.Duration
+	slotTime     time.Duration
+
+	// Phases of the request, when 'traceTimings' is set
+	timing FetchTiming
+
+	// Metrics of the Server-Timing headers of the response
+	serverTiming []ServerTiming
 }
 
 // Used for 'urls' buffered channel
 const MAX_CHAN_URLS int = 100
 
+// Capacity above which a body buffer is not put back in bodyPool
+const MAX_POOLED_BODY_SIZE int = 4 << 20
+
+// Redirects followed when fetching a URL, as many as net/http follows
+const MAX_REDIRECTS int = 10
+
+// Size in bytes above which text responses should be compressed
+const MIN_COMPRESS_SIZE int = 1024
+
+// Response headers kept for each URL unless told otherwise
+var DEFAULT_CAPTURE_HEADERS = []string{"Cache-Control", "Expires", "Date", "Age", "ETag", "Last-Modified", "Vary",
+	"Content-Type", "Content-Encoding", "Content-Length", "Server", "X-Cache", "CF-Ray", "CF-Cache-Status"}
+
+// Limits of a single crawl, enforced by Run. Zero values are unlimited.
+type Quota struct {
+
+	// Number of pages fetched
+	Pages int
+
+	// Size of the response bodies fetched, in bytes
+	Bytes int64
+
+	// Time taken by the crawl
+	Duration time.Duration
+
+	// Heap size of the whole process, in bytes. It is sampled, like the memory limit of the frontier.
+	Memory uint64
+}
+
 // Crawler has not been tested with successive crawls yet (TODO)
 // Safest is to create a new Crawler and operate with it
 type Crawler struct {
@@ -62,10 +172,18 @@ type Crawler struct {
 	// First site to crawl
 	baseSite string
 
+	// Scheme of 'baseSite' (http or https)
+	scheme string
+
 	// Domain name encompassing all crawls, this will extracted from 'baseSite' in New()
-	// and used for the regex FindAbsoluteLinks
 	domain string
 
+	// Matches 'domain' and its subdomains
+	scope *ScopeMatcher
+
+	// Matcher of absolute links local to 'domain', created in Init
+	localLinks *LinkMatcher
+
 	// urls channel used by all goroutines to add new URLs to parse
 	urls chan string
 
@@ -79,17 +197,408 @@ type Crawler struct {
 	// "parent" --> ["child1", "child2"]
 	sitemap sync.Map
 
-	// Used to wait for all goroutines to complete
-	wg sync.WaitGroup
+	// Sites and background tasks not done yet, the crawl is complete when there are none left
+	pending pendingWork
 
 	// Counts the number of websites that have been crawled
-	totalCrawls int
+	totalCrawls int64
 
 	// Slice initialised in New with the list of suffixes that the crawler should ignore
 	ignoreSuffixes []string
 
+	// When not nil, only sites matching 'include' and not matching 'exclude' are crawled
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+
+	// When not empty, only sites whose path starts with it are crawled, see seedPathPrefix
+	pathPrefix string
+
+	// What to do with links leaving 'pathPrefix', see ESCAPE_SKIP and others
+	prefixEscape string
+
+	// When not nil, sites that must never be requested
+	blocklist *Blocklist
+
+	// Words of URLs that are not followed as they likely change state, see isTrap
+	trapWords []string
+
+	// Session and tracking parameters removed from the links found, see stripParams
+	strippedParams []string
+
+	// Crawls only a sample of the URLs of search pages and parameterized endpoints
+	sampler endpointSampler
+
+	// Distinct URLs found after each page crawled, see Coverage
+	discoveries discoveryCurve
+
+	// Decide which of the sites found are crawled, in order, see Filter
+	filters []Filter
+
+	// Capture values from each page crawled, see AddExtractor
+	extractors []*Extractor
+
+	// When not empty, links are only followed inside the elements selected by 'followIn'.
+	// Links inside the elements selected by 'ignoreIn' are never followed, see linkHTML.
+	followIn []*Extractor
+	ignoreIn []*Extractor
+
+	// Values captured on each page crawled, by extractor name
+	// string --> map[string][]string
+	// "https://monzo.com/pricing" --> {"price": ["£5"]}
+	extracted sync.Map
+
 	// Stores statistics about each URL crawled
 	stats sync.Map
+
+	// When each site waiting to be crawled was scheduled, or spilled to disk
+	// string --> time.Time
+	queuedAt sync.Map
+
+	// When true, the number of times each child is linked from its parent is kept in 'linkCounts'
+	keepLinkCounts bool
+
+	// Occurrence count of each child link on a page, only populated when keepLinkCounts is set
+	// string --> map[string]int
+	// "parent" --> {"child1": 1, "child2": 4}
+	linkCounts sync.Map
+
+	// Links found on a page that point outside 'domain', these are recorded but never crawled
+	// string --> []string{}
+	// "parent" --> ["https://twitter.com/x", "https://facebook.com/y"]
+	externalLinks sync.Map
+
+	// External domains each page loads scripts and iframes from or links to, see outboundDomains
+	// string --> map[string][]string{}
+	// "parent" --> {"cdn.segment.com": ["script"], "twitter.com": ["link"]}
+	outbound sync.Map
+
+	// Analytics and tag managers loaded by each HTML page fetched, see DetectTags
+	// string --> []string{}
+	// "https://monzo.com" --> ["Google Tag Manager", "Segment"]
+	tags sync.Map
+
+	// When set, http:// and https:// variants of a URL are treated as the same page. Turned on
+	// once 'baseSite' redirects to its other scheme, see followSchemeRedirect
+	ignoreScheme atomic.Bool
+
+	// When true, http:// and https:// variants of a URL are different pages even when
+	// 'baseSite' redirects from one to the other
+	strictScheme bool
+
+	// When true, /dir and /dir/ are treated as the same page
+	ignoreTrailingSlash bool
+
+	// Directory index file names, /dir/index.html is treated as the same page as /dir/
+	indexFiles []string
+
+	// When true, /About and /about are treated as the same page (e.g. IIS hosted sites).
+	// The casing of the first URL seen is the one crawled and printed.
+	ignoreCase bool
+
+	// When true, URLs whose fragments are routes of a single page application (/#/products/1)
+	// are distinct pages, otherwise fragments are always stripped
+	keepRouteFragments bool
+
+	// Fetches the content of URLs, an HTTPFetcher using fetchTimeout when nil
+	fetcher Fetcher
+
+	// When true, the default HTTPFetcher uses fasthttp instead of net/http
+	fast bool
+
+	// When true, the time taken by each page is logged once the crawl is done
+	verbose bool
+
+	// Maximum time allowed to fetch a single page, zero means no limit
+	fetchTimeout time.Duration
+
+	// Number of pages crawled at the same time by a pool of workers taking sites from 'frontier',
+	// which holds up to 'maxGoroutines' sites. When zero each site is crawled by its own Crawl()
+	// goroutine, up to 'maxGoroutines'.
+	workers  int
+	frontier *frontierQueue
+
+	// Number of sites currently being crawled
+	inFlight int64
+
+	// Number of Crawl() goroutines started and not done, at most 'maxGoroutines' unless
+	// sites could not be spilled. Sites found beyond it are spilled until slots are freed.
+	// With workers, the high-water mark of the sites waiting in 'frontier' instead.
+	goroutines    int64
+	maxGoroutines int64
+
+	// Signalled when a Crawl() goroutine or a worker is done, so that spilled sites take its slot
+	slotFreed chan struct{}
+
+	// 1 while new sites are spilled because 'maxGoroutines' is reached
+	saturated int32
+
+	// When memory usage goes above the limit, new sites are spilled to disk until it goes back down
+	memory memoryGuard
+	spill  frontierSpill
+
+	// Slows requests down when the error rate spikes
+	throttle throttle
+
+	// Limits the number of requests sent at once at the start of the crawl
+	rampUp rampUp
+
+	// Pauses the crawl while the site is down for maintenance
+	maintenance maintenanceGuard
+
+	// When true, URLs of a host serving the same ETag and size as another are recorded as
+	// its aliases, asking with If-None-Match so that the server does not send the body again
+	etagAliases bool
+
+	// When true, the fingerprint of the content of each page is kept to compare crawls
+	fingerprintPages bool
+
+	// Fingerprint of each page crawled, see fingerprint
+	// string --> string
+	fingerprints sync.Map
+
+	// How the pages of each section changed since the previous crawl, see RecordContentChanges
+	contentChanges []SectionChange
+
+	// How often the content of each page changed over the crawls recorded, see RecordContentChanges
+	pageChanges map[string]PageChanges
+
+	// Strong ETags seen on each host, and the URL each alias serves the same resource as
+	// string --> *hostETags
+	// string --> string
+	etags   sync.Map
+	aliases sync.Map
+
+	// Time of day pages are fetched, at any time when nil
+	window *CrawlWindow
+
+	// Rate, concurrency and user agent of requests to each host, unlimited when nil
+	politeness *politeness
+
+	// Random delay added before each request, unless the politeness profile of its host has its own
+	jitter jitter
+
+	// Requests per second sent to each host and how many may be sent at once after a pause,
+	// unlimited when 'rate' is 0. Applies on top of the politeness profiles.
+	rate      float64
+	rateBurst int
+
+	// Token bucket of each host, see waitForRate
+	// string --> *tokenBucket
+	// "monzo.com" --> &tokenBucket{rate: 2, burst: 1, ...}
+	rateBuckets sync.Map
+
+	// Pages whose request already waited for 'rate' before taking a fetch slot, see reserveRate
+	// string --> bool
+	rateReserved sync.Map
+
+	// Health of each host crawled
+	// string --> *hostHealth
+	// "monzo.com" --> &hostHealth{requests: 10, errors: 1, ...}
+	hosts sync.Map
+
+	// Errors that occured while crawling URLs
+	// string --> error
+	// "site" --> FetchTimeout("site")
+	fetchErrors sync.Map
+
+	// When true, the target of a <meta http-equiv="refresh"> is crawled as a child of the page,
+	// otherwise it is only recorded in 'redirects'
+	followMetaRefresh bool
+
+	// URLs whose fetch ended up on a different URL after following redirects,
+	// or whose page redirects with a <meta http-equiv="refresh">
+	// string --> string
+	// "http://monzo.com/about" --> "https://monzo.com/about"
+	redirects sync.Map
+
+	// When true, www.<domain> and <domain> are the same site, links are followed to the one
+	// 'baseSite' redirects to, see canonicalHost
+	aliasWWW bool
+
+	// Host 'baseSite' redirected to when it is its www or apex variant, a string once set
+	redirectedHost atomic.Value
+
+	// Local links pointing at the variant of the site that is not 'canonicalHost'
+	// string --> []string{}
+	// "parent" --> ["https://www.monzo.com/child1"]
+	nonCanonicalLinks sync.Map
+
+	// Local links still pointing at http:// when 'baseSite' is served over https://
+	// string --> []string{}
+	// "parent" --> ["http://monzo.com/child1"]
+	insecureLinks sync.Map
+
+	// When true, the sitemaps declared in robots.txt or linked with <link rel="sitemap">
+	// are fetched and the pages they list crawled
+	ingestSitemaps bool
+
+	// When true, only URLs in scope are fetched: sitemaps on other sites are not ingested and
+	// redirects leaving the scope are not followed. Set by the server when domains are verified.
+	localOnly bool
+
+	// When true, the syntax of robots.txt and the sitemaps it declares are checked, see lintSite
+	lint bool
+
+	// Problems of each file linted
+	// string --> []LintProblem
+	// "https://monzo.com/sitemap.xml" --> [{Problem: "lists no URLs"}]
+	lintProblems sync.Map
+
+	// When true, /favicon.ico and the icons and web app manifests declared by pages are checked
+	checkIcons bool
+
+	// Outcome of checking each icon and manifest, see checkIcon
+	// string --> IconCheck
+	icons sync.Map
+
+	// When true, sitemap.xml has <priority> and <changefreq> estimated for each page
+	sitemapPriorities bool
+
+	// Sitemaps fetched, so that each is only ingested once
+	// string --> bool
+	sitemapsFetched sync.Map
+
+	// Pages listed in the sitemaps ingested, and the sitemap listing them
+	// string --> string
+	// "https://monzo.com/about" --> "https://monzo.com/sitemap.xml"
+	sitemapPages sync.Map
+
+	// Where robots.txt are fetched through, can be shared between crawlers
+	robotsCache *RobotsCache
+
+	// Rules of each robots.txt fetched
+	// string --> *RobotsRules
+	// "https://monzo.com/robots.txt" --> {Groups: [{Agents: ["*"], Disallow: ["/admin"]}]}
+	robots sync.Map
+
+	// Number of links followed from 'baseSite' at most, pages further away are recorded as
+	// children of the page linking to them but not fetched. No limit when 0.
+	maxDepth int
+
+	// When true, the paths robots.txt disallows are skipped and the Crawl-delay of 'baseSite'
+	// is applied, both for 'robotsAgent'
+	respectRobots bool
+	robotsAgent   string
+
+	// When true, a page that does not exist is requested before crawling to learn how the
+	// site responds to those, see notFoundProbe
+	probeNotFound bool
+	notFound      *notFoundProbe
+
+	// Pages fetched successfully that turned out to be the site's not found page
+	// string --> bool
+	softNotFound sync.Map
+
+	// Identifies the crawl, in results and in the CRAWL_ID_HEADER of requests when 'sendCrawlID' is set
+	runID       string
+	sendCrawlID bool
+
+	// Number of requests sent with an ID, and the ID of the last request sent for each URL
+	// string --> string
+	// "https://monzo.com/about" --> "3f2504e04f8911d3-2"
+	requestCount int64
+	requestIDs   sync.Map
+
+	// Number of bytes fetched from the start of resources skipped for their suffix to confirm
+	// their type and size, none are when zero. See probeResource.
+	probeBytes int64
+
+	// Type and size of each resource probed
+	// string --> *ResourceProbe
+	resources sync.Map
+
+	// When true, the DNS, connect, TLS, TTFB and body read times of each request are recorded
+	traceTimings bool
+
+	// Phases of the request of each URL fetched, until stored in its CrawlStat
+	// string --> FetchTiming
+	timings sync.Map
+
+	// Metrics of the Server-Timing headers of each URL fetched, until stored in its CrawlStat
+	// string --> []ServerTiming
+	serverTiming sync.Map
+
+	// Headers sent with every request, whose secrets are redacted from logs and exports, see Redactor
+	requestHeader http.Header
+
+	// Names of the response headers kept in 'headers'
+	captureHeaders []string
+
+	// Response headers of each URL fetched, only those in 'captureHeaders'
+	// string --> http.Header
+	// "https://monzo.com" --> {"Cache-Control": ["max-age=60"], "Server": ["cloudflare"]}
+	headers sync.Map
+
+	// URLs fetched whose Content-Type disagrees with their extension
+	// string --> TypeMismatch
+	typeMismatches sync.Map
+
+	// Charsets and doctype declared by each HTML page fetched
+	// string --> PageEncoding
+	encodings sync.Map
+
+	// Last-Modified of each URL fetched, when the server sent one
+	// string --> time.Time
+	lastModified sync.Map
+
+	// Size in bytes above which text responses served without Content-Encoding are reported
+	minCompressSize int
+
+	// Size of the text responses served without Content-Encoding
+	// string --> int
+	uncompressed sync.Map
+
+	// Time to live under which cached responses are reported as too short lived
+	minCacheTTL time.Duration
+
+	// Slots shared by crawlers running in the same process, one is held during each fetch.
+	// Unlimited when nil.
+	fetchSlots chan struct{}
+
+	// Receives each page as soon as it is crawled, when not nil
+	sink PageSink
+
+	// Page linking to each site scheduled and how many links away from 'baseSite' it was found
+	// string --> discovery
+	// "https://monzo.com/about/team" --> discovery{referrer: "https://monzo.com/about", depth: 2}
+	discovered sync.Map
+
+	// Documents embedded with iframes by the pages crawled, by visitKey, see findFrameLinks
+	// string --> *embeddedFrame
+	frames sync.Map
+
+	// Sites discovered but not fetched and why, see SKIP_BUDGET and others
+	// string --> string
+	// "https://monzo.com/app.pdf" --> "suffix"
+	notCrawled sync.Map
+
+	// Limits of the crawl, the crawl stops with QuotaExceeded once one is reached
+	quota       Quota
+	quotaMemory memoryGuard
+
+	// Number of pages and bytes fetched, counted against 'quota'
+	fetchedPages int64
+	fetchedBytes int64
+
+	// Context of the crawl started by Run, sites still queued once it is done are not fetched
+	ctx context.Context
+
+	// Cancels 'ctx' with the reason the crawl stopped early
+	stop context.CancelCauseFunc
+}
+
+// Returns a Crawler initialised to crawl baseSite, see Init, with the given options applied in order
+func New(baseSite string, options ...Option) (*Crawler, error) {
+	c := new(Crawler)
+	if err := c.Init(baseSite); err != nil {
+		return nil, err
+	}
+	for _, option := range options {
+		if err := option(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
 }
 
 // Initialise the Crawler
@@ -112,238 +621,2249 @@ func (c *Crawler) Init(baseSite string) error {
 
 	// Create buffered channel
 	c.urls = make(chan string, MAX_CHAN_URLS)
+	c.slotFreed = make(chan struct{}, 1)
+	c.runID = newRunID()
+	c.maxGoroutines = DEFAULT_MAX_GOROUTINES
+	c.workers = DEFAULT_WORKERS
 
-	// Extract the domain from the parsed URL
+	// Extract the scheme and domain from the parsed URL
+	c.scheme = u.Scheme
 	c.domain = u.Host
+	c.scope = NewScopeMatcher(stripDefaultPort(u.Scheme, u.Host), true)
+	c.aliasWWW, c.scope.aliasWWW = true, true
+	c.localLinks = &LinkMatcher{scope: c.scope}
+
+	// http://x and https://x are different pages until the site redirects from one to the other
+	c.ignoreScheme.Store(false)
+
+	// /dir, /dir/ and /dir/index.html are the same page unless told otherwise
+	c.ignoreTrailingSlash = true
+	c.indexFiles = []string{"index.html", "index.htm", "index.php"}
+
+	// Pages redirecting with <meta http-equiv="refresh"> are followed
+	c.followMetaRefresh = true
+
+	// Headers useful to audit caching and CDNs
+	c.captureHeaders = DEFAULT_CAPTURE_HEADERS
+
+	c.minCacheTTL = MIN_CACHE_TTL
+	c.rateBurst = DEFAULT_RATE_BURST
+	c.minCompressSize = MIN_COMPRESS_SIZE
+
+	// Learn how the site responds to missing pages to detect soft 404s
+	c.probeNotFound = true
+	c.robotsCache = NewRobotsCache("", DEFAULT_ROBOTS_TTL)
+	c.respectRobots = true
+	c.robotsAgent = DEFAULT_ROBOTS_AGENT
+
+	// A single slow page should not hold up the crawl
+	c.fetchTimeout = 15 * time.Second
+
+	// Back off when half of the last 20 requests failed
+	c.throttle = throttle{windowSize: 20, threshold: 0.5}
+	c.maintenance = maintenanceGuard{threshold: DEFAULT_MAINTENANCE_503S, backoff: DEFAULT_MAINTENANCE_BACKOFF}
 
 	// Initialise list of ignore suffixes
 	c.ignoreSuffixes = []string{"pdf", "png", "jpeg"}
+	c.trapWords = DEFAULT_TRAP_WORDS
+	c.strippedParams = DEFAULT_STRIPPED_PARAMS
+	c.sampler.size = DEFAULT_SAMPLE_SIZE
+	c.discoveries.found = 1 // The seed
+	c.prefixEscape = ESCAPE_SKIP
+	c.filters, _ = c.namedFilters(DEFAULT_FILTERS)
 
 	return nil
 }
 
-// Adds a new site to process
+// Returns the key under which the given URL is recorded in 'visited'.
+// URLs mapping to the same key are considered to be the same page and are only crawled once.
+func (c *Crawler) visitKey(site string) string {
+	u, err := url.Parse(site)
+	if err != nil {
+		return site
+	}
+	// https://monzo.com:443 is https://monzo.com
+	u.Host = stripDefaultPort(u.Scheme, u.Host)
+	if c.aliasWWW {
+		u.Host = stripWWW(strings.ToLower(u.Host))
+	}
+	if c.ignoreScheme.Load() {
+		u.Scheme = ""
+	}
+	if !c.keepRouteFragments || !isRouteFragment(u.Fragment) {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+
+	// Host names are never case sensitive, paths only are when ignoreCase is set
+	u.Host = strings.ToLower(u.Host)
+	if c.ignoreCase {
+		u.Path = strings.ToLower(u.Path)
+		u.RawPath = ""
+	}
+	for _, name := range c.indexFiles {
+		if strings.HasSuffix(u.Path, "/"+name) {
+			u.Path = strings.TrimSuffix(u.Path, name)
+			break
+		}
+	}
+	if c.ignoreTrailingSlash {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = ""
+	}
+	return u.String()
+}
+
+// Returns true if the given site was not visited yet, marking it visited.
+// Only one of the pages linking to a site at the same time gets to schedule it.
+func (c *Crawler) claim(site string) bool {
+	_, visited := c.visited.LoadOrStore(c.visitKey(site), true)
+	return !visited
+}
+
+// Adds a new site to process. It is counted as pending before being sent on 'urls'
+// so that the crawl cannot be seen complete while it is on its way.
 func (c *Crawler) addSite(site string) {
-	c.visited.Store(site, true)
+	c.visited.Store(c.visitKey(site), true)
+	c.queuedAt.LoadOrStore(site, time.Now())
+	c.pending.Add()
+	if c.frontier != nil {
+		c.frontier.push(site)
+		return
+	}
 	c.urls <- site
-	c.wg.Add(1)
 }
 
-// Begin processing sites
-func (c *Crawler) Start() {
-	c.addSite(c.baseSite)
+// Schedules a new site to be crawled by a worker, or by its own goroutine without workers.
+// When memory usage is above the limit, or 'maxGoroutines' sites are being crawled or wait
+// for a worker, the site is spilled to disk and scheduled later instead.
+func (c *Crawler) schedule(site string) {
+	if c.frontier != nil {
+		if (c.memory.exceeded() || c.frontierFull()) && c.spillSite(site) {
+			return
+		}
+		c.addSite(site)
+		return
+	}
+	if !c.memory.exceeded() && c.reserveGoroutine() {
+		c.addSite(site)
+		go c.Crawl()
+		return
+	}
+	if c.spillSite(site) {
+		return
+	}
+	// Crawled straight away rather than lost
+	atomic.AddInt64(&c.goroutines, 1)
+	c.addSite(site)
 	go c.Crawl()
 }
 
-// Checks if the provided URL ends with any of the suffixes defined in ignoreSuffixes.
-// Returns true if it does, otherwise false.
-func (c *Crawler) matchesIgnoreSuffix(url string) bool {
-	for _, ext := range c.ignoreSuffixes {
-		if strings.HasSuffix(url, ext) {
-			return true
+// Spills a new site to disk, it is scheduled again once memory usage is back under the limit.
+// Returns false if the site could not be spilled.
+func (c *Crawler) spillSite(site string) bool {
+	// Counted as pending straight away so that Wait() does not return before it is crawled
+	c.pending.Add()
+	c.queuedAt.Store(site, time.Now())
+	startDrain, err := c.spill.push(site)
+	if err != nil {
+		log.Printf("Failed to spill (%s) to disk: %s\n", site, err)
+		c.pending.Done()
+		return false
+	}
+	c.visited.Store(c.visitKey(site), true)
+	if startDrain {
+		go c.drainSpill()
+	}
+	return true
+}
+
+// Schedules spilled sites again, in batches, whenever memory usage is under the limit or nothing
+// else is being crawled, and as Crawl() goroutines free their slots. Returns once the spill is empty.
+func (c *Crawler) drainSpill() {
+	for {
+		select {
+		case <-time.After(SPILL_DRAIN_INTERVAL):
+		case <-c.slotFreed:
+		}
+		if c.memory.exceeded() && (atomic.LoadInt64(&c.goroutines) > 0 || atomic.LoadInt64(&c.inFlight) > 0) {
+			continue
+		}
+		if c.frontier != nil {
+			room := MAX_CHAN_URLS
+			if c.maxGoroutines > 0 {
+				room = min(room, int(c.maxGoroutines)-c.frontier.len())
+			}
+			if room <= 0 {
+				continue
+			}
+			sites, more, err := c.spill.pop(room)
+			if err != nil {
+				log.Printf("Failed to read spilled sites back: %s\n", err)
+			}
+			for _, site := range sites {
+				c.frontier.push(site)
+			}
+			if !more {
+				c.setSaturated(false)
+				return
+			}
+			continue
+		}
+		// Slots are taken before popping so that sites scheduled meanwhile cannot take them
+		var reserved int
+		for reserved < MAX_CHAN_URLS && c.reserveGoroutine() {
+			reserved++
+		}
+		if reserved == 0 {
+			continue
+		}
+		sites, more, err := c.spill.pop(reserved)
+		if err != nil {
+			log.Printf("Failed to read spilled sites back: %s\n", err)
+		}
+		for i := len(sites); i < reserved; i++ {
+			atomic.AddInt64(&c.goroutines, -1)
+		}
+		for _, site := range sites {
+			c.urls <- site
+			go c.Crawl()
+		}
+		if !more {
+			c.setSaturated(false)
+			return
 		}
 	}
-	return false
 }
 
-// Crawl site by visiting only local pages to the domain
-// Returns error if any occured, nil if none
-func (c *Crawler) Crawl() error {
-	start1 := time.Now()
+// Begin processing sites, until they are all done or Stop is called
+func (c *Crawler) Start() {
+	c.StartWithContext(context.Background())
+}
 
-	// Get URL to crawl from channel
-	defer c.wg.Done()
-	url := <-c.urls
+// Begin processing sites, until they are all done, ctx is done or Stop is called, whichever comes
+// first. Fetches in flight when the crawl stops are aborted and queued sites are dropped, Wait
+// returns once they are. Fetches of a custom fetcher, or with fasthttp, are completed instead.
+func (c *Crawler) StartWithContext(ctx context.Context) {
+	ctx, stop := context.WithCancelCause(ctx)
+	c.ctx, c.stop = ctx, stop
+	c.quotaMemory.limit = c.quota.Memory
+	c.start()
+}
 
-	// If URL matches any of the 'ignore' suffixes, return.
-	// We don't want to crawl it.
-	if c.matchesIgnoreSuffix(url) {
-		return nil
+// Stops the crawl, see StartWithContext. Does nothing if it was not started.
+func (c *Crawler) Stop() {
+	if c.stop != nil {
+		c.stop(nil)
 	}
+}
 
-	// Fetch URL contents
-	startHTTPGET := time.Now()
-	var bytes []byte
-	var err error
-	var elapsedHTTPGET time.Duration
-	if fast != nil && *fast {
-		// FastHTTP
-		startHTTPGET := time.Now()
-		req := fasthttp.AcquireRequest()
-		req.SetRequestURI(url)
-		resp := fasthttp.AcquireResponse()
-		client := &fasthttp.Client{}
-		err := client.Do(req, resp)
-		elapsedHTTPGET = time.Since(startHTTPGET)
-		if err != nil {
-			return Http404Error(url)
+func (c *Crawler) start() {
+	seedAllowed := true
+	if c.respectRobots {
+		if rules := c.robotsRulesOf(c.baseSite); rules != nil {
+			c.applyCrawlDelay(rules)
 		}
-		bytes = resp.Body()
-	} else {
-		resp, err := http.Get(url)
-		if err != nil || resp.StatusCode >= 300 {
-			// TODO LATER: add the url string to list of broken URLs
-			c.visited.Delete(url)
-			return Http404Error(url)
+		if seedAllowed = c.robotsAllow(c.baseSite); !seedAllowed {
+			log.Printf("robots.txt disallows (%s), not crawling it.\n", c.baseSite)
+			c.skip(c.baseSite, SKIP_ROBOTS, discovery{source: SOURCE_SEED})
 		}
-		elapsedHTTPGET = time.Since(startHTTPGET)
-		defer resp.Body.Close()
-		// Read HTML from Body
-		bytes, err = ioutil.ReadAll(resp.Body)
 	}
-
-	// Bytes to String
-	html := string(bytes)
-	if err != nil {
-		return InvalidHTMLContent(url)
+	if c.probeNotFound && seedAllowed {
+		c.notFound = c.probeNotFoundPage()
+	}
+	if c.workers > 0 {
+		c.frontier = newFrontierQueue()
+		if seedAllowed {
+			c.addSite(c.baseSite)
+		}
+	} else if seedAllowed {
+		atomic.AddInt64(&c.goroutines, 1)
+		c.addSite(c.baseSite)
+		go c.Crawl()
+	}
+	if c.ingestSitemaps {
+		c.pending.Add()
+		go c.ingestRobotsSitemaps()
+	}
+	if c.checkIcons {
+		c.checkIcon(c.origin()+"/favicon.ico", ICON_FAVICON, "")
+	}
+	if c.lint {
+		c.pending.Add()
+		go c.lintSite()
 	}
 
-	// Find relative links and convert them to absolute
-	children := FindRelativeLinks(html)
-	for i, x := range children {
-		children[i] = c.baseSite + x
+	// Started last, the crawl is complete for them once nothing is pending
+	if c.frontier != nil {
+		c.startWorkers()
 	}
+}
 
-	// Find absolute links
-	absoluteLinks := FindAbsoluteLinks(html, &c.domain)
+// Crawl the site and block until done or until ctx is done or Stop is called, whichever comes
+// first, see StartWithContext. The crawl also stops early when one of its quotas is exceeded.
+// Returns the pages crawled so far along with ctx's error if it was cancelled, QuotaExceeded
+// if a quota stopped it, or the error fetching 'baseSite' if not even that page could be crawled.
+func (c *Crawler) Run(ctx context.Context) (*CrawlResult, error) {
+	start := time.Now()
+	if c.quota.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, c.quota.Duration, QuotaExceeded("duration"))
+		defer cancel()
+	}
+	c.StartWithContext(ctx)
+	defer c.Stop()
+	c.Wait()
 
-	// Concatenate relative and absolute children together
-	children = append(children, absoluteLinks...)
+	res := c.Result()
+	res.Duration = time.Since(start)
+	if c.verbose {
+		c.logStats(res.Duration)
+	}
+	if err := context.Cause(c.ctx); err != nil {
+		return res, err
+	}
+	if len(res.Pages) == 0 {
+		if err, present := res.Errors[c.baseSite]; present {
+			return res, err
+		}
+	}
+	return res, nil
+}
 
-	// Store URL in sitemap along with its children
-	// Storing the children helps reconstruct the hierarchy if needed
-	c.sitemap.Store(url, children)
+// Logs the time each page took to crawl, then the number of pages crawled in elapsed
+func (c *Crawler) logStats(elapsed time.Duration) {
+	c.stats.Range(func(url, stats interface{}) bool {
+		stat := stats.(CrawlStat)
+		log.Printf("Crawl (%s)  took %s. GET(%s) queued(%s) throttled(%s) slot(%s)\n", url, stat.totalTime,
+			stat.getTime, stat.queueTime, stat.throttleTime, stat.slotTime)
+		return true
+	})
+	log.Printf("%d Crawls took %s\n", atomic.LoadInt64(&c.totalCrawls), elapsed)
+}
 
-	// Place child urls on the urls channel
-	for _, x := range children {
-		if _, present := c.visited.Load(x); !present {
-			c.addSite(x)
-			go c.Crawl()
-		}
+// Counts a page of the given size against the quota, stops the crawl once it is exceeded
+func (c *Crawler) countQuota(size int) {
+	pages := atomic.AddInt64(&c.fetchedPages, 1)
+	bytes := atomic.AddInt64(&c.fetchedBytes, int64(size))
+	if c.stop == nil {
+		return
+	}
+	switch {
+	case c.quota.Pages > 0 && pages >= int64(c.quota.Pages):
+		c.stop(QuotaExceeded("pages"))
+	case c.quota.Bytes > 0 && bytes >= c.quota.Bytes:
+		c.stop(QuotaExceeded("bytes"))
+	case c.quotaMemory.exceeded():
+		c.stop(QuotaExceeded("memory"))
 	}
+}
 
-	// Increment number of pages crawled
-	c.totalCrawls++
+// How a site was found
+const (
+	SOURCE_SEED     = "seed"     // 'baseSite', where the crawl started
+	SOURCE_ANCHOR   = "anchor"   // Linked from the referrer with <a href>
+	SOURCE_FRAME    = "iframe"   // Linked from a document the referrer embeds with <iframe>
+	SOURCE_REDIRECT = "redirect" // Target of the <meta http-equiv="refresh"> of the referrer
+	SOURCE_SITEMAP  = "sitemap"  // Listed in the referrer, a sitemap.xml
+)
 
-	// Compute total time taken and store stats
-	totalTime := time.Since(start1)
-	c.stats.Store(url, CrawlStat{totalTime: totalTime, getTime: elapsedHTTPGET})
+// Where a site was found
+type discovery struct {
 
-	// No error
-	return nil
+	// Page linking to the site, empty for 'baseSite'
+	referrer string
+
+	// Number of links followed from 'baseSite' to reach the site
+	depth int
+
+	// How the referrer pointed to the site, see SOURCE_ANCHOR and others
+	source string
 }
 
-// Wait for all goroutines to finish - blocking function
-func (c *Crawler) Wait() {
-	c.wg.Wait()
+// Returns where the given site was found, 'baseSite' is at depth 0
+func (c *Crawler) discoveryOf(site string) discovery {
+	if d, present := c.discovered.Load(site); present {
+		return d.(discovery)
+	}
+	return discovery{source: SOURCE_SEED}
 }
 
-// Print all crawled URLs and print them without any hierarchical relationship to their children
-func (c *Crawler) PrintSitemapFlattest() {
-	c.sitemap.Range(func(k, v interface{}) bool {
-		fmt.Println(k)
-		return true
-	})
+// Returns page with where it was found, so that exports answer why it was requested
+func (c *Crawler) withProvenance(page CrawlPage) CrawlPage {
+	d := c.discoveryOf(page.URL)
+	page.Referrer, page.Depth, page.Source = d.referrer, d.depth, d.source
+	page.RequestID = c.requestID(page.URL)
+	return page
 }
 
-// Print all sites that have been crawled along with their children.
-func (c *Crawler) PrintSitemapFlat() {
-	c.sitemap.Range(func(k, v interface{}) bool {
-		v1, ok := v.([]string)
-		if !ok {
-			return false
-		}
-		fmt.Printf("\n%s\n", k)
-		for _, child := range v1 {
-			fmt.Printf("  --> %s\n", child)
+// Reasons a site discovered was not fetched
+const (
+	SKIP_BUDGET    = "budget"    // A limit of the crawl was reached, or it was cancelled
+	SKIP_SUFFIX    = "suffix"    // The URL ends with one of 'ignoreSuffixes'
+	SKIP_SCOPE     = "scope"     // The site is outside the domain crawled
+	SKIP_DUPLICATE = "duplicate" // Another URL of a page already visited, see visitKey and redirects
+	SKIP_PATTERN   = "pattern"   // The URL does not match 'include' or matches 'exclude'
+	SKIP_BLOCKLIST = "blocklist" // The URL is on 'blocklist'
+	SKIP_TRAP      = "trap"      // The URL contains one of 'trapWords'
+	SKIP_PREFIX    = "prefix"    // The path of the URL does not start with 'pathPrefix'
+	SKIP_ALIAS     = "alias"     // The URL serves the same resource as another, by ETag, see etagAliases
+	SKIP_SAMPLED   = "sampled"   // Enough URLs of the same search page or endpoint were found, see endpointSampler
+	SKIP_ROBOTS    = "robots"    // robots.txt disallows the URL for 'robotsAgent'
+	SKIP_DEPTH     = "depth"     // The URL is more than 'maxDepth' links away from 'baseSite'
+)
+
+// Records that the given site found at d was not fetched for the given reason.
+// Only the first reason a site was skipped for is kept.
+func (c *Crawler) skip(site string, reason string, d discovery) {
+	if reason == SKIP_PREFIX && c.prefixEscape == ESCAPE_DROP {
+		return
+	}
+	c.discovered.LoadOrStore(site, d)
+	if _, present := c.notCrawled.LoadOrStore(site, reason); !present && c.sink != nil {
+		c.sink.WritePage(c.withProvenance(CrawlPage{URL: site, Skipped: reason}), nil)
+	}
+}
+
+// Checks if the provided URL ends with any of the suffixes defined in ignoreSuffixes.
+// Returns true if it does, otherwise false.
+func (c *Crawler) matchesIgnoreSuffix(url string) bool {
+	for _, ext := range c.ignoreSuffixes {
+		if strings.HasSuffix(url, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Crawl site by visiting only local pages to the domain
+// Returns error if any occured, nil if none
+func (c *Crawler) Crawl() error {
+	// Get URL to crawl from channel, it is done once its children are scheduled
+	defer c.pending.Done()
+	defer c.releaseGoroutine()
+	return c.crawl(<-c.urls)
+}
+
+// Crawls the given site, scheduling the local pages it links to before returning
+func (c *Crawler) crawl(url string) error {
+	start1 := time.Now()
+	atomic.AddInt64(&c.inFlight, 1)
+	defer atomic.AddInt64(&c.inFlight, -1)
+	var queueTime time.Duration
+	if at, present := c.queuedAt.LoadAndDelete(url); present {
+		queueTime = time.Since(at.(time.Time))
+	}
+
+	// Crawl was cancelled, drop the URL
+	if c.ctx != nil && c.ctx.Err() != nil {
+		c.visited.Delete(c.visitKey(url))
+		c.skip(url, SKIP_BUDGET, c.discoveryOf(url))
+		return c.ctx.Err()
+	}
+
+	// Outside of the crawl window, wait for it to reopen
+	if c.window != nil && !c.window.wait(c.ctx, c.checkpoint) {
+		c.visited.Delete(c.visitKey(url))
+		c.skip(url, SKIP_BUDGET, c.discoveryOf(url))
+		return c.ctx.Err()
+	}
+
+	// Fetch URL contents
+	body, elapsedHTTPGET, throttled, slotTime, err := c.fetchPolitely(url)
+
+	// Aborted as the crawl stopped, the page was not found broken
+	if err != nil && c.ctx != nil && c.ctx.Err() != nil {
+		c.visited.Delete(c.visitKey(url))
+		c.skip(url, SKIP_BUDGET, c.discoveryOf(url))
+		return c.ctx.Err()
+	}
+
+	// Another URL of the same resource, nothing new to crawl
+	if alias, ok := err.(ResourceAlias); ok {
+		c.recordHostHealth(url, elapsedHTTPGET, throttled, nil)
+		c.aliases.Store(url, alias.Of)
+		c.skip(url, SKIP_ALIAS, c.discoveryOf(url))
+		return nil
+	}
+	c.throttle.record(err)
+	c.recordHostHealth(url, elapsedHTTPGET, throttled, err)
+	if err != nil {
+		c.fetchErrors.Store(url, err)
+		c.visited.Delete(c.visitKey(url))
+		if c.sink != nil {
+			c.sink.WritePage(c.withProvenance(CrawlPage{URL: url}), err)
+		}
+		return err
+	}
+
+	// Links are extracted from the body as is, the buffer can be reused once we are done
+	html := body.Bytes()
+	defer releaseBody(body)
+	c.countQuota(len(html))
+	if c.fingerprintPages {
+		c.fingerprints.Store(url, fingerprint(html))
+	}
+
+	// Broken links of sites answering missing pages with a 200 look like any other page
+	final, _ := c.redirects.Load(url)
+	finalURL, _ := final.(string)
+	if c.notFound.matches(url, finalURL, html) {
+		c.softNotFound.Store(url, true)
+	}
+
+	// Custom values asked for by the user
+	if len(c.extractors) > 0 {
+		if extracted := c.extract(html); len(extracted) > 0 {
+			c.extracted.Store(url, extracted)
+		}
+	}
+
+	// Find links on the page, including those inside the documents it embeds with iframes
+	linkHTML := c.linkHTML(html)
+	children := c.findLocalLinks(linkHTML)
+	for _, link := range FindDotRelativeLinks(linkHTML) {
+		children = append(children, c.resolveLink(url, link))
+	}
+	anchors := len(children)
+	children = append(children, c.findFrameLinks(url, c.discoveryOf(url).depth+1, linkHTML)...)
+	frames := len(children)
+
+	// A page redirecting with <meta http-equiv="refresh"> has its target as child
+	if target := FindMetaRefresh(html); len(target) > 0 {
+		target = c.resolveLink(url, target)
+		c.redirects.Store(url, target)
+		if c.followMetaRefresh && c.isLocal(target) {
+			children = append(children, target)
+		}
+	}
+
+	// Sitemaps linked from the page
+	if c.ingestSitemaps {
+		for _, sitemap := range FindSitemapLinks(html) {
+			c.ingestSitemap(c.resolveLink(url, sitemap), 0)
+		}
+	}
+
+	// Icons and manifests declared by the page
+	if c.checkIcons {
+		c.checkPageIcons(url, html)
+	}
+
+	// Clean up hrefs as written in the HTML before comparing and fetching them
+	var nonCanonical []string
+	for i, x := range children {
+		children[i] = stripParams(normalizeLink(x, c.keepRouteFragments), c.strippedParams)
+		if canonical, rewritten := c.canonicalLink(children[i]); rewritten {
+			nonCanonical = append(nonCanonical, children[i])
+			children[i] = canonical
+		}
+	}
+	if len(nonCanonical) > 0 {
+		nonCanonical, _ = dedupLinks(nonCanonical)
+		c.nonCanonicalLinks.Store(url, nonCanonical)
+	}
+
+	// How each child was found, the first way it was
+	sources := make(map[string]string, len(children))
+	for i, x := range children {
+		if _, present := sources[x]; !present {
+			switch {
+			case i < anchors:
+				sources[x] = SOURCE_ANCHOR
+			case i < frames:
+				sources[x] = SOURCE_FRAME
+			default:
+				sources[x] = SOURCE_REDIRECT
+			}
+		}
+	}
+
+	// A page often links to the same child several times (header, footer..), keep it once
+	children, counts := dedupLinks(children)
+	if c.keepLinkCounts {
+		c.linkCounts.Store(url, counts)
+	}
+
+	// Keep track of outbound links, they are not crawled
+	depth := c.discoveryOf(url).depth + 1
+	if external, _ := dedupLinks(urlStrings(findExternalLinks(html, c.localLinks))); len(external) > 0 {
+		c.externalLinks.Store(url, external)
+		for _, x := range external {
+			c.skip(x, SKIP_SCOPE, discovery{referrer: url, depth: depth, source: SOURCE_ANCHOR})
+		}
+	}
+	if domains := c.outboundDomains(url, html); len(domains) > 0 {
+		c.outbound.Store(url, domains)
+	}
+
+	// Local links that downgrade an https site to http
+	if c.scheme == "https" {
+		if insecure := linksWithScheme(children, "http"); len(insecure) > 0 {
+			c.insecureLinks.Store(url, insecure)
+		}
+	}
+
+	// Store URL in sitemap along with its children
+	// Storing the children helps reconstruct the hierarchy if needed
+	c.sitemap.Store(url, children)
+
+	// Place child urls on the urls channel
+	var escaped []string
+	for _, x := range children {
+		found := discovery{referrer: url, depth: depth, source: sources[x]}
+		if _, present := c.visited.Load(c.visitKey(x)); !present {
+			if ok, reason := c.allowed(x, depth, url); !ok {
+				if reason == SKIP_PREFIX && c.prefixEscape == ESCAPE_EXTERNAL {
+					escaped = append(escaped, x)
+					continue
+				}
+				c.skip(x, reason, found)
+				if reason == SKIP_SUFFIX {
+					c.probeResource(x)
+				}
+				continue
+			}
+			if _, known := c.discovered.LoadOrStore(x, found); !known {
+				c.discoveries.discover()
+			}
+			// Another page linking to it may have claimed it since
+			if c.claim(x) {
+				c.schedule(x)
+			}
+		} else if _, known := c.discovered.Load(x); !known && x != c.baseSite {
+			// Never scheduled itself, so visited under another URL
+			c.skip(x, SKIP_DUPLICATE, found)
+		}
+	}
+
+	// Links leaving 'pathPrefix' are reported with the outbound links of the page
+	if len(escaped) > 0 {
+		external, _ := c.externalLinks.Load(url)
+		externalLinks, _ := external.([]string)
+		c.externalLinks.Store(url, append(externalLinks, escaped...))
+	}
+
+	// Increment number of pages crawled
+	atomic.AddInt64(&c.totalCrawls, 1)
+	c.discoveries.crawled()
+
+	// Compute total time taken and store stats
+	totalTime := time.Since(start1)
+	stat := CrawlStat{totalTime: totalTime, getTime: elapsedHTTPGET, fetchedAt: start1,
+		queueTime: queueTime, throttleTime: throttled, slotTime: slotTime}
+	if timing, present := c.timings.Load(url); present {
+		stat.timing = timing.(FetchTiming)
+		c.timings.Delete(url)
+	}
+	if metrics, present := c.serverTiming.Load(url); present {
+		stat.serverTiming = metrics.([]ServerTiming)
+		c.serverTiming.Delete(url)
+	}
+	c.stats.Store(url, stat)
+	if c.sink != nil {
+		external, _ := c.externalLinks.Load(url)
+		externalLinks, _ := external.([]string)
+		header, _ := c.headers.Load(url)
+		captured, _ := header.(http.Header)
+		values, _ := c.extracted.Load(url)
+		extracted, _ := values.(map[string][]string)
+		domains, _ := c.outbound.Load(url)
+		outbound, _ := domains.(map[string][]string)
+		c.sink.WritePage(c.withProvenance(CrawlPage{URL: url, Children: children, ExternalLinks: externalLinks,
+			OutboundDomains: outbound, Stat: stat, Header: captured, Extracted: extracted}), nil)
+	}
+
+	// No error
+	return nil
+}
+
+// Fetches url, slowing down first if the site is struggling or its profile says so.
+// Pages answered while the site is down for maintenance are fetched again once it is over.
+// Returns the body, the time taken by the fetch, the time spent throttled and waiting for a slot,
+// and the error of the fetch or ctx's error if the crawl stopped meanwhile.
+func (c *Crawler) fetchPolitely(url string) (body *bytes.Buffer, elapsed, throttled, slotTime time.Duration, err error) {
+	for {
+		pauseStart := time.Now()
+		if !c.maintenance.wait(c.ctx) {
+			return nil, 0, throttled, slotTime, c.ctx.Err()
+		}
+		throttled = time.Since(pauseStart) + c.throttle.wait()
+		throttled += c.reserveRate(url)
+		waited, ok := c.politeness.acquire(c.ctx, url, c.jitter)
+		if throttled += waited; !ok {
+			return nil, 0, throttled, slotTime, c.ctx.Err()
+		}
+		slotTime = c.rampUp.acquire(c.throttle.delayed)
+		if c.fetchSlots != nil {
+			slotStart := time.Now()
+			c.fetchSlots <- struct{}{}
+			slotTime += time.Since(slotStart)
+		}
+		body, elapsed, err = c.fetch(url)
+		if c.fetchSlots != nil {
+			<-c.fetchSlots
+		}
+		c.rampUp.release()
+		c.politeness.release(url)
+
+		if err != nil && c.ctx != nil && c.ctx.Err() != nil {
+			return body, elapsed, throttled, slotTime, c.ctx.Err()
+		}
+		if !c.maintenance.record(url, err, body) {
+			return body, elapsed, throttled, slotTime, err
+		}
+		if body != nil {
+			releaseBody(body)
+		}
+	}
+}
+
+// Fetch the contents of the given URL with the Crawler's fetcher
+// Returns the body, the time taken by HTTP.GET and error if any occured
+// The body comes from bodyPool and should be given back with releaseBody once done with.
+func (c *Crawler) fetch(url string) (*bytes.Buffer, time.Duration, error) {
+	var res *FetchResult
+	var err error
+	if c.etagAliases {
+		res, err = c.fetchOrAlias(url)
+	} else {
+		res, err = c.fetcherOrDefault().Fetch(url)
+	}
+	if err != nil {
+		var elapsedHTTPGET time.Duration
+		if res != nil {
+			elapsedHTTPGET = res.GetTime
+		}
+		return nil, elapsedHTTPGET, err
+	}
+
+	// Text responses are much smaller compressed, those served as is are worth reporting
+	if size := res.Body.Len(); size >= c.minCompressSize && res.Header != nil &&
+		len(res.Header.Get("Content-Encoding")) == 0 && isCompressible(res.Header.Get("Content-Type")) {
+		c.uncompressed.Store(url, size)
+	}
+
+	if !res.Timing.IsZero() {
+		c.timings.Store(url, res.Timing)
+	}
+	if metrics := ParseServerTiming(res.Header.Values("Server-Timing")); len(metrics) > 0 {
+		c.serverTiming.Store(url, metrics)
+	}
+
+	if t, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		c.lastModified.Store(url, t)
+	}
+	c.checkContentType(url, res.Header.Get("Content-Type"))
+	if isHTMLResponse(res.Header, res.Body.Bytes()) {
+		c.encodings.Store(url, pageEncoding(res.Header, res.Body.Bytes()))
+		c.tags.Store(url, DetectTags(res.Body.Bytes()))
+	}
+
+	// Keep the headers asked for, so that caching and CDNs can be audited without fetching again
+	if header := captureHeaders(res.Header, c.captureHeaders); len(header) > 0 {
+		c.headers.Store(url, header)
+	}
+
+	// Remember where we were redirected to (e.g. http -> https) so that the
+	// final URL is not crawled again when we find a link to it
+	if final := res.FinalURL; len(final) > 0 && final != url {
+		if url == c.baseSite {
+			c.followHostRedirect(final)
+			if c.followSchemeRedirect(final) {
+				// The key of the site changed with the scheme
+				c.visited.Store(c.visitKey(url), true)
+			}
+		}
+		c.redirects.Store(url, final)
+		c.visited.Store(c.visitKey(final), true)
+	}
+	return res.Body, res.GetTime, nil
+}
+
+// --------------------
+// Fetchers
+// --------------------
+
+// Result of a successful fetch
+type FetchResult struct {
+
+	// Content of the URL, from bodyPool
+	Body *bytes.Buffer
+
+	// URL the content was fetched from after following redirects, empty if unknown
+	FinalURL string
+
+	// Time taken by HTTP.GET
+	GetTime time.Duration
+
+	// Headers of the response as sent by the server, nil if unknown.
+	// The body is decompressed but Content-Encoding is kept.
+	Header http.Header
+
+	// Phases of the request, zero unless the fetcher traces requests
+	Timing FetchTiming
+}
+
+// Fetches the content of URLs for the Crawler
+// Implementations must be safe for concurrent use. A FetchResult may be returned along
+// with an error, in which case only its GetTime is used.
+type Fetcher interface {
+	Fetch(url string) (*FetchResult, error)
+}
+
+// Fetcher doing HTTP GET requests, used by the Crawler unless told otherwise
+type HTTPFetcher struct {
+
+	// Maximum time allowed to fetch a single URL, zero means no limit
+	Timeout time.Duration
+
+	// Use fasthttp instead of net/http
+	Fast bool
+
+	// Headers sent with every request, e.g. the cookie of a logged-in session
+	Header http.Header
+
+	// Time the phases of each request, see FetchTiming. Not supported with Fast.
+	Trace bool
+
+	// Requests in flight are aborted once it is done, never when nil. Not supported with Fast.
+	Context context.Context
+
+	// Redirects are only followed to the URLs it returns true for, all of them when nil
+	Redirect func(url string) bool
+}
+
+func (f *HTTPFetcher) Fetch(url string) (*FetchResult, error) {
+	return f.FetchWithHeader(url, nil)
+}
+
+// Fetches url sending the given headers along with those of the fetcher
+func (f *HTTPFetcher) FetchWithHeader(url string, extra http.Header) (*FetchResult, error) {
+	startHTTPGET := time.Now()
+	if f.Fast {
+		// FastHTTP
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		req.Header.SetMethod(fasthttp.MethodGet)
+		req.SetRequestURI(url)
+		req.Header.Set("Accept-Encoding", "gzip, br")
+		for _, header := range []http.Header{f.Header, extra} {
+			for name, values := range header {
+				for _, v := range values {
+					req.Header.Add(name, v)
+				}
+			}
+		}
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+		client := &fasthttp.Client{}
+		var err error
+
+		// fasthttp does not follow redirects along with a timeout, they are followed here
+		finalURL := url
+		for redirects := 0; ; redirects++ {
+			if f.Timeout > 0 {
+				err = client.DoTimeout(req, resp, f.Timeout)
+			} else {
+				err = client.Do(req, resp)
+			}
+			if err != nil || !fasthttp.StatusCodeIsRedirect(resp.StatusCode()) {
+				break
+			}
+			location := resp.Header.Peek("Location")
+			if len(location) == 0 || redirects >= MAX_REDIRECTS {
+				return &FetchResult{GetTime: time.Since(startHTTPGET)}, Http404Error(url)
+			}
+			req.URI().UpdateBytes(location)
+			finalURL = req.URI().String()
+			if f.Redirect != nil && !f.Redirect(finalURL) {
+				return &FetchResult{GetTime: time.Since(startHTTPGET)}, OffScopeRedirect(finalURL)
+			}
+		}
+		elapsedHTTPGET := time.Since(startHTTPGET)
+		if err == fasthttp.ErrTimeout {
+			return &FetchResult{GetTime: elapsedHTTPGET}, FetchTimeout(url)
+		} else if err != nil {
+			return &FetchResult{GetTime: elapsedHTTPGET}, Http404Error(url)
+		}
+		// The response is released on return, copy its body and headers out
+		content, err := resp.BodyUncompressed()
+		if err != nil {
+			return &FetchResult{GetTime: elapsedHTTPGET}, InvalidHTMLContent(url)
+		}
+		header := make(http.Header)
+		resp.Header.VisitAll(func(k, v []byte) {
+			header.Add(string(k), string(v))
+		})
+		if status := resp.StatusCode(); status == http.StatusServiceUnavailable {
+			if int64(len(content)) > MAX_MAINTENANCE_BODY {
+				content = content[:MAX_MAINTENANCE_BODY]
+			}
+			return nil, ServiceUnavailable{URL: url, RetryAfter: parseRetryAfter(header.Get("Retry-After")),
+				Body: append([]byte(nil), content...)}
+		} else if status >= 500 {
+			return nil, HttpServerError(url)
+		} else if status == http.StatusNotModified {
+			return &FetchResult{GetTime: elapsedHTTPGET, Header: header}, NotModified(url)
+		} else if status >= 300 {
+			return nil, Http404Error(url)
+		}
+		body := acquireBody()
+		body.Write(content)
+		return &FetchResult{Body: body, FinalURL: finalURL, GetTime: elapsedHTTPGET, Header: header}, nil
+	}
+
+	client := &http.Client{Timeout: f.Timeout, Transport: safeTransport{}}
+	if f.Redirect != nil {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if !f.Redirect(req.URL.String()) {
+				return OffScopeRedirect(req.URL.String())
+			}
+			if len(via) >= MAX_REDIRECTS {
+				return fmt.Errorf("stopped after %d redirects", MAX_REDIRECTS)
+			}
+			return nil
+		}
+	}
+	ctx := f.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, InvalidURL(url)
+	}
+	for _, header := range []http.Header{f.Header, extra} {
+		for name, values := range header {
+			req.Header[name] = values
+		}
+	}
+	var tracer *fetchTracer
+	if f.Trace {
+		tracer = newFetchTracer()
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), tracer.clientTrace()))
+	}
+	resp, err := client.Do(req)
+	var offScope OffScopeRedirect
+	if err != nil && ctx.Err() != nil {
+		return &FetchResult{GetTime: time.Since(startHTTPGET)}, ctx.Err()
+	} else if errors.As(err, &offScope) {
+		return &FetchResult{GetTime: time.Since(startHTTPGET)}, offScope
+	} else if e, ok := err.(net.Error); ok && e.Timeout() {
+		return &FetchResult{GetTime: time.Since(startHTTPGET)}, FetchTimeout(url)
+	} else if err != nil {
+		return nil, Http404Error(url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, MAX_MAINTENANCE_BODY))
+		return nil, ServiceUnavailable{URL: url, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")), Body: body}
+	} else if resp.StatusCode >= 500 {
+		return nil, HttpServerError(url)
+	} else if resp.StatusCode == http.StatusNotModified {
+		return &FetchResult{GetTime: time.Since(startHTTPGET), Header: resp.Header}, NotModified(url)
+	} else if resp.StatusCode >= 300 {
+		return nil, Http404Error(url)
+	}
+	elapsedHTTPGET := time.Since(startHTTPGET)
+
+	// Read HTML from Body
+	body := acquireBody()
+	_, err = body.ReadFrom(resp.Body)
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		releaseBody(body)
+		return &FetchResult{GetTime: elapsedHTTPGET}, FetchTimeout(url)
+	} else if err != nil {
+		releaseBody(body)
+		return &FetchResult{GetTime: elapsedHTTPGET}, InvalidHTMLContent(url)
+	}
+
+	// The transport asks for gzip and decompresses it transparently, removing Content-Encoding
+	if resp.Uncompressed {
+		resp.Header.Set("Content-Encoding", "gzip")
+	}
+	res := &FetchResult{Body: body, FinalURL: resp.Request.URL.String(), GetTime: elapsedHTTPGET, Header: resp.Header}
+	if tracer != nil {
+		res.Timing = tracer.done()
+	}
+	return res, nil
+}
+
+// Returns true if responses of the given Content-Type benefit from compression
+func isCompressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, t := range []string{"text/", "javascript", "json", "xml"} {
+		if strings.Contains(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the headers of the given response that are in the allowlist, see redactHeader
+func captureHeaders(header http.Header, allowlist []string) http.Header {
+	captured := make(http.Header)
+	for _, name := range allowlist {
+		if values := header.Values(name); len(values) > 0 {
+			captured[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	return redactHeader(captured)
+}
+
+// Returns the Crawler's fetcher, or an HTTPFetcher using fetchTimeout if it has none.
+// The fetcher sends the crawl IDs when 'sendCrawlID' is set and the user agent of the
+// politeness profile of each host, when it can send headers. Every request it sends
+// waits for 'rate', see rateFetcher.
+func (c *Crawler) fetcherOrDefault() Fetcher {
+	f := c.fetcher
+	if f == nil {
+		hf := &HTTPFetcher{Timeout: c.fetchTimeout, Fast: c.fast, Header: c.requestHeader, Trace: c.traceTimings,
+			Context: c.ctx}
+		if c.localOnly {
+			hf.Redirect = c.isLocal
+		}
+		f = hf
+	}
+	if hf, ok := f.(HeaderFetcher); ok && c.politeness != nil {
+		f = &politeFetcher{p: c.politeness, next: hf}
+	}
+	if hf, ok := f.(HeaderFetcher); ok && c.sendCrawlID {
+		f = &crawlIDFetcher{c: c, next: hf}
+	}
+	if c.rate > 0 {
+		if _, ok := f.(HeaderFetcher); ok {
+			return &rateHeaderFetcher{rateFetcher{c: c, next: f}}
+		}
+		return &rateFetcher{c: c, next: f}
+	}
+	return f
+}
+
+// Returns an empty buffer from bodyPool to read a response body into
+func acquireBody() *bytes.Buffer {
+	body := bodyPool.Get().(*bytes.Buffer)
+	body.Reset()
+	return body
+}
+
+// Gives a buffer obtained with acquireBody back to bodyPool.
+// Unusually large buffers are dropped so that the pool does not pin them in memory.
+func releaseBody(body *bytes.Buffer) {
+	if body.Cap() <= MAX_POOLED_BODY_SIZE {
+		bodyPool.Put(body)
+	}
+}
+
+// Find links local to the domain in the given html, relative links are converted to absolute
+func (c *Crawler) findLocalLinks(html []byte) []string {
+	var links []string
+	for _, u := range FindRelativeLinks(html) {
+		links = append(links, c.origin()+u.String())
+	}
+	for _, u := range c.localLinks.FindLinks(html) {
+		links = append(links, u.String())
+	}
+	return links
+}
+
+// Find local links inside the iframes embedded in the given html of page.
+// Inline documents (srcdoc) are parsed as they are, documents referenced by src, relative
+// to page or not, are fetched once however many pages embed them if they are local to the
+// domain and the filters allow them at depth, otherwise they are recorded as skipped.
+func (c *Crawler) findFrameLinks(page string, depth int, html []byte) []string {
+	var links []string
+	for _, doc := range FindFrameSrcdocs(html) {
+		links = append(links, c.findLocalLinks([]byte(doc))...)
+	}
+	for _, src := range FindFrameSources(html) {
+		if src = c.resolveLink(page, src); !c.isLocal(src) {
+			continue
+		}
+		src = normalizeLink(src, false)
+		if ok, reason := c.allowed(src, depth, page); !ok {
+			c.skip(src, reason, discovery{referrer: page, depth: depth, source: SOURCE_FRAME})
+			continue
+		}
+		f, _ := c.frames.LoadOrStore(c.visitKey(src), new(embeddedFrame))
+		frame := f.(*embeddedFrame)
+		frame.once.Do(func() { frame.links = c.fetchFrame(src, page, depth) })
+		links = append(links, frame.links...)
+	}
+	return links
+}
+
+// Document embedded with an iframe, fetched by the first page embedding it.
+// Pages embedding it at the same time wait for it to be fetched.
+type embeddedFrame struct {
+	once  sync.Once
+	links []string
+}
+
+// Returns the local links of the document at src embedded by page, fetched like pages are by
+// crawl and counted against the quota. Documents that fail to fetch are recorded in 'fetchErrors'.
+func (c *Crawler) fetchFrame(src string, page string, depth int) []string {
+	if c.window != nil && !c.window.wait(c.ctx, c.checkpoint) {
+		return nil
+	}
+	body, elapsed, throttled, _, err := c.fetchPolitely(src)
+	if err != nil && c.ctx != nil && c.ctx.Err() != nil {
+		return nil
+	}
+	if _, alias := err.(ResourceAlias); alias {
+		c.recordHostHealth(src, elapsed, throttled, nil)
+		return nil
+	}
+	c.throttle.record(err)
+	c.recordHostHealth(src, elapsed, throttled, err)
+	if err != nil {
+		c.discovered.LoadOrStore(src, discovery{referrer: page, depth: depth, source: SOURCE_FRAME})
+		c.fetchErrors.Store(src, err)
+		if c.sink != nil {
+			c.sink.WritePage(c.withProvenance(CrawlPage{URL: src}), err)
+		}
+		return nil
+	}
+	defer releaseBody(body)
+	c.countQuota(body.Len())
+	return c.findLocalLinks(body.Bytes())
+}
+
+// Resolves a link found on the given page to an absolute URL.
+// Links starting with '/' are relative to origin like those returned by FindRelativeLinks.
+func (c *Crawler) resolveLink(page string, link string) string {
+	if strings.HasPrefix(link, "/") && !strings.HasPrefix(link, "//") {
+		return c.origin() + link
+	}
+	base, err := url.Parse(page)
+	if err != nil {
+		return link
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// Returns true if the given absolute URL is on the crawled domain or one of its subdomains
+func (c *Crawler) isLocal(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && c.scope.Matches(u)
+}
+
+// Health of a single host, summarised in the report
+type hostHealth struct {
+	mu sync.Mutex
+
+	// Number of requests made to the host and how many of them failed
+	requests int
+	errors   int
+
+	// Total time spent in HTTP.GET and waiting on the throttle
+	latency   time.Duration
+	throttled time.Duration
+}
+
+// Records the outcome of a request to the host of the given site
+func (c *Crawler) recordHostHealth(site string, latency time.Duration, throttled time.Duration, err error) {
+	host := site
+	if u, e := url.Parse(site); e == nil {
+		host = u.Host
+	}
+	v, _ := c.hosts.LoadOrStore(host, &hostHealth{})
+	h := v.(*hostHealth)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests++
+	if err != nil {
+		h.errors++
+	}
+	h.latency += latency
+	h.throttled += throttled
+}
+
+// Wait for all sites scheduled and background tasks to be done - blocking function
+func (c *Crawler) Wait() {
+	c.pending.Wait()
+}
+
+// Page crawled, as found in CrawlResult
+type CrawlPage struct {
+	URL string
+
+	// Local links found on the page
+	Children []string
+
+	// Links found on the page pointing outside the crawled domain
+	ExternalLinks []string
+
+	// Domains outside the crawl the page loads scripts and iframes from or links to, and how
+	OutboundDomains map[string][]string
+
+	Stat CrawlStat
+
+	// Response headers captured, see Crawler.captureHeaders
+	Header http.Header
+
+	// Values captured by the extractors of the Crawler, by extractor name
+	Extracted map[string][]string
+
+	// Page the site was first found on, empty for the first site crawled
+	Referrer string
+
+	// Number of links followed from the first site crawled to reach it
+	Depth int
+
+	// How the referrer pointed to the site, see SOURCE_ANCHOR and others
+	Source string
+
+	// REQUEST_ID_HEADER sent when fetching the page, empty if none was
+	RequestID string
+
+	// Why the page could not be crawled, nil if it was.
+	// Only set by QueryPages, CrawlResult keeps failed pages in Errors.
+	Err error
+
+	// Why the page was not fetched, see SKIP_BUDGET and others. Only set for PageSink,
+	// CrawlResult keeps skipped pages in NotCrawled.
+	Skipped string
+}
+
+// Site discovered but never fetched, as found in CrawlResult
+type UncrawledPage struct {
+	URL string
+
+	// Page the site was found on
+	Referrer string
+
+	// Number of links followed from the first site crawled to reach it
+	Depth int
+
+	// How the referrer pointed to the site, see SOURCE_ANCHOR and others
+	Source string
+
+	// Why it was not fetched, see SKIP_BUDGET and others
+	Reason string
+}
+
+// Outcome of a crawl, as returned by Run
+type CrawlResult struct {
+
+	// Identifies the crawl, see Crawler.runID
+	RunID string
+
+	// Pages crawled, sorted by URL
+	Pages []CrawlPage
+
+	// Sites that could not be crawled and why
+	Errors map[string]error
+
+	// Sites redirecting elsewhere and their target
+	Redirects map[string]string
+
+	// Sites discovered but never fetched and why, sorted by URL
+	NotCrawled []UncrawledPage
+
+	// Rules of each robots.txt fetched
+	Robots map[string]*RobotsRules
+
+	// Resources skipped for their suffix whose first bytes were fetched, sorted by URL
+	Resources []ResourceProbe
+
+	// Time taken by the whole crawl
+	Duration time.Duration
+}
+
+// Returns the pages, errors and redirects recorded by the crawl so far
+func (c *Crawler) Result() *CrawlResult {
+	res := &CrawlResult{RunID: c.runID, Errors: make(map[string]error), Redirects: make(map[string]string),
+		Robots: make(map[string]*RobotsRules)}
+	c.sitemap.Range(func(k, v interface{}) bool {
+		page := CrawlPage{URL: k.(string), Children: v.([]string)}
+		if external, present := c.externalLinks.Load(k); present {
+			page.ExternalLinks = external.([]string)
+		}
+		if domains, present := c.outbound.Load(k); present {
+			page.OutboundDomains = domains.(map[string][]string)
+		}
+		if stat, present := c.stats.Load(k); present {
+			page.Stat = stat.(CrawlStat)
+		}
+		if header, present := c.headers.Load(k); present {
+			page.Header = header.(http.Header)
+		}
+		if extracted, present := c.extracted.Load(k); present {
+			page.Extracted = extracted.(map[string][]string)
+		}
+		res.Pages = append(res.Pages, c.withProvenance(page))
+		return true
+	})
+	sort.Slice(res.Pages, func(i, j int) bool { return res.Pages[i].URL < res.Pages[j].URL })
+	c.fetchErrors.Range(func(k, v interface{}) bool {
+		res.Errors[k.(string)] = v.(error)
+		return true
+	})
+	c.redirects.Range(func(k, v interface{}) bool {
+		res.Redirects[k.(string)] = v.(string)
+		return true
+	})
+	res.NotCrawled = c.uncrawledPages()
+	res.Resources = c.probedResources()
+	c.robots.Range(func(k, v interface{}) bool {
+		res.Robots[k.(string)] = v.(*RobotsRules)
+		return true
+	})
+	return res
+}
+
+// Returns the sites discovered but dropped without being fetched, sorted by URL
+func (c *Crawler) uncrawledPages() []UncrawledPage {
+	var pages []UncrawledPage
+	c.notCrawled.Range(func(k, v interface{}) bool {
+		// Dropped sites may have been scheduled again and crawled before the limit was hit
+		if _, crawled := c.sitemap.Load(k); !crawled {
+			d := c.discoveryOf(k.(string))
+			pages = append(pages, UncrawledPage{URL: k.(string), Referrer: d.referrer, Depth: d.depth, Source: d.source,
+				Reason: v.(string)})
+		}
+		return true
+	})
+	sort.Slice(pages, func(i, j int) bool { return pages[i].URL < pages[j].URL })
+	return pages
+}
+
+// Number of pages returned by QueryPages when no limit is given
+const DEFAULT_QUERY_LIMIT int = 1000
+
+// Selects the pages returned by QueryPages
+type PageQuery struct {
+
+	// Only pages whose URL starts with Prefix
+	Prefix string
+
+	// Only pages with this outcome, "ok" or an error category ("timeout", "not found"..), all when empty
+	Status string
+
+	// Only pages at least MinDepth and at most MaxDepth links away from 'baseSite'.
+	// No upper bound when MaxDepth is 0.
+	MinDepth int
+	MaxDepth int
+
+	// Only pages after this URL, as returned by the previous call. Empty for the first page of results
+	Cursor string
+
+	// Maximum number of pages returned, DEFAULT_QUERY_LIMIT when zero
+	Limit int
+}
+
+// Returns the pages crawled or failed matching q, sorted by URL, so that the results of
+// huge crawls can be consumed a bit at a time rather than all at once like Result does.
+// Also returns the cursor to pass in the next query, empty once there are no more pages.
+func (c *Crawler) QueryPages(q PageQuery) ([]CrawlPage, string) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DEFAULT_QUERY_LIMIT
+	}
+	matches := func(url string, err error) bool {
+		status := "ok"
+		if err != nil {
+			status = errorCategory(err)
+		}
+		if url <= q.Cursor || !strings.HasPrefix(url, q.Prefix) || (len(q.Status) > 0 && q.Status != status) {
+			return false
+		}
+		depth := c.discoveryOf(url).depth
+		return depth >= q.MinDepth && (q.MaxDepth <= 0 || depth <= q.MaxDepth)
+	}
+
+	// Only the URLs are gathered and sorted, the pages are built for those returned
+	var urls []string
+	c.sitemap.Range(func(k, v interface{}) bool {
+		if matches(k.(string), nil) {
+			urls = append(urls, k.(string))
+		}
+		return true
+	})
+	c.fetchErrors.Range(func(k, v interface{}) bool {
+		if matches(k.(string), v.(error)) {
+			urls = append(urls, k.(string))
+		}
+		return true
+	})
+	sort.Strings(urls)
+
+	// A page failing once may have been crawled when linked again later
+	urls, _ = dedupLinks(urls)
+
+	next := ""
+	if len(urls) > limit {
+		urls = urls[:limit]
+		next = urls[limit-1]
+	}
+	pages := make([]CrawlPage, 0, len(urls))
+	for _, url := range urls {
+		page := CrawlPage{URL: url}
+		if children, present := c.sitemap.Load(url); present {
+			page.Children = children.([]string)
+			if external, present := c.externalLinks.Load(url); present {
+				page.ExternalLinks = external.([]string)
+			}
+			if domains, present := c.outbound.Load(url); present {
+				page.OutboundDomains = domains.(map[string][]string)
+			}
+			if stat, present := c.stats.Load(url); present {
+				page.Stat = stat.(CrawlStat)
+			}
+			if header, present := c.headers.Load(url); present {
+				page.Header = header.(http.Header)
+			}
+		} else if err, present := c.fetchErrors.Load(url); present {
+			page.Err = err.(error)
+		}
+		pages = append(pages, c.withProvenance(page))
+	}
+	return pages, next
+}
+
+// Number of pages listed as stalest in the report
+const MAX_STALEST_PAGES int = 20
+
+// Returns at most n pages with a Last-Modified, the least recently modified first
+func (c *Crawler) stalestPages(n int) []string {
+	type modified struct {
+		url string
+		t   time.Time
+	}
+	var pages []modified
+	c.lastModified.Range(func(k, v interface{}) bool {
+		pages = append(pages, modified{k.(string), v.(time.Time)})
+		return true
+	})
+	sort.Slice(pages, func(i, j int) bool { return pages[i].t.Before(pages[j].t) })
+	var stalest []string
+	for i := 0; i < len(pages) && i < n; i++ {
+		stalest = append(stalest, pages[i].url)
+	}
+	return stalest
+}
+
+// Print all crawled URLs and print them without any hierarchical relationship to their children
+func (c *Crawler) PrintSitemapFlattest() {
+	c.WriteSitemapFlattest(os.Stdout)
+}
+
+// Write all crawled URLs to w, without any hierarchical relationship to their children
+func (c *Crawler) WriteSitemapFlattest(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	c.sitemap.Range(func(k, v interface{}) bool {
+		fmt.Fprintln(bw, k)
+		return true
+	})
+	return bw.Flush()
+}
+
+// Write all crawled URLs to w sorted, one per line, the plain text sitemap accepted by search consoles
+func (c *Crawler) WriteSitemapText(w io.Writer) error {
+	var urls []string
+	c.sitemap.Range(func(k, v interface{}) bool {
+		urls = append(urls, k.(string))
+		return true
+	})
+	sort.Strings(urls)
+	bw := bufio.NewWriter(w)
+	for _, u := range urls {
+		fmt.Fprintln(bw, u)
+	}
+	return bw.Flush()
+}
+
+// Print all sites that have been crawled along with their children.
+func (c *Crawler) PrintSitemapFlat() {
+	c.WriteSitemapFlat(os.Stdout)
+}
+
+// Write all sites that have been crawled along with their children to w.
+func (c *Crawler) WriteSitemapFlat(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	c.sitemap.Range(func(k, v interface{}) bool {
+		v1, ok := v.([]string)
+		if !ok {
+			return false
+		}
+		fmt.Fprintf(bw, "\n%s\n", k)
+		counts := map[string]int{}
+		if m, ok := c.linkCounts.Load(k); ok {
+			counts = m.(map[string]int)
+		}
+		for _, child := range v1 {
+			if n := counts[child]; n > 1 {
+				fmt.Fprintf(bw, "  --> %s (x%d)\n", child, n)
+			} else {
+				fmt.Fprintf(bw, "  --> %s\n", child)
+			}
+		}
+		return true
+	})
+	return bw.Flush()
+}
+
+// Print all crawled URLs that link outside the domain, along with the external links.
+func (c *Crawler) PrintExternalLinks() {
+	c.WriteExternalLinks(os.Stdout)
+}
+
+// Write all crawled URLs that link outside the domain, along with the external links, to w.
+func (c *Crawler) WriteExternalLinks(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	c.externalLinks.Range(func(k, v interface{}) bool {
+		fmt.Fprintf(bw, "\n%s\n", k)
+		for _, link := range v.([]string) {
+			fmt.Fprintf(bw, "  ==> %s\n", link)
+		}
+		return true
+	})
+	return bw.Flush()
+}
+
+// Write the crawl to w in the given print mode: mode1 (flattest), mode2 (flat), mode3 (external links),
+// txt (sorted URLs), xml (sitemap.xml), junit (findings as JUnit XML) or sarif (findings as SARIF)
+func (c *Crawler) WritePrintMode(w io.Writer, mode string) error {
+	switch mode {
+	case "mode1":
+		return c.WriteSitemapFlattest(w)
+	case "mode2":
+		return c.WriteSitemapFlat(w)
+	case "mode3":
+		return c.WriteExternalLinks(w)
+	case "txt":
+		return c.WriteSitemapText(w)
+	case "xml":
+		return c.WriteSitemapXML(w)
+	case "junit":
+		return c.WriteJUnit(w)
+	case "sarif":
+		return c.WriteSARIF(w)
+	}
+	return fmt.Errorf("Unknown printmode (%s)", mode)
+}
+
+// Print findings gathered during the crawl that are worth the attention of the site owner.
+func (c *Crawler) PrintReport() {
+	c.WriteReport(os.Stdout)
+}
+
+// Write findings gathered during the crawl that are worth the attention of the site owner to w.
+func (c *Crawler) WriteReport(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "\nNon-canonical links (to the variant of the site other than %s)\n", c.canonicalHost())
+	c.nonCanonicalLinks.Range(func(k, v interface{}) bool {
+		for _, link := range v.([]string) {
+			fmt.Fprintf(bw, "  %s --> %s\n", k, link)
+		}
+		return true
+	})
+
+	fmt.Fprintf(bw, "\nInsecure links (http:// on an https:// site)\n")
+	c.insecureLinks.Range(func(k, v interface{}) bool {
+		for _, link := range v.([]string) {
+			fmt.Fprintf(bw, "  %s --> %s\n", k, link)
+		}
+		return true
+	})
+
+	// Errors grouped by category, so that timeouts stand out from broken links
+	byCategory := make(map[string][]string)
+	c.fetchErrors.Range(func(k, v interface{}) bool {
+		category := errorCategory(v.(error))
+		byCategory[category] = append(byCategory[category], k.(string))
+		return true
+	})
+	fmt.Fprintf(bw, "\nErrors\n")
+	for category, urls := range byCategory {
+		fmt.Fprintf(bw, "  %s (%d)\n", category, len(urls))
+		for _, u := range urls {
+			fmt.Fprintf(bw, "    %s\n", u)
+		}
+	}
+
+	fmt.Fprintf(bw, "\nSoft 404s (missing pages answered with a page, %s)\n", c.notFound)
+	c.softNotFound.Range(func(k, v interface{}) bool {
+		fmt.Fprintf(bw, "  %s\n", k)
+		return true
+	})
+
+	fmt.Fprintf(bw, "\nCaching (no policy, conflicting directives or time to live under %s)\n", c.minCacheTTL)
+	caching := c.cachingProblems()
+	for _, u := range sortedKeys(caching) {
+		fmt.Fprintf(bw, "  %s: %s\n", u, strings.Join(caching[u], "; "))
+	}
+
+	fmt.Fprintf(bw, "\nEncoding (pages missing a charset or doctype, or declaring conflicting charsets)\n")
+	encodings := c.encodingProblems()
+	for _, u := range sortedKeys(encodings) {
+		fmt.Fprintf(bw, "  %s: %s\n", u, strings.Join(encodings[u], "; "))
+	}
+
+	fmt.Fprintf(bw, "\nContent types (URLs served as a type other than their extension's, often an error page)\n")
+	for _, m := range c.contentTypeMismatches() {
+		fmt.Fprintf(bw, "  %s: served as %s, expecting %s\n", m.URL, mediaType(m.ContentType), strings.Join(m.Expected, " or "))
+	}
+
+	fmt.Fprintf(bw, "\nThird parties (external domains the pages crawled load scripts and iframes from or link to)\n")
+	for _, d := range c.thirdPartyDomains() {
+		fmt.Fprintf(bw, "  %s: %d pages (%s)\n", d.Domain, d.Pages, strings.Join(d.Kinds, ", "))
+	}
+
+	fmt.Fprintf(bw, "\nTags (analytics and tag managers loaded by the pages crawled, and the pages missing them)\n")
+	for _, inv := range c.tagInventory() {
+		fmt.Fprintf(bw, "  %s: %d of %d pages\n", inv.Tag, len(inv.Pages), len(inv.Pages)+len(inv.Missing))
+		for _, page := range inv.Missing {
+			fmt.Fprintf(bw, "    missing on %s\n", page)
+		}
+	}
+
+	if c.checkIcons {
+		fmt.Fprintf(bw, "\nIcons (favicon.ico, icons and web app manifests that failed)\n")
+		for _, check := range c.iconProblems() {
+			from := ""
+			if len(check.Referrer) > 0 {
+				from = ", from " + check.Referrer
+			}
+			fmt.Fprintf(bw, "  %s (%s%s): %s\n", check.URL, check.Kind, from, check.Problem)
+		}
+	}
+
+	if c.lint {
+		fmt.Fprintf(bw, "\nLint (problems of robots.txt and the sitemaps)\n")
+		for _, p := range c.lintFindings() {
+			if p.Line > 0 {
+				fmt.Fprintf(bw, "  %s:%d: %s\n", p.URL, p.Line, p.Problem)
+			} else {
+				fmt.Fprintf(bw, "  %s: %s\n", p.URL, p.Problem)
+			}
+		}
+	}
+
+	fmt.Fprintf(bw, "\nCompression (text responses over %d bytes served without Content-Encoding)\n", c.minCompressSize)
+	c.uncompressed.Range(func(k, v interface{}) bool {
+		fmt.Fprintf(bw, "  %s (%d bytes)\n", k, v)
+		return true
+	})
+
+	if c.probeBytes > 0 {
+		fmt.Fprintf(bw, "\nResources (first %d bytes fetched with a Range request)\n", c.probeBytes)
+		for _, p := range c.probedResources() {
+			size := "unknown size"
+			if p.Size >= 0 {
+				size = fmt.Sprintf("%d bytes", p.Size)
+			}
+			switch {
+			case len(p.Error) > 0:
+				fmt.Fprintf(bw, "  %s: %s\n", p.URL, p.Error)
+			case p.Status >= 300 && p.Status != http.StatusRequestedRangeNotSatisfiable:
+				fmt.Fprintf(bw, "  %s: status %d\n", p.URL, p.Status)
+			case len(p.Sniffed) == 0:
+				fmt.Fprintf(bw, "  %s: %s\n", p.URL, size)
+			case p.Mismatched():
+				fmt.Fprintf(bw, "  %s: %s, %s (served as %s)\n", p.URL, p.Sniffed, size, p.ContentType)
+			default:
+				fmt.Fprintf(bw, "  %s: %s, %s\n", p.URL, p.Sniffed, size)
+			}
+		}
+	}
+
+	if c.etagAliases {
+		fmt.Fprintf(bw, "\nAliases (URLs serving the same resource as another, by ETag)\n")
+		aliases := c.resourceAliases()
+		for _, original := range sortedKeys(aliases) {
+			fmt.Fprintf(bw, "  %s: %s\n", original, strings.Join(aliases[original], ", "))
+		}
+	}
+
+	if len(c.contentChanges) > 0 {
+		fmt.Fprintf(bw, "\nContent changes (pages whose content changed since the previous crawl)\n")
+		for _, s := range append(c.contentChanges, totalChange(c.contentChanges)) {
+			fmt.Fprintf(bw, "  %-30s %5.1f%% changed (%d of %d)  %d added  %d removed\n",
+				s.Section, s.ChangedRate()*100, s.Changed, s.Compared, s.Added, s.Removed)
+		}
+	}
+
+	fmt.Fprintf(bw, "\nStalest pages (by Last-Modified)\n")
+	for _, page := range c.stalestPages(MAX_STALEST_PAGES) {
+		t, _ := c.lastModified.Load(page)
+		fmt.Fprintf(bw, "  %s (%s)\n", page, t.(time.Time).Format("2006-01-02"))
+	}
+
+	fmt.Fprintf(bw, "\nHosts\n")
+	c.hosts.Range(func(k, v interface{}) bool {
+		h := v.(*hostHealth)
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		errorRate := 100 * float64(h.errors) / float64(h.requests)
+		averageLatency := h.latency / time.Duration(h.requests)
+		fmt.Fprintf(bw, "  %s: %d requests, %.1f%% errors, average latency %s, throttled %s\n",
+			k, h.requests, errorRate, averageLatency, h.throttled)
+		return true
+	})
+
+	fmt.Fprintf(bw, "\nWaiting (time pages spent queued, throttled and waiting for a fetch slot before being fetched)\n")
+	var waits [3]struct{ total, max time.Duration }
+	var pages, fetching time.Duration
+	c.stats.Range(func(k, v interface{}) bool {
+		stat := v.(CrawlStat)
+		for i, d := range []time.Duration{stat.queueTime, stat.throttleTime, stat.slotTime} {
+			waits[i].total += d
+			if d > waits[i].max {
+				waits[i].max = d
+			}
+		}
+		pages++
+		fetching += stat.getTime
+		return true
+	})
+	if pages > 0 {
+		for i, name := range []string{"queued", "throttled", "slot"} {
+			fmt.Fprintf(bw, "  %-10s average %s, max %s\n", name, waits[i].total/pages, waits[i].max)
+		}
+		fmt.Fprintf(bw, "  %-10s average %s\n", "GET", fetching/pages)
+	}
+
+	if c.traceTimings {
+		fmt.Fprintf(bw, "\nSlowest requests (network: DNS, connect, TLS; server: TTFB; payload: body)\n")
+		for _, p := range c.slowestTimings(MAX_REPORTED_TIMINGS) {
+			t := p.Timing
+			fmt.Fprintf(bw, "  %s: DNS %s, connect %s, TLS %s, TTFB %s, body %s\n", p.URL, t.DNS, t.Connect, t.TLS, t.TTFB, t.Body)
+		}
+	}
+
+	fmt.Fprintf(bw, "\nServer-Timing (durations reported by the server, against the TTFB measured or the GET without -timings)\n")
+	for _, p := range c.serverTimings(MAX_REPORTED_SERVER_TIMINGS) {
+		fmt.Fprintf(bw, "  %s\n", serverTimingLine(p))
+	}
+
+	fmt.Fprintf(bw, "\nSections\n")
+	for _, s := range c.Result().Sections() {
+		fmt.Fprintf(bw, "  %-30s %6d pages %6d errors (%.1f%%)  average latency %.1fms\n",
+			s.Section, s.Pages, s.Errors, s.ErrorRate()*100, s.AverageLatencyMs)
+	}
+
+	fmt.Fprintf(bw, "\nURL templates (pages sharing a path once identifiers are replaced, and query parameters)\n")
+	for i, t := range c.Result().Templates() {
+		if i == MAX_REPORTED_TEMPLATES || t.Pages == 1 {
+			break
+		}
+		fmt.Fprintf(bw, "  %6d %s\n", t.Pages, t.Template)
+	}
+
+	fmt.Fprintf(bw, "\nSampled endpoints (search pages and parameterized URLs, only the first %d of each template crawled)\n", c.sampler.size)
+	for _, e := range c.sampler.sampledEndpoints() {
+		fmt.Fprintf(bw, "  %s (%s): %d crawled, %d more not crawled\n", e.Template, e.Kind, e.Sampled, e.Dropped)
+	}
+
+	fmt.Fprintf(bw, "\nCoverage (share of the site crawled, estimated from the rate new URLs were found)\n")
+	switch cv := c.Coverage(); {
+	case !cv.Truncated:
+		fmt.Fprintf(bw, "  complete, %d pages crawled\n", cv.Crawled)
+	case cv.Estimated > 0:
+		fmt.Fprintf(bw, "  %d pages crawled of an estimated %.0f (%.0f%%), %d URLs found\n",
+			cv.Crawled, cv.Estimated, cv.Rate()*100, cv.Discovered)
+	default:
+		fmt.Fprintf(bw, "  %d pages crawled, %d URLs found, too few pages or still finding new URLs to estimate the size of the site\n",
+			cv.Crawled, cv.Discovered)
+	}
+
+	fmt.Fprintf(bw, "\nRobots.txt\n")
+	c.robots.Range(func(k, v interface{}) bool {
+		rules := v.(*RobotsRules)
+		if !rules.Found {
+			fmt.Fprintf(bw, "  %s: not found, everything allowed\n", k)
+			return true
+		}
+		fmt.Fprintf(bw, "  %s (fetched %s)\n", k, rules.FetchedAt.Format("2006-01-02 15:04"))
+		for _, group := range rules.Groups {
+			fmt.Fprintf(bw, "    User-agent: %s (%d allow, %d disallow, crawl-delay %s)\n",
+				strings.Join(group.Agents, ", "), len(group.Allow), len(group.Disallow), group.CrawlDelay)
 		}
 		return true
 	})
+
+	fmt.Fprintf(bw, "\nOrphan pages (listed in a sitemap, not linked from any page)\n")
+	for _, page := range c.orphanPages() {
+		fmt.Fprintf(bw, "  %s\n", page)
+	}
+
+	fmt.Fprintf(bw, "\nNot crawled\n")
+	for _, page := range c.uncrawledPages() {
+		fmt.Fprintf(bw, "  %s (%s, depth %d, %s on %s)\n", page.URL, page.Reason, page.Depth, page.Source, page.Referrer)
+	}
+
+	fmt.Fprintf(bw, "\nRedirects\n")
+	c.redirects.Range(func(k, v interface{}) bool {
+		fmt.Fprintf(bw, "  %s --> %s\n", k, v)
+		return true
+	})
+	return bw.Flush()
+}
+
+// --------------------
+// Frontier spill
+// --------------------
+
+// How often the memory usage is sampled, and spilled sites are considered for crawling
+const MEMORY_SAMPLE_INTERVAL time.Duration = 100 * time.Millisecond
+const SPILL_DRAIN_INTERVAL time.Duration = 100 * time.Millisecond
+
+// Samples the heap size of the process to tell whether it is above the limit.
+// The zero value has no limit.
+type memoryGuard struct {
+	mu sync.Mutex
+
+	// Heap size in bytes above which the limit is exceeded, zero for no limit
+	limit uint64
+
+	// Result of the last sample and when it was taken
+	over      bool
+	sampledAt time.Time
+}
+
+// Returns true if the heap size was above the limit when last sampled.
+// Sampling stops the world, so it is done at most every MEMORY_SAMPLE_INTERVAL.
+func (m *memoryGuard) exceeded() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.limit == 0 {
+		return false
+	}
+	if time.Since(m.sampledAt) >= MEMORY_SAMPLE_INTERVAL {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		m.over = stats.HeapAlloc > m.limit
+		m.sampledAt = time.Now()
+	}
+	return m.over
+}
+
+// Queue of sites stored one per line in a temporary file.
+// The file is created on first push and removed whenever the queue is emptied.
+type frontierSpill struct {
+	mu sync.Mutex
+
+	file *os.File
+
+	// Offsets in the file of the next site to pop, and of the next site to push
+	readOffset  int64
+	writeOffset int64
+
+	// True while a goroutine is draining the queue
+	draining bool
+}
+
+// Appends a site to the queue.
+// Returns true if nobody is draining the queue, in which case the caller must start draining it.
+func (s *frontierSpill) push(site string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		f, err := ioutil.TempFile("", "crawler-frontier-")
+		if err != nil {
+			return false, err
+		}
+		s.file = f
+	}
+	n, err := s.file.WriteAt([]byte(site+"\n"), s.writeOffset)
+	if err != nil {
+		return false, err
+	}
+	s.writeOffset += int64(n)
+
+	startDrain := !s.draining
+	s.draining = true
+	return startDrain, nil
+}
+
+// Pops up to max sites from the queue.
+// Returns false once the queue is empty, at which point draining has stopped.
+func (s *frontierSpill) pop(max int) ([]string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sites []string
+	var err error
+	if s.file != nil {
+		r := bufio.NewReader(io.NewSectionReader(s.file, s.readOffset, s.writeOffset-s.readOffset))
+		for len(sites) < max {
+			line, e := r.ReadString('\n')
+			if e != nil {
+				if e != io.EOF {
+					err = e
+				}
+				break
+			}
+			s.readOffset += int64(len(line))
+			sites = append(sites, strings.TrimSuffix(line, "\n"))
+		}
+	}
+
+	// Nothing left (or nothing readable), reclaim the disk space
+	if s.readOffset >= s.writeOffset || err != nil {
+		if s.file != nil {
+			s.file.Close()
+			os.Remove(s.file.Name())
+			s.file = nil
+		}
+		s.readOffset, s.writeOffset = 0, 0
+		s.draining = false
+		return sites, false, err
+	}
+	return sites, true, nil
+}
+
+// --------------------
+// Throttle
+// --------------------
+
+// Bounds of the delay added before each request while the error rate is high
+const MIN_THROTTLE_DELAY time.Duration = 100 * time.Millisecond
+const MAX_THROTTLE_DELAY time.Duration = 10 * time.Second
+
+// Adaptive throttle slowing the crawl down when too many of the last requests failed
+// with a timeout or a server error, and speeding it back up once they succeed again.
+// The zero value never throttles.
+type throttle struct {
+	mu sync.Mutex
+
+	// Number of most recent requests considered
+	windowSize int
+
+	// Ratio of failed requests in the window above which the delay is increased
+	threshold float64
+
+	// Outcomes of the most recent requests (true if failed), used as a ring buffer
+	window []bool
+	next   int
+	failed int
+
+	// Delay added before each request
+	delay time.Duration
+}
+
+// Returns true if the given error means the site may be overloaded
+func isOverloadError(err error) bool {
+	switch err.(type) {
+	case FetchTimeout, HttpServerError, ServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// Sleeps for the current delay and returns the time slept
+func (t *throttle) wait() time.Duration {
+	t.mu.Lock()
+	delay := t.delay
+	t.mu.Unlock()
+	time.Sleep(delay)
+	return delay
+}
+
+// Returns true while requests are being slowed down
+func (t *throttle) delayed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.delay > 0
+}
+
+// Records the outcome of a request and adjusts the delay accordingly
+func (t *throttle) record(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.windowSize <= 0 {
+		return
+	}
+	if len(t.window) != t.windowSize {
+		t.window = make([]bool, t.windowSize)
+		t.next, t.failed = 0, 0
+	}
+
+	// Replace the oldest outcome with this one
+	if t.window[t.next] {
+		t.failed--
+	}
+	t.window[t.next] = isOverloadError(err)
+	if t.window[t.next] {
+		t.failed++
+	}
+	t.next = (t.next + 1) % t.windowSize
+
+	rate := float64(t.failed) / float64(t.windowSize)
+	switch {
+	case rate > t.threshold && t.delay < MAX_THROTTLE_DELAY:
+		t.delay = t.delay * 2
+		if t.delay < MIN_THROTTLE_DELAY {
+			t.delay = MIN_THROTTLE_DELAY
+		} else if t.delay > MAX_THROTTLE_DELAY {
+			t.delay = MAX_THROTTLE_DELAY
+		}
+		log.Printf("Error rate is %.0f%%, adding a delay of %s before each request.\n", rate*100, t.delay)
+	case rate <= t.threshold/2 && t.delay > 0:
+		t.delay = t.delay / 2
+		if t.delay < MIN_THROTTLE_DELAY {
+			t.delay = 0
+		}
+		log.Printf("Error rate is %.0f%%, speeding up to a delay of %s.\n", rate*100, t.delay)
+	}
 }
 
 // --------------------
 // Link handling
 // --------------------
 
-// TODO LATER: look into using 'net/url' package instead
+// Returns the given capture group of all the matches of re in html.
+// The returned slices point into html, nothing is copied.
+func findCaptures(re *regexp.Regexp, html []byte, captureGroup int) [][]byte {
+	allMatches := re.FindAllSubmatchIndex(html, -1)
+	b := make([][]byte, 0, len(allMatches))
+	for _, x := range allMatches {
+		if start, end := x[2*captureGroup], x[2*captureGroup+1]; start >= 0 {
+			b = append(b, html[start:end])
+		}
+	}
+	return b
+}
+
+// Parses the given links as found in an href.
+// Links that do not parse as they are written are normalized first, those that still don't are dropped.
+func parseLinks(links [][]byte) []*url.URL {
+	b := make([]*url.URL, 0, len(links))
+	for _, link := range links {
+		u, err := url.Parse(string(link))
+		if err != nil {
+			u, err = url.Parse(normalizeLink(string(link), true))
+		}
+		if err == nil {
+			b = append(b, u)
+		}
+	}
+	return b
+}
+
+// Returns the string form of each of the given URLs
+func urlStrings(urls []*url.URL) []string {
+	b := make([]string, len(urls))
+	for i, u := range urls {
+		b[i] = u.String()
+	}
+	return b
+}
+
+// Find relative links (starting with '/') present in the given html
+func FindRelativeLinks(html []byte) []*url.URL {
+	const captureGroup int = 1
+	return parseLinks(findCaptures(relativeLinkRe, html, captureGroup))
+}
 
-func FindRelativeLinks(html string) []string {
-	const relativePattern string = "href=\"(/[-\\w\\d_/\\.]+)\""
+// Find links relative to the page they are on (./guide, ../api) in the given html, as written in the HTML
+func FindDotRelativeLinks(html []byte) []string {
 	const captureGroup int = 1
-	re := regexp.MustCompile(relativePattern)
-	allMatches := re.FindAllStringSubmatch(html, -1)
-	b := make([]string, len(allMatches))
+	var b []string
+	for _, x := range findCaptures(dotRelativeLinkRe, html, captureGroup) {
+		b = append(b, string(x))
+	}
+	return b
+}
 
-	// take the first capturing group from matches
-	for i, x := range allMatches {
-		b[i] = x[captureGroup]
+// Find the src of all iframes present in the given html, as written in the HTML
+func FindFrameSources(html []byte) []string {
+	const captureGroup int = 1
+	var b []string
+	for _, x := range findCaptures(frameSourceRe, html, captureGroup) {
+		b = append(b, string(x))
 	}
 	return b
 }
 
-// Find aboslute links present in the given html string.
-// If domain is not nil, then only links local to the domain will be returned
-func FindAbsoluteLinks(html string, domain *string) []string {
+// Find the inline documents (srcdoc) of all iframes present in the given html.
+// The returned documents are unescaped and can be searched for links like any other page.
+func FindFrameSrcdocs(html []byte) []string {
+	const captureGroup int = 1
+	var b []string
+	for _, x := range findCaptures(frameSrcdocRe, html, captureGroup) {
+		b = append(b, htmlutil.UnescapeString(string(x)))
+	}
+	return b
+}
+
+// Find the target URL of a <meta http-equiv="refresh" content="0;url=..."> present in the
+// given html, as written in the HTML. Returns an empty string if there is none.
+func FindMetaRefresh(html []byte) string {
+	for _, tag := range metaTagRe.FindAll(html, -1) {
+		if !metaRefreshRe.Match(tag) {
+			continue
+		}
+		if m := metaRefreshURLRe.FindSubmatch(tag); m != nil {
+			return htmlutil.UnescapeString(string(m[1]))
+		}
+	}
+	return ""
+}
 
-	// If domain == nil, use a default domain matcher
-	var defaultDomainPattern string = "([^:\\/\\s]+)"
+// Removes duplicate links from the given slice, keeping the order in which they first appear.
+// Also returns the number of times each link occurred in the original slice.
+func dedupLinks(links []string) ([]string, map[string]int) {
+	counts := make(map[string]int, len(links))
+	unique := make([]string, 0, len(links))
+	for _, link := range links {
+		if counts[link] == 0 {
+			unique = append(unique, link)
+		}
+		counts[link]++
+	}
+	return unique, counts
+}
+
+// Absolute links to any domain.
+// http[s] is required for the absolute link to match, otherwise we would match relative links as well.
+var absoluteLinkRe = regexp.MustCompile("href=\"((http[s]?:\\/\\/)([^:\\/\\s\"]+)(:[0-9]+)?(\\/[^\\s]*)*)\"")
+
+// Matcher of absolute links, to the domain of its ScopeMatcher or to any domain without one
+type LinkMatcher struct {
+	scope *ScopeMatcher
+}
+
+// Returns a matcher of absolute links local to the given domain or its subdomains.
+// If domain is nil, links to any domain are matched.
+func NewLinkMatcher(domain *string) *LinkMatcher {
 	if domain == nil {
-		domain = &defaultDomainPattern
+		return &LinkMatcher{}
 	}
+	return &LinkMatcher{scope: NewScopeMatcher(*domain, true)}
+}
 
-	// Absolute pattern to match
-	// http[s] is required for the absolute link to match, otherwise we would match relative links as well.
-	// The domain may be specified by the caller of the function, otherwise a default domain pattern matcher is used.
-	var absolutePattern string = fmt.Sprintf("href=\"((http[s]?:\\/\\/)([^\\s\\/]*\\.)?%s(\\/[^\\s]*)*)\"", *domain)
+// Find absolute links present in the given html matched by m
+func (m *LinkMatcher) FindLinks(html []byte) []*url.URL {
 	const captureGroup int = 1
+	links := parseLinks(findCaptures(absoluteLinkRe, html, captureGroup))
+	if m.scope == nil {
+		return links
+	}
+	local := links[:0]
+	for _, u := range links {
+		if m.scope.Matches(u) {
+			local = append(local, u)
+		}
+	}
+	return local
+}
 
-	re := regexp.MustCompile(absolutePattern)
-	allMatches := re.FindAllStringSubmatch(html, -1)
+// Find aboslute links present in the given html.
+// If domain is not nil, then only links local to the domain will be returned
+func FindAbsoluteLinks(html []byte, domain *string) []*url.URL {
+	if domain == nil {
+		return anyDomainLinks.FindLinks(html)
+	}
+	return NewLinkMatcher(domain).FindLinks(html)
+}
 
-	b := make([]string, len(allMatches))
+// Characters that never need to be percent-encoded in a URL (RFC 3986 section 2.3)
+func isUnreserved(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' ||
+		b == '-' || b == '.' || b == '_' || b == '~'
+}
 
-	// Take the first capturing group from matches
-	for i, x := range allMatches {
-		b[i] = x[captureGroup]
+// Normalizes a link as found in an href before it is deduplicated and fetched:
+//   - surrounding whitespace is trimmed, tabs and newlines are removed and spaces are encoded
+//   - percent-encoded unreserved characters are decoded (%7E -> ~)
+//   - other percent-encodings use uppercase hex digits (%2f -> %2F)
+//   - stray '%' not followed by two hex digits are encoded (% -> %25)
+//   - the fragment is removed, it is never sent to the server, unless keepRoutes is set
+//     and the fragment is a route of a hash-routed single page application (#/products/1)
+func normalizeLink(link string, keepRoutes bool) string {
+	link = strings.TrimSpace(link)
+	if i := strings.IndexByte(link, '#'); i >= 0 && !(keepRoutes && isRouteFragment(link[i+1:])) {
+		link = link[:i]
 	}
 
-	return b
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(link); i++ {
+		switch ch := link[i]; ch {
+		case '\t', '\n', '\r':
+			// Dropped, browsers do the same
+		case ' ':
+			b.WriteString("%20")
+		case '%':
+			hi, lo := unhex(link, i+1), unhex(link, i+2)
+			if hi < 0 || lo < 0 {
+				b.WriteString("%25")
+				continue
+			}
+			if decoded := byte(hi<<4 | lo); isUnreserved(decoded) {
+				b.WriteByte(decoded)
+			} else {
+				b.WriteByte('%')
+				b.WriteByte(hex[hi])
+				b.WriteByte(hex[lo])
+			}
+			i += 2
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
 }
 
-func main() {
-	// Parse command line
-	verbose = flag.Bool("verbose", false, "Provides versbose output.")
-	printMode := flag.String("printmode", "mode1", "options: mode1 (flattest), mode2 (flat)")
-	fast = flag.Bool("fast", false, "Use httpfast")
-	flag.Parse()
-
-	defer profile.Start().Stop()
+// Returns true if the given fragment (without '#') is a route of a hash-routed
+// single page application, e.g. "/products/1" or "!/products/1"
+func isRouteFragment(fragment string) bool {
+	return strings.HasPrefix(fragment, "/") || strings.HasPrefix(fragment, "!/")
+}
 
-	// Crawl and measure time taken
-	var c *Crawler = new(Crawler)
-	start := time.Now()
-	c.Init("https://monzo.com")
-	c.Start()
-	c.Wait()
-	elapsed := time.Since(start)
+// Returns the value of the hex digit at s[i], or -1 if there is none
+func unhex(s string, i int) int {
+	if i >= len(s) {
+		return -1
+	}
+	switch ch := s[i]; {
+	case '0' <= ch && ch <= '9':
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch - 'a' + 10)
+	case 'A' <= ch && ch <= 'F':
+		return int(ch - 'A' + 10)
+	}
+	return -1
+}
 
-	if *verbose {
-		c.stats.Range(func(url, stats interface{}) bool {
-			stat := stats.(CrawlStat)
-			log.Printf("Crawl (%s)  took %s. GET(%s)\n", url, stat.totalTime, stat.getTime)
-			return true
-		})
-		log.Printf("%d Crawls took %s\n", c.totalCrawls, elapsed)
+// Returns the links in the given slice that use the given scheme (e.g. "http")
+func linksWithScheme(links []string, scheme string) []string {
+	var b []string
+	for _, link := range links {
+		if strings.HasPrefix(link, scheme+"://") {
+			b = append(b, link)
+		}
 	}
+	return b
+}
 
-	switch *printMode {
-	case "mode1":
-		c.PrintSitemapFlattest()
-	case "mode2":
-		c.PrintSitemapFlat()
-	default:
-		log.Fatalf("Unknown printmode (%s). Not printing.\n", *printMode)
+// Find absolute links present in the given html that are not local to the domain.
+func FindExternalLinks(html []byte, domain string) []*url.URL {
+	return findExternalLinks(html, NewLinkMatcher(&domain))
+}
+
+// Find absolute links present in the given html that are not matched by the local matcher.
+func findExternalLinks(html []byte, local *LinkMatcher) []*url.URL {
+	isLocal := make(map[string]bool)
+	for _, u := range local.FindLinks(html) {
+		isLocal[u.String()] = true
 	}
 
-	log.Printf("Crawler done. Exiting main.")
+	var b []*url.URL
+	for _, u := range anyDomainLinks.FindLinks(html) {
+		if !isLocal[u.String()] {
+			b = append(b, u)
+		}
+	}
+	return b
 }
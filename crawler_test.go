@@ -1,11 +1,20 @@
-package main
+package crawler
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -100,7 +109,7 @@ func TestFindRelativeLinks_findsAllCorrectly(t *testing.T) {
         }
 
         // Get relative links and test function
-        results := FindRelativeLinks(string(data))
+        results := urlStrings(FindRelativeLinks(data))
         res := testArraysMatch(t, RELATIVE_LINKS[:], results)
 
         if res == 1 {
@@ -140,7 +149,7 @@ func TestFindAbsoluteLinks_findsAllCorrectly(t *testing.T) {
         }
 
         // Get absolute links and test function
-        results := FindAbsoluteLinks(string(data), nil)
+        results := urlStrings(FindAbsoluteLinks(data, nil))
         res := testArraysMatch(t, ABSOLUTE_LINKS[:], results)
         if res == 1 {
                 t.Errorf("Not all absolute links were found. Expecting (%d), found (%d)\n",
@@ -150,6 +159,205 @@ func TestFindAbsoluteLinks_findsAllCorrectly(t *testing.T) {
         }
 }
 
+// Test that FindExternalLinks only returns absolute links that are outside the domain
+func TestFindExternalLinks_excludesLocalLinks(t *testing.T) {
+	data, err := ioutil.ReadFile(MONZO_HTML_FILENAME)
+	if err != nil {
+		t.Fatalf("Failed to open file %s", MONZO_HTML_FILENAME)
+	}
+
+	results := urlStrings(FindExternalLinks(data, "monzo.com"))
+	if i := Find(results, "https://twitter.com/monzo"); i < 0 {
+		t.Errorf("External link (https://twitter.com/monzo) was not found.")
+	}
+	if i := Find(results, "https://monzo.com/community"); i >= 0 {
+		t.Errorf("Local link (https://monzo.com/community) was returned as external.")
+	}
+	if i := Find(results, "https://web.monzo.com"); i >= 0 {
+		t.Errorf("Subdomain link (https://web.monzo.com) was returned as external.")
+	}
+	// 17 absolute links in total, 2 of which are local
+	if len(results) != 15 {
+		t.Errorf("Expecting (15) external links, found (%d)", len(results))
+	}
+}
+
+// Test that normalizeLink fixes percent-encoding, whitespace and fragments
+func TestNormalizeLink(t *testing.T) {
+	cases := map[string]string{
+		"/about":                   "/about",
+		"  /about\n":               "/about",
+		"/my page":                 "/my%20page",
+		"/a\tb":                    "/ab",
+		"/%7euser":                 "/~user",
+		"/%41%62c":                 "/Abc",
+		"/a%2fb":                   "/a%2Fb",
+		"/100%":                    "/100%25",
+		"/50%zz":                   "/50%25zz",
+		"/faq#section":             "/faq",
+		"https://monzo.com/x%3a#y": "https://monzo.com/x%3A",
+	}
+	for in, expected := range cases {
+		if out := normalizeLink(in, false); out != expected {
+			t.Errorf("normalizeLink(%q) = %q, expecting %q", in, out, expected)
+		}
+	}
+}
+
+// Test that links are parsed from the html bytes, and that those not parsing as written are normalized
+func TestFindRelativeLinks_parsesLinks(t *testing.T) {
+	html := []byte(`<a href="/about">About</a> <a href="/100%">Full</a>`)
+	results := urlStrings(FindRelativeLinks(html))
+	if res := testArraysMatch(t, []string{"/about", "/100%25"}, results); res != 0 {
+		t.Errorf("Unexpected relative links %v", results)
+	}
+}
+
+// Test that links inside <noscript> fallback content are found like any other link
+func TestFindLinks_insideNoscript(t *testing.T) {
+	html := []byte(`<script>render()</script>
+		<noscript><a href="/sitemap">Sitemap</a> <a href="https://monzo.com/about">About</a></noscript>`)
+
+	if res := testArraysMatch(t, []string{"/sitemap"}, urlStrings(FindRelativeLinks(html))); res != 0 {
+		t.Errorf("Relative link inside noscript was not found.")
+	}
+	domain := "monzo.com"
+	if res := testArraysMatch(t, []string{"https://monzo.com/about"}, urlStrings(FindAbsoluteLinks(html, &domain))); res != 0 {
+		t.Errorf("Absolute link inside noscript was not found.")
+	}
+}
+
+// Test that iframe src and srcdoc attributes are found, and that srcdoc documents are unescaped
+func TestFindFrames(t *testing.T) {
+	html := []byte(`<iframe width="10" src="/nav.html"></iframe>
+		<iframe srcdoc="&lt;a href=&quot;/about&quot;&gt;About&lt;/a&gt;"></iframe>`)
+
+	if res := testArraysMatch(t, []string{"/nav.html"}, FindFrameSources(html)); res != 0 {
+		t.Errorf("FindFrameSources did not return the iframe src.")
+	}
+
+	docs := FindFrameSrcdocs(html)
+	if len(docs) != 1 {
+		t.Fatalf("Expecting (1) srcdoc, found (%d)", len(docs))
+	}
+	if res := testArraysMatch(t, []string{"/about"}, urlStrings(FindRelativeLinks([]byte(docs[0])))); res != 0 {
+		t.Errorf("Links inside srcdoc (%s) were not found.", docs[0])
+	}
+}
+
+// Test that FindMetaRefresh finds the target of meta refresh redirects regardless of attribute order
+func TestFindMetaRefresh(t *testing.T) {
+	cases := map[string]string{
+		`<meta http-equiv="refresh" content="0;url=/new">`:                 "/new",
+		`<META CONTENT="5; URL='https://monzo.com/x'" HTTP-EQUIV=Refresh>`: "https://monzo.com/x",
+		`<meta http-equiv="refresh" content="30">`:                         "",
+		`<meta name="description" content="0;url=/not-a-redirect">`:        "",
+		`<html><body></body></html>`:                                       "",
+	}
+	for html, expected := range cases {
+		if target := FindMetaRefresh([]byte(html)); target != expected {
+			t.Errorf("FindMetaRefresh(%s) = %q, expecting %q", html, target, expected)
+		}
+	}
+}
+
+// Test that normalizeLink keeps hash routes only when asked to
+func TestNormalizeLink_keepsRouteFragments(t *testing.T) {
+	if out := normalizeLink("/#/products/1", true); out != "/#/products/1" {
+		t.Errorf("Expecting route fragment to be kept, got %q", out)
+	}
+	if out := normalizeLink("/#!/products/1", true); out != "/#!/products/1" {
+		t.Errorf("Expecting hashbang route fragment to be kept, got %q", out)
+	}
+	if out := normalizeLink("/faq#section", true); out != "/faq" {
+		t.Errorf("Expecting anchor fragment to be stripped, got %q", out)
+	}
+	if out := normalizeLink("/#/products/1", false); out != "/" {
+		t.Errorf("Expecting route fragment to be stripped, got %q", out)
+	}
+}
+
+// Test that dedupLinks removes duplicates while preserving order and counting occurrences
+func TestDedupLinks_removesDuplicatesAndCounts(t *testing.T) {
+	data, err := ioutil.ReadFile(MONZO_HTML_FILENAME)
+	if err != nil {
+		t.Fatalf("Failed to open file %s", MONZO_HTML_FILENAME)
+	}
+
+	links := urlStrings(FindRelativeLinks(data))
+	unique, counts := dedupLinks(links)
+
+	if len(unique) != len(counts) {
+		t.Errorf("Expecting (%d) unique links, found (%d)", len(counts), len(unique))
+	}
+	if n := counts["/-play-store-redirect"]; n != 4 {
+		t.Errorf("Expecting /-play-store-redirect to be counted 4 times, got (%d)", n)
+	}
+	if unique[0] != links[0] {
+		t.Errorf("Expecting first link (%s) to be kept first, got (%s)", links[0], unique[0])
+	}
+	for i, x := range unique {
+		if Find(unique, x) != i {
+			t.Errorf("Link (%s) is present more than once", x)
+		}
+	}
+}
+
+// Benchmark FindRelativeLinks on the Monzo page
+func BenchmarkFindRelativeLinks(b *testing.B) {
+	data, err := ioutil.ReadFile(MONZO_HTML_FILENAME)
+	if err != nil {
+		b.Fatalf("Failed to open file %s", MONZO_HTML_FILENAME)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		FindRelativeLinks(data)
+	}
+}
+
+// Benchmark normalizeLink on a link needing every kind of fix
+func BenchmarkNormalizeLink(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		normalizeLink(" /my page/%7euser/a%2fb#section\n", false)
+	}
+}
+
+// Benchmark computing the visit key of a URL with the default normalization options
+func BenchmarkVisitKey(b *testing.B) {
+	var c Crawler
+	c.Init("https://monzo.com")
+	for i := 0; i < b.N; i++ {
+		c.visitKey("https://Monzo.com/blog/index.html#top")
+	}
+}
+
+// Benchmark FindAbsoluteLinks, which compiles the domain regex on each call
+func BenchmarkFindAbsoluteLinks(b *testing.B) {
+	data, err := ioutil.ReadFile(MONZO_HTML_FILENAME)
+	if err != nil {
+		b.Fatalf("Failed to open file %s", MONZO_HTML_FILENAME)
+	}
+	domain := "monzo.com"
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		FindAbsoluteLinks(data, &domain)
+	}
+}
+
+// Benchmark a LinkMatcher compiled once for the domain, as used by the Crawler
+func BenchmarkLinkMatcher_FindLinks(b *testing.B) {
+	data, err := ioutil.ReadFile(MONZO_HTML_FILENAME)
+	if err != nil {
+		b.Fatalf("Failed to open file %s", MONZO_HTML_FILENAME)
+	}
+	domain := "monzo.com"
+	m := NewLinkMatcher(&domain)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.FindLinks(data)
+	}
+}
+
 // ---------------------------
 // Test Error implementations
 // ---------------------------
@@ -162,10 +370,144 @@ func TestInvalidHTMLContent(t *testing.T) {
 	_ = InvalidHTMLContent("Some error message")
 }
 
+func TestFetchTimeout(t *testing.T) {
+	_ = FetchTimeout("Some error message")
+}
+
+// Test that each error type is reported under its own category
+func TestErrorCategory(t *testing.T) {
+	if category := errorCategory(FetchTimeout("x")); category != "timeout" {
+		t.Errorf("Expecting FetchTimeout to be categorised as timeout, got (%s)", category)
+	}
+	if category := errorCategory(Http404Error("x")); category != "not found" {
+		t.Errorf("Expecting Http404Error to be categorised as not found, got (%s)", category)
+	}
+}
+
 func TestInvalidURL(t *testing.T) {
 	_ = InvalidURL("Some error message")
 }
 
+// Test that fetch returns the body in a pooled buffer
+func TestFetch_readsBodyIntoPooledBuffer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<html></html>")
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	body, _, err := c.fetch(ts.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if body.String() != "<html></html>" {
+		t.Errorf("Unexpected body (%s)", body.String())
+	}
+	releaseBody(body)
+
+	reused := acquireBody()
+	if reused.Len() != 0 {
+		t.Errorf("Expecting an acquired buffer to be empty, got (%s)", reused.String())
+	}
+}
+
+// --------------------
+// Test Frontier spill
+// --------------------
+
+// Test that sites pushed to the spill are popped back in order and in batches
+func TestFrontierSpill_pushAndPop(t *testing.T) {
+	var s frontierSpill
+	sites := []string{"https://monzo.com/a", "https://monzo.com/b", "https://monzo.com/c"}
+	for i, site := range sites {
+		startDrain, err := s.push(site)
+		if err != nil {
+			t.Fatalf("Failed to push (%s): %s", site, err)
+		}
+		if startDrain != (i == 0) {
+			t.Errorf("Expecting only the first push to ask for draining.")
+		}
+	}
+
+	popped, more, err := s.pop(2)
+	if err != nil || !more || len(popped) != 2 || popped[0] != sites[0] || popped[1] != sites[1] {
+		t.Errorf("Expecting the first two sites and more to come, got %v (more: %t, err: %v)", popped, more, err)
+	}
+	popped, more, err = s.pop(2)
+	if err != nil || more || len(popped) != 1 || popped[0] != sites[2] {
+		t.Errorf("Expecting the last site and nothing more, got %v (more: %t, err: %v)", popped, more, err)
+	}
+	if s.file != nil {
+		t.Errorf("Expecting the spill file to be removed once empty.")
+	}
+}
+
+// Test that a crawl completes with every page when all new sites are spilled to disk
+func TestCrawl_completesWhenMemoryLimitExceeded(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, err := urlToHTMLContent(r.URL.Path)
+		if err != nil {
+			w.WriteHeader(404)
+		}
+		io.WriteString(w, content)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.memory.limit = 1
+	c.Start()
+	c.Wait()
+
+	for _, page := range []string{"/page1.html", "/page11.html", "/page22b.html", "/page31.html"} {
+		if _, ok := c.sitemap.Load(ts.URL + page); !ok {
+			t.Errorf("Sitemap does not contain (%s) as it should.", page)
+		}
+	}
+}
+
+// --------------
+// Test Throttle
+// --------------
+
+// Test that the throttle slows down when requests fail and speeds back up when they succeed
+func TestThrottle_adjustsDelayToErrorRate(t *testing.T) {
+	th := throttle{windowSize: 10, threshold: 0.5}
+	for i := 0; i < 10; i++ {
+		th.record(HttpServerError("x"))
+	}
+	if th.delay < MIN_THROTTLE_DELAY {
+		t.Errorf("Expecting a delay after consecutive server errors, got (%s)", th.delay)
+	}
+	if th.delay > MAX_THROTTLE_DELAY {
+		t.Errorf("Delay (%s) exceeds the maximum (%s)", th.delay, MAX_THROTTLE_DELAY)
+	}
+
+	for i := 0; i < 30; i++ {
+		th.record(nil)
+	}
+	if th.delay != 0 {
+		t.Errorf("Expecting no delay after consecutive successes, got (%s)", th.delay)
+	}
+}
+
+// Test that not found errors do not slow the crawl down, and that the zero value never throttles
+func TestThrottle_ignoresNotFoundAndZeroValue(t *testing.T) {
+	th := throttle{windowSize: 10, threshold: 0.5}
+	var zero throttle
+	for i := 0; i < 10; i++ {
+		th.record(Http404Error("x"))
+		zero.record(FetchTimeout("x"))
+	}
+	if th.delay != 0 {
+		t.Errorf("Expecting no delay after not found errors, got (%s)", th.delay)
+	}
+	if zero.delay != 0 {
+		t.Errorf("Expecting the zero value throttle to never delay, got (%s)", zero.delay)
+	}
+}
+
 // --------------
 // Test Crawler
 // --------------
@@ -190,6 +532,20 @@ func TestInit_noErrorWhenSiteIsValidURL(t *testing.T) {
 	}
 }
 
+// Test that New returns an initialised Crawler, or the error of Init
+func TestNew(t *testing.T) {
+	c, err := New("https://monzo.com/abcde")
+	if err != nil {
+		t.Fatalf("Got an unexpected error %s", err)
+	}
+	if c.baseSite != "https://monzo.com/abcde" {
+		t.Errorf("Expecting a crawler of (https://monzo.com/abcde), got (%s)", c.baseSite)
+	}
+	if _, err := New("hello"); err == nil {
+		t.Errorf("Expecting an error for (hello)")
+	}
+}
+
 // Test that Crawler.Wait() does not block when wg.Add(1) has not been called
 func TestWait_doesNotBlockWGIsZero(t *testing.T) {
 	var c Crawler
@@ -202,15 +558,15 @@ func TestWait_doesNotBlockWGIsZero(t *testing.T) {
 }
 
 // Test that Crawler.Wait() works by ensuring it blocks for at least x seconds
-// before getting to the end of the function. We start a goroutine that calls Crawler.wg.Done()
+// before getting to the end of the function. We start a goroutine that calls Crawler.pending.Done()
 // after x seconds.
 func TestWait_blocksWhenWGNotZero(t *testing.T) {
 	delay := 1 * time.Second
 	var c Crawler
-	c.wg.Add(1)
+	c.pending.Add()
 	go func() {
 		time.Sleep(delay)
-		c.wg.Done()
+		c.pending.Done()
 	}()
 
 	start := time.Now()
@@ -222,6 +578,144 @@ func TestWait_blocksWhenWGNotZero(t *testing.T) {
 	}
 }
 
+// Test that http and https variants of a URL share the same visit key once ignoreScheme is set
+func TestVisitKey_ignoresSchemeWhenConfigured(t *testing.T) {
+	var c Crawler
+	c.Init("https://monzo.com")
+
+	if c.visitKey("http://monzo.com/about") == c.visitKey("https://monzo.com/about") {
+		t.Errorf("Expecting http and https variants to have different visit keys.")
+	}
+
+	c.ignoreScheme.Store(true)
+	if c.visitKey("http://monzo.com/about") != c.visitKey("https://monzo.com/about") {
+		t.Errorf("Expecting http and https variants to have the same visit key.")
+	}
+}
+
+// Fetcher answering every URL from https://monzo.com/home, as a site redirecting to https would
+type httpsRedirectFetcher struct{}
+
+func (f httpsRedirectFetcher) Fetch(url string) (*FetchResult, error) {
+	body := acquireBody()
+	body.WriteString("<html></html>")
+	return &FetchResult{Body: body, FinalURL: "https://monzo.com/home"}, nil
+}
+
+// Test that http and https variants are the same page once the site redirects from one to the other
+func TestFetch_followsSchemeRedirect(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		var c Crawler
+		c.Init("http://monzo.com")
+		c.fetcher = httpsRedirectFetcher{}
+		c.strictScheme = strict
+		body, _, err := c.fetch(c.baseSite)
+		if err != nil {
+			t.Fatalf("Failed to fetch (%s): %s", c.baseSite, err)
+		}
+		releaseBody(body)
+		if c.ignoreScheme.Load() == strict {
+			t.Errorf("Expecting http and https to be the same page (%v) with strictScheme (%v)", !strict, strict)
+		}
+		// Links to the https variant of the site are not crawled again
+		if _, visited := c.visited.Load(c.visitKey("https://monzo.com")); visited == strict {
+			t.Errorf("Expecting (https://monzo.com) to be visited (%v) with strictScheme (%v)", !strict, strict)
+		}
+	}
+}
+
+// Test that the fast fetcher follows redirects and returns the URL it ended up on
+func TestHTTPFetcher_fastFollowsRedirects(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		io.WriteString(w, "<html>"+r.URL.Path+"</html>")
+	}))
+	defer ts.Close()
+
+	f := &HTTPFetcher{Fast: true, Timeout: time.Second}
+	res, err := f.Fetch(ts.URL + "/old")
+	if err != nil {
+		t.Fatalf("Failed to fetch (/old): %s", err)
+	}
+	if res.FinalURL != ts.URL+"/new" || res.Body.String() != "<html>/new</html>" {
+		t.Errorf("Expecting the content of (%s/new), got (%s) from (%s)", ts.URL, res.Body.String(), res.FinalURL)
+	}
+	f.Redirect = func(url string) bool { return false }
+	if _, err := f.Fetch(ts.URL + "/old"); err != OffScopeRedirect(ts.URL+"/new") {
+		t.Errorf("Expecting the redirect to be refused, got (%v)", err)
+	}
+}
+
+// Test that /dir, /dir/ and /dir/index.html share the same visit key unless disabled
+func TestVisitKey_mergesTrailingSlashAndIndexFiles(t *testing.T) {
+	var c Crawler
+	c.Init("https://monzo.com")
+
+	key := c.visitKey("https://monzo.com/blog")
+	for _, site := range []string{"https://monzo.com/blog/", "https://monzo.com/blog/index.html"} {
+		if c.visitKey(site) != key {
+			t.Errorf("Expecting (%s) to have the same visit key as (https://monzo.com/blog)", site)
+		}
+	}
+	if c.visitKey("https://monzo.com") != c.visitKey("https://monzo.com/") {
+		t.Errorf("Expecting the root with and without a trailing slash to have the same visit key.")
+	}
+
+	c.ignoreTrailingSlash = false
+	c.indexFiles = nil
+	if c.visitKey("https://monzo.com/blog/") == key || c.visitKey("https://monzo.com/blog/index.html") == key {
+		t.Errorf("Expecting /blog, /blog/ and /blog/index.html to have different visit keys.")
+	}
+}
+
+// Test that paths only share the same visit key regardless of casing when ignoreCase is set
+func TestVisitKey_ignoresCaseWhenConfigured(t *testing.T) {
+	var c Crawler
+	c.Init("https://monzo.com")
+
+	if c.visitKey("https://monzo.com/About") == c.visitKey("https://monzo.com/about") {
+		t.Errorf("Expecting /About and /about to have different visit keys by default.")
+	}
+	if c.visitKey("https://MONZO.com/about") != c.visitKey("https://monzo.com/about") {
+		t.Errorf("Expecting host names to be case insensitive.")
+	}
+
+	c.ignoreCase = true
+	if c.visitKey("https://monzo.com/About") != c.visitKey("https://monzo.com/about") {
+		t.Errorf("Expecting /About and /about to have the same visit key.")
+	}
+}
+
+// Test that hash routes are distinct pages only when keepRouteFragments is set
+func TestVisitKey_routeFragments(t *testing.T) {
+	var c Crawler
+	c.Init("https://monzo.com")
+
+	if c.visitKey("https://monzo.com/#/a") != c.visitKey("https://monzo.com/#/b") {
+		t.Errorf("Expecting fragments to be ignored by default.")
+	}
+
+	c.keepRouteFragments = true
+	if c.visitKey("https://monzo.com/#/a") == c.visitKey("https://monzo.com/#/b") {
+		t.Errorf("Expecting hash routes to have different visit keys.")
+	}
+	if c.visitKey("https://monzo.com/faq#a") != c.visitKey("https://monzo.com/faq#b") {
+		t.Errorf("Expecting anchor fragments to be ignored.")
+	}
+}
+
+// Test that linksWithScheme only returns links with the requested scheme
+func TestLinksWithScheme(t *testing.T) {
+	links := []string{"http://monzo.com/a", "https://monzo.com/b", "http://monzo.com/c"}
+	res := testArraysMatch(t, []string{"http://monzo.com/a", "http://monzo.com/c"}, linksWithScheme(links, "http"))
+	if res != 0 {
+		t.Errorf("linksWithScheme did not return the http links.")
+	}
+}
+
 // Test that we can call PrintSitemapFlat without having called Start()
 func TestPrintSitemapFlat_doesNotCrashIfEmpty(t *testing.T) {
 	var c Crawler
@@ -236,6 +730,69 @@ func TestPrintSitemapFlattest_doesNotCrashIfEmpty(t *testing.T) {
 	c.PrintSitemapFlattest()
 }
 
+// Test that we can call PrintReport without having called Start()
+func TestPrintReport_doesNotCrashIfEmpty(t *testing.T) {
+	var c Crawler
+	c.Init("https://monzo.com")
+	c.PrintReport()
+}
+
+// Output is written to the given writer rather than stdout
+func TestWriteSitemapFlat_writesToWriter(t *testing.T) {
+	var c Crawler
+	c.Init("https://monzo.com")
+	c.sitemap.Store("https://monzo.com/a", []string{"https://monzo.com/b", "https://monzo.com/c"})
+	c.linkCounts.Store("https://monzo.com/a", map[string]int{"https://monzo.com/c": 3})
+
+	var out bytes.Buffer
+	if err := c.WriteSitemapFlat(&out); err != nil {
+		t.Fatalf("WriteSitemapFlat failed: %v", err)
+	}
+	expected := "\nhttps://monzo.com/a\n  --> https://monzo.com/b\n  --> https://monzo.com/c (x3)\n"
+	if out.String() != expected {
+		t.Errorf("Expecting (%q), got (%q)", expected, out.String())
+	}
+}
+
+// URLs are written sorted, one per line
+func TestWriteSitemapText(t *testing.T) {
+	var c Crawler
+	c.Init("https://monzo.com")
+	for _, u := range []string{"https://monzo.com/c", "https://monzo.com", "https://monzo.com/a"} {
+		c.sitemap.Store(u, []string{})
+	}
+
+	var out bytes.Buffer
+	if err := c.WritePrintMode(&out, "txt"); err != nil {
+		t.Fatalf("WriteSitemapText failed: %v", err)
+	}
+	expected := "https://monzo.com\nhttps://monzo.com/a\nhttps://monzo.com/c\n"
+	if out.String() != expected {
+		t.Errorf("Expecting (%q), got (%q)", expected, out.String())
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+// Errors writing the output are returned
+func TestWriteReport_returnsWriteErrors(t *testing.T) {
+	var c Crawler
+	c.Init("https://monzo.com")
+	c.redirects.Store("http://monzo.com", "https://monzo.com")
+	if err := c.WriteReport(failingWriter{}); err == nil {
+		t.Errorf("Expecting an error writing the report")
+	}
+	var out bytes.Buffer
+	c.WriteReport(&out)
+	if !strings.Contains(out.String(), "http://monzo.com --> https://monzo.com") {
+		t.Errorf("Report does not contain the redirect: (%s)", out.String())
+	}
+}
+
 func urlToHTMLContent(url string) (string, error) {
 	const ROOT_FOLDER string = "test-files/test_site/"
 	var fileToRead string
@@ -320,6 +877,35 @@ func TestCrawlSampleSite(t *testing.T) {
 			t.Errorf("Sitemap does not contain (page3.html) as it should.")
 		}
 
+		// Page 12 is the meta refresh target of page 11
+		if page11Children, ok := c.sitemap.Load(ts.URL + "/page11.html"); ok {
+			if i := Find(page11Children.([]string), ts.URL+"/page12.html"); i < 0 {
+				t.Errorf("page12.html is not child of page11.html as it should be.")
+			}
+		}
+		if _, ok := c.sitemap.Load(ts.URL + "/page12.html"); !ok {
+			t.Errorf("Sitemap does not contain (page12.html) as it should.")
+		}
+
+		// Page 23 is linked from the noscript block of page 2
+		if page2Children, ok := c.sitemap.Load(ts.URL + "/page2.html"); ok {
+			if i := Find(page2Children.([]string), ts.URL+"/page23.html"); i < 0 {
+				t.Errorf("page23.html is not child of page2.html as it should be.")
+			}
+		}
+		if _, ok := c.sitemap.Load(ts.URL + "/page23.html"); !ok {
+			t.Errorf("Sitemap does not contain (page23.html) as it should.")
+		}
+
+		// Page 31 and 32 are linked from the iframes embedded in page 3
+		if page3Children, ok := c.sitemap.Load(ts.URL + "/page3.html"); !ok {
+			t.Errorf("Sitemap does not contain (page3.html) as it should.")
+		} else if i := Find(page3Children.([]string), ts.URL+"/page31.html"); i < 0 {
+			t.Errorf("page31.html is not child of page3.html as it should be.")
+		} else if i := Find(page3Children.([]string), ts.URL+"/page32.html"); i < 0 {
+			t.Errorf("page32.html is not child of page3.html as it should be.")
+		}
+
 		// Page 11
 		if _, ok := c.sitemap.Load(ts.URL + "/page11.html"); !ok {
 			t.Errorf("Sitemap does not contain (page11.html) as it should.")
@@ -338,9 +924,614 @@ func TestCrawlSampleSite(t *testing.T) {
 		}
 	})
 
+	// Test that the health of the test server is tracked
+	t.Run("TestHostHealthIsRecorded", func(t *testing.T) {
+		u, _ := url.Parse(ts.URL)
+		v, ok := c.hosts.Load(u.Host)
+		if !ok {
+			t.Fatalf("Host (%s) has no health record.", u.Host)
+		}
+		h := v.(*hostHealth)
+		if h.requests == 0 {
+			t.Errorf("Expecting requests to be counted for (%s).", u.Host)
+		}
+		// pageAbsent.html is not found
+		if h.errors == 0 {
+			t.Errorf("Expecting errors to be counted for (%s).", u.Host)
+		}
+	})
+
 	// TEARDOWN
 	// --------
 
 	// Teardown here..
 
 }
+
+// Test that a page slower than fetchTimeout is recorded as a timeout and does not hold up the crawl
+func TestCrawl_recordsFetchTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow.html" {
+			time.Sleep(time.Second)
+		}
+		io.WriteString(w, `<a href="/slow.html"></a>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.fetchTimeout = 100 * time.Millisecond
+	start := time.Now()
+	c.Start()
+	c.Wait()
+
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Crawl took (%s), fetchTimeout was not applied.", elapsed)
+	}
+	if err, ok := c.fetchErrors.Load(ts.URL + "/slow.html"); !ok {
+		t.Errorf("Expecting an error for slow.html.")
+	} else if _, ok := err.(FetchTimeout); !ok {
+		t.Errorf("Expecting a FetchTimeout error for slow.html, got (%s)", err)
+	}
+}
+
+// Test that every page of a synthetic site is crawled
+func TestCrawlSyntheticSite(t *testing.T) {
+	site := &SyntheticSite{Depth: 3, Branching: 3}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.Start()
+	c.Wait()
+
+	crawled := 0
+	c.sitemap.Range(func(k, v interface{}) bool {
+		crawled++
+		return true
+	})
+	if crawled != site.Pages() {
+		t.Errorf("Expecting (%d) pages to be crawled, got (%d)", site.Pages(), crawled)
+	}
+	if _, ok := c.sitemap.Load(ts.URL + "/2/1/0"); !ok {
+		t.Errorf("Sitemap does not contain (/2/1/0) as it should.")
+	}
+}
+
+// Run blocks until the crawl is done and returns everything it found
+func TestRun_returnsResult(t *testing.T) {
+	site := &SyntheticSite{Depth: 2, Branching: 3, ErrorRate: 0.3}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// Every child found is either crawled or failed
+	crawled := make(map[string]bool)
+	for _, page := range res.Pages {
+		crawled[page.URL] = true
+	}
+	for _, page := range res.Pages {
+		for _, child := range page.Children {
+			if _, failed := res.Errors[child]; !crawled[child] && !failed {
+				t.Errorf("Child (%s) of (%s) is neither in Pages nor in Errors", child, page.URL)
+			}
+		}
+	}
+	for i := 1; i < len(res.Pages); i++ {
+		if res.Pages[i-1].URL >= res.Pages[i].URL {
+			t.Errorf("Pages are not sorted by URL: (%s) before (%s)", res.Pages[i-1].URL, res.Pages[i].URL)
+		}
+	}
+	for url, err := range res.Errors {
+		if errorCategory(err) != "server error" {
+			t.Errorf("Expecting (%s) to fail with a server error, got (%v)", url, err)
+		}
+	}
+	if res.Pages[0].URL != ts.URL || len(res.Pages[0].Children) != site.Branching {
+		t.Errorf("Expecting (%s) with (%d) children first, got (%+v)", ts.URL, site.Branching, res.Pages[0])
+	}
+	if res.Duration <= 0 {
+		t.Errorf("Duration of the crawl was not recorded")
+	}
+}
+
+// Queued sites are dropped and fetches in flight aborted once the context is done, Run returns
+// what was crawled until then
+func TestRun_stopsWhenCancelled(t *testing.T) {
+	site := &SyntheticSite{Depth: 3, Branching: 5, Latency: 100 * time.Millisecond}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.respectRobots = false
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	res, err := c.Run(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expecting (%v), got (%v)", context.DeadlineExceeded, err)
+	}
+	if len(res.Pages) == 0 || len(res.Pages) >= site.Pages() {
+		t.Errorf("Expecting part of the (%d) pages to be crawled, got (%d)", site.Pages(), len(res.Pages))
+	}
+
+	// Sites dropped are reported along with where they were found
+	if len(res.NotCrawled) == 0 {
+		t.Errorf("Expecting the sites dropped to be reported")
+	}
+	for _, page := range res.NotCrawled {
+		if page.Depth != strings.Count(strings.TrimPrefix(page.URL, ts.URL), "/") {
+			t.Errorf("Expecting (%s) to be found at depth (%d), got (%d)", page.URL,
+				strings.Count(strings.TrimPrefix(page.URL, ts.URL), "/"), page.Depth)
+		}
+		if !strings.HasPrefix(page.URL, page.Referrer+"/") {
+			t.Errorf("Expecting (%s) to be found on its parent, got (%s)", page.URL, page.Referrer)
+		}
+		if page.Reason != SKIP_BUDGET {
+			t.Errorf("Expecting (%s) to be skipped for (%s), got (%s)", page.URL, SKIP_BUDGET, page.Reason)
+		}
+	}
+}
+
+// Stop aborts the fetches in flight, Wait returns without waiting for the server to answer
+func TestStartWithContext_stop(t *testing.T) {
+	site := &SyntheticSite{Depth: 2, Branching: 5, Latency: 50 * time.Millisecond}
+	slow := time.Now()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+		site.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.respectRobots = false
+	c.StartWithContext(context.Background())
+	time.Sleep(200 * time.Millisecond)
+	c.Stop()
+	c.Wait()
+	if elapsed := time.Since(slow); elapsed > 2*time.Second {
+		t.Errorf("Expecting Wait to return once stopped, took (%s)", elapsed)
+	}
+
+	res := c.Result()
+	if len(res.Pages) != 1 || len(res.Errors) != 0 {
+		t.Errorf("Expecting only (%s) crawled and no error, got (%d) pages and (%v)", ts.URL, len(res.Pages), res.Errors)
+	}
+	if len(res.NotCrawled) != site.Branching {
+		t.Errorf("Expecting the (%d) children aborted to be reported as not crawled, got (%d)", site.Branching, len(res.NotCrawled))
+	}
+}
+
+// Run returns the error fetching the base site when nothing could be crawled
+func TestRun_failsIfBaseSiteFails(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	if _, err := c.Run(context.Background()); err == nil {
+		t.Errorf("Expecting an error crawling (%s)", ts.URL)
+	}
+}
+
+// Pages are returned a bit at a time, following the cursor until there are none left
+func TestQueryPages_paginatesAndFilters(t *testing.T) {
+	site := &SyntheticSite{Depth: 2, Branching: 4, ErrorRate: 0.3}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	res, _ := c.Run(context.Background())
+
+	// All pages and errors, each exactly once, in order
+	var all []CrawlPage
+	cursor := ""
+	for {
+		pages, next := c.QueryPages(PageQuery{Cursor: cursor, Limit: 3})
+		if len(pages) > 3 {
+			t.Fatalf("Expecting at most (3) pages, got (%d)", len(pages))
+		}
+		all = append(all, pages...)
+		if len(next) == 0 {
+			break
+		}
+		cursor = next
+	}
+	if len(all) != len(res.Pages)+len(res.Errors) {
+		t.Errorf("Expecting (%d) pages, got (%d)", len(res.Pages)+len(res.Errors), len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i-1].URL >= all[i].URL {
+			t.Errorf("Pages are not sorted by URL: (%s) before (%s)", all[i-1].URL, all[i].URL)
+		}
+	}
+
+	// Filtered by outcome and prefix
+	failed, _ := c.QueryPages(PageQuery{Status: "server error"})
+	if len(failed) != len(res.Errors) {
+		t.Errorf("Expecting (%d) server errors, got (%d)", len(res.Errors), len(failed))
+	}
+	for _, page := range failed {
+		if page.Err == nil {
+			t.Errorf("Expecting the error of (%s) to be set", page.URL)
+		}
+	}
+	expected := 0
+	for _, page := range all {
+		if page.Err == nil && strings.HasPrefix(page.URL, ts.URL+"/1/") {
+			expected++
+		}
+	}
+	if pages, _ := c.QueryPages(PageQuery{Prefix: ts.URL + "/1/", Status: "ok"}); len(pages) != expected {
+		t.Errorf("Expecting (%d) pages crawled under (/1/), got (%d)", expected, len(pages))
+	}
+
+	// Filtered by depth
+	for _, bounds := range [][2]int{{1, 1}, {2, 0}, {0, 1}} {
+		expected := 0
+		for _, page := range all {
+			if page.Depth >= bounds[0] && (bounds[1] == 0 || page.Depth <= bounds[1]) {
+				expected++
+			}
+		}
+		pages, _ := c.QueryPages(PageQuery{MinDepth: bounds[0], MaxDepth: bounds[1]})
+		if len(pages) != expected || expected == 0 {
+			t.Errorf("Expecting (%d) pages at depths (%v), got (%d)", expected, bounds, len(pages))
+		}
+		for _, page := range pages {
+			if page.Depth < bounds[0] || (bounds[1] > 0 && page.Depth > bounds[1]) {
+				t.Errorf("Expecting (%s) at depths (%v), got (%d)", page.URL, bounds, page.Depth)
+			}
+		}
+	}
+}
+
+// Only the response headers in the allowlist are kept
+func TestCrawl_capturesHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("X-Cache", "HIT")
+		w.Header().Set("Set-Cookie", "session=secret")
+		io.WriteString(w, "<html></html>")
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.captureHeaders = []string{"cache-control", "X-Cache"}
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	header := res.Pages[0].Header
+	if header.Get("Cache-Control") != "max-age=60" || header.Get("X-Cache") != "HIT" {
+		t.Errorf("Expecting the headers in the allowlist to be kept, got (%v)", header)
+	}
+	if len(header) != 2 {
+		t.Errorf("Expecting only the headers in the allowlist to be kept, got (%v)", header)
+	}
+}
+
+// Large text responses served without compression are recorded
+func TestCrawl_recordsUncompressedResponses(t *testing.T) {
+	page := "<html><a href=\"/gzipped\">Gzipped</a><a href=\"/small\">Small</a>" + strings.Repeat("<p>Monzo</p>", 200) + "</html>"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch r.URL.Path {
+		case "/gzipped":
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			io.WriteString(gz, page)
+			gz.Close()
+		case "/small":
+			io.WriteString(w, "<html></html>")
+		default:
+			io.WriteString(w, page)
+		}
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.Start()
+	c.Wait()
+
+	if size, ok := c.uncompressed.Load(ts.URL); !ok || size.(int) != len(page) {
+		t.Errorf("Expecting (%s) to be served uncompressed with (%d) bytes, got (%v)", ts.URL, len(page), size)
+	}
+	for _, u := range []string{ts.URL + "/gzipped", ts.URL + "/small"} {
+		if _, ok := c.uncompressed.Load(u); ok {
+			t.Errorf("(%s) should not be reported as served uncompressed", u)
+		}
+	}
+	if header, _ := c.headers.Load(ts.URL + "/gzipped"); header.(http.Header).Get("Content-Encoding") != "gzip" {
+		t.Errorf("Expecting the Content-Encoding of (/gzipped) to be kept, got (%v)", header)
+	}
+}
+
+// Every site found but not fetched is reported with the reason it was skipped
+func TestRun_recordsSkipReasons(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<html><a href="/about">About</a><a href="/about/">About</a>
+			<a href="/terms.pdf">Terms</a><a href="https://example.com/">Example</a></html>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	reasons := make(map[string]string)
+	for _, page := range res.NotCrawled {
+		reasons[page.URL] = page.Reason
+		if page.Depth != 1 || page.Referrer != ts.URL {
+			t.Errorf("Expecting (%s) to be found on (%s) at depth (1), got (%+v)", page.URL, ts.URL, page)
+		}
+	}
+	want := map[string]string{ts.URL + "/terms.pdf": SKIP_SUFFIX, "https://example.com/": SKIP_SCOPE}
+	for u, reason := range want {
+		if reasons[u] != reason {
+			t.Errorf("Expecting (%s) to be skipped for (%s), got (%s)", u, reason, reasons[u])
+		}
+	}
+	if reasons[ts.URL+"/about"] != SKIP_DUPLICATE && reasons[ts.URL+"/about/"] != SKIP_DUPLICATE {
+		t.Errorf("Expecting one of (/about) and (/about/) to be skipped as duplicate, got (%v)", reasons)
+	}
+}
+
+// Pages linked from many pages crawled at the same time are still fetched once
+func TestRun_fetchesEachPageOnce(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		for i := 0; i < 30; i++ {
+			fmt.Fprintf(w, `<a href="/p%d">Page %d</a>`, i, i)
+		}
+	}))
+	defer ts.Close()
+
+	for run := 0; run < 5; run++ {
+		requests = make(map[string]int)
+		var c Crawler
+		c.Init(ts.URL)
+		c.probeNotFound = false
+		c.respectRobots = false
+		// Slow filters widen the window between finding a link and scheduling it
+		c.filters = append(c.filters, FilterFunc(func(url string, depth int, referrer string) (bool, string) {
+			time.Sleep(time.Millisecond)
+			return true, ""
+		}))
+		if _, err := c.Run(context.Background()); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		mu.Lock()
+		for path, n := range requests {
+			if n != 1 {
+				t.Errorf("Expecting (%s) to be fetched once, got (%d) fetches", path, n)
+			}
+		}
+		if len(requests) != 31 {
+			t.Errorf("Expecting (31) pages to be fetched, got (%d)", len(requests))
+		}
+		if c.totalCrawls != 31 {
+			t.Errorf("Expecting (31) crawls to be counted, got (%d)", c.totalCrawls)
+		}
+		mu.Unlock()
+	}
+}
+
+// Each page records which page first pointed to it and how
+func TestRun_recordsProvenance(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			io.WriteString(w, `<html><a href="/about">About</a><iframe src="/widget"></iframe></html>`)
+		case "/about":
+			io.WriteString(w, `<html><meta http-equiv="refresh" content="0; url=/team"></html>`)
+		case "/widget":
+			io.WriteString(w, `<html><a href="/terms">Terms</a></html>`)
+		default:
+			io.WriteString(w, `<html></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	want := map[string]CrawlPage{
+		ts.URL:            {Source: SOURCE_SEED},
+		ts.URL + "/about": {Referrer: ts.URL, Depth: 1, Source: SOURCE_ANCHOR},
+		ts.URL + "/terms": {Referrer: ts.URL, Depth: 1, Source: SOURCE_FRAME},
+		ts.URL + "/team":  {Referrer: ts.URL + "/about", Depth: 2, Source: SOURCE_REDIRECT},
+	}
+	for _, page := range res.Pages {
+		w, ok := want[page.URL]
+		if !ok {
+			t.Errorf("Unexpected page (%s)", page.URL)
+			continue
+		}
+		if page.Referrer != w.Referrer || page.Depth != w.Depth || page.Source != w.Source {
+			t.Errorf("Expecting (%s) to be found on (%s) at depth (%d) by (%s), got (%s, %d, %s)",
+				page.URL, w.Referrer, w.Depth, w.Source, page.Referrer, page.Depth, page.Source)
+		}
+		delete(want, page.URL)
+	}
+	if len(want) > 0 {
+		t.Errorf("Expecting (%v) to be crawled", want)
+	}
+}
+
+// Documents embedded with iframes go through the filters like links do
+func TestRun_filtersFrames(t *testing.T) {
+	var loggedOut int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			io.WriteString(w, `<html><iframe src="/logout"></iframe><iframe src="/widget"></iframe></html>`)
+		case "/logout":
+			atomic.AddInt64(&loggedOut, 1)
+		default:
+			io.WriteString(w, `<html></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.respectRobots = false
+	res, _ := c.Run(context.Background())
+	if loggedOut != 0 {
+		t.Errorf("Expecting the trap (/logout) not to be fetched, got (%d) requests", loggedOut)
+	}
+	want := UncrawledPage{URL: ts.URL + "/logout", Referrer: ts.URL, Depth: 1, Source: SOURCE_FRAME, Reason: SKIP_TRAP}
+	if len(res.NotCrawled) != 1 || res.NotCrawled[0] != want {
+		t.Errorf("Expecting (%+v) to be skipped, got (%+v)", want, res.NotCrawled)
+	}
+}
+
+// Documents embedded with a relative src are resolved against the page embedding them
+func TestRun_relativeFrames(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/docs/":
+			io.WriteString(w, `<html><iframe src="embed.html"></iframe><iframe src="../nav.html"></iframe></html>`)
+		case "/docs/embed.html":
+			io.WriteString(w, `<html><a href="/docs/embedded">Embedded</a></html>`)
+		case "/nav.html":
+			io.WriteString(w, `<html><a href="/about">About</a></html>`)
+		default:
+			io.WriteString(w, `<html></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL + "/docs/")
+	c.probeNotFound = false
+	c.respectRobots = false
+	res, _ := c.Run(context.Background())
+	crawled := make(map[string]bool)
+	for _, page := range res.Pages {
+		crawled[page.URL] = true
+	}
+	for _, u := range []string{ts.URL + "/docs/embedded", ts.URL + "/about"} {
+		if !crawled[u] {
+			t.Errorf("Expecting (%s) linked from a relative iframe to be crawled, got (%v)", u, crawled)
+		}
+	}
+}
+
+// A document embedded by several pages is fetched once, and counted against the quota
+func TestRun_sharedFrame(t *testing.T) {
+	var navFetches int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			io.WriteString(w, `<html><a href="/a">A</a><a href="/b">B</a></html>`)
+		case "/a", "/b":
+			io.WriteString(w, `<html><iframe src="/nav.html"></iframe></html>`)
+		case "/nav.html":
+			atomic.AddInt64(&navFetches, 1)
+			io.WriteString(w, `<html><a href="/about">About</a></html>`)
+		default:
+			io.WriteString(w, `<html></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.respectRobots = false
+	res, _ := c.Run(context.Background())
+	if navFetches != 1 {
+		t.Errorf("Expecting (/nav.html) to be fetched once, got (%d)", navFetches)
+	}
+	if len(res.Pages) != 4 {
+		t.Errorf("Expecting the (4) pages to be crawled, got (%d)", len(res.Pages))
+	}
+	// Pages (/, /a, /b, /about) and the frame
+	if fetched := atomic.LoadInt64(&c.fetchedPages); fetched != 5 {
+		t.Errorf("Expecting the frame to be counted against the quota, got (%d) fetches", fetched)
+	}
+}
+
+// Time spent waiting for a fetch slot is kept apart from the time taken by HTTP.GET
+func TestRun_recordsWaitTimes(t *testing.T) {
+	site := &SyntheticSite{Depth: 1, Branching: 4, Latency: 20 * time.Millisecond}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.fetchSlots = make(chan struct{}, 1)
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	var slotTime time.Duration
+	for _, page := range res.Pages {
+		slotTime += page.Stat.slotTime
+		if page.Stat.slotTime > page.Stat.totalTime {
+			t.Errorf("Expecting the slot time of (%s) within its total time, got (%+v)", page.URL, page.Stat)
+		}
+	}
+	// The 4 children are fetched one at a time, each waiting for those before it
+	if slotTime < 3*site.Latency {
+		t.Errorf("Expecting children to wait at least (%s) for a slot overall, got (%s)", 3*site.Latency, slotTime)
+	}
+}
+
+// Benchmark crawling synthetic sites of increasing size end to end
+func BenchmarkCrawl(b *testing.B) {
+	sites := []*SyntheticSite{
+		{Depth: 2, Branching: 3},
+		{Depth: 3, Branching: 5},
+		{Depth: 4, Branching: 6},
+	}
+	for _, site := range sites {
+		b.Run(fmt.Sprintf("%dpages", site.Pages()), func(b *testing.B) {
+			ts := httptest.NewServer(site)
+			defer ts.Close()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var c Crawler
+				c.Init(ts.URL)
+				c.Start()
+				c.Wait()
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// --------------------
+// Crawl IDs
+// --------------------
+
+// Headers identifying the crawl and each of its requests, so that site owners can find
+// the traffic of a crawl in their logs. Sent when 'sendCrawlID' is set.
+const CRAWL_ID_HEADER = "X-Crawl-Id"
+const REQUEST_ID_HEADER = "X-Request-Id"
+
+// Fetcher able to send additional headers with a request
+type HeaderFetcher interface {
+	Fetcher
+	FetchWithHeader(url string, header http.Header) (*FetchResult, error)
+}
+
+// Returns a new random run ID, e.g. 3f2504e04f8911d3
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Fetcher sending the run ID of the Crawler and a new request ID with each request,
+// and recording the request ID of each URL in 'requestIDs'
+type crawlIDFetcher struct {
+	c    *Crawler
+	next HeaderFetcher
+}
+
+func (f *crawlIDFetcher) Fetch(url string) (*FetchResult, error) {
+	return f.FetchWithHeader(url, nil)
+}
+
+func (f *crawlIDFetcher) FetchWithHeader(url string, header http.Header) (*FetchResult, error) {
+	id := fmt.Sprintf("%s-%d", f.c.runID, atomic.AddInt64(&f.c.requestCount, 1))
+	f.c.requestIDs.Store(url, id)
+	with := http.Header{CRAWL_ID_HEADER: {f.c.runID}, REQUEST_ID_HEADER: {id}}
+	for name, values := range header {
+		with[name] = values
+	}
+	return f.next.FetchWithHeader(url, with)
+}
+
+// Returns the ID of the last request made for the given URL, empty if none was sent
+func (c *Crawler) requestID(site string) string {
+	if id, present := c.requestIDs.Load(site); present {
+		return id.(string)
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Each request carries the run ID and its own request ID, both recorded in the results
+func TestRun_sendsCrawlIDs(t *testing.T) {
+	var mu sync.Mutex
+	crawlIDs, requestIDs := make(map[string]bool), make(map[string]string)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		crawlIDs[r.Header.Get(CRAWL_ID_HEADER)] = true
+		requestIDs[r.URL.Path] = r.Header.Get(REQUEST_ID_HEADER)
+		mu.Unlock()
+		io.WriteString(w, `<html><a href="/about">About</a><a href="/team">Team</a></html>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.sendCrawlID = true
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if len(res.RunID) == 0 || len(crawlIDs) != 1 || !crawlIDs[res.RunID] {
+		t.Errorf("Expecting every request to carry the run ID (%s), got (%v)", res.RunID, crawlIDs)
+	}
+	seen := make(map[string]bool)
+	for _, page := range res.Pages {
+		path := strings.TrimPrefix(page.URL, ts.URL)
+		if path == "" {
+			path = "/"
+		}
+		if page.RequestID != requestIDs[path] || !strings.HasPrefix(page.RequestID, res.RunID+"-") {
+			t.Errorf("Expecting (%s) to record the request ID sent (%s), got (%s)", page.URL, requestIDs[path], page.RequestID)
+		}
+		if seen[page.RequestID] {
+			t.Errorf("Expecting request IDs to be unique, got (%s) twice", page.RequestID)
+		}
+		seen[page.RequestID] = true
+	}
+
+	// Not sent unless asked for
+	var quiet Crawler
+	quiet.Init(ts.URL)
+	quiet.probeNotFound = false
+	crawlIDs = make(map[string]bool)
+	res, _ = quiet.Run(context.Background())
+	if !crawlIDs[""] || len(crawlIDs) != 1 || len(res.Pages[0].RequestID) > 0 {
+		t.Errorf("Expecting no crawl ID to be sent by default, got (%v)", crawlIDs)
+	}
+}
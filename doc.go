@@ -0,0 +1,16 @@
+// Package crawler crawls the pages of a site, following the links local to its domain, and
+// reports its sitemap along with the problems found on the way (broken links, redirects,
+// caching, ...).
+//
+//	c, err := crawler.New("https://monzo.com", crawler.WithWorkers(4), crawler.WithQuota(crawler.Quota{Pages: 500}))
+//	if err != nil {
+//		return err
+//	}
+//	res, err := c.Run(ctx)
+//
+// Options such as WithFetcher, WithFilter and WithSink set up the crawl, see Option.
+// StartWithContext and Wait run the crawl in the background instead, Stop cancels it. The links of a page can also be
+// found on their own with FindRelativeLinks, FindAbsoluteLinks and FindExternalLinks.
+//
+// The crawler command, with its flags and subcommands, is in cmd/crawler.
+package crawler
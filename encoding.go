@@ -0,0 +1,105 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// --------------------
+// Character encoding
+// --------------------
+
+// Bytes of a page searched for its doctype and <meta> charset, browsers only look at the start
+const MAX_ENCODING_PREFIX int = 1024
+
+// <meta charset="utf-8"> and <meta http-equiv="Content-Type" content="text/html; charset=utf-8">
+var metaCharsetRe = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-z0-9_:.\-]+)`)
+
+// <!DOCTYPE html>, possibly after comments or a byte order mark
+var doctypeRe = regexp.MustCompile(`(?i)<!doctype\s+([^>]*)>`)
+
+// Other names of the same charsets, see normalizeCharset
+var charsetAliases = map[string]string{
+	"utf8":    "utf-8",
+	"latin1":  "iso-8859-1",
+	"latin-1": "iso-8859-1",
+	"ascii":   "us-ascii",
+}
+
+// Charsets and doctype declared by an HTML page
+type PageEncoding struct {
+
+	// Charset of the Content-Type header, and of the <meta> element
+	HeaderCharset string `json:"header_charset"`
+	MetaCharset   string `json:"meta_charset"`
+
+	// e.g. "html", empty if the page has none
+	Doctype string `json:"doctype"`
+}
+
+func normalizeCharset(charset string) string {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if alias, present := charsetAliases[charset]; present {
+		return alias
+	}
+	return charset
+}
+
+// Returns the encoding declared by the given response of an HTML page
+func pageEncoding(header http.Header, html []byte) PageEncoding {
+	var e PageEncoding
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil {
+		e.HeaderCharset = normalizeCharset(params["charset"])
+	}
+	prefix := html
+	if len(prefix) > MAX_ENCODING_PREFIX {
+		prefix = prefix[:MAX_ENCODING_PREFIX]
+	}
+	if m := metaCharsetRe.FindSubmatch(prefix); m != nil {
+		e.MetaCharset = normalizeCharset(string(m[1]))
+	}
+	if m := doctypeRe.FindSubmatch(prefix); m != nil {
+		e.Doctype = strings.ToLower(strings.Join(strings.Fields(string(m[1])), " "))
+	}
+	return e
+}
+
+// Returns what is wrong with the encoding of the page, none if nothing
+func (e PageEncoding) Problems() []string {
+	var problems []string
+	switch {
+	case len(e.HeaderCharset) == 0 && len(e.MetaCharset) == 0:
+		problems = append(problems, "no charset declared")
+	case len(e.HeaderCharset) > 0 && len(e.MetaCharset) > 0 && e.HeaderCharset != e.MetaCharset:
+		problems = append(problems, fmt.Sprintf("conflicting charsets (%s in Content-Type, %s in <meta>)",
+			e.HeaderCharset, e.MetaCharset))
+	}
+	if len(e.Doctype) == 0 {
+		problems = append(problems, "no doctype")
+	}
+	return problems
+}
+
+// Returns true if the given response is an HTML page, or likely one when it has no Content-Type
+func isHTMLResponse(header http.Header, body []byte) bool {
+	if contentType := header.Get("Content-Type"); len(contentType) > 0 {
+		return strings.Contains(strings.ToLower(contentType), "html")
+	}
+	return bytes.Contains(bytes.ToLower(body[:min(len(body), MAX_ENCODING_PREFIX)]), []byte("<html"))
+}
+
+// Returns the pages whose encoding has problems and what they are, see PageEncoding.Problems
+func (c *Crawler) encodingProblems() map[string][]string {
+	problems := make(map[string][]string)
+	c.encodings.Range(func(k, v interface{}) bool {
+		if p := v.(PageEncoding).Problems(); len(p) > 0 {
+			problems[k.(string)] = p
+		}
+		return true
+	})
+	return problems
+}
@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPageEncoding(t *testing.T) {
+	tests := []struct {
+		contentType string
+		html        string
+		want        PageEncoding
+		problems    int
+	}{
+		{"text/html; charset=UTF-8", `<!DOCTYPE html><html><head><meta charset="utf8">`,
+			PageEncoding{HeaderCharset: "utf-8", MetaCharset: "utf-8", Doctype: "html"}, 0},
+		{"text/html", `<!doctype HTML><meta http-equiv="Content-Type" content="text/html; charset=iso-8859-1">`,
+			PageEncoding{MetaCharset: "iso-8859-1", Doctype: "html"}, 0},
+		{"text/html; charset=utf-8", `<html><meta charset='windows-1252'>`,
+			PageEncoding{HeaderCharset: "utf-8", MetaCharset: "windows-1252"}, 2},
+		{"text/html", `<html><body>No charset</body></html>`, PageEncoding{}, 2},
+	}
+	for _, test := range tests {
+		header := http.Header{"Content-Type": {test.contentType}}
+		got := pageEncoding(header, []byte(test.html))
+		if got != test.want {
+			t.Errorf("Expecting (%+v) for (%s), got (%+v)", test.want, test.html, got)
+		}
+		if problems := got.Problems(); len(problems) != test.problems {
+			t.Errorf("Expecting (%d) problems for (%s), got (%v)", test.problems, test.html, problems)
+		}
+	}
+
+	// Only the start of the page is looked at, like browsers do
+	late := "<!DOCTYPE html>" + strings.Repeat(" ", MAX_ENCODING_PREFIX) + `<meta charset="utf-8">`
+	if got := pageEncoding(http.Header{}, []byte(late)); len(got.MetaCharset) > 0 {
+		t.Errorf("Expecting no charset past the first (%d) bytes, got (%s)", MAX_ENCODING_PREFIX, got.MetaCharset)
+	}
+}
+
+func TestCrawlEncodingReport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/legacy":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, `<html><meta charset="iso-8859-1"></html>`)
+		case "/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			io.WriteString(w, `body {}`)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, `<!DOCTYPE html><html><a href="/legacy">Legacy</a><a href="/style.css">Style</a></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.Run(context.Background())
+
+	problems := c.encodingProblems()
+	if len(problems) != 1 || len(problems[ts.URL+"/legacy"]) != 2 {
+		t.Errorf("Expecting (2) problems for /legacy only, got (%v)", problems)
+	}
+	var report bytes.Buffer
+	c.WriteReport(&report)
+	if want := ts.URL + "/legacy: conflicting charsets (utf-8 in Content-Type, iso-8859-1 in <meta>); no doctype"; !strings.Contains(report.String(), want) {
+		t.Errorf("Expecting (%s) in the report, got (%s)", want, report.String())
+	}
+}
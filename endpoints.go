@@ -0,0 +1,126 @@
+package crawler
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// --------------------
+// Sampled endpoints
+// --------------------
+
+// Number of URLs of a search or parameterized template crawled unless told otherwise
+const DEFAULT_SAMPLE_SIZE int = 50
+
+// Kinds of endpoints whose URLs are sampled, see endpointKind
+const (
+	ENDPOINT_SEARCH        = "search"
+	ENDPOINT_PARAMETERIZED = "parameterized"
+)
+
+// Path segments and query parameters of internal search result pages
+var searchSegments = map[string]bool{"search": true, "find": true, "results": true}
+var searchParams = map[string]bool{"q": true, "query": true, "s": true, "search": true, "keyword": true,
+	"keywords": true, "term": true, "text": true}
+
+// Returns search for internal search result pages, parameterized for other URLs with a query,
+// whose values may be unbounded (filters, sorting, calendars), and empty for the others
+func endpointKind(site string) string {
+	u, err := url.Parse(site)
+	if err != nil {
+		return ""
+	}
+	query := u.Query()
+	for name := range query {
+		if searchParams[strings.ToLower(name)] {
+			return ENDPOINT_SEARCH
+		}
+	}
+	for _, segment := range strings.Split(strings.ToLower(u.Path), "/") {
+		if searchSegments[segment] {
+			return ENDPOINT_SEARCH
+		}
+	}
+	if len(query) > 0 {
+		return ENDPOINT_PARAMETERIZED
+	}
+	return ""
+}
+
+// URLs of a template seen so far, see endpointSampler
+type sampledEndpoint struct {
+	kind    string
+	sampled map[string]bool
+
+	// URLs not crawled, beyond the sample
+	dropped map[string]bool
+}
+
+// Stops expanding search pages and parameterized endpoints once 'size' URLs of their
+// template were found, so that a search box or a calendar does not take the whole crawl.
+// Each template is reported instead, see SampledEndpoint.
+type endpointSampler struct {
+	mu   sync.Mutex
+	size int
+
+	// string --> *sampledEndpoint, by urlTemplate
+	endpoints map[string]*sampledEndpoint
+}
+
+// Returns true if the given URL is within the sample of its template
+func (s *endpointSampler) allow(site string) bool {
+	if s.size <= 0 {
+		return true
+	}
+	kind := endpointKind(site)
+	if len(kind) == 0 {
+		return true
+	}
+	template := urlTemplate(site)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.endpoints == nil {
+		s.endpoints = make(map[string]*sampledEndpoint)
+	}
+	e, present := s.endpoints[template]
+	if !present {
+		e = &sampledEndpoint{kind: kind, sampled: make(map[string]bool), dropped: make(map[string]bool)}
+		s.endpoints[template] = e
+	}
+	if e.sampled[site] || len(e.sampled) < s.size {
+		e.sampled[site] = true
+		return true
+	}
+	e.dropped[site] = true
+	return false
+}
+
+// Template of which only a sample of URLs were crawled
+type SampledEndpoint struct {
+	Template string `json:"template"`
+	Kind     string `json:"kind"`
+	Sampled  int    `json:"sampled"`
+	Dropped  int    `json:"dropped"`
+}
+
+// Returns the templates whose URLs were not all crawled, those dropping most first
+func (s *endpointSampler) sampledEndpoints() []SampledEndpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var endpoints []SampledEndpoint
+	for template, e := range s.endpoints {
+		if len(e.dropped) > 0 {
+			endpoints = append(endpoints, SampledEndpoint{Template: template, Kind: e.kind, Sampled: len(e.sampled), Dropped: len(e.dropped)})
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Dropped != endpoints[j].Dropped {
+			return endpoints[i].Dropped > endpoints[j].Dropped
+		}
+		return endpoints[i].Template < endpoints[j].Template
+	})
+	return endpoints
+}
@@ -0,0 +1,68 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEndpointKind(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://monzo.com/search?q=card", ENDPOINT_SEARCH},
+		{"https://monzo.com/help?query=card", ENDPOINT_SEARCH},
+		{"https://monzo.com/search/card", ENDPOINT_SEARCH},
+		{"https://monzo.com/events?date=2019-01-01", ENDPOINT_PARAMETERIZED},
+		{"https://monzo.com/blog/2019/research", ""},
+		{"https://monzo.com/about", ""},
+	}
+	for _, test := range tests {
+		if got := endpointKind(test.url); got != test.want {
+			t.Errorf("Expecting (%s) to be (%s), got (%s)", test.url, test.want, got)
+		}
+	}
+}
+
+// A calendar linking to the next day forever is only crawled up to the sample size
+func TestCrawlSampledEndpoints(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		day := 0
+		fmt.Sscanf(r.URL.Query().Get("day"), "%d", &day)
+		base := "http://" + r.Host
+		fmt.Fprintf(w, `<html><a href="%s/calendar?day=%d">Next</a><a href="%s/calendar?day=%d">Next week</a>`, base, day+1, base, day+7)
+		io.WriteString(w, `<a href="/about">About</a></html>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.sampler.size = 5
+	c.Run(context.Background())
+
+	calendar := 0
+	for _, page := range c.Result().Pages {
+		if strings.Contains(page.URL, "/calendar") {
+			calendar++
+		}
+	}
+	if calendar != 5 {
+		t.Errorf("Expecting (5) calendar pages crawled, got (%d)", calendar)
+	}
+	endpoints := c.sampler.sampledEndpoints()
+	if len(endpoints) != 1 || endpoints[0].Template != "/calendar?day=" || endpoints[0].Kind != ENDPOINT_PARAMETERIZED {
+		t.Fatalf("Expecting the calendar to be reported, got (%+v)", endpoints)
+	}
+	var report bytes.Buffer
+	c.WriteReport(&report)
+	if !strings.Contains(report.String(), "/calendar?day= (parameterized): 5 crawled") {
+		t.Errorf("Expecting the report to list the calendar, got (%s)", report.String())
+	}
+}
@@ -0,0 +1,141 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// --------------------
+// ETag aliases
+// --------------------
+
+// Number of ETags of a host sent with If-None-Match, the most recently seen
+const MAX_ALIAS_ETAGS int = 16
+
+// A URL serving the same resource as another one already fetched, recorded in place of
+// fetching and crawling it again when 'etagAliases' is set
+type ResourceAlias struct {
+	URL string
+	Of  string
+}
+
+func (e ResourceAlias) Error() string {
+	return fmt.Sprintf("URL (%s) serves the same resource as (%s).", e.URL, e.Of)
+}
+
+// Response of 304 Not Modified, to a request sent with If-None-Match
+type NotModified string
+
+func (e NotModified) Error() string {
+	return fmt.Sprintf("Not modified for URL (%s).", string(e))
+}
+
+// Resource first fetched with a given ETag
+type etagResource struct {
+	URL  string
+	Size int
+}
+
+// Strong ETags seen on a host, weak ones (W/"..") do not promise the same bytes
+type hostETags struct {
+	mu     sync.Mutex
+	byETag map[string]etagResource
+
+	// ETags in the order they were first seen
+	order []string
+}
+
+// Returns the ETags of the host of the given URL
+func (c *Crawler) hostETags(site string) *hostETags {
+	host := site
+	if u, err := url.Parse(site); err == nil {
+		host = u.Host
+	}
+	v, _ := c.etags.LoadOrStore(host, &hostETags{byETag: make(map[string]etagResource)})
+	return v.(*hostETags)
+}
+
+// Returns the If-None-Match header listing the ETags last seen on the host of the given URL,
+// empty if there are none
+func (c *Crawler) ifNoneMatch(site string) string {
+	h := c.hostETags(site)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	recent := h.order
+	if len(recent) > MAX_ALIAS_ETAGS {
+		recent = recent[len(recent)-MAX_ALIAS_ETAGS:]
+	}
+	return strings.Join(recent, ", ")
+}
+
+// Records the ETag of a response of the given size fetched from site. Returns the URL first
+// fetched with the same ETag and size, empty if it is the first or the ETag is weak.
+func (c *Crawler) recordETag(site string, etag string, size int) string {
+	if len(etag) == 0 || strings.HasPrefix(etag, "W/") {
+		return ""
+	}
+	h := c.hostETags(site)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if r, present := h.byETag[etag]; present {
+		if r.URL != site && (size < 0 || r.Size == size) {
+			return r.URL
+		}
+		return ""
+	}
+	h.byETag[etag] = etagResource{URL: site, Size: size}
+	h.order = append(h.order, etag)
+	return ""
+}
+
+// Fetches the given URL asking the server whether it serves one of the resources of its host
+// already fetched. Returns the error ResourceAlias when it does.
+func (c *Crawler) fetchOrAlias(site string) (*FetchResult, error) {
+	f := c.fetcherOrDefault()
+	hf, ok := f.(HeaderFetcher)
+	inm := c.ifNoneMatch(site)
+	if !ok || len(inm) == 0 {
+		res, err := f.Fetch(site)
+		return c.aliasOf(site, res, err)
+	}
+	res, err := hf.FetchWithHeader(site, http.Header{"If-None-Match": {inm}})
+	if _, notModified := err.(NotModified); notModified {
+		// Only the ETag echoed by the server tells which resource it is
+		if res != nil && res.Header != nil {
+			if original := c.recordETag(site, res.Header.Get("ETag"), -1); len(original) > 0 {
+				return res, ResourceAlias{URL: site, Of: original}
+			}
+		}
+		res, err = f.Fetch(site)
+	}
+	return c.aliasOf(site, res, err)
+}
+
+// Returns the given result of fetching site, or ResourceAlias if another URL served it already
+func (c *Crawler) aliasOf(site string, res *FetchResult, err error) (*FetchResult, error) {
+	if err != nil || res.Header == nil {
+		return res, err
+	}
+	if original := c.recordETag(site, res.Header.Get("ETag"), res.Body.Len()); len(original) > 0 {
+		releaseBody(res.Body)
+		return &FetchResult{GetTime: res.GetTime}, ResourceAlias{URL: site, Of: original}
+	}
+	return res, nil
+}
+
+// Returns the URLs recorded as aliases of each resource, sorted
+func (c *Crawler) resourceAliases() map[string][]string {
+	aliases := make(map[string][]string)
+	c.aliases.Range(func(k, v interface{}) bool {
+		aliases[v.(string)] = append(aliases[v.(string)], k.(string))
+		return true
+	})
+	for _, urls := range aliases {
+		sort.Strings(urls)
+	}
+	return aliases
+}
@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The same stylesheet served under several paths is only transferred once
+func TestCrawlETagAliases(t *testing.T) {
+	var mu sync.Mutex
+	transferred := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/static/") || strings.HasPrefix(r.URL.Path, "/assets/") {
+			w.Header().Set("ETag", `"site-css"`)
+			if strings.Contains(r.Header.Get("If-None-Match"), `"site-css"`) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			mu.Lock()
+			transferred++
+			mu.Unlock()
+			io.WriteString(w, "body { color: red }")
+			return
+		}
+		io.WriteString(w, `<html><a href="/static/site.css">A</a><a href="/about">About</a></html>`)
+		if r.URL.Path == "/about" {
+			// Found once the first stylesheet was fetched
+			time.Sleep(50 * time.Millisecond)
+			io.WriteString(w, `<a href="/assets/site.css">B</a><a href="/assets/v2/site.css">C</a>`)
+		}
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.etagAliases = true
+	c.Run(context.Background())
+
+	aliases := c.resourceAliases()
+	want := map[string][]string{ts.URL + "/static/site.css": {ts.URL + "/assets/site.css", ts.URL + "/assets/v2/site.css"}}
+	if transferred != 1 || !reflect.DeepEqual(aliases, want) {
+		t.Errorf("Expecting the stylesheet transferred once and (%v) aliases, got (%d) and (%v)", want, transferred, aliases)
+	}
+	var report bytes.Buffer
+	c.WriteReport(&report)
+	if !strings.Contains(report.String(), ts.URL+"/static/site.css: "+ts.URL+"/assets/site.css") {
+		t.Errorf("Expecting the report to list the aliases, got (%s)", report.String())
+	}
+}
+
+// Weak ETags, or the same ETag with another size, are not aliases
+func TestRecordETag(t *testing.T) {
+	var c Crawler
+	c.Init("https://monzo.com")
+	if original := c.recordETag("https://monzo.com/a", `W/"x"`, 10); original != "" {
+		t.Errorf("Expecting weak ETags to be ignored, got (%s)", original)
+	}
+	c.recordETag("https://monzo.com/a", `"x"`, 10)
+	if original := c.recordETag("https://monzo.com/b", `"x"`, 11); original != "" {
+		t.Errorf("Expecting another size not to be an alias, got (%s)", original)
+	}
+	if original := c.recordETag("https://monzo.com/c", `"x"`, 10); original != "https://monzo.com/a" {
+		t.Errorf("Expecting (https://monzo.com/a), got (%s)", original)
+	}
+	if original := c.recordETag("https://example.com/c", `"x"`, 10); original != "" {
+		t.Errorf("Expecting ETags of other hosts to be ignored, got (%s)", original)
+	}
+	if inm := c.ifNoneMatch("https://monzo.com/d"); inm != `"x"` {
+		t.Errorf("Expecting (\"x\"), got (%s)", inm)
+	}
+}
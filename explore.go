@@ -0,0 +1,230 @@
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --------------------
+// Explore
+// --------------------
+
+// Maximum number of URLs listed at once by the explore subcommand
+const MAX_EXPLORE_LISTED = 50
+
+// Pages of a saved crawl linked to each other, both ways
+type crawlGraph struct {
+	pages map[string]streamedPage
+
+	// Pages linking to each page
+	parents map[string][]string
+
+	// URLs of all pages, sorted
+	urls []string
+}
+
+// Returns the graph of the given streamed pages. A page written several times, e.g. skipped
+// before being crawled, is kept as crawled.
+func newCrawlGraph(streamed []streamedPage) *crawlGraph {
+	g := &crawlGraph{pages: make(map[string]streamedPage), parents: make(map[string][]string)}
+	for _, p := range streamed {
+		if old, present := g.pages[p.URL]; present && old.outcome() == "ok" {
+			continue
+		}
+		g.pages[p.URL] = p
+	}
+	for u, p := range g.pages {
+		g.urls = append(g.urls, u)
+		for _, child := range p.Children {
+			g.parents[child] = append(g.parents[child], u)
+		}
+	}
+	sort.Strings(g.urls)
+	for _, parents := range g.parents {
+		sort.Strings(parents)
+	}
+	return g
+}
+
+// Returns the pages of the graph, sorted by URL
+func (g *crawlGraph) sorted() []streamedPage {
+	pages := make([]streamedPage, len(g.urls))
+	for i, u := range g.urls {
+		pages[i] = g.pages[u]
+	}
+	return pages
+}
+
+// Returns ok, the error or why the page was skipped, e.g. error: not found or skipped: suffix
+func (p streamedPage) outcome() string {
+	switch {
+	case len(p.Category) > 0:
+		return "error: " + p.Category
+	case len(p.Error) > 0:
+		return "error: " + p.Error
+	case len(p.Skipped) > 0:
+		return "skipped: " + p.Skipped
+	}
+	return "ok"
+}
+
+// Interactive navigation of a crawlGraph, one command per line
+type Explorer struct {
+	g   *crawlGraph
+	out io.Writer
+
+	// Page shown, and those shown before it
+	current string
+	history []string
+
+	// URLs last listed, opened by their number
+	listed []string
+}
+
+// Returns an Explorer of the given pages of a saved crawl writing to out. Tells how many pages
+// were loaded and shows the seed of the crawl, if any, to start from.
+func NewExplorer(pages []streamedPage, out io.Writer) *Explorer {
+	g := newCrawlGraph(pages)
+	e := &Explorer{g: g, out: out}
+	fmt.Fprintf(e.out, "%d pages loaded, type help for the commands.\n", len(g.urls))
+	for _, p := range pages {
+		if p.Source == SOURCE_SEED && p.Depth == 0 {
+			e.open(p.URL)
+			break
+		}
+	}
+	return e
+}
+
+const exploreHelp = `Commands:
+  search <text>      list the URLs containing text
+  status <outcome>   list the URLs with the given outcome: ok, error, skipped, or a reason such as suffix
+  open <url|n>       show a page, by URL or by its number in the last list
+  <n>                same as open <n>
+  children           list the children of the page shown
+  parents            list the pages linking to the page shown
+  back               show the page shown before
+  help               show this help
+  quit               leave
+`
+
+// Lists the given URLs, numbered so that they can be opened
+func (e *Explorer) list(urls []string) {
+	e.listed = urls
+	if len(urls) == 0 {
+		fmt.Fprintln(e.out, "  none")
+		return
+	}
+	for i, u := range urls {
+		if i == MAX_EXPLORE_LISTED {
+			fmt.Fprintf(e.out, "  ... %d more\n", len(urls)-i)
+			break
+		}
+		outcome := "not in the crawl"
+		if p, present := e.g.pages[u]; present {
+			outcome = p.outcome()
+		}
+		fmt.Fprintf(e.out, "  %3d %s (%s)\n", i+1, u, outcome)
+	}
+}
+
+// Shows the given page and makes it the current one
+func (e *Explorer) open(u string) {
+	p, present := e.g.pages[u]
+	if !present {
+		fmt.Fprintf(e.out, "Unknown page (%s)\n", u)
+		return
+	}
+	if len(e.current) > 0 && e.current != u {
+		e.history = append(e.history, e.current)
+	}
+	e.current = u
+	fmt.Fprintf(e.out, "%s\n  outcome:  %s\n  depth:    %d\n", p.URL, p.outcome(), p.Depth)
+	if len(p.Referrer) > 0 {
+		fmt.Fprintf(e.out, "  found on: %s (%s)\n", p.Referrer, p.Source)
+	}
+	fmt.Fprintf(e.out, "  %d children, %d parents, %d external links\n", len(p.Children), len(e.g.parents[u]), len(p.ExternalLinks))
+}
+
+// Runs the given command line, returns false once told to quit
+func (e *Explorer) run(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+	command, arg := fields[0], strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), fields[0]))
+	if _, err := strconv.Atoi(command); err == nil {
+		command, arg = "open", command
+	}
+
+	switch command {
+	case "search":
+		var found []string
+		for _, u := range e.g.urls {
+			if strings.Contains(u, arg) {
+				found = append(found, u)
+			}
+		}
+		e.list(found)
+	case "status":
+		var found []string
+		for _, u := range e.g.urls {
+			outcome := e.g.pages[u].outcome()
+			if strings.HasPrefix(outcome, arg) || outcome == "skipped: "+arg {
+				found = append(found, u)
+			}
+		}
+		e.list(found)
+	case "open":
+		if n, err := strconv.Atoi(arg); err == nil {
+			if n < 1 || n > len(e.listed) {
+				fmt.Fprintf(e.out, "No page (%d) in the last list\n", n)
+				return true
+			}
+			arg = e.listed[n-1]
+		}
+		e.open(arg)
+	case "children", "parents":
+		if len(e.current) == 0 {
+			fmt.Fprintln(e.out, "No page shown, open one first")
+			return true
+		}
+		if command == "children" {
+			e.list(e.g.pages[e.current].Children)
+		} else {
+			e.list(e.g.parents[e.current])
+		}
+	case "back":
+		if len(e.history) == 0 {
+			fmt.Fprintln(e.out, "No page shown before")
+			return true
+		}
+		previous := e.history[len(e.history)-1]
+		e.history, e.current = e.history[:len(e.history)-1], ""
+		e.open(previous)
+	case "help":
+		fmt.Fprint(e.out, exploreHelp)
+	case "quit", "exit":
+		return false
+	default:
+		fmt.Fprintf(e.out, "Unknown command (%s), see help\n", command)
+	}
+	return true
+}
+
+// Runs the commands read from in until it ends or quit, prompting for each when prompt is set
+func (e *Explorer) Run(in io.Reader, prompt bool) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		if prompt {
+			fmt.Fprint(e.out, "> ")
+		}
+		if !scanner.Scan() || !e.run(scanner.Text()) {
+			return scanner.Err()
+		}
+	}
+}
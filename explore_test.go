@@ -0,0 +1,50 @@
+package crawler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Pages are searched, filtered by outcome and navigated through their links
+func TestExplorer(t *testing.T) {
+	g := newCrawlGraph([]streamedPage{
+		{URL: "https://monzo.com/old", Skipped: SKIP_SUFFIX},
+		{URL: "https://monzo.com", Source: SOURCE_SEED, Children: []string{"https://monzo.com/about", "https://monzo.com/old"}},
+		{URL: "https://monzo.com/about", Referrer: "https://monzo.com", Source: SOURCE_ANCHOR, Depth: 1,
+			Children: []string{"https://monzo.com/gone"}},
+		{URL: "https://monzo.com/gone", Error: "Not found", Referrer: "https://monzo.com/about", Depth: 2},
+		// Written again once crawled, e.g. after a skipped duplicate
+		{URL: "https://monzo.com/about", Skipped: SKIP_DUPLICATE},
+	})
+
+	var out bytes.Buffer
+	e := &Explorer{g: g, out: &out}
+	session := []struct {
+		command string
+		want    string
+	}{
+		{"search about", "1 https://monzo.com/about (ok)"},
+		{"1", "found on: https://monzo.com (anchor)"},
+		{"children", "1 https://monzo.com/gone (error: Not found)"},
+		{"parents", "1 https://monzo.com (ok)"},
+		{"open https://monzo.com", "2 children, 0 parents"},
+		{"back", "https://monzo.com/about\n"},
+		{"status skipped", "1 https://monzo.com/old (skipped: suffix)"},
+		{"status error", "https://monzo.com/gone"},
+		{"7", "No page (7) in the last list"},
+		{"jump", "Unknown command (jump)"},
+	}
+	for _, step := range session {
+		out.Reset()
+		if !e.run(step.command) {
+			t.Fatalf("Expecting (%s) not to quit", step.command)
+		}
+		if !strings.Contains(out.String(), step.want) {
+			t.Errorf("Expecting (%s) to show (%s), got (%s)", step.command, step.want, out.String())
+		}
+	}
+	if e.run("quit") {
+		t.Errorf("Expecting quit to stop exploring")
+	}
+}
@@ -0,0 +1,269 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// --------------------
+// Extractors
+// --------------------
+
+var startTagRe = regexp.MustCompile("<([a-zA-Z][a-zA-Z0-9-]*)(\\s[^>]*)?>")
+var attributeRe = regexp.MustCompile("([a-zA-Z_:][-a-zA-Z0-9_:.]*)(?:\\s*=\\s*(?:\"([^\"]*)\"|'([^']*)'|([^\\s\"'>]+)))?")
+var anyTagRe = regexp.MustCompile("<[^>]*>")
+var selectorPartRe = regexp.MustCompile("^([a-zA-Z0-9*-]*)((?:[#.][-_a-zA-Z0-9]+)*)((?:\\[[^\\]]+\\])*)(?:@([-_:a-zA-Z0-9]+))?$")
+var xpathRe = regexp.MustCompile("^//([a-zA-Z0-9*-]+)((?:\\[@[-_:a-zA-Z0-9]+\\s*=\\s*['\"][^'\"]*['\"]\\])*)(?:/@([-_:a-zA-Z0-9]+)|/text\\(\\))?$")
+var xpathPredicateRe = regexp.MustCompile("\\[@([-_:a-zA-Z0-9]+)\\s*=\\s*['\"]([^'\"]*)['\"]\\]")
+var selectorIDClassRe = regexp.MustCompile("[#.][^#.]+")
+var selectorAttrRe = regexp.MustCompile("\\[([^=\\]]+)(?:=[\"']?([^\"'\\]]*)[\"']?)?\\]")
+
+// Captures values from the HTML of each page crawled, e.g. the price of a product.
+// Elements are matched by a simple selector, without combinators:
+//
+//	span.price                  text of <span class="price">
+//	meta[name=author]@content   content attribute of <meta name="author">
+//	//span[@class='price']      same as span.price, written as XPath
+//	//meta[@name='author']/@content
+//
+// The text of an element ends at its closing tag, or is empty if it has none.
+type Extractor struct {
+	Name string
+
+	// Tag of the elements matched, any when empty
+	tag string
+
+	// Attributes the elements must have, with their value, any value when empty
+	attrs map[string]string
+
+	// Classes the elements must have among others (span.price)
+	classes []string
+
+	// Attribute captured, the text of the element when empty
+	capture string
+}
+
+// Returns the extractor named name capturing what expr selects, as a CSS selector or XPath
+func ParseExtractor(name string, expr string) (*Extractor, error) {
+	e := &Extractor{Name: name, attrs: make(map[string]string)}
+	expr = strings.TrimSpace(expr)
+
+	if strings.HasPrefix(expr, "/") {
+		m := xpathRe.FindStringSubmatch(expr)
+		if m == nil {
+			return nil, fmt.Errorf("Unsupported XPath (%s)", expr)
+		}
+		e.tag, e.capture = m[1], m[3]
+		for _, p := range xpathPredicateRe.FindAllStringSubmatch(m[2], -1) {
+			e.attrs[strings.ToLower(p[1])] = p[2]
+		}
+	} else {
+		m := selectorPartRe.FindStringSubmatch(expr)
+		if m == nil || len(expr) == 0 {
+			return nil, fmt.Errorf("Unsupported selector (%s)", expr)
+		}
+		e.tag, e.capture = m[1], m[4]
+		for _, part := range selectorIDClassRe.FindAllString(m[2], -1) {
+			if part[0] == '#' {
+				e.attrs["id"] = part[1:]
+			} else {
+				e.classes = append(e.classes, part[1:])
+			}
+		}
+		for _, a := range selectorAttrRe.FindAllStringSubmatch(m[3], -1) {
+			e.attrs[strings.ToLower(strings.TrimSpace(a[1]))] = a[2]
+		}
+	}
+	if e.tag == "*" {
+		e.tag = ""
+	}
+	e.tag = strings.ToLower(e.tag)
+	e.capture = strings.ToLower(e.capture)
+	return e, nil
+}
+
+// Returns the attributes of a start tag, by lowercase name
+func parseAttributes(attrs string) map[string]string {
+	parsed := make(map[string]string)
+	for _, m := range attributeRe.FindAllStringSubmatch(attrs, -1) {
+		parsed[strings.ToLower(m[1])] = html.UnescapeString(m[2] + m[3] + m[4])
+	}
+	return parsed
+}
+
+// Returns true if an element with the given tag and attributes is selected by e
+func (e *Extractor) matches(tag string, attrs map[string]string) bool {
+	if len(e.tag) > 0 && e.tag != tag {
+		return false
+	}
+	for name, want := range e.attrs {
+		if got, present := attrs[name]; !present || (len(want) > 0 && got != want) {
+			return false
+		}
+	}
+	classes := strings.Fields(attrs["class"])
+	for _, want := range e.classes {
+		found := false
+		for _, class := range classes {
+			found = found || class == want
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Elements that never have content nor closing tag
+var voidElements = map[string]bool{"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true,
+	"img": true, "input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true}
+
+// Returns the index in lower, the lowercase html, of the closing tag of the element with the
+// given tag whose content starts at start. Elements of the same tag nested in it are skipped.
+// Returns -1 if it is never closed.
+func closingTag(lower []byte, start int, tag string) int {
+	open, close := []byte("<"+tag), []byte("</"+tag)
+	depth := 0
+	for i := start; i < len(lower); {
+		next := bytes.IndexByte(lower[i:], '<')
+		if next < 0 {
+			return -1
+		}
+		i += next
+		if bytes.HasPrefix(lower[i:], close) {
+			if depth == 0 {
+				return i
+			}
+			depth--
+		} else if bytes.HasPrefix(lower[i:], open) && i+len(open) < len(lower) {
+			if ch := lower[i+len(open)]; ch == '>' || ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' {
+				depth++
+			}
+		}
+		i++
+	}
+	return -1
+}
+
+// Calls f with the attributes and the bounds of the content of each element of page selected by e,
+// in document order. The content is empty for elements that are never closed.
+func (e *Extractor) elements(page []byte, f func(attrs map[string]string, start int, end int)) {
+	var lower []byte
+	for _, m := range startTagRe.FindAllSubmatchIndex(page, -1) {
+		tag := strings.ToLower(string(page[m[2]:m[3]]))
+		var attrs map[string]string
+		if m[4] >= 0 {
+			attrs = parseAttributes(string(page[m[4]:m[5]]))
+		}
+		if !e.matches(tag, attrs) {
+			continue
+		}
+		if lower == nil {
+			lower = bytes.ToLower(page)
+		}
+		end := m[1]
+		if page[m[1]-2] != '/' && !voidElements[tag] {
+			if i := closingTag(lower, m[1], tag); i >= 0 {
+				end = i
+			}
+		}
+		f(attrs, m[1], end)
+	}
+}
+
+// Returns the values captured by e in the given html, in document order
+func (e *Extractor) Extract(page []byte) []string {
+	var values []string
+	e.elements(page, func(attrs map[string]string, start int, end int) {
+		if len(e.capture) > 0 {
+			if v, present := attrs[e.capture]; present {
+				values = append(values, v)
+			}
+			return
+		}
+		text := html.UnescapeString(anyTagRe.ReplaceAllString(string(page[start:end]), " "))
+		if text = strings.Join(strings.Fields(text), " "); len(text) > 0 {
+			values = append(values, text)
+		}
+	})
+	return values
+}
+
+// Registers an extractor named name capturing what expr selects on each page, see Extractor
+func (c *Crawler) AddExtractor(name string, expr string) error {
+	e, err := ParseExtractor(name, expr)
+	if err != nil {
+		return err
+	}
+	c.extractors = append(c.extractors, e)
+	return nil
+}
+
+// Returns the values captured by the extractors of the Crawler in the given html, by name
+func (c *Crawler) extract(page []byte) map[string][]string {
+	extracted := make(map[string][]string)
+	for _, e := range c.extractors {
+		if values := e.Extract(page); len(values) > 0 {
+			extracted[e.Name] = values
+		}
+	}
+	return extracted
+}
+
+// Returns the parts of page links are followed from: the content of the elements selected by
+// 'followIn', or the whole page if there are none, without the content of those selected by 'ignoreIn'
+func (c *Crawler) linkHTML(page []byte) []byte {
+	if len(c.followIn) == 0 && len(c.ignoreIn) == 0 {
+		return page
+	}
+
+	// Bytes of page kept
+	keep := make([]bool, len(page))
+	for i := range keep {
+		keep[i] = len(c.followIn) == 0
+	}
+	for _, e := range c.followIn {
+		e.elements(page, func(attrs map[string]string, start int, end int) {
+			for i := start; i < end; i++ {
+				keep[i] = true
+			}
+		})
+	}
+	for _, e := range c.ignoreIn {
+		e.elements(page, func(attrs map[string]string, start int, end int) {
+			for i := start; i < end; i++ {
+				keep[i] = false
+			}
+		})
+	}
+
+	// Parts are separated so that links cut in half never join up
+	var b bytes.Buffer
+	for i := 0; i < len(page); i++ {
+		if keep[i] {
+			b.WriteByte(page[i])
+		} else if i > 0 && keep[i-1] {
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes()
+}
+
+// Returns the extractors of the given comma separated selectors
+func parseSelectors(selectors string) ([]*Extractor, error) {
+	var extractors []*Extractor
+	for _, selector := range strings.Split(selectors, ",") {
+		if selector = strings.TrimSpace(selector); len(selector) == 0 {
+			continue
+		}
+		e, err := ParseExtractor(selector, selector)
+		if err != nil {
+			return nil, err
+		}
+		extractors = append(extractors, e)
+	}
+	return extractors, nil
+}
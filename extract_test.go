@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestExtractor_Extract(t *testing.T) {
+	page := []byte(`<html><head><meta name="author" content="Monzo &amp; co"><meta name="description" content="Banking"></head>
+		<body><div id="main"><span class="price sale">£5</span><span class="price">£<b>10</b></span>
+		<SPAN CLASS="old price">£15</SPAN></div><a href="/about" data-track='nav'>About us</a></body></html>`)
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"span.price", []string{"£5", "£ 10", "£15"}},
+		{"span.price.sale", []string{"£5"}},
+		{".sale", []string{"£5"}},
+		{"meta[name=author]@content", []string{"Monzo & co"}},
+		{"meta[name='description']@content", []string{"Banking"}},
+		{"a[data-track]@href", []string{"/about"}},
+		{"#main span.old", []string(nil)},
+		{"//span[@class='price']", []string{"£ 10"}},
+		{"//meta[@name='author']/@content", []string{"Monzo & co"}},
+		{"//a/text()", []string{"About us"}},
+		{"//*[@id='main']/@id", []string{"main"}},
+	}
+	for _, test := range tests {
+		e, err := ParseExtractor("x", test.expr)
+		if err != nil {
+			if test.want != nil {
+				t.Errorf("Failed to parse (%s): %s", test.expr, err)
+			}
+			continue
+		}
+		if got := e.Extract(page); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Expecting (%q) for (%s), got (%q)", test.want, test.expr, got)
+		}
+	}
+}
+
+// Values extracted are attached to the pages of the result
+func TestRun_extractsValues(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<html><h1>`+r.URL.Path+`</h1><a href="/about">About</a></html>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	if err := c.AddExtractor("title", "h1"); err != nil {
+		t.Fatalf("Failed to add extractor: %s", err)
+	}
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	for _, page := range res.Pages {
+		if want := page.URL[len(ts.URL):]; len(want) > 0 && !reflect.DeepEqual(page.Extracted["title"], []string{want}) {
+			t.Errorf("Expecting title (%s) for (%s), got (%v)", want, page.URL, page.Extracted)
+		}
+	}
+}
+
+func TestCrawler_linkHTML(t *testing.T) {
+	page := []byte(`<html><nav><a href="/nav">Nav</a></nav><main><div class="post"><div><a href="/post">Post</a></div>
+		<div class="comments"><a href="/spam">Spam</a></div><a href="/more">More</a></div></main>
+		<footer><a href="/legal">Legal</a></footer></html>`)
+
+	tests := []struct {
+		followIn string
+		ignoreIn string
+		want     []string
+	}{
+		{"", "", []string{"/nav", "/post", "/spam", "/more", "/legal"}},
+		{"nav", "", []string{"/nav"}},
+		{"nav,main", ".comments", []string{"/nav", "/post", "/more"}},
+		{"div.post", "", []string{"/post", "/spam", "/more"}},
+		{"", "footer,.comments", []string{"/nav", "/post", "/more"}},
+	}
+	for _, test := range tests {
+		var c Crawler
+		c.Init("https://monzo.com")
+		c.followIn, _ = parseSelectors(test.followIn)
+		c.ignoreIn, _ = parseSelectors(test.ignoreIn)
+		got := urlStrings(FindRelativeLinks(c.linkHTML(page)))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Expecting (%v) following in (%s) and ignoring (%s), got (%v)", test.want, test.followIn, test.ignoreIn, got)
+		}
+	}
+}
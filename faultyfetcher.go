@@ -0,0 +1,107 @@
+package crawler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sync"
+	"time"
+)
+
+// --------------------
+// Faulty fetcher
+// --------------------
+
+// Fetcher injecting faults in the results of another Fetcher, so that backoff and parsing
+// robustness can be exercised in tests. Whether a fetch fails is decided from a hash of
+// the URL, the number of times it was fetched before and Seed, so the same faults are
+// injected on every run.
+type FaultyFetcher struct {
+
+	// Fetcher whose results faults are injected in
+	Fetcher Fetcher
+
+	// Varies which fetches get a fault
+	Seed uint32
+
+	// Time added to every fetch
+	Latency time.Duration
+
+	// Fraction of fetches failing with HttpServerError
+	ServerErrorRate float64
+
+	// Fraction of fetches failing with FetchTimeout
+	TimeoutRate float64
+
+	// Fraction of fetches whose body is mangled into malformed HTML
+	MalformedRate float64
+
+	// Number of times each URL was fetched
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+// Kinds of faults injected by FaultyFetcher
+const (
+	noFault = iota
+	serverErrorFault
+	timeoutFault
+	malformedFault
+)
+
+// Returns the fault to inject in this fetch of the given URL
+func (f *FaultyFetcher) fault(url string) int {
+	f.mu.Lock()
+	if f.attempts == nil {
+		f.attempts = make(map[string]int)
+	}
+	attempt := f.attempts[url]
+	f.attempts[url]++
+	f.mu.Unlock()
+
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d %d %s", f.Seed, attempt, url)
+	roll := float64(h.Sum32()%10000) / 10000
+
+	switch {
+	case roll < f.ServerErrorRate:
+		return serverErrorFault
+	case roll < f.ServerErrorRate+f.TimeoutRate:
+		return timeoutFault
+	case roll < f.ServerErrorRate+f.TimeoutRate+f.MalformedRate:
+		return malformedFault
+	}
+	return noFault
+}
+
+func (f *FaultyFetcher) Fetch(url string) (*FetchResult, error) {
+	time.Sleep(f.Latency)
+
+	switch f.fault(url) {
+	case serverErrorFault:
+		return &FetchResult{GetTime: f.Latency}, HttpServerError(url)
+	case timeoutFault:
+		return &FetchResult{GetTime: f.Latency}, FetchTimeout(url)
+	case malformedFault:
+		res, err := f.Fetcher.Fetch(url)
+		if err != nil {
+			return res, err
+		}
+		mangle(res)
+		res.GetTime += f.Latency
+		return res, nil
+	}
+
+	res, err := f.Fetcher.Fetch(url)
+	if res != nil {
+		res.GetTime += f.Latency
+	}
+	return res, err
+}
+
+// Turns the body of the given result into malformed HTML: it is cut in the middle,
+// followed by unterminated tags and attributes.
+func mangle(res *FetchResult) {
+	res.Body.Truncate(res.Body.Len() / 2)
+	io.WriteString(res.Body, `<a href="/unterminated <iframe srcdoc="&lt;a href=&quot;/x`+"\x00"+`<meta http-equiv=refresh content="0;url=`)
+}
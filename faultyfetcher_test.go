@@ -0,0 +1,129 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+// Fetcher returning the same page for every URL
+type staticFetcher string
+
+func (f staticFetcher) Fetch(url string) (*FetchResult, error) {
+	body := acquireBody()
+	body.WriteString(string(f))
+	return &FetchResult{Body: body}, nil
+}
+
+// Returns the outcome of fetching each URL once with the given fetcher
+func outcomes(f Fetcher, urls []string) []string {
+	var b []string
+	for _, url := range urls {
+		res, err := f.Fetch(url)
+		if err != nil {
+			b = append(b, errorCategory(err))
+		} else {
+			b = append(b, res.Body.String())
+		}
+	}
+	return b
+}
+
+// Test that the same faults are injected on every run with the same seed
+func TestFaultyFetcher_isDeterministic(t *testing.T) {
+	var urls []string
+	for i := 0; i < 100; i++ {
+		urls = append(urls, fmt.Sprintf("https://monzo.com/page%d", i))
+	}
+	newFetcher := func(seed uint32) *FaultyFetcher {
+		return &FaultyFetcher{Fetcher: staticFetcher("<html></html>"), Seed: seed,
+			ServerErrorRate: 0.2, TimeoutRate: 0.2, MalformedRate: 0.2}
+	}
+
+	first, second := outcomes(newFetcher(1), urls), outcomes(newFetcher(1), urls)
+	other := outcomes(newFetcher(2), urls)
+	same := true
+	for i := range urls {
+		if first[i] != second[i] {
+			t.Errorf("Outcome of (%s) differs between runs: (%s) and (%s)", urls[i], first[i], second[i])
+		}
+		same = same && first[i] == other[i]
+	}
+	if same {
+		t.Errorf("Expecting a different seed to inject different faults.")
+	}
+}
+
+// Test that each kind of fault is injected in roughly the requested proportion
+func TestFaultyFetcher_injectsEachFault(t *testing.T) {
+	f := &FaultyFetcher{Fetcher: staticFetcher("<html></html>"),
+		ServerErrorRate: 0.25, TimeoutRate: 0.25, MalformedRate: 0.25}
+
+	counts := make(map[string]int)
+	for i := 0; i < 400; i++ {
+		res, err := f.Fetch(fmt.Sprintf("https://monzo.com/page%d", i))
+		switch {
+		case err != nil:
+			counts[errorCategory(err)]++
+		case res.Body.String() != "<html></html>":
+			counts["malformed"]++
+		default:
+			counts["ok"]++
+		}
+	}
+	for _, outcome := range []string{"server error", "timeout", "malformed", "ok"} {
+		if n := counts[outcome]; n < 50 || n > 150 {
+			t.Errorf("Expecting around 100 fetches with outcome (%s), got (%d)", outcome, n)
+		}
+	}
+}
+
+// Test that a URL fetched again is not bound to get the same fault, so retries can succeed
+func TestFaultyFetcher_variesWithAttempts(t *testing.T) {
+	f := &FaultyFetcher{Fetcher: staticFetcher("<html></html>"), ServerErrorRate: 0.5}
+	failed, succeeded := false, false
+	for i := 0; i < 20; i++ {
+		_, err := f.Fetch("https://monzo.com")
+		failed = failed || err != nil
+		succeeded = succeeded || err == nil
+	}
+	if !failed || !succeeded {
+		t.Errorf("Expecting repeated fetches of the same URL to both fail and succeed.")
+	}
+}
+
+// Test that a crawl through a faulty fetcher completes and reports the injected errors
+func TestCrawl_withFaultyFetcher(t *testing.T) {
+	site := &SyntheticSite{Depth: 3, Branching: 4}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	// Pick a seed with which the home page is fetched, otherwise there is nothing to crawl
+	newFetcher := func(seed uint32) *FaultyFetcher {
+		return &FaultyFetcher{Fetcher: &HTTPFetcher{}, Seed: seed,
+			ServerErrorRate: 0.1, TimeoutRate: 0.1, MalformedRate: 0.2}
+	}
+	var seed uint32
+	for newFetcher(seed).fault(ts.URL) != noFault {
+		seed++
+	}
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.throttle.windowSize = 0
+	c.fetcher = newFetcher(seed)
+	c.Start()
+	c.Wait()
+
+	categories := make(map[string]int)
+	c.fetchErrors.Range(func(k, v interface{}) bool {
+		categories[errorCategory(v.(error))]++
+		return true
+	})
+	if categories["server error"]+categories["timeout"] == 0 {
+		t.Errorf("Expecting injected server errors and timeouts to be recorded, got %v", categories)
+	}
+	if len(categories) > 2 {
+		t.Errorf("Expecting only injected errors to be recorded, got %v", categories)
+	}
+}
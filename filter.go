@@ -0,0 +1,161 @@
+package crawler
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// --------------------
+// URL filters
+// --------------------
+
+// Decides whether a site found while crawling is fetched. Filters are evaluated in order
+// before a site is scheduled, the first one rejecting it gives the reason it is skipped.
+type Filter interface {
+
+	// Returns true if the site found on referrer, depth links away from 'baseSite',
+	// should be fetched. Otherwise returns false and why, see SKIP_BUDGET and others.
+	Allow(url string, depth int, referrer string) (bool, string)
+}
+
+// Function used as a Filter
+type FilterFunc func(url string, depth int, referrer string) (bool, string)
+
+func (f FilterFunc) Allow(url string, depth int, referrer string) (bool, string) {
+	return f(url, depth, referrer)
+}
+
+// Filters applied unless told otherwise, in order
+var DEFAULT_FILTERS = []string{"blocklist", "trap", "scope", "depth", "robots", "under", "suffix", "pattern", "sample"}
+
+// Built-in filters by name, each reading the options of the Crawler it is made for
+// when evaluated so that they can be set in any order
+var builtinFilters = map[string]func(c *Crawler) Filter{
+
+	// Rejects sites on 'blocklist'
+	"blocklist": func(c *Crawler) Filter {
+		return FilterFunc(func(url string, depth int, referrer string) (bool, string) {
+			return c.blocklist == nil || !c.blocklist.Blocked(url), SKIP_BLOCKLIST
+		})
+	},
+
+	// Rejects sites whose URL contains one of 'trapWords', see isTrap
+	"trap": func(c *Crawler) Filter {
+		return FilterFunc(func(url string, depth int, referrer string) (bool, string) {
+			return !isTrap(url, c.trapWords), SKIP_TRAP
+		})
+	},
+
+	// Rejects sites outside the domain crawled
+	"scope": func(c *Crawler) Filter {
+		return FilterFunc(func(url string, depth int, referrer string) (bool, string) {
+			return c.isLocal(url), SKIP_SCOPE
+		})
+	},
+
+	// Rejects sites more than 'maxDepth' links away from 'baseSite', unless it is 0
+	"depth": func(c *Crawler) Filter {
+		return FilterFunc(func(url string, depth int, referrer string) (bool, string) {
+			return c.maxDepth <= 0 || depth <= c.maxDepth, SKIP_DEPTH
+		})
+	},
+
+	// Rejects sites robots.txt disallows, unless 'respectRobots' is false
+	"robots": func(c *Crawler) Filter {
+		return FilterFunc(func(url string, depth int, referrer string) (bool, string) {
+			return !c.respectRobots || c.robotsAllow(url), SKIP_ROBOTS
+		})
+	},
+
+	// Rejects sites whose path does not start with 'pathPrefix', unless 'prefixEscape'
+	// lets them be followed from a page under it
+	"under": func(c *Crawler) Filter {
+		return FilterFunc(func(url string, depth int, referrer string) (bool, string) {
+			if c.isUnderPrefix(url) {
+				return true, ""
+			}
+			return c.prefixEscape == ESCAPE_FOLLOW && c.isUnderPrefix(referrer), SKIP_PREFIX
+		})
+	},
+
+	// Rejects sites ending with one of 'ignoreSuffixes'
+	"suffix": func(c *Crawler) Filter {
+		return FilterFunc(func(url string, depth int, referrer string) (bool, string) {
+			return !c.matchesIgnoreSuffix(url), SKIP_SUFFIX
+		})
+	},
+
+	// Rejects sites not matching 'include' or matching 'exclude'
+	"pattern": func(c *Crawler) Filter {
+		return FilterFunc(func(url string, depth int, referrer string) (bool, string) {
+			if c.include != nil && !c.include.MatchString(url) {
+				return false, SKIP_PATTERN
+			}
+			return c.exclude == nil || !c.exclude.MatchString(url), SKIP_PATTERN
+		})
+	},
+
+	// Rejects search pages and parameterized URLs beyond the sample of their template, see endpointSampler
+	"sample": func(c *Crawler) Filter {
+		return FilterFunc(func(url string, depth int, referrer string) (bool, string) {
+			return c.sampler.allow(url), SKIP_SAMPLED
+		})
+	},
+}
+
+// Returns the built-in filters with the given names, in order
+func (c *Crawler) namedFilters(names []string) ([]Filter, error) {
+	filters := make([]Filter, 0, len(names))
+	for _, name := range names {
+		f, ok := builtinFilters[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown filter (%s)", name)
+		}
+		filters = append(filters, f(c))
+	}
+	return filters, nil
+}
+
+// Returns the given filter names with those that must apply whichever are chosen added in
+// front when left out: blocklist when there is one, as blocked URLs must never be requested,
+// scope, and robots unless 'respectRobots' is false
+func (c *Crawler) enforcedFilters(names []string) []string {
+	var required []string
+	if c.blocklist != nil {
+		required = append(required, "blocklist")
+	}
+	required = append(required, "scope")
+	if c.respectRobots {
+		required = append(required, "robots")
+	}
+	var missing []string
+	for _, r := range required {
+		found := false
+		for _, name := range names {
+			found = found || name == r
+		}
+		if !found {
+			missing = append(missing, r)
+		}
+	}
+	return append(missing, names...)
+}
+
+// Returns true if all filters of the Crawler allow the given site,
+// otherwise false and the reason of the first one rejecting it
+func (c *Crawler) allowed(url string, depth int, referrer string) (bool, string) {
+	for _, f := range c.filters {
+		if ok, reason := f.Allow(url, depth, referrer); !ok {
+			return false, reason
+		}
+	}
+	return true, ""
+}
+
+// Returns the regular expression compiled from pattern, nil if pattern is empty
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) == 0 {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
@@ -0,0 +1,129 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCrawler_allowed(t *testing.T) {
+	var c Crawler
+	c.Init("https://monzo.com")
+	c.respectRobots = false
+	c.exclude = regexp.MustCompile("/blog/")
+
+	tests := []struct {
+		url    string
+		want   bool
+		reason string
+	}{
+		{"https://monzo.com/about", true, ""},
+		{"https://example.com/about", false, SKIP_SCOPE},
+		{"https://monzo.com/terms.pdf", false, SKIP_SUFFIX},
+		{"https://monzo.com/blog/post", false, SKIP_PATTERN},
+		{"https://monzo.com/logout", false, SKIP_TRAP},
+		// First filter rejecting the site gives the reason
+		{"https://example.com/blog/terms.pdf", false, SKIP_SCOPE},
+	}
+	for _, test := range tests {
+		if ok, reason := c.allowed(test.url, 1, "https://monzo.com"); ok != test.want || reason != test.reason {
+			t.Errorf("Expecting (%v, %s) for (%s), got (%v, %s)", test.want, test.reason, test.url, ok, reason)
+		}
+	}
+
+	// Reordered, the suffix is what rejects it
+	c.filters, _ = c.namedFilters([]string{"suffix", "scope"})
+	if _, reason := c.allowed("https://example.com/blog/terms.pdf", 1, "https://monzo.com"); reason != SKIP_SUFFIX {
+		t.Errorf("Expecting the first filter of the chain to reject the site, got (%s)", reason)
+	}
+	if _, err := c.namedFilters([]string{"scope", "nope"}); err == nil {
+		t.Errorf("Expecting an error for an unknown filter")
+	}
+}
+
+// Filters left out of the list chosen are added when they must apply
+func TestCrawler_enforcedFilters(t *testing.T) {
+	var c Crawler
+	c.Init("https://monzo.com")
+
+	tests := []struct {
+		names         []string
+		respectRobots bool
+		blocklist     bool
+		want          string
+	}{
+		{[]string{"under", "sample"}, true, false, "scope,robots,under,sample"},
+		{[]string{"under", "sample"}, false, false, "scope,under,sample"},
+		{[]string{"under"}, true, true, "blocklist,scope,robots,under"},
+		{[]string{"robots", "scope", "under"}, true, false, "robots,scope,under"},
+		{DEFAULT_FILTERS, true, true, strings.Join(DEFAULT_FILTERS, ",")},
+	}
+	for _, test := range tests {
+		c.respectRobots, c.blocklist = test.respectRobots, nil
+		if test.blocklist {
+			c.blocklist = &Blocklist{}
+		}
+		if got := strings.Join(c.enforcedFilters(test.names), ","); got != test.want {
+			t.Errorf("Expecting (%s) for (%v), got (%s)", test.want, test.names, got)
+		}
+	}
+}
+
+// Filters of the chain can be replaced by custom ones
+func TestRun_customFilter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<html><a href="/docs">Docs</a><a href="/docs/api">API</a><a href="/about">About</a></html>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	docsOnly := FilterFunc(func(url string, depth int, referrer string) (bool, string) {
+		return strings.HasPrefix(url, ts.URL+"/docs"), "not docs"
+	})
+	c.filters = append(c.filters, docsOnly)
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(res.Pages) != 3 {
+		t.Errorf("Expecting the base site and the (2) docs pages to be crawled, got (%v)", res.Pages)
+	}
+	if len(res.NotCrawled) != 1 || res.NotCrawled[0].Reason != "not docs" {
+		t.Errorf("Expecting (/about) to be skipped by the custom filter, got (%+v)", res.NotCrawled)
+	}
+}
+
+// Pages beyond the maximum depth are listed on the page linking to them but not fetched
+func TestRun_maxDepth(t *testing.T) {
+	site := &SyntheticSite{Depth: 3, Branching: 2}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.respectRobots = false
+	c.maxDepth = 1
+	res, _ := c.Run(context.Background())
+	if len(res.Pages) != 3 {
+		t.Errorf("Expecting the base site and its (2) children to be crawled, got (%d) pages", len(res.Pages))
+	}
+	for _, page := range res.Pages {
+		if page.Depth == 1 && len(page.Children) != 2 {
+			t.Errorf("Expecting the children of (%s) to be listed, got (%v)", page.URL, page.Children)
+		}
+	}
+	if len(res.NotCrawled) != 4 {
+		t.Errorf("Expecting the (4) pages at depth 2 to be skipped, got (%+v)", res.NotCrawled)
+	}
+	for _, page := range res.NotCrawled {
+		if page.Reason != SKIP_DEPTH || page.Depth != 2 {
+			t.Errorf("Expecting (%s) to be skipped for (%s) at depth 2, got (%s) at depth (%d)", page.URL, SKIP_DEPTH, page.Reason, page.Depth)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package crawler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// --------------------
+// Findings
+// --------------------
+
+// Rules pages are checked against, each finding breaks one
+const (
+	RULE_BROKEN_LINK        = "broken-link"
+	RULE_SERVER_ERROR       = "server-error"
+	RULE_TIMEOUT            = "timeout"
+	RULE_SOFT_404           = "soft-404"
+	RULE_INSECURE_LINK      = "insecure-link"
+	RULE_NON_CANONICAL_LINK = "non-canonical-link"
+	RULE_CACHING            = "caching"
+	RULE_COMPRESSION        = "compression"
+	RULE_ICON               = "icon"
+	RULE_ROBOTS_TXT         = "robots-txt"
+	RULE_SITEMAP            = "sitemap"
+)
+
+// Rule pages are checked against
+type FindingRule struct {
+	ID          string
+	Description string
+}
+
+// Rules in the order findings are reported in
+var FINDING_RULES = []FindingRule{
+	{RULE_BROKEN_LINK, "Internal links must not answer with not found"},
+	{RULE_SERVER_ERROR, "Pages must not answer with a server error (5xx)"},
+	{RULE_TIMEOUT, "Pages must answer within the fetch timeout"},
+	{RULE_SOFT_404, "Missing pages must answer with a 404, not the site's not found page"},
+	{RULE_INSECURE_LINK, "Pages of an https site must not link to http pages of the site"},
+	{RULE_NON_CANONICAL_LINK, "Links must point at the canonical host of the site"},
+	{RULE_CACHING, "Responses must have a consistent caching policy"},
+	{RULE_COMPRESSION, "Text responses must be compressed"},
+	{RULE_ICON, "Favicons, icons and web app manifests must resolve, manifests must be valid JSON"},
+	{RULE_ROBOTS_TXT, "robots.txt must only have valid directives, within User-agent groups"},
+	{RULE_SITEMAP, "Sitemaps must be well-formed, within the limits of the protocol, and only list URLs under them"},
+}
+
+// Problem found with a URL, worth the attention of the site owner
+type Finding struct {
+	Rule    string
+	URL     string
+	Message string
+}
+
+// Returns the findings of the crawl, sorted by rule as in FINDING_RULES then by URL
+func (c *Crawler) Findings() []Finding {
+	var findings []Finding
+	c.fetchErrors.Range(func(k, v interface{}) bool {
+		site, referrer := k.(string), c.discoveryOf(k.(string)).referrer
+		from := ""
+		if len(referrer) > 0 {
+			from = ", linked from " + referrer
+		}
+		switch v.(type) {
+		case Http404Error:
+			findings = append(findings, Finding{RULE_BROKEN_LINK, site, "Not found" + from})
+		case HttpServerError, ServiceUnavailable:
+			findings = append(findings, Finding{RULE_SERVER_ERROR, site, "Server error" + from})
+		case FetchTimeout:
+			findings = append(findings, Finding{RULE_TIMEOUT, site, "Timed out" + from})
+		}
+		return true
+	})
+	c.softNotFound.Range(func(k, v interface{}) bool {
+		findings = append(findings, Finding{RULE_SOFT_404, k.(string), "Answers with the site's not found page"})
+		return true
+	})
+	c.insecureLinks.Range(func(k, v interface{}) bool {
+		findings = append(findings, Finding{RULE_INSECURE_LINK, k.(string), "Links to " + strings.Join(v.([]string), ", ")})
+		return true
+	})
+	c.nonCanonicalLinks.Range(func(k, v interface{}) bool {
+		findings = append(findings, Finding{RULE_NON_CANONICAL_LINK, k.(string),
+			fmt.Sprintf("Links to %s instead of %s", strings.Join(v.([]string), ", "), c.canonicalHost())})
+		return true
+	})
+	for site, problems := range c.cachingProblems() {
+		findings = append(findings, Finding{RULE_CACHING, site, strings.Join(problems, "; ")})
+	}
+	c.uncompressed.Range(func(k, v interface{}) bool {
+		findings = append(findings, Finding{RULE_COMPRESSION, k.(string), fmt.Sprintf("Served %d bytes without Content-Encoding", v)})
+		return true
+	})
+	for _, check := range c.iconProblems() {
+		findings = append(findings, Finding{RULE_ICON, check.URL, fmt.Sprintf("%s: %s", check.Kind, check.Problem)})
+	}
+	for _, p := range c.lintFindings() {
+		rule, message := RULE_SITEMAP, p.Problem
+		if p.Kind == LINT_ROBOTS {
+			rule = RULE_ROBOTS_TXT
+		}
+		if p.Line > 0 {
+			message = fmt.Sprintf("Line %d: %s", p.Line, p.Problem)
+		}
+		findings = append(findings, Finding{rule, p.URL, message})
+	}
+
+	order := make(map[string]int, len(FINDING_RULES))
+	for i, rule := range FINDING_RULES {
+		order[rule.ID] = i
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Rule != findings[j].Rule {
+			return order[findings[i].Rule] < order[findings[j].Rule]
+		}
+		return findings[i].URL < findings[j].URL
+	})
+	return findings
+}
+
+// Returns the URLs checked by the crawl, those fetched and those that failed, sorted
+func (c *Crawler) checkedURLs() []string {
+	var urls []string
+	c.sitemap.Range(func(k, v interface{}) bool {
+		urls = append(urls, k.(string))
+		return true
+	})
+	c.fetchErrors.Range(func(k, v interface{}) bool {
+		urls = append(urls, k.(string))
+		return true
+	})
+	sort.Strings(urls)
+	return urls
+}
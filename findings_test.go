@@ -0,0 +1,50 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Returns a crawled site with a broken link, a server error and an uncompressed page
+func crawlSiteWithFindings(t *testing.T) (*Crawler, *httptest.Server) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.NotFound(w, r)
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Header().Set("Cache-Control", "max-age=3600")
+			io.WriteString(w, `<html><a href="/old">Old</a><a href="/broken">Broken</a><a href="/about">About</a></html>`)
+		}
+	}))
+	c := new(Crawler)
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	if _, err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	return c, ts
+}
+
+func TestCrawler_Findings(t *testing.T) {
+	c, ts := crawlSiteWithFindings(t)
+	defer ts.Close()
+
+	want := []Finding{
+		{RULE_BROKEN_LINK, ts.URL + "/old", "Not found, linked from " + ts.URL},
+		{RULE_SERVER_ERROR, ts.URL + "/broken", "Server error, linked from " + ts.URL},
+	}
+	findings := c.Findings()
+	if len(findings) != len(want) {
+		t.Fatalf("Expecting (%v), got (%v)", want, findings)
+	}
+	for i := range want {
+		if findings[i] != want[i] {
+			t.Errorf("Expecting (%v), got (%v)", want[i], findings[i])
+		}
+	}
+}
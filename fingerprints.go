@@ -0,0 +1,251 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// --------------------
+// Content fingerprints
+// --------------------
+
+// Pages of a section whose content changed since the previous crawl
+type SectionChange struct {
+	Section string `json:"section"`
+
+	// Pages crawled in both crawls, and those whose content is different
+	Compared int `json:"compared"`
+	Changed  int `json:"changed"`
+
+	// Pages only crawled in this crawl, and only in the previous one
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+// Returns the fraction of the pages crawled in both crawls whose content changed
+func (s SectionChange) ChangedRate() float64 {
+	if s.Compared == 0 {
+		return 0
+	}
+	return float64(s.Changed) / float64(s.Compared)
+}
+
+// Returns the fingerprint of the given content, the same for the same bytes
+func fingerprint(content []byte) string {
+	h := fnv.New64a()
+	h.Write(content)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// Returns the fingerprint of each page crawled
+func (c *Crawler) pageFingerprints() map[string]string {
+	fingerprints := make(map[string]string)
+	c.fingerprints.Range(func(k, v interface{}) bool {
+		fingerprints[k.(string)] = v.(string)
+		return true
+	})
+	return fingerprints
+}
+
+// Returns the file holding the fingerprints of the last crawl of the given site in dir
+func fingerprintsFile(dir string, site string) string {
+	return filepath.Join(dir, siteFilename(site)+".fingerprints.json")
+}
+
+// Returns the fingerprints of the last crawl of the given site recorded in dir, none if there are none
+func LoadFingerprints(dir string, site string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(fingerprintsFile(dir, site))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var fingerprints map[string]string
+	if err := json.Unmarshal(content, &fingerprints); err != nil {
+		return nil, fmt.Errorf("Malformed fingerprints (%s): %s", fingerprintsFile(dir, site), err)
+	}
+	return fingerprints, nil
+}
+
+// Replaces the fingerprints of the last crawl of the given site in dir
+func SaveFingerprints(dir string, site string, fingerprints map[string]string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := createAtomic(fingerprintsFile(dir, site))
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(fingerprints); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
+
+// Returns how the pages of each section changed from the previous fingerprints to the
+// current ones, sorted by section. Nil when there were no previous fingerprints.
+func CompareFingerprints(previous map[string]string, current map[string]string) []SectionChange {
+	if len(previous) == 0 {
+		return nil
+	}
+	bySection := make(map[string]*SectionChange)
+	section := func(site string) *SectionChange {
+		name := pathSection(site)
+		s, ok := bySection[name]
+		if !ok {
+			s = &SectionChange{Section: name}
+			bySection[name] = s
+		}
+		return s
+	}
+	for site, fp := range current {
+		s := section(site)
+		old, present := previous[site]
+		switch {
+		case !present:
+			s.Added++
+		case old != fp:
+			s.Compared++
+			s.Changed++
+		default:
+			s.Compared++
+		}
+	}
+	for site := range previous {
+		if _, present := current[site]; !present {
+			section(site).Removed++
+		}
+	}
+
+	changes := make([]SectionChange, 0, len(bySection))
+	for _, s := range bySection {
+		changes = append(changes, *s)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Section < changes[j].Section })
+	return changes
+}
+
+// Returns the changes of all sections added up
+func totalChange(changes []SectionChange) SectionChange {
+	total := SectionChange{Section: "total"}
+	for _, s := range changes {
+		total.Compared += s.Compared
+		total.Changed += s.Changed
+		total.Added += s.Added
+		total.Removed += s.Removed
+	}
+	return total
+}
+
+// How often the content of a page changed over the crawls of its site recorded
+type PageChanges struct {
+
+	// Crawls the page was fingerprinted in, and in how many of them its content had changed
+	Crawls  int `json:"crawls"`
+	Changes int `json:"changes"`
+
+	// When it was first and last fingerprinted
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+}
+
+// Shortest time a page must have been crawled over without changing for that time to
+// estimate how often it changes; crawls closer together say nothing about it
+const MIN_UNCHANGED_SPAN time.Duration = 31 * 24 * time.Hour
+
+// Returns the average time between changes of the page, or the time it was crawled over
+// if it never changed. Zero until it was crawled twice, or while it never changed over
+// less than MIN_UNCHANGED_SPAN.
+func (p PageChanges) Interval() time.Duration {
+	if p.Crawls < 2 {
+		return 0
+	}
+	span := p.Last.Sub(p.First)
+	if p.Changes == 0 && span < MIN_UNCHANGED_SPAN {
+		return 0
+	}
+	return span / time.Duration(max(p.Changes, 1))
+}
+
+// Returns the file holding the changes of the pages of the given site in dir
+func pageChangesFile(dir string, site string) string {
+	return filepath.Join(dir, siteFilename(site)+".changes.json")
+}
+
+// Returns the changes of the pages of the given site recorded in dir, none if there are none
+func LoadPageChanges(dir string, site string) (map[string]PageChanges, error) {
+	content, err := ioutil.ReadFile(pageChangesFile(dir, site))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var changes map[string]PageChanges
+	if err := json.Unmarshal(content, &changes); err != nil {
+		return nil, fmt.Errorf("Malformed page changes (%s): %s", pageChangesFile(dir, site), err)
+	}
+	return changes, nil
+}
+
+// Replaces the changes of the pages of the given site in dir
+func SavePageChanges(dir string, site string, changes map[string]PageChanges) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := createAtomic(pageChangesFile(dir, site))
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(changes); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
+
+// Returns the changes of the pages crawled at the given time, counting those whose fingerprint
+// differs from the previous crawl. Pages no longer crawled are forgotten.
+func updatePageChanges(changes map[string]PageChanges, previous map[string]string, current map[string]string, at time.Time) map[string]PageChanges {
+	updated := make(map[string]PageChanges, len(current))
+	for site, fp := range current {
+		p := changes[site]
+		if p.Crawls == 0 {
+			p.First = at
+		} else if old, present := previous[site]; present && old != fp {
+			p.Changes++
+		}
+		p.Crawls++
+		p.Last = at
+		updated[site] = p
+	}
+	return updated
+}
+
+// Compares the pages crawled to the last crawl of the site recorded in dir, keeping the
+// changes in 'contentChanges' and how often each page changed in 'pageChanges', then
+// records the fingerprints of this crawl in its place
+func (c *Crawler) RecordContentChanges(dir string) error {
+	previous, err := LoadFingerprints(dir, c.baseSite)
+	if err != nil {
+		return err
+	}
+	changes, err := LoadPageChanges(dir, c.baseSite)
+	if err != nil {
+		return err
+	}
+	current := c.pageFingerprints()
+	c.contentChanges = CompareFingerprints(previous, current)
+	c.pageChanges = updatePageChanges(changes, previous, current, time.Now())
+	if err := SavePageChanges(dir, c.baseSite, c.pageChanges); err != nil {
+		return err
+	}
+	return SaveFingerprints(dir, c.baseSite, current)
+}
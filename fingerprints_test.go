@@ -0,0 +1,117 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCompareFingerprints(t *testing.T) {
+	previous := map[string]string{"https://monzo.com": "1", "https://monzo.com/blog/a": "2",
+		"https://monzo.com/blog/b": "3", "https://monzo.com/old": "4"}
+	current := map[string]string{"https://monzo.com": "1", "https://monzo.com/blog/a": "2",
+		"https://monzo.com/blog/b": "5", "https://monzo.com/blog/c": "6"}
+	want := []SectionChange{
+		{Section: "/", Compared: 1},
+		{Section: "/blog", Compared: 2, Changed: 1, Added: 1},
+		{Section: "/old", Removed: 1},
+	}
+	got := CompareFingerprints(previous, current)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expecting (%+v), got (%+v)", want, got)
+	}
+	if rate := got[1].ChangedRate(); rate != 0.5 {
+		t.Errorf("Expecting half of /blog changed, got (%f)", rate)
+	}
+	if CompareFingerprints(nil, current) != nil {
+		t.Errorf("Expecting no changes without a previous crawl")
+	}
+}
+
+// The second crawl of a site reports the pages changed since the first
+func TestCrawlContentChanges(t *testing.T) {
+	var run int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/blog/news" && atomic.LoadInt32(&run) == 2 {
+			io.WriteString(w, "<html>Fresh news</html>")
+			return
+		}
+		io.WriteString(w, `<html><a href="/blog/news">News</a><a href="/about">About</a></html>`)
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "crawler-fingerprints-")
+	if err != nil {
+		t.Fatalf("Failed to create history directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var c *Crawler
+	for i := int32(1); i <= 2; i++ {
+		atomic.StoreInt32(&run, i)
+		c = new(Crawler)
+		c.Init(ts.URL)
+		c.probeNotFound = false
+		c.fingerprintPages = true
+		c.Run(context.Background())
+		if err := c.RecordContentChanges(dir); err != nil {
+			t.Fatalf("Failed to record changes: %s", err)
+		}
+	}
+
+	total := totalChange(c.contentChanges)
+	if total.Compared != 3 || total.Changed != 1 {
+		t.Errorf("Expecting 1 of 3 pages changed, got (%+v)", total)
+	}
+	var report bytes.Buffer
+	c.WriteReport(&report)
+	if !strings.Contains(report.String(), "/blog                          100.0% changed (1 of 1)") {
+		t.Errorf("Expecting the report to show /blog changed, got (%s)", report.String())
+	}
+}
+
+func TestUpdatePageChanges(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	crawls := []map[string]string{
+		{"https://monzo.com": "1", "https://monzo.com/blog": "a", "https://monzo.com/old": "x"},
+		{"https://monzo.com": "1", "https://monzo.com/blog": "b"},
+		{"https://monzo.com": "1", "https://monzo.com/blog": "c", "https://monzo.com/new": "y"},
+	}
+	var changes map[string]PageChanges
+	var previous map[string]string
+	for i, current := range crawls {
+		changes = updatePageChanges(changes, previous, current, start.Add(time.Duration(i)*7*day))
+		previous = current
+	}
+
+	want := map[string]PageChanges{
+		"https://monzo.com":      {Crawls: 3, First: start, Last: start.Add(14 * day)},
+		"https://monzo.com/blog": {Crawls: 3, Changes: 2, First: start, Last: start.Add(14 * day)},
+		"https://monzo.com/new":  {Crawls: 1, First: start.Add(14 * day), Last: start.Add(14 * day)},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Expecting (%+v), got (%+v)", want, changes)
+	}
+	// Unchanged over two weeks is too short to tell, over two months it is not
+	changes["https://monzo.com/about"] = PageChanges{Crawls: 2, First: start, Last: start.Add(60 * day)}
+	intervals := map[string]time.Duration{
+		"https://monzo.com":       0,
+		"https://monzo.com/about": 60 * day,
+		"https://monzo.com/blog":  7 * day,
+		"https://monzo.com/new":   0,
+	}
+	for page, interval := range intervals {
+		if got := changes[page].Interval(); got != interval {
+			t.Errorf("Expecting (%s) to change every (%s), got (%s)", page, interval, got)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// --------------------
+// Crawl fixtures
+// --------------------
+
+// Name of the file listing the URLs recorded in a fixture directory.
+// Each line holds the body file name, the outcome ("ok" or an error category),
+// the final URL and the URL, separated by tabs.
+const FIXTURE_INDEX_FILENAME string = "index.tsv"
+
+// Returns the name of the file the body of the given URL is recorded in
+func fixtureFilename(url string) string {
+	return fmt.Sprintf("%x.html", sha1.Sum([]byte(url)))
+}
+
+// Returns the name of the file the response headers recorded along with the given body file are in
+func fixtureHeaderFilename(filename string) string {
+	return strings.TrimSuffix(filename, ".html") + ".headers"
+}
+
+// Returns an error of the given category, as returned by errorCategory
+func errorForCategory(category string, url string) error {
+	switch category {
+	case "timeout":
+		return FetchTimeout(url)
+	case "server error":
+		return HttpServerError(url)
+	case "invalid content":
+		return InvalidHTMLContent(url)
+	case "invalid url":
+		return InvalidURL(url)
+	}
+	return Http404Error(url)
+}
+
+// Fetcher saving everything fetched by another Fetcher to a fixture directory,
+// which can then be served back by a ReplayFetcher.
+type RecordingFetcher struct {
+
+	// Fetcher whose results are recorded
+	Fetcher Fetcher
+
+	// Directory the fixture is recorded in
+	Dir string
+
+	mu    sync.Mutex
+	index *os.File
+}
+
+// Returns a RecordingFetcher recording the results of fetcher in dir, creating it if needed.
+// Close must be called once done fetching.
+func NewRecordingFetcher(fetcher Fetcher, dir string) (*RecordingFetcher, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	index, err := os.OpenFile(filepath.Join(dir, FIXTURE_INDEX_FILENAME), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordingFetcher{Fetcher: fetcher, Dir: dir, index: index}, nil
+}
+
+// Records every response of the crawl to the fixture directory dir, wrapping the fetcher set up
+// so far. The RecordingFetcher returned must be closed once the crawl is done.
+func (c *Crawler) Record(dir string) (*RecordingFetcher, error) {
+	recorder, err := NewRecordingFetcher(c.fetcherOrDefault(), dir)
+	if err != nil {
+		return nil, err
+	}
+	c.fetcher = recorder
+	return recorder, nil
+}
+
+func (f *RecordingFetcher) Fetch(url string) (*FetchResult, error) {
+	res, err := f.Fetcher.Fetch(url)
+
+	filename, outcome, final := fixtureFilename(url), "ok", ""
+	if err != nil {
+		outcome = errorCategory(err)
+	} else {
+		final = res.FinalURL
+		if e := ioutil.WriteFile(filepath.Join(f.Dir, filename), res.Body.Bytes(), 0644); e != nil {
+			return res, e
+		}
+		if res.Header != nil {
+			var header bytes.Buffer
+			redactHeader(res.Header).Write(&header)
+			header.WriteString("\r\n")
+			if e := ioutil.WriteFile(filepath.Join(f.Dir, fixtureHeaderFilename(filename)), header.Bytes(), 0644); e != nil {
+				return res, e
+			}
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, e := fmt.Fprintf(f.index, "%s\t%s\t%s\t%s\n", filename, outcome, final, url); e != nil {
+		return res, e
+	}
+	return res, err
+}
+
+// Probes resources with the recorded Fetcher if it can, probes are not part of the fixture
+func (f *RecordingFetcher) FetchRange(url string, n int64) (*ResourceProbe, error) {
+	rf, ok := f.Fetcher.(RangeFetcher)
+	if !ok {
+		return nil, InvalidURL(url)
+	}
+	return rf.FetchRange(url, n)
+}
+
+// Closes the index of the fixture
+func (f *RecordingFetcher) Close() error {
+	return f.index.Close()
+}
+
+// A URL recorded in a fixture
+type fixtureEntry struct {
+	filename string
+	outcome  string
+	final    string
+}
+
+// Fetcher serving back the fixture recorded by a RecordingFetcher, without any network access.
+// URLs missing from the fixture are not found.
+type ReplayFetcher struct {
+
+	// Directory the fixture was recorded in
+	Dir string
+
+	entries map[string]fixtureEntry
+}
+
+// Returns a ReplayFetcher serving the fixture recorded in dir
+func NewReplayFetcher(dir string) (*ReplayFetcher, error) {
+	index, err := os.Open(filepath.Join(dir, FIXTURE_INDEX_FILENAME))
+	if err != nil {
+		return nil, err
+	}
+	defer index.Close()
+
+	// Later lines win, so the last outcome recorded for a URL is the one replayed
+	entries := make(map[string]fixtureEntry)
+	scanner := bufio.NewScanner(index)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("Malformed line in fixture index (%s)", scanner.Text())
+		}
+		entries[fields[3]] = fixtureEntry{filename: fields[0], outcome: fields[1], final: fields[2]}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &ReplayFetcher{Dir: dir, entries: entries}, nil
+}
+
+func (f *ReplayFetcher) Fetch(url string) (*FetchResult, error) {
+	entry, ok := f.entries[url]
+	if !ok {
+		return nil, Http404Error(url)
+	}
+	if entry.outcome != "ok" {
+		return nil, errorForCategory(entry.outcome, url)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(f.Dir, entry.filename))
+	if err != nil {
+		return nil, InvalidHTMLContent(url)
+	}
+	body := acquireBody()
+	body.Write(content)
+
+	// Fixtures recorded before headers were kept have none
+	var header http.Header
+	if f, err := os.Open(filepath.Join(f.Dir, fixtureHeaderFilename(entry.filename))); err == nil {
+		defer f.Close()
+		mime, _ := textproto.NewReader(bufio.NewReader(f)).ReadMIMEHeader()
+		header = http.Header(mime)
+	}
+	return &FetchResult{Body: body, FinalURL: entry.final, Header: header}, nil
+}
@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// Test that a crawl replayed from a recorded fixture gives the same sitemap without the server
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-fixture-")
+	if err != nil {
+		t.Fatalf("Failed to create fixture directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, err := urlToHTMLContent(r.URL.Path)
+		if err != nil {
+			w.WriteHeader(404)
+		}
+		io.WriteString(w, content)
+	}))
+
+	// Record a crawl of the test site
+	recorder, err := NewRecordingFetcher(&HTTPFetcher{}, dir)
+	if err != nil {
+		t.Fatalf("Failed to create recording fetcher: %s", err)
+	}
+	var recorded Crawler
+	recorded.Init(ts.URL)
+	recorded.fetcher = recorder
+	recorded.Start()
+	recorded.Wait()
+	recorder.Close()
+	ts.Close()
+
+	// Replay it once the server is gone
+	replayer, err := NewReplayFetcher(dir)
+	if err != nil {
+		t.Fatalf("Failed to create replay fetcher: %s", err)
+	}
+	var replayed Crawler
+	replayed.Init(ts.URL)
+	replayed.fetcher = replayer
+	replayed.Start()
+	replayed.Wait()
+
+	recorded.sitemap.Range(func(k, v interface{}) bool {
+		children, ok := replayed.sitemap.Load(k)
+		if !ok {
+			t.Errorf("Replayed sitemap does not contain (%s).", k)
+		} else if res := testArraysMatch(t, v.([]string), children.([]string)); res != 0 {
+			t.Errorf("Replayed children of (%s) differ from those recorded.", k)
+		}
+		return true
+	})
+	if _, ok := replayed.fetchErrors.Load(ts.URL + "/pageAbsent.html"); !ok {
+		t.Errorf("Expecting the recorded error of pageAbsent.html to be replayed.")
+	}
+	recorded.headers.Range(func(k, v interface{}) bool {
+		header, ok := replayed.headers.Load(k)
+		if !ok || header.(http.Header).Get("Content-Type") != v.(http.Header).Get("Content-Type") {
+			t.Errorf("Replayed headers of (%s) differ from those recorded.", k)
+		}
+		return true
+	})
+}
+
+// Test that URLs missing from the fixture are not found
+func TestReplayFetcher_missingURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-fixture-")
+	if err != nil {
+		t.Fatalf("Failed to create fixture directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(dir+"/"+FIXTURE_INDEX_FILENAME, nil, 0644)
+
+	replayer, err := NewReplayFetcher(dir)
+	if err != nil {
+		t.Fatalf("Failed to create replay fetcher: %s", err)
+	}
+	if _, err := replayer.Fetch("https://monzo.com"); err == nil {
+		t.Errorf("Expecting an error for a URL that was not recorded.")
+	} else if _, ok := err.(Http404Error); !ok {
+		t.Errorf("Expecting Http404Error, got (%s)", err)
+	}
+}
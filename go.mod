@@ -0,0 +1,16 @@
+module github.com/skfarhat/go-web-crawler
+
+go 1.25
+
+require (
+	github.com/pkg/profile v1.7.0
+	github.com/valyala/fasthttp v1.69.0
+)
+
+require (
+	github.com/andybalholm/brotli v1.2.0 // indirect
+	github.com/felixge/fgprof v0.9.3 // indirect
+	github.com/google/pprof v0.0.0-20211214055906-6f57359322fd // indirect
+	github.com/klauspost/compress v1.20.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+)
@@ -0,0 +1,143 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --------------------
+// Crawl history
+// --------------------
+
+// Number of runs kept per site unless told otherwise
+const DEFAULT_HISTORY_RUNS int = 30
+
+// Summary of a crawl kept in the history of its site
+type RunSummary struct {
+	Site            string    `json:"site"`
+	RunID           string    `json:"run_id,omitempty"`
+	Started         time.Time `json:"started"`
+	DurationMs      float64   `json:"duration_ms"`
+	Pages           int       `json:"pages"`
+	Errors          int       `json:"errors"`
+	BrokenLinks     int       `json:"broken_links"`
+	MedianLatencyMs float64   `json:"median_latency_ms"`
+
+	Sections []SectionStats `json:"sections,omitempty"`
+
+	// Content changed since the previous crawl, see CompareFingerprints
+	Changes []SectionChange `json:"changes,omitempty"`
+}
+
+// Returns the summary of the given crawl result
+func summarizeRun(site string, started time.Time, res *CrawlResult) RunSummary {
+	s := RunSummary{Site: site, RunID: res.RunID, Started: started, DurationMs: float64(res.Duration) / float64(time.Millisecond),
+		Pages: len(res.Pages), Errors: len(res.Errors), Sections: res.Sections()}
+	for _, err := range res.Errors {
+		if errorCategory(err) == "not found" {
+			s.BrokenLinks++
+		}
+	}
+	var latencies []time.Duration
+	for _, page := range res.Pages {
+		latencies = append(latencies, page.Stat.getTime)
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		s.MedianLatencyMs = float64(latencies[len(latencies)/2]) / float64(time.Millisecond)
+	}
+	return s
+}
+
+// Returns the summary of res, the result of the crawl started at started, along with the
+// content changed since the previous crawl when compared with RecordContentChanges
+func (c *Crawler) Summary(started time.Time, res *CrawlResult) RunSummary {
+	run := summarizeRun(c.baseSite, started, res)
+	run.Changes = c.contentChanges
+	return run
+}
+
+// Returns a file name without extension for the given site, e.g. https_monzo.com
+func siteFilename(site string) string {
+	return strings.NewReplacer("://", "_", "/", "_", ":", "_").Replace(strings.TrimSuffix(site, "/"))
+}
+
+// Returns the file holding the history of the given site in dir, one RunSummary per line
+func historyFile(dir string, site string) string {
+	return filepath.Join(dir, siteFilename(site)+".ndjson")
+}
+
+// Returns the runs recorded for the given site in dir, oldest first
+func LoadHistory(dir string, site string) ([]RunSummary, error) {
+	f, err := os.Open(historyFile(dir, site))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var runs []RunSummary
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var run RunSummary
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			return nil, fmt.Errorf("Malformed line in history (%s): %s", scanner.Text(), err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, scanner.Err()
+}
+
+// Adds the given run to the history of its site in dir, only keeping the last maxRuns
+func AppendHistory(dir string, run RunSummary, maxRuns int) error {
+	runs, err := LoadHistory(dir, run.Site)
+	if err != nil {
+		return err
+	}
+	runs = append(runs, run)
+	if maxRuns > 0 && len(runs) > maxRuns {
+		runs = runs[len(runs)-maxRuns:]
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := createAtomic(historyFile(dir, run.Site))
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, r := range runs {
+		if err := enc.Encode(r); err != nil {
+			f.Abort()
+			return err
+		}
+	}
+	return f.Commit()
+}
+
+// Write how the site's health evolved over the given runs to w
+func WriteTrends(w io.Writer, runs []RunSummary) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%-20s %8s %8s %8s %12s\n", "run", "pages", "errors", "broken", "median GET")
+	for i, run := range runs {
+		fmt.Fprintf(bw, "%-20s %8d %8d %8d %10.1fms", run.Started.Format("2006-01-02 15:04"),
+			run.Pages, run.Errors, run.BrokenLinks, run.MedianLatencyMs)
+		if i > 0 {
+			fmt.Fprintf(bw, "  (%+d pages, %+d broken)", run.Pages-runs[i-1].Pages, run.BrokenLinks-runs[i-1].BrokenLinks)
+		}
+		if len(run.Changes) > 0 {
+			fmt.Fprintf(bw, "  %.1f%% changed", totalChange(run.Changes).ChangedRate()*100)
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
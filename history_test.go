@@ -0,0 +1,61 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that only the last runs of a site are kept, oldest first
+func TestAppendHistory_keepsLastRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-history-")
+	if err != nil {
+		t.Fatalf("Failed to create history directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		run := RunSummary{Site: "https://monzo.com", Started: start.AddDate(0, 0, i), Pages: 10 + i}
+		if err := AppendHistory(dir, run, 3); err != nil {
+			t.Fatalf("Failed to append run: %s", err)
+		}
+	}
+	AppendHistory(dir, RunSummary{Site: "https://other.com", Started: start, Pages: 1}, 3)
+
+	runs, err := LoadHistory(dir, "https://monzo.com")
+	if err != nil {
+		t.Fatalf("Failed to load history: %s", err)
+	}
+	if len(runs) != 3 || runs[0].Pages != 12 || runs[2].Pages != 14 {
+		t.Errorf("Expecting the last (3) runs oldest first, got (%+v)", runs)
+	}
+
+	var out bytes.Buffer
+	WriteTrends(&out, runs)
+	if !strings.Contains(out.String(), "(+1 pages, +0 broken)") {
+		t.Errorf("Expecting the change between runs in the trends, got (%s)", out.String())
+	}
+}
+
+// Test that runs are summarised from the crawl result
+func TestSummarizeRun(t *testing.T) {
+	site := &SyntheticSite{Depth: 2, Branching: 3}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	start := time.Now()
+	res, _ := c.Run(context.Background())
+
+	run := summarizeRun(ts.URL, start, res)
+	if run.Pages != site.Pages() || run.Errors != 0 || run.MedianLatencyMs <= 0 {
+		t.Errorf("Expecting (%d) pages without errors, got (%+v)", site.Pages(), run)
+	}
+}
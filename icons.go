@@ -0,0 +1,132 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// --------------------
+// Icons and web app manifest
+// --------------------
+
+// Kinds of the icons checked, see IconCheck
+const (
+	ICON_FAVICON       = "favicon"       // /favicon.ico, requested by browsers whether declared or not
+	ICON_LINK          = "icon"          // <link rel="icon">, apple-touch-icon and others
+	ICON_MANIFEST      = "manifest"      // <link rel="manifest">
+	ICON_MANIFEST_ICON = "manifest icon" // Listed in the icons of a manifest
+)
+
+var linkRelRe = regexp.MustCompile("(?i)rel\\s*=\\s*[\"']?([^\"'>]+)")
+
+// Returns the href of the <link> tags of the given html with a rel value accepted by the given function, as written
+func findLinkTags(html []byte, rel func(value string) bool) []string {
+	var hrefs []string
+	for _, tag := range linkTagRe.FindAll(html, -1) {
+		m := linkRelRe.FindSubmatch(tag)
+		if m == nil {
+			continue
+		}
+		for _, value := range strings.Fields(strings.ToLower(string(m[1]))) {
+			if rel(value) {
+				if href := linkHrefRe.FindSubmatch(tag); href != nil {
+					hrefs = append(hrefs, string(href[1]))
+				}
+				break
+			}
+		}
+	}
+	return hrefs
+}
+
+// Returns the href of the icons declared in the given html (icon, shortcut icon, apple-touch-icon..), as written
+func FindIconLinks(html []byte) []string {
+	return findLinkTags(html, func(value string) bool { return strings.HasSuffix(value, "icon") })
+}
+
+// Returns the href of the web app manifests declared in the given html, as written
+func FindManifestLinks(html []byte) []string {
+	return findLinkTags(html, func(value string) bool { return value == "manifest" })
+}
+
+// Web app manifest, only what is checked of it
+type webManifest struct {
+	Icons []struct {
+		Src string `json:"src"`
+	} `json:"icons"`
+}
+
+// Outcome of checking an icon or manifest, see Crawler.checkIcons
+type IconCheck struct {
+	URL  string `json:"url"`
+	Kind string `json:"kind"`
+
+	// Page declaring it, empty for /favicon.ico
+	Referrer string `json:"referrer,omitempty"`
+
+	// What is wrong with it, empty if nothing
+	Problem string `json:"problem,omitempty"`
+}
+
+// Checks the icon or manifest at the given URL in the background, once per URL
+func (c *Crawler) checkIcon(site string, kind string, referrer string) {
+	if _, checked := c.icons.LoadOrStore(site, IconCheck{URL: site, Kind: kind, Referrer: referrer}); checked {
+		return
+	}
+	c.pending.Add()
+	go func() {
+		defer c.pending.Done()
+		if c.fetchSlots != nil {
+			c.fetchSlots <- struct{}{}
+			defer func() { <-c.fetchSlots }()
+		}
+		check := IconCheck{URL: site, Kind: kind, Referrer: referrer}
+		res, err := c.fetcherOrDefault().Fetch(site)
+		switch {
+		case err != nil:
+			check.Problem = errorCategory(err)
+		case kind == ICON_MANIFEST:
+			var manifest webManifest
+			if err := json.Unmarshal(res.Body.Bytes(), &manifest); err != nil {
+				check.Problem = fmt.Sprintf("malformed JSON: %s", err)
+			}
+			for _, icon := range manifest.Icons {
+				if len(icon.Src) > 0 {
+					c.checkIcon(c.resolveLink(site, icon.Src), ICON_MANIFEST_ICON, site)
+				}
+			}
+		case strings.Contains(mediaType(res.Header.Get("Content-Type")), "html"):
+			check.Problem = "served as an HTML page"
+		}
+		if res != nil && res.Body != nil {
+			releaseBody(res.Body)
+		}
+		c.icons.Store(site, check)
+	}()
+}
+
+// Checks the icons and manifests declared by the given page
+func (c *Crawler) checkPageIcons(page string, html []byte) {
+	for _, icon := range FindIconLinks(html) {
+		c.checkIcon(c.resolveLink(page, icon), ICON_LINK, page)
+	}
+	for _, manifest := range FindManifestLinks(html) {
+		c.checkIcon(c.resolveLink(page, manifest), ICON_MANIFEST, page)
+	}
+}
+
+// Returns the icons and manifests that failed their check, sorted by URL
+func (c *Crawler) iconProblems() []IconCheck {
+	var problems []IconCheck
+	c.icons.Range(func(k, v interface{}) bool {
+		if check := v.(IconCheck); len(check.Problem) > 0 {
+			problems = append(problems, check)
+		}
+		return true
+	})
+	sort.Slice(problems, func(i, j int) bool { return problems[i].URL < problems[j].URL })
+	return problems
+}
@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFindIconLinks(t *testing.T) {
+	html := []byte(`<head><link rel="shortcut icon" href="/favicon.png"><link rel='apple-touch-icon' href='/touch.png'>
+		<link rel="stylesheet" href="/style.css"><link href="/site.webmanifest" rel="manifest"></head>`)
+	if icons := FindIconLinks(html); len(icons) != 2 || icons[0] != "/favicon.png" || icons[1] != "/touch.png" {
+		t.Errorf("Expecting ([/favicon.png /touch.png]), got (%v)", icons)
+	}
+	if manifests := FindManifestLinks(html); len(manifests) != 1 || manifests[0] != "/site.webmanifest" {
+		t.Errorf("Expecting ([/site.webmanifest]), got (%v)", manifests)
+	}
+}
+
+// favicon.ico is missing, the manifest is malformed and the icon it lists answers with a page
+func TestCrawlIcons(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/favicon.ico":
+			http.NotFound(w, r)
+		case "/icon.png":
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, "\x89PNG")
+		case "/good.webmanifest":
+			io.WriteString(w, `{"name": "Monzo", "icons": [{"src": "/login"}]}`)
+		case "/bad.webmanifest":
+			io.WriteString(w, `{"name": "Monzo",}`)
+		case "/login":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, "<html>Log in</html>")
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<html><head><link rel="icon" href="/icon.png"><link rel="manifest" href="/good.webmanifest">`+
+				`</head><a href="/about">About</a></html>`)
+			if r.URL.Path == "/about" {
+				io.WriteString(w, `<link rel="manifest" href="bad.webmanifest">`)
+			}
+		}
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.checkIcons = true
+	c.Run(context.Background())
+
+	problems := c.iconProblems()
+	want := map[string]string{"/bad.webmanifest": ICON_MANIFEST, "/favicon.ico": ICON_FAVICON, "/login": ICON_MANIFEST_ICON}
+	if len(problems) != len(want) {
+		t.Fatalf("Expecting (%d) problems, got (%+v)", len(want), problems)
+	}
+	for _, p := range problems {
+		if kind, present := want[strings.TrimPrefix(p.URL, ts.URL)]; !present || kind != p.Kind {
+			t.Errorf("Expecting no problem with (%s), got (%+v)", p.URL, p)
+		}
+	}
+
+	var report bytes.Buffer
+	c.WriteReport(&report)
+	if want := ts.URL + "/favicon.ico (favicon): not found"; !strings.Contains(report.String(), want) {
+		t.Errorf("Expecting (%s) in the report, got (%s)", want, report.String())
+	}
+	found := false
+	for _, f := range c.Findings() {
+		found = found || f.Rule == RULE_ICON && f.URL == ts.URL+"/bad.webmanifest"
+	}
+	if !found {
+		t.Errorf("Expecting the malformed manifest in the findings, got (%+v)", c.Findings())
+	}
+}
@@ -0,0 +1,158 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --------------------
+// Imports
+// --------------------
+
+// Pages of a crawl made by another tool, merged from one or more of its exports
+type CrawlImport struct {
+	pages map[string]*streamedPage
+}
+
+// Returns an empty CrawlImport, see ImportScreamingFrog and ImportSitemap
+func NewCrawlImport() *CrawlImport {
+	return &CrawlImport{pages: make(map[string]*streamedPage)}
+}
+
+// Returns the page of the given URL, added if not imported yet
+func (ci *CrawlImport) page(site string) *streamedPage {
+	p, present := ci.pages[site]
+	if !present {
+		p = &streamedPage{URL: site}
+		ci.pages[site] = p
+	}
+	return p
+}
+
+// Returns the imported pages, sorted by URL
+func (ci *CrawlImport) Pages() []streamedPage {
+	pages := make([]streamedPage, 0, len(ci.pages))
+	for _, p := range ci.pages {
+		pages = append(pages, *p)
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].URL < pages[j].URL })
+	return pages
+}
+
+// Records the given status code of a page as its outcome, see errorCategory
+func importStatus(p *streamedPage, status int) {
+	switch {
+	case status == 0:
+		// Screaming Frog reports connection timeouts and refusals without a status
+		p.Error, p.Category = "No response", "timeout"
+	case status >= 500:
+		p.Error, p.Category = fmt.Sprintf("Status %d", status), "server error"
+	case status >= 400:
+		p.Error, p.Category = fmt.Sprintf("Status %d", status), "not found"
+	}
+}
+
+// Returns the index of each column of a CSV header, by lowercase name
+func csvColumns(header []string) map[string]int {
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	return columns
+}
+
+// Imports a Screaming Frog CSV export: the pages of "Internal: All" (Address, Status Code,
+// Crawl Depth, Response Time..) or the links of "All Outlinks" (Source, Destination..).
+func (ci *CrawlImport) ImportScreamingFrog(r io.Reader) error {
+	// Exports start with a byte order mark, which the CSV reader takes for part of a field
+	br := bufio.NewReader(r)
+	if bom, _ := br.Peek(3); string(bom) == "\ufeff" {
+		br.Discard(3)
+	}
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	columns := csvColumns(header)
+	field := func(record []string, name string) string {
+		if i, present := columns[name]; present && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	_, pages := columns["address"]
+	_, source := columns["source"]
+	_, destination := columns["destination"]
+	if !pages && !(source && destination) {
+		return fmt.Errorf("Unknown Screaming Frog export, expecting an Address column or Source and Destination columns")
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if pages {
+			p := ci.page(field(record, "address"))
+			status, _ := strconv.Atoi(field(record, "status code"))
+			importStatus(p, status)
+			if depth, err := strconv.Atoi(field(record, "crawl depth")); err == nil {
+				p.Depth = depth
+				if depth == 0 {
+					p.Source = SOURCE_SEED
+				}
+			}
+			if seconds, err := strconv.ParseFloat(field(record, "response time"), 64); err == nil {
+				p.GetTimeMs = seconds * 1000
+			}
+			continue
+		}
+
+		// Only hyperlinks between pages, not images, scripts and stylesheets
+		if kind := field(record, "type"); len(kind) > 0 && !strings.EqualFold(kind, "hyperlink") {
+			continue
+		}
+		from, to := field(record, "source"), field(record, "destination")
+		parent := ci.page(from)
+		parent.Children = append(parent.Children, to)
+		if child := ci.page(to); len(child.Referrer) == 0 {
+			child.Referrer, child.Source = from, SOURCE_ANCHOR
+		}
+	}
+}
+
+// Imports the pages listed in a sitemap.xml, returns the sitemaps listed if it is an index
+func (ci *CrawlImport) ImportSitemap(r io.Reader) ([]string, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	urls, sitemaps, err := ParseSitemap(content)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range urls {
+		if p := ci.page(u); len(p.Source) == 0 {
+			p.Source = SOURCE_SITEMAP
+		}
+	}
+	return sitemaps, nil
+}
+
+// Keeps each child of a page once, exports list a link for each time a page links to another
+func (ci *CrawlImport) DedupChildren() {
+	for _, p := range ci.pages {
+		p.Children, _ = dedupLinks(p.Children)
+	}
+}
@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Pages and links of separate exports are merged
+func TestCrawlImport_ImportScreamingFrog(t *testing.T) {
+	internal := "\ufeff\"Address\",\"Content Type\",\"Status Code\",\"Status\",\"Crawl Depth\",\"Response Time\"\n" +
+		"\"https://monzo.com/\",\"text/html\",\"200\",\"OK\",\"0\",\"0.120\"\n" +
+		"\"https://monzo.com/old\",\"text/html\",\"404\",\"Not Found\",\"1\",\"0.050\"\n" +
+		"\"https://monzo.com/slow\",\"\",\"0\",\"Connection Timeout\",\"1\",\"\"\n"
+	outlinks := "Type,Source,Destination,Status Code\n" +
+		"Hyperlink,https://monzo.com/,https://monzo.com/old,404\n" +
+		"Hyperlink,https://monzo.com/,https://monzo.com/old,404\n" +
+		"Image,https://monzo.com/,https://monzo.com/logo.png,200\n" +
+		"Hyperlink,https://monzo.com/,https://monzo.com/slow,0\n"
+
+	ci := NewCrawlImport()
+	if err := ci.ImportScreamingFrog(strings.NewReader(internal)); err != nil {
+		t.Fatalf("Failed to import pages: %s", err)
+	}
+	if err := ci.ImportScreamingFrog(strings.NewReader(outlinks)); err != nil {
+		t.Fatalf("Failed to import links: %s", err)
+	}
+	ci.DedupChildren()
+
+	pages := ci.Pages()
+	if len(pages) != 3 {
+		t.Fatalf("Expecting 3 pages, got (%+v)", pages)
+	}
+	home, old, slow := pages[0], pages[1], pages[2]
+	if home.Source != SOURCE_SEED || home.GetTimeMs != 120 || home.outcome() != "ok" ||
+		!reflect.DeepEqual(home.Children, []string{"https://monzo.com/old", "https://monzo.com/slow"}) {
+		t.Errorf("Expecting the home page to link to old and slow, got (%+v)", home)
+	}
+	if old.Category != "not found" || old.Depth != 1 || old.Referrer != "https://monzo.com/" {
+		t.Errorf("Expecting old to be not found, linked from the home page, got (%+v)", old)
+	}
+	if slow.Category != "timeout" {
+		t.Errorf("Expecting slow to have timed out, got (%+v)", slow)
+	}
+
+	if err := NewCrawlImport().ImportScreamingFrog(strings.NewReader("URL,Title\n")); err == nil {
+		t.Errorf("Expecting an unknown export to be rejected")
+	}
+}
+
+func TestCrawlImport_ImportSitemap(t *testing.T) {
+	ci := NewCrawlImport()
+	sitemap := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://monzo.com/</loc></url>
+  <url><loc>https://monzo.com/about</loc></url>
+</urlset>`
+	if sitemaps, err := ci.ImportSitemap(strings.NewReader(sitemap)); err != nil || len(sitemaps) > 0 {
+		t.Fatalf("Failed to import sitemap: (%v, %v)", sitemaps, err)
+	}
+	pages := ci.Pages()
+	if len(pages) != 2 || pages[1].URL != "https://monzo.com/about" || pages[1].Source != SOURCE_SITEMAP {
+		t.Errorf("Expecting the 2 pages of the sitemap, got (%+v)", pages)
+	}
+}
@@ -0,0 +1,300 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --------------------
+// Broken link issues
+// --------------------
+
+// Label of the issues opened for broken links
+const BROKEN_LINKS_LABEL = "broken-links"
+
+// API of github.com and gitlab.com, unless told otherwise for self-hosted instances
+const GITHUB_API = "https://api.github.com"
+const GITLAB_API = "https://gitlab.com/api/v4"
+
+// Internal link answering with not found, and the page it was first found on
+type BrokenLink struct {
+	URL      string
+	Referrer string
+}
+
+// Issue of a tracker, identified by its number within the repository or project
+type Issue struct {
+	Number int
+	Title  string
+	Body   string
+}
+
+// Where broken links are reported, as a single open issue per site kept up to date
+type IssueTracker interface {
+
+	// Returns the open issue with the given title, nil if there is none
+	FindIssue(title string) (*Issue, error)
+
+	CreateIssue(title string, body string) error
+	UpdateIssue(issue *Issue, body string) error
+}
+
+type IssueTrackerError struct {
+	Request string
+	Status  int
+	Message string
+}
+
+func (e IssueTrackerError) Error() string {
+	return fmt.Sprintf("Issue tracker request (%s) failed with status (%d): %s", e.Request, e.Status, e.Message)
+}
+
+// Sends a JSON request to an issue tracker API, decoding the response into out unless nil
+func trackerRequest(client *http.Client, method string, endpoint string, header http.Header, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return IssueTrackerError{Request: method + " " + endpoint, Status: res.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// Issues of a GitHub repository, owner/repo
+type GitHubTracker struct {
+	API    string
+	Repo   string
+	Token  string
+	Client *http.Client
+}
+
+func (g *GitHubTracker) header() http.Header {
+	return http.Header{"Authorization": {"Bearer " + g.Token}, "Accept": {"application/vnd.github+json"}}
+}
+
+func (g *GitHubTracker) FindIssue(title string) (*Issue, error) {
+	var issues []struct {
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+		Body   string `json:"body"`
+	}
+	endpoint := fmt.Sprintf("%s/repos/%s/issues?state=open&per_page=100&labels=%s", g.API, g.Repo, BROKEN_LINKS_LABEL)
+	if err := trackerRequest(g.Client, http.MethodGet, endpoint, g.header(), nil, &issues); err != nil {
+		return nil, err
+	}
+	for _, i := range issues {
+		if i.Title == title {
+			return &Issue{Number: i.Number, Title: i.Title, Body: i.Body}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (g *GitHubTracker) CreateIssue(title string, body string) error {
+	issue := map[string]interface{}{"title": title, "body": body, "labels": []string{BROKEN_LINKS_LABEL}}
+	return trackerRequest(g.Client, http.MethodPost, fmt.Sprintf("%s/repos/%s/issues", g.API, g.Repo), g.header(), issue, nil)
+}
+
+func (g *GitHubTracker) UpdateIssue(issue *Issue, body string) error {
+	endpoint := fmt.Sprintf("%s/repos/%s/issues/%d", g.API, g.Repo, issue.Number)
+	return trackerRequest(g.Client, http.MethodPatch, endpoint, g.header(), map[string]string{"body": body}, nil)
+}
+
+// Issues of a GitLab project, group/project
+type GitLabTracker struct {
+	API     string
+	Project string
+	Token   string
+	Client  *http.Client
+}
+
+func (g *GitLabTracker) header() http.Header {
+	return http.Header{"Private-Token": {g.Token}}
+}
+
+// Returns the API URL of the issues of the project
+func (g *GitLabTracker) issues() string {
+	return fmt.Sprintf("%s/projects/%s/issues", g.API, url.PathEscape(g.Project))
+}
+
+func (g *GitLabTracker) FindIssue(title string) (*Issue, error) {
+	var issues []struct {
+		IID         int    `json:"iid"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+	endpoint := fmt.Sprintf("%s?state=opened&per_page=100&labels=%s", g.issues(), BROKEN_LINKS_LABEL)
+	if err := trackerRequest(g.Client, http.MethodGet, endpoint, g.header(), nil, &issues); err != nil {
+		return nil, err
+	}
+	for _, i := range issues {
+		if i.Title == title {
+			return &Issue{Number: i.IID, Title: i.Title, Body: i.Description}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (g *GitLabTracker) CreateIssue(title string, body string) error {
+	issue := map[string]string{"title": title, "description": body, "labels": BROKEN_LINKS_LABEL}
+	return trackerRequest(g.Client, http.MethodPost, g.issues(), g.header(), issue, nil)
+}
+
+func (g *GitLabTracker) UpdateIssue(issue *Issue, body string) error {
+	endpoint := fmt.Sprintf("%s/%d", g.issues(), issue.Number)
+	return trackerRequest(g.Client, http.MethodPut, endpoint, g.header(), map[string]string{"description": body}, nil)
+}
+
+// Returns the tracker of the given github:owner/repo or gitlab:group/project, using the API
+// at api if not empty and the token in GITHUB_TOKEN or GITLAB_TOKEN read with getenv
+func NewIssueTracker(target string, api string, getenv func(string) string) (IssueTracker, error) {
+	i := strings.Index(target, ":")
+	if i < 0 || !strings.Contains(target[i+1:], "/") {
+		return nil, fmt.Errorf("Invalid issue tracker (%s), expecting github:owner/repo or gitlab:group/project", target)
+	}
+	kind, repo := target[:i], target[i+1:]
+	client := &http.Client{Timeout: 30 * time.Second}
+	switch kind {
+	case "github":
+		token := getenv("GITHUB_TOKEN")
+		if len(token) == 0 {
+			return nil, fmt.Errorf("Reporting to (%s) needs GITHUB_TOKEN", target)
+		}
+		redactor.AddHeader("Authorization", "Bearer "+token)
+		if len(api) == 0 {
+			api = GITHUB_API
+		}
+		return &GitHubTracker{API: strings.TrimSuffix(api, "/"), Repo: repo, Token: token, Client: client}, nil
+	case "gitlab":
+		token := getenv("GITLAB_TOKEN")
+		if len(token) == 0 {
+			return nil, fmt.Errorf("Reporting to (%s) needs GITLAB_TOKEN", target)
+		}
+		redactor.AddHeader("Private-Token", token)
+		if len(api) == 0 {
+			api = GITLAB_API
+		}
+		return &GitLabTracker{API: strings.TrimSuffix(api, "/"), Project: repo, Token: token, Client: client}, nil
+	}
+	return nil, fmt.Errorf("Unknown issue tracker (%s), expecting github or gitlab", kind)
+}
+
+// Returns the internal links of the crawl that were not found, sorted by URL
+func (c *Crawler) brokenLinks() []BrokenLink {
+	var broken []BrokenLink
+	c.fetchErrors.Range(func(k, v interface{}) bool {
+		if _, notFound := v.(Http404Error); notFound {
+			broken = append(broken, BrokenLink{URL: k.(string), Referrer: c.discoveryOf(k.(string)).referrer})
+		}
+		return true
+	})
+	sort.Slice(broken, func(i, j int) bool { return broken[i].URL < broken[j].URL })
+	return broken
+}
+
+// Returns the title of the issue listing the broken links of site
+func brokenLinksTitle(site string) string {
+	host := site
+	if u, err := url.Parse(site); err == nil && len(u.Host) > 0 {
+		host = u.Host
+	}
+	return "Broken links on " + host
+}
+
+// Returns the URLs listed in the body of a broken links issue, one per "- " line
+func listedLinks(body string) map[string]bool {
+	listed := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "- ") {
+			continue
+		}
+		if fields := strings.Fields(line[2:]); len(fields) > 0 {
+			listed[fields[0]] = true
+		}
+	}
+	return listed
+}
+
+// Returns the lines listing the given links in an issue
+func brokenLinkLines(broken []BrokenLink) string {
+	var b strings.Builder
+	for _, link := range broken {
+		if len(link.Referrer) > 0 {
+			fmt.Fprintf(&b, "- %s (linked from %s)\n", link.URL, link.Referrer)
+		} else {
+			fmt.Fprintf(&b, "- %s\n", link.URL)
+		}
+	}
+	return b.String()
+}
+
+// Opens an issue listing the broken links of site, or adds those it does not list yet to the one
+// already open. Links reported before are never reported again while the issue is open.
+// Returns the links newly reported.
+func ReportBrokenLinks(tracker IssueTracker, site string, runID string, broken []BrokenLink) ([]BrokenLink, error) {
+	if len(broken) == 0 {
+		return nil, nil
+	}
+	title := brokenLinksTitle(site)
+	issue, err := tracker.FindIssue(title)
+	if err != nil {
+		return nil, err
+	}
+
+	if issue == nil {
+		body := fmt.Sprintf("Internal links not found when crawling %s (crawl %s).\n\n%s", site, runID, brokenLinkLines(broken))
+		return broken, tracker.CreateIssue(title, body)
+	}
+	listed := listedLinks(issue.Body)
+	var added []BrokenLink
+	for _, link := range broken {
+		if !listed[link.URL] {
+			added = append(added, link)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	body := fmt.Sprintf("%s\n\nNew in crawl %s (%s):\n\n%s", strings.TrimRight(issue.Body, "\n"), runID,
+		time.Now().Format("2006-01-02"), brokenLinkLines(added))
+	return added, tracker.UpdateIssue(issue, body)
+}
+
+// Reports the broken links of the crawl to tracker, see ReportBrokenLinks.
+// Returns the links newly reported.
+func (c *Crawler) ReportBrokenLinks(tracker IssueTracker) ([]BrokenLink, error) {
+	return ReportBrokenLinks(tracker, c.baseSite, c.runID, c.brokenLinks())
+}
@@ -0,0 +1,92 @@
+package crawler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Fake GitHub API holding the issues of a single repository
+type fakeGitHub struct {
+	mu     sync.Mutex
+	issues []map[string]interface{}
+}
+
+func (g *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer t0ken" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var in map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&in)
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/repos/monzo/site/issues":
+		json.NewEncoder(w).Encode(g.issues)
+	case r.Method == http.MethodPost && r.URL.Path == "/repos/monzo/site/issues":
+		in["number"] = float64(len(g.issues) + 1)
+		g.issues = append(g.issues, in)
+	case r.Method == http.MethodPatch && r.URL.Path == "/repos/monzo/site/issues/1":
+		g.issues[0]["body"] = in["body"]
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// A single issue is opened, then only links it does not list yet are added to it
+func TestReportBrokenLinks(t *testing.T) {
+	github := new(fakeGitHub)
+	ts := httptest.NewServer(github)
+	defer ts.Close()
+	tracker, err := NewIssueTracker("github:monzo/site", ts.URL, func(name string) string {
+		return map[string]string{"GITHUB_TOKEN": "t0ken"}[name]
+	})
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %s", err)
+	}
+
+	broken := []BrokenLink{{URL: "https://monzo.com/old", Referrer: "https://monzo.com/about"}}
+	reported, err := ReportBrokenLinks(tracker, "https://monzo.com", "run1", broken)
+	if err != nil || len(reported) != 1 || len(github.issues) != 1 {
+		t.Fatalf("Expecting an issue to be opened, got (%v, %v) (%v)", reported, err, github.issues)
+	}
+	if github.issues[0]["title"] != "Broken links on monzo.com" ||
+		!strings.Contains(github.issues[0]["body"].(string), "- https://monzo.com/old (linked from https://monzo.com/about)") {
+		t.Errorf("Expecting the broken link in the issue, got (%v)", github.issues[0])
+	}
+
+	broken = append(broken, BrokenLink{URL: "https://monzo.com/gone"})
+	reported, err = ReportBrokenLinks(tracker, "https://monzo.com", "run2", broken)
+	if err != nil || len(reported) != 1 || reported[0].URL != "https://monzo.com/gone" || len(github.issues) != 1 {
+		t.Fatalf("Expecting only the new link to be added, got (%v, %v) (%v)", reported, err, github.issues)
+	}
+	body := github.issues[0]["body"].(string)
+	if strings.Count(body, "https://monzo.com/old") != 1 || !strings.Contains(body, "New in crawl run2") {
+		t.Errorf("Expecting the new link appended once, got (%s)", body)
+	}
+
+	// Nothing new, nothing sent
+	if reported, err := ReportBrokenLinks(tracker, "https://monzo.com", "run3", broken); err != nil || len(reported) > 0 {
+		t.Errorf("Expecting nothing to be reported, got (%v, %v)", reported, err)
+	}
+}
+
+func TestNewIssueTracker(t *testing.T) {
+	env := func(name string) string { return map[string]string{"GITLAB_TOKEN": "t0ken"}[name] }
+	tracker, err := NewIssueTracker("gitlab:monzo/web/site", "", env)
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %s", err)
+	}
+	if g, ok := tracker.(*GitLabTracker); !ok || g.issues() != GITLAB_API+"/projects/monzo%2Fweb%2Fsite/issues" {
+		t.Errorf("Expecting the issues of monzo/web/site on gitlab.com, got (%+v)", tracker)
+	}
+	for _, target := range []string{"github:monzo/site", "jira:monzo/site", "gitlab:site"} {
+		if _, err := NewIssueTracker(target, "", env); err == nil {
+			t.Errorf("Expecting (%s) to be rejected", target)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package crawler
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// --------------------
+// JUnit XML
+// --------------------
+
+type junitFailure struct {
+	Type    string `xml:"type,attr"`
+	Message string `xml:"message,attr"`
+	Detail  string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// Write the findings of the crawl to w as JUnit XML, so that CI servers show them as failed tests.
+// Each rule of FINDING_RULES is a test suite with a test case per URL checked, failing if the
+// URL breaks the rule.
+func (c *Crawler) WriteJUnit(w io.Writer) error {
+	failed := make(map[string]map[string]Finding)
+	for _, f := range c.Findings() {
+		if failed[f.Rule] == nil {
+			failed[f.Rule] = make(map[string]Finding)
+		}
+		failed[f.Rule][f.URL] = f
+	}
+
+	urls := c.checkedURLs()
+	suites := junitTestSuites{Name: "crawl " + c.baseSite}
+	for _, rule := range FINDING_RULES {
+		suite := junitTestSuite{Name: rule.ID, Tests: len(urls)}
+		for _, u := range urls {
+			tc := junitTestCase{ClassName: rule.ID, Name: u}
+			if f, present := failed[rule.ID][u]; present {
+				tc.Failure = &junitFailure{Type: rule.ID, Message: f.Message, Detail: rule.Description + "\n" + f.Message}
+				suite.Failures++
+			}
+			suite.TestCases = append(suite.TestCases, tc)
+		}
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
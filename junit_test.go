@@ -0,0 +1,35 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+// Each rule is a suite with a case per URL checked, failing for the URLs breaking it
+func TestCrawler_WriteJUnit(t *testing.T) {
+	c, ts := crawlSiteWithFindings(t)
+	defer ts.Close()
+
+	var out bytes.Buffer
+	if err := c.WritePrintMode(&out, "junit"); err != nil {
+		t.Fatalf("WriteJUnit failed: %v", err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(out.Bytes(), &suites); err != nil {
+		t.Fatalf("Expecting valid XML, got (%v) (%s)", err, out.String())
+	}
+	if len(suites.Suites) != len(FINDING_RULES) || suites.Failures != 2 {
+		t.Fatalf("Expecting a suite per rule and 2 failures, got (%+v)", suites)
+	}
+
+	broken := suites.Suites[0]
+	if broken.Name != RULE_BROKEN_LINK || broken.Tests != 4 || broken.Failures != 1 {
+		t.Errorf("Expecting 4 URLs checked for broken links, 1 failing, got (%+v)", broken)
+	}
+	for _, tc := range broken.TestCases {
+		if failed := tc.Failure != nil; failed != (tc.Name == ts.URL+"/old") {
+			t.Errorf("Expecting only (%s/old) to fail, got (%+v)", ts.URL, tc)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --------------------
+// robots.txt and sitemap lint
+// --------------------
+
+// Limits of the sitemaps protocol, a sitemap over either is ignored by search engines
+const (
+	MAX_SITEMAP_URLS  int = 50000
+	MAX_SITEMAP_BYTES int = 50 * 1024 * 1024 // Uncompressed
+)
+
+// Bytes of robots.txt crawlers must read, the rest may be ignored, see RFC 9309
+const MAX_ROBOTS_BYTES int = 500 * 1024
+
+// Files linted, see LintProblem
+const (
+	LINT_ROBOTS  = "robots.txt"
+	LINT_SITEMAP = "sitemap"
+)
+
+// Directives of robots.txt understood by at least the major search engines
+var robotsDirectives = map[string]bool{
+	"user-agent":  true,
+	"allow":       true,
+	"disallow":    true,
+	"crawl-delay": true,
+	"sitemap":     true,
+	"host":        true,
+	"clean-param": true,
+}
+
+// Problem with robots.txt or a sitemap of the site
+type LintProblem struct {
+	URL  string `json:"url"`
+	Kind string `json:"kind"`
+
+	// Line of robots.txt the problem is on, 0 when it is about the whole file
+	Line int `json:"line,omitempty"`
+
+	Problem string `json:"problem"`
+}
+
+// Returns the problems of the syntax of the given robots.txt, those ParseRobots skips silently
+func LintRobots(robots []byte) []LintProblem {
+	var problems []LintProblem
+	add := func(line int, format string, a ...interface{}) {
+		problems = append(problems, LintProblem{Kind: LINT_ROBOTS, Line: line, Problem: fmt.Sprintf(format, a...)})
+	}
+	if len(robots) > MAX_ROBOTS_BYTES {
+		add(0, "larger than %d KiB, crawlers may ignore the rest", MAX_ROBOTS_BYTES/1024)
+	}
+
+	inGroup := false
+	n := 0
+	scanner := bufio.NewScanner(bytes.NewReader(robots))
+	for scanner.Scan() {
+		n++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			add(n, "not a directive, expecting (name: value)")
+			continue
+		}
+		key, value := strings.ToLower(strings.TrimSpace(line[:i])), strings.TrimSpace(line[i+1:])
+		if !robotsDirectives[key] {
+			add(n, "unknown directive (%s)", strings.TrimSpace(line[:i]))
+			continue
+		}
+
+		switch key {
+		case "user-agent":
+			inGroup = true
+			if len(value) == 0 {
+				add(n, "empty User-agent")
+			}
+		case "allow", "disallow":
+			if !inGroup {
+				add(n, "%s before any User-agent, ignored", strings.TrimSpace(line[:i]))
+			} else if len(value) > 0 && value[0] != '/' && value[0] != '*' {
+				add(n, "path (%s) should start with / or *", value)
+			}
+		case "crawl-delay":
+			if !inGroup {
+				add(n, "Crawl-delay before any User-agent, ignored")
+			} else if seconds, err := strconv.ParseFloat(value, 64); err != nil || seconds < 0 {
+				add(n, "invalid Crawl-delay (%s), expecting seconds", value)
+			}
+		case "sitemap":
+			if u, err := url.Parse(value); err != nil || !u.IsAbs() {
+				add(n, "Sitemap (%s) is not an absolute URL", value)
+			}
+		}
+	}
+	return problems
+}
+
+// Root element of a sitemap and what it lists, see LintSitemap
+type sitemapRootXML struct {
+	XMLName  xml.Name
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+// Returns the problems of the sitemap at the given URL with the given content, which may be
+// gzip-compressed, and the sitemaps it lists if it is an index. Sitemaps must be well-formed,
+// within the limits of the protocol and only list URLs under their own directory.
+func LintSitemap(sitemap string, content []byte) ([]LintProblem, []string) {
+	var problems []LintProblem
+	add := func(format string, a ...interface{}) {
+		problems = append(problems, LintProblem{URL: sitemap, Kind: LINT_SITEMAP, Problem: fmt.Sprintf(format, a...)})
+	}
+	content, err := decompressSitemap(content)
+	if err != nil {
+		add("invalid gzip: %s", err)
+		return problems, nil
+	}
+	if len(content) > MAX_SITEMAP_BYTES {
+		add("larger than %d MiB uncompressed", MAX_SITEMAP_BYTES/1024/1024)
+	}
+	var root sitemapRootXML
+	if err := xml.Unmarshal(content, &root); err != nil {
+		add("malformed XML: %s", err)
+		return problems, nil
+	}
+
+	var listed []string
+	switch root.XMLName.Local {
+	case "urlset":
+		listed = root.URLs
+	case "sitemapindex":
+		listed = root.Sitemaps
+	default:
+		add("root element is <%s>, expecting <urlset> or <sitemapindex>", root.XMLName.Local)
+		return problems, nil
+	}
+	if len(listed) == 0 {
+		add("lists no URLs")
+	}
+	if len(listed) > MAX_SITEMAP_URLS {
+		add("lists %d URLs, more than %d", len(listed), MAX_SITEMAP_URLS)
+	}
+
+	// Only URLs under the directory of the sitemap, on its scheme and host, may be listed
+	scope := sitemap[:strings.LastIndex(sitemap, "/")+1]
+	outside := 0
+	example := ""
+	for i, loc := range listed {
+		listed[i] = strings.TrimSpace(loc)
+		if !strings.HasPrefix(listed[i], scope) {
+			if outside == 0 {
+				example = listed[i]
+			}
+			outside++
+		}
+	}
+	if outside > 0 {
+		add("%d URLs outside of %s, e.g. %s", outside, scope, example)
+	}
+	return problems, root.Sitemaps
+}
+
+// Lints robots.txt and the sitemaps it declares, or /sitemap.xml if it declares none,
+// recording the problems in 'lintProblems'
+func (c *Crawler) lintSite() {
+	defer c.pending.Done()
+	if c.fetchSlots != nil {
+		c.fetchSlots <- struct{}{}
+		defer func() { <-c.fetchSlots }()
+	}
+	fetcher := c.fetcherOrDefault()
+
+	robots := c.origin() + "/robots.txt"
+	var sitemaps []string
+	res, err := fetcher.Fetch(robots)
+	switch err.(type) {
+	case nil:
+		problems := LintRobots(res.Body.Bytes())
+		if isHTMLResponse(res.Header, res.Body.Bytes()) {
+			problems = append(problems, LintProblem{Kind: LINT_ROBOTS, Problem: "served as an HTML page"})
+		}
+		for i := range problems {
+			problems[i].URL = robots
+		}
+		c.lintProblems.Store(robots, problems)
+		sitemaps = FindSitemapDirectives(res.Body.Bytes())
+		releaseBody(res.Body)
+	case Http404Error:
+	default:
+		c.lintProblems.Store(robots, []LintProblem{{URL: robots, Kind: LINT_ROBOTS, Problem: errorCategory(err)}})
+	}
+
+	if len(sitemaps) == 0 {
+		c.lintSitemap(fetcher, c.origin()+"/sitemap.xml", 0, true)
+	}
+	for _, sitemap := range sitemaps {
+		c.lintSitemap(fetcher, sitemap, 0, false)
+	}
+}
+
+// Lints the sitemap at the given URL and those it lists, up to MAX_SITEMAP_DEPTH.
+// A missing sitemap is only a problem when it was declared. Sitemaps on other sites
+// are not fetched when 'localOnly' is set.
+func (c *Crawler) lintSitemap(fetcher Fetcher, sitemap string, depth int, optional bool) {
+	if _, done := c.lintProblems.Load(sitemap); done || depth > MAX_SITEMAP_DEPTH || (c.localOnly && !c.isLocal(sitemap)) {
+		return
+	}
+	res, err := fetcher.Fetch(sitemap)
+	if err != nil {
+		if _, missing := err.(Http404Error); !missing || !optional {
+			c.lintProblems.Store(sitemap, []LintProblem{{URL: sitemap, Kind: LINT_SITEMAP, Problem: errorCategory(err)}})
+		}
+		return
+	}
+	problems, sitemaps := LintSitemap(sitemap, res.Body.Bytes())
+	releaseBody(res.Body)
+	c.lintProblems.Store(sitemap, problems)
+	for _, s := range sitemaps {
+		c.lintSitemap(fetcher, s, depth+1, false)
+	}
+}
+
+// Returns the problems found by the lint of robots.txt and the sitemaps, sorted by URL then line
+func (c *Crawler) lintFindings() []LintProblem {
+	var problems []LintProblem
+	c.lintProblems.Range(func(k, v interface{}) bool {
+		problems = append(problems, v.([]LintProblem)...)
+		return true
+	})
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].URL != problems[j].URL {
+			return problems[i].URL < problems[j].URL
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
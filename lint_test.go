@@ -0,0 +1,145 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLintRobots(t *testing.T) {
+	robots := []byte(`# Rules
+Disallow: /early
+User-agent: *
+Disalow: /typo
+Disallow: admin
+Allow: /*.css$
+Crawl-delay: soon
+just some text
+
+Sitemap: /sitemap.xml
+Sitemap: https://monzo.com/sitemap.xml
+`)
+	want := map[int]string{
+		2:  "Disallow before any User-agent, ignored",
+		4:  "unknown directive (Disalow)",
+		5:  "path (admin) should start with / or *",
+		7:  "invalid Crawl-delay (soon), expecting seconds",
+		8:  "not a directive, expecting (name: value)",
+		10: "Sitemap (/sitemap.xml) is not an absolute URL",
+	}
+	problems := LintRobots(robots)
+	if len(problems) != len(want) {
+		t.Fatalf("Expecting (%d) problems, got (%+v)", len(want), problems)
+	}
+	for _, p := range problems {
+		if want[p.Line] != p.Problem || p.Kind != LINT_ROBOTS {
+			t.Errorf("Expecting (%s) on line (%d), got (%s)", want[p.Line], p.Line, p.Problem)
+		}
+	}
+	if problems := LintRobots([]byte("User-agent: *\nDisallow:\n")); len(problems) != 0 {
+		t.Errorf("Expecting no problems, got (%+v)", problems)
+	}
+}
+
+func TestLintSitemap(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	io.WriteString(w, `<urlset><url><loc>https://monzo.com/blog/a</loc></url></urlset>`)
+	w.Close()
+
+	var many strings.Builder
+	many.WriteString("<urlset>")
+	for i := 0; i <= MAX_SITEMAP_URLS; i++ {
+		fmt.Fprintf(&many, "<url><loc>https://monzo.com/%d</loc></url>", i)
+	}
+	many.WriteString("</urlset>")
+
+	tests := []struct {
+		sitemap  string
+		content  string
+		problems []string
+	}{
+		{"https://monzo.com/blog/sitemap.xml", gz.String(), nil},
+		{"https://monzo.com/sitemap.xml", `<urlset><url><loc>https://monzo.com/a</loc></url>`,
+			[]string{"malformed XML: XML syntax error on line 1: unexpected EOF"}},
+		{"https://monzo.com/sitemap.xml", `<html></html>`,
+			[]string{"root element is <html>, expecting <urlset> or <sitemapindex>"}},
+		{"https://monzo.com/sitemap.xml", `<urlset></urlset>`, []string{"lists no URLs"}},
+		{"https://monzo.com/sitemap.xml", many.String(), []string{"lists 50001 URLs, more than 50000"}},
+		{"https://monzo.com/blog/sitemap.xml", `<urlset><url><loc>https://monzo.com/blog/a</loc></url>
+			<url><loc>https://monzo.com/about</loc></url><url><loc>http://monzo.com/blog/b</loc></url></urlset>`,
+			[]string{"2 URLs outside of https://monzo.com/blog/, e.g. https://monzo.com/about"}},
+	}
+	for _, test := range tests {
+		problems, _ := LintSitemap(test.sitemap, []byte(test.content))
+		var got []string
+		for _, p := range problems {
+			got = append(got, p.Problem)
+		}
+		if strings.Join(got, "; ") != strings.Join(test.problems, "; ") {
+			t.Errorf("Expecting (%v), got (%v)", test.problems, got)
+		}
+	}
+
+	_, sitemaps := LintSitemap("https://monzo.com/sitemap.xml",
+		[]byte(`<sitemapindex><sitemap><loc>https://monzo.com/blog.xml</loc></sitemap></sitemapindex>`))
+	if len(sitemaps) != 1 || sitemaps[0] != "https://monzo.com/blog.xml" {
+		t.Errorf("Expecting ([https://monzo.com/blog.xml]), got (%v)", sitemaps)
+	}
+}
+
+// robots.txt declares an index listing a sitemap with a page outside of it, and one that is missing
+func TestCrawlLint(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /admin\nNoindex: /private\nSitemap: %s/sitemaps/index.xml\n", ts.URL)
+		case "/sitemaps/index.xml":
+			fmt.Fprintf(w, "<sitemapindex><sitemap><loc>%[1]s/sitemaps/pages.xml</loc></sitemap>"+
+				"<sitemap><loc>%[1]s/sitemaps/missing.xml</loc></sitemap></sitemapindex>", ts.URL)
+		case "/sitemaps/pages.xml":
+			fmt.Fprintf(w, "<urlset><url><loc>%s/</loc></url></urlset>", ts.URL)
+		case "/sitemaps/missing.xml":
+			http.NotFound(w, r)
+		default:
+			io.WriteString(w, "<html>Home</html>")
+		}
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.lint = true
+	c.Run(context.Background())
+
+	want := []LintProblem{
+		{URL: ts.URL + "/robots.txt", Kind: LINT_ROBOTS, Line: 3, Problem: "unknown directive (Noindex)"},
+		{URL: ts.URL + "/sitemaps/missing.xml", Kind: LINT_SITEMAP, Problem: "not found"},
+		{URL: ts.URL + "/sitemaps/pages.xml", Kind: LINT_SITEMAP, Problem: "1 URLs outside of " + ts.URL + "/sitemaps/, e.g. " + ts.URL + "/"},
+	}
+	problems := c.lintFindings()
+	if fmt.Sprint(problems) != fmt.Sprint(want) {
+		t.Errorf("Expecting (%+v), got (%+v)", want, problems)
+	}
+
+	var report bytes.Buffer
+	c.WriteReport(&report)
+	if want := ts.URL + "/robots.txt:3: unknown directive (Noindex)"; !strings.Contains(report.String(), want) {
+		t.Errorf("Expecting (%s) in the report, got (%s)", want, report.String())
+	}
+	found := false
+	for _, f := range c.Findings() {
+		found = found || f.Rule == RULE_SITEMAP && f.URL == ts.URL+"/sitemaps/missing.xml"
+	}
+	if !found {
+		t.Errorf("Expecting the missing sitemap in the findings, got (%+v)", c.Findings())
+	}
+}
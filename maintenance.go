@@ -0,0 +1,145 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// --------------------
+// Maintenance mode
+// --------------------
+
+// Consecutive 503 responses taken for the whole site being down for maintenance, unless told otherwise
+const DEFAULT_MAINTENANCE_503S int = 10
+
+// Time the crawl pauses for when the site is down for maintenance, unless it sends Retry-After
+const DEFAULT_MAINTENANCE_BACKOFF time.Duration = 5 * time.Minute
+
+// Number of pauses after which the site is taken for down for good, and its errors recorded
+const MAX_MAINTENANCE_PAUSES int = 12
+
+// Bytes of the body of 503 responses kept to look for the maintenance signature
+const MAX_MAINTENANCE_BODY int64 = 64 << 10
+
+// Error of a 503 response, grouped with server errors in the report
+type ServiceUnavailable struct {
+	URL string
+
+	// Time the server asked to retry after, zero if it did not say
+	RetryAfter time.Duration
+
+	// Start of the body of the response
+	Body []byte
+}
+
+func (e ServiceUnavailable) Error() string {
+	return fmt.Sprintf("Service unavailable for URL (%s).", e.URL)
+}
+
+// Returns the time to wait of a Retry-After header, in seconds or as a date, zero if invalid
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(t); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// Pauses the crawl when the site is down for maintenance, detected by many consecutive 503
+// responses or a page containing the maintenance signature, instead of recording an error
+// for every page. Pages fetched during maintenance are fetched again once the pause is over.
+// The zero value never pauses.
+type maintenanceGuard struct {
+	mu sync.Mutex
+
+	// Consecutive 503 responses meaning maintenance, never when zero
+	threshold int
+
+	// Text of the maintenance page, e.g. "We'll be back soon", ignored when empty
+	signature string
+
+	// Time paused for, unless the server sends a longer Retry-After
+	backoff time.Duration
+
+	consecutive int
+
+	// End of the current pause, and number of pauses so far
+	until  time.Time
+	pauses int
+}
+
+// Records the outcome of a fetch, returns true if the page should be fetched again once
+// the maintenance is over
+func (m *maintenanceGuard) record(url string, err error, body *bytes.Buffer) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pauses >= MAX_MAINTENANCE_PAUSES {
+		return false
+	}
+	signed := func(content []byte) bool {
+		return len(m.signature) > 0 && bytes.Contains(content, []byte(m.signature))
+	}
+
+	var retryAfter time.Duration
+	unavailable, is503 := err.(ServiceUnavailable)
+	switch {
+	case is503:
+		m.consecutive++
+		retryAfter = unavailable.RetryAfter
+		if m.threshold <= 0 || m.consecutive < m.threshold {
+			if !signed(unavailable.Body) {
+				return false
+			}
+		}
+	case err == nil && body != nil && signed(body.Bytes()):
+	default:
+		m.consecutive = 0
+		return false
+	}
+
+	// Another page may have started the pause already
+	if time.Now().Before(m.until) {
+		return true
+	}
+	pause := m.backoff
+	if retryAfter > pause {
+		pause = retryAfter
+	}
+	m.until = time.Now().Add(pause)
+	m.pauses++
+	m.consecutive = 0
+	log.Printf("Site down for maintenance (%s), pausing the crawl for %s.\n", url, pause)
+	return true
+}
+
+// Blocks until the current pause is over or ctx is done, returns false if it is
+func (m *maintenanceGuard) wait(ctx context.Context) bool {
+	m.mu.Lock()
+	pause := time.Until(m.until)
+	m.mu.Unlock()
+	if pause <= 0 {
+		return true
+	}
+	if ctx == nil {
+		time.Sleep(pause)
+		return true
+	}
+	timer := time.NewTimer(pause)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,122 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("120"); got != 2*time.Minute {
+		t.Errorf("Expecting (2m), got (%s)", got)
+	}
+	if got := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); got < 59*time.Minute {
+		t.Errorf("Expecting about an hour, got (%s)", got)
+	}
+	if got := parseRetryAfter("soon"); got != 0 {
+		t.Errorf("Expecting (0) for an invalid value, got (%s)", got)
+	}
+}
+
+func TestMaintenanceGuard_record(t *testing.T) {
+	m := maintenanceGuard{threshold: 3, signature: "back soon", backoff: time.Hour}
+	unavailable := ServiceUnavailable{URL: "https://monzo.com"}
+	if m.record("a", unavailable, nil) || m.record("b", unavailable, nil) {
+		t.Errorf("Expecting no pause before (3) consecutive 503s")
+	}
+	if !m.record("c", unavailable, nil) || m.pauses != 1 {
+		t.Errorf("Expecting a pause after (3) consecutive 503s, got (%d) pauses", m.pauses)
+	}
+
+	m = maintenanceGuard{threshold: 3, signature: "back soon", backoff: time.Hour}
+	m.record("a", unavailable, nil)
+	m.record("b", nil, bytes.NewBufferString("<html>Hello</html>"))
+	if m.record("c", unavailable, nil) {
+		t.Errorf("Expecting a page answering to reset the count of 503s")
+	}
+	if !m.record("d", nil, bytes.NewBufferString("<html>We'll be back soon</html>")) {
+		t.Errorf("Expecting a pause for a page with the maintenance signature")
+	}
+	if m.record("e", Http404Error("e"), nil) {
+		t.Errorf("Expecting no pause for a page not found")
+	}
+
+	var zero maintenanceGuard
+	if zero.record("a", unavailable, nil) {
+		t.Errorf("Expecting the zero value to never pause")
+	}
+}
+
+// Pages answered with 503 while the site is down are fetched again once it is back,
+// with either HTTP client
+func TestCrawlMaintenance(t *testing.T) {
+	for _, fast := range []bool{false, true} {
+		var requests int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) <= 2 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				io.WriteString(w, "Down for maintenance")
+				return
+			}
+			io.WriteString(w, `<html><a href="/a">A</a></html>`)
+		}))
+
+		var c Crawler
+		c.Init(ts.URL)
+		c.fast = fast
+		c.probeNotFound = false
+		c.respectRobots = false
+		c.maintenance = maintenanceGuard{threshold: 1, backoff: 20 * time.Millisecond}
+		c.Run(context.Background())
+		ts.Close()
+
+		errors := 0
+		c.fetchErrors.Range(func(k, v interface{}) bool {
+			errors++
+			return true
+		})
+		if errors != 0 || c.maintenance.pauses != 2 {
+			t.Errorf("Expecting no errors and (2) pauses with fast (%t), got (%d) errors and (%d) pauses", fast, errors, c.maintenance.pauses)
+		}
+		if pages := len(c.Result().Pages); pages != 2 {
+			t.Errorf("Expecting (2) pages crawled with fast (%t), got (%d)", fast, pages)
+		}
+	}
+}
+
+// Status codes of the fasthttp client are mapped to the same errors as those of net/http
+func TestHTTPFetcher_fastStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/cached":
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			io.WriteString(w, "<html></html>")
+		}
+	}))
+	defer ts.Close()
+
+	f := &HTTPFetcher{Fast: true, Timeout: time.Second}
+	if _, err := f.Fetch(ts.URL + "/missing"); err != Http404Error(ts.URL+"/missing") {
+		t.Errorf("Expecting (%v), got (%v)", Http404Error(ts.URL+"/missing"), err)
+	}
+	if _, err := f.Fetch(ts.URL + "/broken"); err != HttpServerError(ts.URL+"/broken") {
+		t.Errorf("Expecting (%v), got (%v)", HttpServerError(ts.URL+"/broken"), err)
+	}
+	if _, err := f.Fetch(ts.URL + "/cached"); err != NotModified(ts.URL+"/cached") {
+		t.Errorf("Expecting (%v), got (%v)", NotModified(ts.URL+"/cached"), err)
+	}
+	if res, err := f.Fetch(ts.URL); err != nil || res.Body == nil {
+		t.Errorf("Expecting the page to be fetched, got (%v)", err)
+	}
+}
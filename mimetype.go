@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// --------------------
+// Content types
+// --------------------
+
+// Media types a resource of each extension may be served as. Kept here rather than taken from
+// mime.TypeByExtension, which also reads the mime.types of the system and so differs between hosts.
+var extensionTypes = map[string][]string{
+	".html":  {"text/html"},
+	".htm":   {"text/html"},
+	".css":   {"text/css"},
+	".js":    {"text/javascript", "application/javascript", "application/x-javascript"},
+	".json":  {"application/json"},
+	".xml":   {"application/xml", "text/xml"},
+	".txt":   {"text/plain"},
+	".csv":   {"text/csv"},
+	".pdf":   {"application/pdf"},
+	".zip":   {"application/zip"},
+	".png":   {"image/png"},
+	".jpg":   {"image/jpeg"},
+	".jpeg":  {"image/jpeg"},
+	".gif":   {"image/gif"},
+	".webp":  {"image/webp"},
+	".svg":   {"image/svg+xml"},
+	".ico":   {"image/x-icon", "image/vnd.microsoft.icon"},
+	".mp4":   {"video/mp4"},
+	".woff":  {"font/woff", "application/font-woff"},
+	".woff2": {"font/woff2"},
+}
+
+// URL whose Content-Type disagrees with its extension, e.g. a .png answered with an error page
+type TypeMismatch struct {
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+
+	// Media types expected of the extension of the URL
+	Expected []string `json:"expected"`
+}
+
+// Returns the media types expected of the extension of site, and true if the given Content-Type
+// is none of them. False when the extension or the Content-Type is unknown.
+func typeMismatch(site string, contentType string) ([]string, bool) {
+	if len(contentType) == 0 {
+		return nil, false
+	}
+	u, err := url.Parse(site)
+	if err != nil {
+		return nil, false
+	}
+	expected, known := extensionTypes[strings.ToLower(path.Ext(u.Path))]
+	if !known {
+		return nil, false
+	}
+	served := mediaType(contentType)
+	for _, t := range expected {
+		if t == served {
+			return expected, false
+		}
+	}
+	return expected, true
+}
+
+// Records the Content-Type the given URL was served with if it disagrees with its extension
+func (c *Crawler) checkContentType(site string, contentType string) {
+	if expected, mismatched := typeMismatch(site, contentType); mismatched {
+		c.typeMismatches.Store(site, TypeMismatch{URL: site, ContentType: contentType, Expected: expected})
+	}
+}
+
+// Returns the pages crawled and resources probed whose Content-Type disagrees with their
+// extension, sorted by URL
+func (c *Crawler) contentTypeMismatches() []TypeMismatch {
+	var mismatches []TypeMismatch
+	c.typeMismatches.Range(func(k, v interface{}) bool {
+		mismatches = append(mismatches, v.(TypeMismatch))
+		return true
+	})
+	for _, p := range c.probedResources() {
+		if p.Status >= 300 || len(p.Error) > 0 {
+			continue
+		}
+		if expected, mismatched := typeMismatch(p.URL, p.ContentType); mismatched {
+			mismatches = append(mismatches, TypeMismatch{URL: p.URL, ContentType: p.ContentType, Expected: expected})
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].URL < mismatches[j].URL })
+	return mismatches
+}
@@ -0,0 +1,66 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTypeMismatch(t *testing.T) {
+	tests := []struct {
+		url         string
+		contentType string
+		want        bool
+	}{
+		{"https://monzo.com/logo.png", "text/html; charset=utf-8", true},
+		{"https://monzo.com/logo.PNG", "image/png", false},
+		{"https://monzo.com/app.js?v=2", "application/javascript", false},
+		{"https://monzo.com/feed.xml", "application/json", true},
+		{"https://monzo.com/about", "text/html", false},
+		{"https://monzo.com/download.exe", "text/html", false},
+		{"https://monzo.com/logo.png", "", false},
+	}
+	for _, test := range tests {
+		if _, got := typeMismatch(test.url, test.contentType); got != test.want {
+			t.Errorf("Expecting (%v) for (%s) served as (%s), got (%v)", test.want, test.url, test.contentType, got)
+		}
+	}
+}
+
+// A page with a .html extension served as plain text and an image answered with an error page
+func TestCrawlContentTypeReport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/terms.html":
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, "Terms")
+		case "/logo.png":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, "<html>Not found</html>")
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<html><a href="/terms.html">Terms</a><a href="/logo.png">Logo</a><a href="/about">About</a></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.probeBytes = DEFAULT_PROBE_BYTES
+	c.Run(context.Background())
+
+	mismatches := c.contentTypeMismatches()
+	if len(mismatches) != 2 || mismatches[0].URL != ts.URL+"/logo.png" || mismatches[1].URL != ts.URL+"/terms.html" {
+		t.Errorf("Expecting (/logo.png) and (/terms.html) to be mismatched, got (%+v)", mismatches)
+	}
+	var report bytes.Buffer
+	c.WriteReport(&report)
+	if want := ts.URL + "/logo.png: served as text/html, expecting image/png"; !strings.Contains(report.String(), want) {
+		t.Errorf("Expecting (%s) in the report, got (%s)", want, report.String())
+	}
+}
@@ -0,0 +1,211 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------
+// Link rot monitor
+// --------------------
+
+// Number of checks kept per URL unless told otherwise
+const DEFAULT_MONITOR_CHECKS int = 100
+
+// Number of URLs checked at the same time unless told otherwise
+const DEFAULT_MONITOR_CONCURRENCY int = 10
+
+// Outcome of checking a URL once
+type URLCheck struct {
+	Time time.Time `json:"time"`
+
+	// ok, or the category of the error, see errorCategory
+	Outcome string `json:"outcome"`
+
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// Checks a fixed list of URLs, without discovering any other, and keeps the history of each.
+// Requests go through the same Fetcher and adaptive throttle as crawls.
+type LinkMonitor struct {
+	mu sync.Mutex
+
+	fetcher  Fetcher
+	throttle throttle
+
+	// Maximum number of URLs checked at the same time
+	concurrency int
+
+	// Checks of each URL, oldest first, at most maxChecks of them
+	history   map[string][]URLCheck
+	maxChecks int
+}
+
+// Returns a LinkMonitor checking URLs with fetcher, keeping maxChecks checks of each
+func NewLinkMonitor(fetcher Fetcher, concurrency int, maxChecks int) *LinkMonitor {
+	if concurrency <= 0 {
+		concurrency = DEFAULT_MONITOR_CONCURRENCY
+	}
+	return &LinkMonitor{fetcher: fetcher, throttle: throttle{windowSize: 20, threshold: 0.5},
+		concurrency: concurrency, history: make(map[string][]URLCheck), maxChecks: maxChecks}
+}
+
+// Returns the URLs listed in r, one per line. Blank lines and lines starting with # are skipped.
+func ParseURLList(r io.Reader) ([]string, error) {
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
+
+// Loads the history kept in the JSON file at path, none if it does not exist yet
+func (m *LinkMonitor) LoadHistory(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := json.Unmarshal(content, &m.history); err != nil {
+		return fmt.Errorf("Malformed monitor history (%s): %s", path, err)
+	}
+	return nil
+}
+
+// Writes the history to the JSON file at path, replacing it once fully written
+func (m *LinkMonitor) SaveHistory(path string) error {
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	err = json.NewEncoder(f).Encode(m.history)
+	m.mu.Unlock()
+	if err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
+
+// Checks each URL once and records the outcome in its history
+func (m *LinkMonitor) Check(urls []string) {
+	slots := make(chan struct{}, m.concurrency)
+	var wg sync.WaitGroup
+	for _, u := range urls {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(u string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			m.throttle.wait()
+			start := time.Now()
+			res, err := m.fetcher.Fetch(u)
+			m.throttle.record(err)
+			check := URLCheck{Time: start, Outcome: "ok", LatencyMs: float64(time.Since(start)) / float64(time.Millisecond)}
+			if err != nil {
+				check.Outcome = errorCategory(err)
+			}
+			if res != nil && res.Body != nil {
+				releaseBody(res.Body)
+			}
+
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			checks := append(m.history[u], check)
+			if m.maxChecks > 0 && len(checks) > m.maxChecks {
+				checks = checks[len(checks)-m.maxChecks:]
+			}
+			m.history[u] = checks
+		}(u)
+	}
+	wg.Wait()
+}
+
+// Status of a URL over its history
+type LinkRot struct {
+	URL string
+
+	// Outcome of the last check, and time of the first check of the streak it ends
+	Outcome string
+	Since   time.Time
+
+	// Number of checks in the history, and of those that failed
+	Checks int
+	Failed int
+
+	// True if the last check changed the outcome of the URL
+	Changed bool
+}
+
+// Returns the status of the given URLs, those failing first then sorted by URL
+func (m *LinkMonitor) Status(urls []string) []LinkRot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var status []LinkRot
+	for _, u := range urls {
+		checks := m.history[u]
+		if len(checks) == 0 {
+			continue
+		}
+		last := len(checks) - 1
+		s := LinkRot{URL: u, Outcome: checks[last].Outcome, Since: checks[last].Time, Checks: len(checks)}
+		for i := last; i >= 0 && checks[i].Outcome == s.Outcome; i-- {
+			s.Since = checks[i].Time
+		}
+		for _, c := range checks {
+			if c.Outcome != "ok" {
+				s.Failed++
+			}
+		}
+		s.Changed = last > 0 && checks[last-1].Outcome != s.Outcome
+		status = append(status, s)
+	}
+	sort.Slice(status, func(i, j int) bool {
+		if failing := status[i].Outcome != "ok"; failing != (status[j].Outcome != "ok") {
+			return failing
+		}
+		return status[i].URL < status[j].URL
+	})
+	return status
+}
+
+// Write the status of the given URLs to w, flagging those whose outcome just changed
+func (m *LinkMonitor) WriteReport(w io.Writer, urls []string) error {
+	bw := bufio.NewWriter(w)
+	status := m.Status(urls)
+	broken := 0
+	for _, s := range status {
+		if s.Outcome != "ok" {
+			broken++
+		}
+	}
+	fmt.Fprintf(bw, "\nLink rot (%d of %d URLs failing)\n", broken, len(status))
+	for _, s := range status {
+		change := ""
+		if s.Changed && s.Outcome == "ok" {
+			change = " RECOVERED"
+		} else if s.Changed {
+			change = " NEWLY BROKEN"
+		}
+		fmt.Fprintf(bw, "  %-16s since %s  %d/%d checks failed  %s%s\n", s.Outcome, s.Since.Format("2006-01-02 15:04"),
+			s.Failed, s.Checks, s.URL, change)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,78 @@
+package crawler
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseURLList(t *testing.T) {
+	urls, err := ParseURLList(strings.NewReader("# partners\nhttps://monzo.com/a\n\n  https://monzo.com/b  \n"))
+	if want := []string{"https://monzo.com/a", "https://monzo.com/b"}; err != nil || !reflect.DeepEqual(urls, want) {
+		t.Errorf("Expecting (%v), got (%v, %v)", want, urls, err)
+	}
+}
+
+// Only the URLs listed are checked, the history of each survives across runs
+func TestLinkMonitor(t *testing.T) {
+	var broken int32
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/flaky" && atomic.LoadInt32(&broken) == 1 {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, `<html><a href="/other">Other</a></html>`)
+	}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "crawler-monitor-")
+	if err != nil {
+		t.Fatalf("Failed to create history directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	history := filepath.Join(dir, "linkrot.json")
+	urls := []string{ts.URL + "/flaky", ts.URL + "/stable"}
+
+	m := NewLinkMonitor(&HTTPFetcher{}, 2, 3)
+	m.Check(urls)
+	if err := m.SaveHistory(history); err != nil {
+		t.Fatalf("Failed to save history: %s", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expecting only the 2 URLs listed to be fetched, got (%d) requests", requests)
+	}
+
+	// Next run, the flaky URL broke
+	atomic.StoreInt32(&broken, 1)
+	m = NewLinkMonitor(&HTTPFetcher{}, 2, 3)
+	if err := m.LoadHistory(history); err != nil {
+		t.Fatalf("Failed to load history: %s", err)
+	}
+	m.Check(urls)
+	status := m.Status(urls)
+	if len(status) != 2 || status[0].URL != urls[0] || status[0].Outcome != "not found" || !status[0].Changed ||
+		status[0].Checks != 2 || status[0].Failed != 1 {
+		t.Fatalf("Expecting the flaky URL to be newly broken, got (%+v)", status)
+	}
+	var report bytes.Buffer
+	m.WriteReport(&report, urls)
+	if !strings.Contains(report.String(), "1 of 2 URLs failing") || !strings.Contains(report.String(), urls[0]+" NEWLY BROKEN") {
+		t.Errorf("Expecting the report to flag the flaky URL, got (%s)", report.String())
+	}
+
+	// Only the last checks are kept
+	m.Check(urls)
+	m.Check(urls)
+	if checks := m.Status(urls)[0].Checks; checks != 3 {
+		t.Errorf("Expecting 3 checks kept, got (%d)", checks)
+	}
+}
@@ -0,0 +1,135 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// --------------------
+// Multiple sites
+// --------------------
+
+// Number of fetches in flight across all sites unless the config says otherwise
+const DEFAULT_MULTI_CONCURRENCY int = 20
+
+// Site crawled by the multi subcommand
+type SiteConfig struct {
+
+	// First page to crawl
+	URL string `json:"url"`
+
+	// File the crawl is written to, derived from URL in the output directory when empty
+	Output string `json:"output"`
+
+	// Print mode of the output, mode1 when empty
+	PrintMode string `json:"printmode"`
+}
+
+// Config file of the multi subcommand, e.g.
+//
+//	{"concurrency": 20, "sites": [{"url": "https://monzo.com"}, {"url": "https://example.com", "printmode": "xml"}]}
+//
+// along with the "profiles" and "hosts" of a PolitenessConfig, applied across all sites.
+type MultiConfig struct {
+
+	// Maximum number of fetches in flight across all sites
+	Concurrency int `json:"concurrency"`
+
+	Sites []SiteConfig `json:"sites"`
+
+	PolitenessConfig
+}
+
+// Returns the config read from the JSON file at path
+func LoadMultiConfig(path string) (*MultiConfig, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &MultiConfig{Concurrency: DEFAULT_MULTI_CONCURRENCY}
+	if err := json.Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("Malformed config (%s): %s", path, err)
+	}
+	for _, site := range cfg.Sites {
+		if len(site.URL) == 0 {
+			return nil, fmt.Errorf("Site without url in config (%s)", path)
+		}
+	}
+	if err := cfg.PolitenessConfig.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid config (%s): %s", path, err)
+	}
+	return cfg, nil
+}
+
+// Crawls all sites of cfg concurrently, sharing cfg.Concurrency fetches and robots.txt between them.
+// Returns each site's crawler and result, in the order of cfg.Sites.
+func CrawlSites(ctx context.Context, cfg *MultiConfig) ([]*Crawler, []*CrawlResult, []error) {
+	var slots chan struct{}
+	if cfg.Concurrency > 0 {
+		slots = make(chan struct{}, cfg.Concurrency)
+	}
+	crawlers := make([]*Crawler, len(cfg.Sites))
+	results := make([]*CrawlResult, len(cfg.Sites))
+	errs := make([]error, len(cfg.Sites))
+
+	robots := NewRobotsCache("", DEFAULT_ROBOTS_TTL)
+	var polite *politeness
+	if len(cfg.Profiles) > 0 {
+		polite = newPoliteness(&cfg.PolitenessConfig)
+	}
+	var wg sync.WaitGroup
+	for i, site := range cfg.Sites {
+		c := new(Crawler)
+		if errs[i] = c.Init(site.URL); errs[i] != nil {
+			continue
+		}
+		c.fetchSlots, c.robotsCache, c.politeness = slots, robots, polite
+		crawlers[i] = c
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = crawlers[i].Run(ctx)
+		}(i)
+	}
+	wg.Wait()
+	return crawlers, results, errs
+}
+
+// Returns the file the given site is written to, in dir unless the config names one
+func SiteOutput(dir string, site SiteConfig) string {
+	if len(site.Output) > 0 {
+		return site.Output
+	}
+	ext := ".txt"
+	if site.PrintMode == "xml" {
+		ext = ".xml"
+	}
+	return filepath.Join(dir, siteFilename(site.URL)+ext)
+}
+
+// Write a summary line per site to w
+func WriteMultiSummary(w io.Writer, summaries []RunSummary, errs []error) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%-40s %8s %8s %8s %12s\n", "site", "pages", "errors", "broken", "duration")
+	total := RunSummary{Site: "total"}
+	for i, s := range summaries {
+		if errs[i] != nil && s.Pages == 0 {
+			fmt.Fprintf(bw, "%-40s failed: %s\n", s.Site, errs[i])
+			continue
+		}
+		fmt.Fprintf(bw, "%-40s %8d %8d %8d %12s\n", s.Site, s.Pages, s.Errors, s.BrokenLinks,
+			time.Duration(s.DurationMs*float64(time.Millisecond)).Round(time.Millisecond))
+		total.Pages += s.Pages
+		total.Errors += s.Errors
+		total.BrokenLinks += s.BrokenLinks
+	}
+	fmt.Fprintf(bw, "%-40s %8d %8d %8d\n", total.Site, total.Pages, total.Errors, total.BrokenLinks)
+	return bw.Flush()
+}
@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test that all sites are crawled without going over the shared concurrency budget
+func TestCrawlSites_sharesConcurrency(t *testing.T) {
+	var inFlight, maxInFlight int64
+	site := &SyntheticSite{Depth: 2, Branching: 4, Latency: 5 * time.Millisecond}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+		for {
+			max := atomic.LoadInt64(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, n) {
+				break
+			}
+		}
+		site.ServeHTTP(w, r)
+	})
+	ts1 := httptest.NewServer(handler)
+	defer ts1.Close()
+	ts2 := httptest.NewServer(handler)
+	defer ts2.Close()
+
+	cfg := &MultiConfig{Concurrency: 3, Sites: []SiteConfig{{URL: ts1.URL}, {URL: ts2.URL}}}
+	_, results, errs := CrawlSites(context.Background(), cfg)
+	for i, res := range results {
+		if errs[i] != nil {
+			t.Errorf("Crawl of (%s) failed: %s", cfg.Sites[i].URL, errs[i])
+		} else if len(res.Pages) != site.Pages() {
+			t.Errorf("Expecting (%d) pages for (%s), got (%d)", site.Pages(), cfg.Sites[i].URL, len(res.Pages))
+		}
+	}
+	// The probe of a missing page is not counted against the budget
+	if maxInFlight > int64(cfg.Concurrency)+int64(len(cfg.Sites)) {
+		t.Errorf("Expecting at most (%d) requests in flight, got (%d)", cfg.Concurrency, maxInFlight)
+	}
+}
+
+func TestLoadMultiConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-multi-")
+	if err != nil {
+		t.Fatalf("Failed to create config directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sites.json")
+
+	ioutil.WriteFile(path, []byte(`{"sites": [{"url": "https://monzo.com"}, {"url": "https://example.com", "printmode": "xml"}]}`), 0644)
+	cfg, err := LoadMultiConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %s", err)
+	}
+	if cfg.Concurrency != DEFAULT_MULTI_CONCURRENCY || len(cfg.Sites) != 2 {
+		t.Errorf("Config was not loaded as it should, got (%+v)", cfg)
+	}
+	if out := SiteOutput("out", cfg.Sites[1]); out != filepath.Join("out", "https_example.com.xml") {
+		t.Errorf("Expecting output (out/https_example.com.xml), got (%s)", out)
+	}
+
+	ioutil.WriteFile(path, []byte(`{"sites": [{"printmode": "xml"}]}`), 0644)
+	if _, err := LoadMultiConfig(path); err == nil {
+		t.Errorf("Expecting an error for a site without url")
+	}
+}
@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+)
+
+// --------------------
+// Not found probe
+// --------------------
+
+// How the site responds to a page that does not exist, learnt by requesting one at the start
+// of the crawl. Sites answering 200 (soft 404) make broken links look like pages, those
+// are recognised by their body or redirect target matching the probe's.
+type notFoundProbe struct {
+
+	// URL requested, chosen to not exist
+	url string
+
+	// Error fetching the probe, Http404Error for sites handling missing pages properly
+	err error
+
+	// Where the probe was redirected to, empty if it was not
+	final string
+
+	// Signature of the body of the probe, see bodySignature
+	signature uint32
+}
+
+// Returns the URL of a page that should not exist on the crawled site.
+// It is the same on every run so that the probe can be recorded and replayed with fixtures.
+func (c *Crawler) notFoundProbeURL() string {
+	h := fnv.New32a()
+	h.Write([]byte(c.domain))
+	return fmt.Sprintf("%s://%s/this-page-does-not-exist-%x", c.scheme, c.domain, h.Sum32())
+}
+
+// Returns a hash of the given body, with the occurrences of the page's path removed as
+// not found pages often echo the URL requested
+func bodySignature(page string, body []byte) uint32 {
+	if i := strings.Index(page, "://"); i >= 0 {
+		if j := strings.Index(page[i+3:], "/"); j >= 0 {
+			body = bytes.Replace(body, []byte(page[i+3+j:]), nil, -1)
+		}
+	}
+	h := fnv.New32a()
+	h.Write(body)
+	return h.Sum32()
+}
+
+// Requests a page that does not exist to learn how the site responds to those
+func (c *Crawler) probeNotFoundPage() *notFoundProbe {
+	probe := &notFoundProbe{url: c.notFoundProbeURL()}
+	res, err := c.fetcherOrDefault().Fetch(probe.url)
+	if err != nil {
+		probe.err = err
+		if errorCategory(err) != "not found" {
+			log.Printf("Probing a missing page failed with (%s), errors of this site may be misreported.\n", err)
+		}
+		return probe
+	}
+	if res.FinalURL != probe.url {
+		probe.final = res.FinalURL
+	}
+	probe.signature = bodySignature(probe.url, res.Body.Bytes())
+	releaseBody(res.Body)
+	return probe
+}
+
+// Returns true if the site answers missing pages with a page rather than an error
+func (p *notFoundProbe) soft() bool {
+	return p != nil && p.err == nil
+}
+
+// Returns true if the given page, fetched successfully, is the site's not found page
+func (p *notFoundProbe) matches(page string, final string, body []byte) bool {
+	if !p.soft() {
+		return false
+	}
+	// The body of a redirected probe is that of its target, only the redirect tells them apart
+	if len(p.final) > 0 {
+		return final == p.final && page != p.final
+	}
+	return bodySignature(page, body) == p.signature
+}
+
+// Returns a description of how the site handles missing pages, for the report
+func (p *notFoundProbe) String() string {
+	switch {
+	case p == nil:
+		return "not probed"
+	case !p.soft():
+		return fmt.Sprintf("%s (%s)", errorCategory(p.err), p.url)
+	case len(p.final) > 0:
+		return fmt.Sprintf("soft 404, redirects to %s (%s)", p.final, p.url)
+	}
+	return fmt.Sprintf("soft 404, responds with a page (%s)", p.url)
+}
@@ -0,0 +1,92 @@
+package crawler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Site answering missing pages with a 200 page echoing the path requested
+func softNotFoundSite() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			io.WriteString(w, `<html><a href="/about">About</a><a href="/broken">Broken</a></html>`)
+		case "/about":
+			io.WriteString(w, `<html>About us</html>`)
+		default:
+			io.WriteString(w, `<html>Sorry, `+r.URL.Path+` could not be found</html>`)
+		}
+	})
+}
+
+// Test that broken links of a site answering them with a 200 are detected
+func TestCrawl_detectsSoftNotFound(t *testing.T) {
+	ts := httptest.NewServer(softNotFoundSite())
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.Start()
+	c.Wait()
+
+	if !c.notFound.soft() {
+		t.Errorf("Expecting the site to be found to answer missing pages with a 200, got (%s)", c.notFound)
+	}
+	if _, ok := c.softNotFound.Load(ts.URL + "/broken"); !ok {
+		t.Errorf("Expecting (/broken) to be a soft 404")
+	}
+	for _, page := range []string{ts.URL, ts.URL + "/about"} {
+		if _, ok := c.softNotFound.Load(page); ok {
+			t.Errorf("(%s) exists and should not be a soft 404", page)
+		}
+	}
+}
+
+// Test that missing pages redirected to the home page are detected
+func TestCrawl_detectsSoftNotFoundRedirects(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			io.WriteString(w, `<html><a href="/about">About</a><a href="/broken">Broken</a></html>`)
+		case "/about":
+			io.WriteString(w, `<html>About us</html>`)
+		default:
+			http.Redirect(w, r, "/", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.Start()
+	c.Wait()
+
+	if _, ok := c.softNotFound.Load(ts.URL + "/broken"); !ok {
+		t.Errorf("Expecting (/broken) to be a soft 404, probe (%s)", c.notFound)
+	}
+	if _, ok := c.softNotFound.Load(ts.URL); ok {
+		t.Errorf("The home page should not be a soft 404")
+	}
+}
+
+// Test that nothing is a soft 404 on sites answering missing pages with a 404
+func TestCrawl_noSoftNotFoundWith404s(t *testing.T) {
+	site := &SyntheticSite{Depth: 2, Branching: 2}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.Start()
+	c.Wait()
+
+	if c.notFound.soft() || errorCategory(c.notFound.err) != "not found" {
+		t.Errorf("Expecting the probe to be not found, got (%s)", c.notFound)
+	}
+	c.softNotFound.Range(func(k, v interface{}) bool {
+		t.Errorf("(%s) should not be a soft 404", k)
+		return true
+	})
+}
@@ -0,0 +1,534 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --------------------
+// Options
+// --------------------
+
+// Setting of a Crawler made by New, for crawlers used as a library:
+//
+//	c, err := crawler.New("https://monzo.com", crawler.WithWorkers(4), crawler.WithQuota(crawler.Quota{Pages: 100}))
+//
+// Options are applied in order after the defaults, a later one overrides an earlier one.
+type Option func(c *Crawler) error
+
+// Crawls n pages at the same time with a pool of workers, see DEFAULT_WORKERS.
+// 0 crawls each page in its own goroutine instead.
+func WithWorkers(n int) Option {
+	return func(c *Crawler) error {
+		if n < 0 {
+			return fmt.Errorf("Invalid number of workers (%d)", n)
+		}
+		c.workers = n
+		return nil
+	}
+}
+
+// Fetches the content of URLs with f instead of an HTTPFetcher
+func WithFetcher(f Fetcher) Option {
+	return func(c *Crawler) error {
+		c.fetcher = f
+		return nil
+	}
+}
+
+// Gives up on a page after d, 0 for no limit
+func WithFetchTimeout(d time.Duration) Option {
+	return func(c *Crawler) error {
+		if d < 0 {
+			return fmt.Errorf("Invalid fetch timeout (%s)", d)
+		}
+		c.fetchTimeout = d
+		return nil
+	}
+}
+
+// Adds f to the end of the filters deciding which of the sites found are crawled, see Filter
+func WithFilter(f Filter) Option {
+	return func(c *Crawler) error {
+		c.filters = append(c.filters, f)
+		return nil
+	}
+}
+
+// Sends each page to s as soon as it is crawled
+func WithSink(s PageSink) Option {
+	return func(c *Crawler) error {
+		c.sink = s
+		return nil
+	}
+}
+
+// Stops the crawl with QuotaExceeded once one of the limits of q is reached
+func WithQuota(q Quota) Option {
+	return func(c *Crawler) error {
+		c.quota = q
+		return nil
+	}
+}
+
+// Respects robots.txt when true, the default, ignores it otherwise
+func WithRobots(respect bool) Option {
+	return func(c *Crawler) error {
+		c.respectRobots = respect
+		return nil
+	}
+}
+
+// Only crawls sites at most n links away from the base site, 0 for no limit
+func WithMaxDepth(n int) Option {
+	return func(c *Crawler) error {
+		if n < 0 {
+			return fmt.Errorf("Invalid maximum depth (%d)", n)
+		}
+		c.maxDepth = n
+		return nil
+	}
+}
+
+// Sends at most rate requests per second to each host, burst of them at once after a pause,
+// see DEFAULT_RATE_BURST. 0 for no limit.
+func WithRate(rate float64, burst int) Option {
+	return func(c *Crawler) error {
+		if rate < 0 || burst < 1 {
+			return fmt.Errorf("Invalid rate (%g) and burst (%d)", rate, burst)
+		}
+		c.rate, c.rateBurst = rate, burst
+		return nil
+	}
+}
+
+// Fetches pages with fasthttp instead of net/http, when no fetcher is set with WithFetcher
+func WithFast(fast bool) Option {
+	return func(c *Crawler) error {
+		c.fast = fast
+		return nil
+	}
+}
+
+// Logs the time taken by each page once the crawl is done
+func WithVerbose(verbose bool) Option {
+	return func(c *Crawler) error {
+		c.verbose = verbose
+		return nil
+	}
+}
+
+// Keeps the number of times each child is linked from its parent, shown by WriteSitemapFlat
+func WithLinkCounts(keep bool) Option {
+	return func(c *Crawler) error {
+		c.keepLinkCounts = keep
+		return nil
+	}
+}
+
+// Crawls the http:// and https:// variants of a URL as different pages, even when the site
+// redirects from one to the other
+func WithStrictScheme(strict bool) Option {
+	return func(c *Crawler) error {
+		c.strictScheme = strict
+		return nil
+	}
+}
+
+// Crawls /dir, /dir/ and /dir/index.html as different pages
+func WithStrictPaths(strict bool) Option {
+	return func(c *Crawler) error {
+		if strict {
+			c.ignoreTrailingSlash = false
+			c.indexFiles = nil
+		}
+		return nil
+	}
+}
+
+// Treats www.<domain> and <domain> as the same site when true, the default
+func WithWWWAlias(alias bool) Option {
+	return func(c *Crawler) error {
+		c.aliasWWW, c.scope.aliasWWW = alias, alias
+		return nil
+	}
+}
+
+// Treats all ports of the domain crawled as the same site, not only its default ports
+func WithAnyPort(any bool) Option {
+	return func(c *Crawler) error {
+		c.scope.anyPort = any
+		return nil
+	}
+}
+
+// Treats URL paths as case insensitive when deciding whether a page was visited
+func WithIgnoreCase(ignore bool) Option {
+	return func(c *Crawler) error {
+		c.ignoreCase = ignore
+		return nil
+	}
+}
+
+// Crawls the target of <meta http-equiv="refresh"> redirects when true, the default,
+// only reports them otherwise
+func WithMetaRefresh(follow bool) Option {
+	return func(c *Crawler) error {
+		c.followMetaRefresh = follow
+		return nil
+	}
+}
+
+// Crawls URLs with hash routes (/#/products/1) as distinct pages
+func WithRouteFragments(keep bool) Option {
+	return func(c *Crawler) error {
+		c.keepRouteFragments = keep
+		return nil
+	}
+}
+
+// Applies the politeness profiles of config to the hosts they match
+func WithPoliteness(config *PolitenessConfig) Option {
+	return func(c *Crawler) error {
+		c.politeness = newPoliteness(config)
+		return nil
+	}
+}
+
+// Records URLs of a host serving the same ETag and size as another as its aliases, without
+// fetching their body again
+func WithETagAliases(aliases bool) Option {
+	return func(c *Crawler) error {
+		c.etagAliases = aliases
+		return nil
+	}
+}
+
+// Pauses the crawl for backoff, unless the site sends a longer Retry-After, after threshold
+// consecutive 503 responses or a page containing signature, see DEFAULT_MAINTENANCE_503S.
+// A threshold of 0 never pauses for 503s, an empty signature never pauses for a page.
+func WithMaintenance(threshold int, signature string, backoff time.Duration) Option {
+	return func(c *Crawler) error {
+		if threshold < 0 || backoff < 0 {
+			return fmt.Errorf("Invalid maintenance threshold (%d) and backoff (%s)", threshold, backoff)
+		}
+		c.maintenance.threshold, c.maintenance.signature = threshold, signature
+		c.maintenance.backoff = backoff
+		return nil
+	}
+}
+
+// Adds a random delay between min and max before each request, none when max is 0
+func WithJitter(min time.Duration, max time.Duration) Option {
+	return func(c *Crawler) error {
+		j := jitter{min: min, max: max}
+		if err := j.validate(); err != nil {
+			return err
+		}
+		c.jitter = j
+		return nil
+	}
+}
+
+// Only fetches pages within w, the crawl pauses outside of it
+func WithWindow(w *CrawlWindow) Option {
+	return func(c *Crawler) error {
+		c.window = w
+		return nil
+	}
+}
+
+// Starts with from requests at once and allows more over d up to to, after which there is no
+// limit, holding while the error rate is high. 0 starts at full speed.
+func WithRampUp(d time.Duration, from int, to int) Option {
+	return func(c *Crawler) error {
+		if d <= 0 {
+			c.rampUp = rampUp{}
+			return nil
+		}
+		if from < 1 || to < from {
+			return fmt.Errorf("Invalid ramp up from (%d) to (%d), expecting 1 <= from <= to", from, to)
+		}
+		c.rampUp = rampUp{duration: d, from: from, to: to}
+		return nil
+	}
+}
+
+// Slows requests down once the error rate goes above threshold, never when it is 0
+func WithBackoff(threshold float64) Option {
+	return func(c *Crawler) error {
+		c.throttle.threshold = threshold
+		if threshold <= 0 {
+			c.throttle.windowSize = 0
+		}
+		return nil
+	}
+}
+
+// Spills sites found to disk once n of them are being crawled, or wait for a worker, see
+// DEFAULT_MAX_GOROUTINES. 0 for no limit.
+func WithMaxGoroutines(n int64) Option {
+	return func(c *Crawler) error {
+		if n < 0 {
+			return fmt.Errorf("Invalid maximum number of goroutines (%d)", n)
+		}
+		c.maxGoroutines = n
+		return nil
+	}
+}
+
+// Spills sites found to disk while the heap is above limit bytes, until it goes back down.
+// 0 for no limit.
+func WithMaxMemory(limit uint64) Option {
+	return func(c *Crawler) error {
+		c.memory.limit = limit
+		return nil
+	}
+}
+
+// Records the DNS, connect, TLS, TTFB and body read times of each request, not supported by
+// the fasthttp fetcher
+func WithTimings(trace bool) Option {
+	return func(c *Crawler) error {
+		c.traceTimings = trace
+		return nil
+	}
+}
+
+// Fetches the first n bytes of resources skipped for their suffix with a Range request, to
+// report their type and size. 0 never fetches them.
+func WithProbeBytes(n int64) Option {
+	return func(c *Crawler) error {
+		if n < 0 {
+			return fmt.Errorf("Invalid number of probe bytes (%d)", n)
+		}
+		c.probeBytes = n
+		return nil
+	}
+}
+
+// Sends CRAWL_ID_HEADER and REQUEST_ID_HEADER with every request
+func WithCrawlID(send bool) Option {
+	return func(c *Crawler) error {
+		c.sendCrawlID = send
+		return nil
+	}
+}
+
+// Sends header with every request. Its values are secrets, redacted from logs and exports.
+func WithRequestHeader(header http.Header) Option {
+	return func(c *Crawler) error {
+		c.requestHeader = header
+		for name, values := range header {
+			for _, v := range values {
+				redactor.AddHeader(name, v)
+			}
+		}
+		return nil
+	}
+}
+
+// Keeps the given response headers of each page, see DEFAULT_CAPTURE_HEADERS
+func WithCaptureHeaders(names []string) Option {
+	return func(c *Crawler) error {
+		c.captureHeaders = names
+		return nil
+	}
+}
+
+// Reports cached responses with a time to live under d, see MIN_CACHE_TTL
+func WithMinCacheTTL(d time.Duration) Option {
+	return func(c *Crawler) error {
+		c.minCacheTTL = d
+		return nil
+	}
+}
+
+// Reports text responses above size bytes served uncompressed, see MIN_COMPRESS_SIZE
+func WithMinCompressSize(size int) Option {
+	return func(c *Crawler) error {
+		c.minCompressSize = size
+		return nil
+	}
+}
+
+// Estimates the <priority> and <changefreq> of each page in sitemap.xml, see WriteSitemapXML
+func WithSitemapPriorities(estimate bool) Option {
+	return func(c *Crawler) error {
+		c.sitemapPriorities = estimate
+		return nil
+	}
+}
+
+// Requests a missing page before crawling to detect sites answering broken links with a 200,
+// when true, the default
+func WithProbeNotFound(probe bool) Option {
+	return func(c *Crawler) error {
+		c.probeNotFound = probe
+		return nil
+	}
+}
+
+// Fetches robots.txt through cache, so that they are kept across crawls
+func WithRobotsCache(cache *RobotsCache) Option {
+	return func(c *Crawler) error {
+		c.robotsCache = cache
+		return nil
+	}
+}
+
+// Replaces the filters with the built-in ones of the given names, in order, see DEFAULT_FILTERS.
+// blocklist, scope and robots are added in front when left out, so it must come after
+// WithBlocklist and WithRobots.
+func WithFilters(names ...string) Option {
+	return func(c *Crawler) error {
+		filters, err := c.namedFilters(c.enforcedFilters(names))
+		if err != nil {
+			return err
+		}
+		c.filters = filters
+		return nil
+	}
+}
+
+// Only crawls URLs under the path of the base site, e.g. /docs/ when crawling https://monzo.com/docs/
+func WithStayUnder(stay bool) Option {
+	return func(c *Crawler) error {
+		c.pathPrefix = ""
+		if stay {
+			c.pathPrefix = seedPathPrefix(c.baseSite)
+		}
+		return nil
+	}
+}
+
+// What is done with links leaving the path of WithStayUnder, see ESCAPE_SKIP and others
+func WithParentLinks(escape string) Option {
+	return func(c *Crawler) error {
+		switch escape {
+		case ESCAPE_SKIP, ESCAPE_FOLLOW, ESCAPE_EXTERNAL, ESCAPE_DROP:
+			c.prefixEscape = escape
+			return nil
+		}
+		return fmt.Errorf("Unknown parent links (%s)", escape)
+	}
+}
+
+// Only crawls n URLs of each search page or parameterized endpoint template, see
+// DEFAULT_SAMPLE_SIZE. 0 for no limit.
+func WithSampleSize(n int) Option {
+	return func(c *Crawler) error {
+		if n < 0 {
+			return fmt.Errorf("Invalid sample size (%d)", n)
+		}
+		c.sampler.size = n
+		return nil
+	}
+}
+
+// Never follows URLs containing one of words, see DEFAULT_TRAP_WORDS
+func WithTrapWords(words []string) Option {
+	return func(c *Crawler) error {
+		c.trapWords = lowercase(words)
+		return nil
+	}
+}
+
+// Removes the given session or tracking parameters from links, ending with * to match a
+// prefix, see DEFAULT_STRIPPED_PARAMS
+func WithStrippedParams(params []string) Option {
+	return func(c *Crawler) error {
+		c.strippedParams = lowercase(params)
+		return nil
+	}
+}
+
+// Never fetches the URLs of b, see the blocklist filter
+func WithBlocklist(b *Blocklist) Option {
+	return func(c *Crawler) error {
+		c.blocklist = b
+		return nil
+	}
+}
+
+// Only crawls URLs matching the regular expression pattern
+func WithInclude(pattern string) Option {
+	return func(c *Crawler) (err error) {
+		c.include, err = compilePattern(pattern)
+		return err
+	}
+}
+
+// Does not crawl URLs matching the regular expression pattern
+func WithExclude(pattern string) Option {
+	return func(c *Crawler) (err error) {
+		c.exclude, err = compilePattern(pattern)
+		return err
+	}
+}
+
+// Captures the values selected by expr on each page under name, see AddExtractor
+func WithExtractor(name string, expr string) Option {
+	return func(c *Crawler) error {
+		return c.AddExtractor(name, expr)
+	}
+}
+
+// Only follows links inside the elements of the given comma separated selectors, e.g. "nav,main"
+func WithFollowIn(selectors string) Option {
+	return func(c *Crawler) (err error) {
+		c.followIn, err = parseSelectors(selectors)
+		return err
+	}
+}
+
+// Never follows links inside the elements of the given comma separated selectors, e.g. "footer"
+func WithIgnoreIn(selectors string) Option {
+	return func(c *Crawler) (err error) {
+		c.ignoreIn, err = parseSelectors(selectors)
+		return err
+	}
+}
+
+// Checks the syntax of robots.txt and the sitemaps
+func WithLint(lint bool) Option {
+	return func(c *Crawler) error {
+		c.lint = lint
+		return nil
+	}
+}
+
+// Checks /favicon.ico and the icons and web app manifests declared by pages
+func WithIcons(check bool) Option {
+	return func(c *Crawler) error {
+		c.checkIcons = check
+		return nil
+	}
+}
+
+// Also crawls the pages listed in the sitemaps declared in robots.txt or linked from pages
+func WithSitemaps(ingest bool) Option {
+	return func(c *Crawler) error {
+		c.ingestSitemaps = ingest
+		return nil
+	}
+}
+
+// Fingerprints the content of each page, so that RecordContentChanges can compare crawls
+func WithFingerprints(fingerprint bool) Option {
+	return func(c *Crawler) error {
+		c.fingerprintPages = fingerprint
+		return nil
+	}
+}
+
+// Returns words in lower case
+func lowercase(words []string) []string {
+	lowered := make([]string, len(words))
+	for i, w := range words {
+		lowered[i] = strings.ToLower(w)
+	}
+	return lowered
+}
@@ -0,0 +1,181 @@
+package crawler_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	crawler "github.com/skfarhat/go-web-crawler"
+)
+
+// Collects the pages crawled, not those skipped
+type pageCollector struct {
+	mu    sync.Mutex
+	pages []string
+}
+
+func (s *pageCollector) WritePage(page crawler.CrawlPage, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(page.Skipped) == 0 {
+		s.pages = append(s.pages, page.URL)
+	}
+}
+
+// A crawl set up from another package with options only
+func TestNew_options(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<a href="/docs">Docs</a><a href="/docs/api">API</a><a href="/about">About</a>`)
+	}))
+	defer ts.Close()
+
+	sink := &pageCollector{}
+	docsOnly := crawler.FilterFunc(func(url string, depth int, referrer string) (bool, string) {
+		return strings.HasPrefix(url, ts.URL+"/docs"), "not docs"
+	})
+	c, err := crawler.New(ts.URL, crawler.WithWorkers(2), crawler.WithFilter(docsOnly), crawler.WithSink(sink),
+		crawler.WithFetchTimeout(time.Second), crawler.WithQuota(crawler.Quota{Pages: 10}), crawler.WithRobots(false))
+	if err != nil {
+		t.Fatalf("Got an unexpected error %s", err)
+	}
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(res.Pages) != 3 || len(sink.pages) != 3 {
+		t.Errorf("Expecting the base site and the (2) docs pages to be crawled and sent to the sink, got (%d) and (%v)",
+			len(res.Pages), sink.pages)
+	}
+	if len(res.NotCrawled) != 1 || res.NotCrawled[0].Reason != "not docs" {
+		t.Errorf("Expecting (/about) to be skipped by the custom filter, got (%+v)", res.NotCrawled)
+	}
+
+	if _, err := crawler.New(ts.URL, crawler.WithWorkers(-1)); err == nil {
+		t.Errorf("Expecting an error for a negative number of workers")
+	}
+}
+
+// Pages more than the maximum depth away are skipped rather than crawled
+func TestNew_maxDepth(t *testing.T) {
+	site := &crawler.SyntheticSite{Depth: 3, Branching: 2}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	c, err := crawler.New(ts.URL, crawler.WithMaxDepth(1), crawler.WithRobots(false))
+	if err != nil {
+		t.Fatalf("Got an unexpected error %s", err)
+	}
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(res.Pages) != 3 {
+		t.Errorf("Expecting the base site and its (2) children to be crawled, got (%d) pages", len(res.Pages))
+	}
+	if len(res.NotCrawled) != 4 {
+		t.Errorf("Expecting the (4) pages at depth 2 to be skipped, got (%+v)", res.NotCrawled)
+	}
+	for _, page := range res.NotCrawled {
+		if page.Reason != crawler.SKIP_DEPTH {
+			t.Errorf("Expecting (%s) to be skipped for (%s), got (%s)", page.URL, crawler.SKIP_DEPTH, page.Reason)
+		}
+	}
+
+	if _, err := crawler.New(ts.URL, crawler.WithMaxDepth(-1)); err == nil {
+		t.Errorf("Expecting an error for a negative maximum depth")
+	}
+}
+
+// Every request waits for the rate, robots.txt and the probe of the 404 page as much as pages
+func TestNew_rate(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	var times []time.Time
+	site := &crawler.SyntheticSite{Depth: 1, Branching: 3}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths, times = append(paths, r.URL.Path), append(times, time.Now())
+		mu.Unlock()
+		site.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	c, err := crawler.New(ts.URL, crawler.WithRate(20, 1), crawler.WithWorkers(4))
+	if err != nil {
+		t.Fatalf("Got an unexpected error %s", err)
+	}
+	c.Run(context.Background())
+
+	if len(times) <= site.Pages() {
+		t.Fatalf("Expecting robots.txt and the 404 probe to be requested besides the (%d) pages, got (%v)", site.Pages(), paths)
+	}
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < 40*time.Millisecond {
+			t.Errorf("Expecting (%s) and (%s) to be 50ms apart, got (%s)", paths[i-1], paths[i], gap)
+		}
+	}
+
+	if _, err := crawler.New(ts.URL, crawler.WithRate(1, 0)); err == nil {
+		t.Errorf("Expecting an error for a burst of (0)")
+	}
+}
+
+// Two crawlers of the same process each fetch with the client they were set up with
+func TestNew_fast(t *testing.T) {
+	agents := func(agents *sync.Map) *httptest.Server {
+		site := &crawler.SyntheticSite{Depth: 1, Branching: 2}
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			agents.Store(r.UserAgent(), true)
+			site.ServeHTTP(w, r)
+		}))
+	}
+	var fastAgents, defaultAgents sync.Map
+	fastSite, defaultSite := agents(&fastAgents), agents(&defaultAgents)
+	defer fastSite.Close()
+	defer defaultSite.Close()
+
+	fast, err := crawler.New(fastSite.URL, crawler.WithFast(true), crawler.WithVerbose(true), crawler.WithRobots(false))
+	if err != nil {
+		t.Fatalf("Got an unexpected error %s", err)
+	}
+	other, err := crawler.New(defaultSite.URL, crawler.WithRobots(false))
+	if err != nil {
+		t.Fatalf("Got an unexpected error %s", err)
+	}
+	for _, c := range []*crawler.Crawler{fast, other} {
+		if res, err := c.Run(context.Background()); err != nil || len(res.Pages) != 3 {
+			t.Fatalf("Expecting the (3) pages to be crawled, got (%v) and (%v)", res, err)
+		}
+	}
+
+	for name, m := range map[string]*sync.Map{"fasthttp": &fastAgents, "Go-http-client/1.1": &defaultAgents} {
+		m.Range(func(agent, _ interface{}) bool {
+			if agent != name {
+				t.Errorf("Expecting requests from (%s), got (%s)", name, agent)
+			}
+			return true
+		})
+	}
+}
+
+// Settings out of range are refused by New
+func TestNew_invalidOptions(t *testing.T) {
+	for _, option := range []crawler.Option{
+		crawler.WithParentLinks("up"),
+		crawler.WithJitter(2*time.Second, time.Second),
+		crawler.WithRampUp(time.Second, 5, 2),
+		crawler.WithInclude("("),
+		crawler.WithFollowIn("a[href"),
+		crawler.WithFilters("scope", "nope"),
+		crawler.WithSampleSize(-1),
+	} {
+		if _, err := crawler.New("https://monzo.com", option); err == nil {
+			t.Errorf("Expecting an error for an invalid option")
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package crawler
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --------------------
+// Output files
+// --------------------
+
+// File written under a temporary name next to its path and renamed to it once complete,
+// so that a crashed or cancelled crawl never leaves a truncated output behind for
+// downstream jobs to consume.
+type atomicFile struct {
+	*os.File
+
+	// Path the file is renamed to on commit
+	path string
+}
+
+// Returns an atomicFile that will replace the file at path once committed
+func createAtomic(path string) (*atomicFile, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: f, path: path}, nil
+}
+
+// Flushes the file to disk and renames it to its path.
+// The temporary file is removed if any of this fails.
+func (f *atomicFile) Commit() error {
+	err := f.Sync()
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		// TempFile creates files only readable by their owner
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Discards what was written, leaving the file at path untouched
+func (f *atomicFile) Abort() error {
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// Where the sitemap and report are written: stdout, or a file when given a path.
+// Exports of large sites easily reach hundreds of MB, so they can be gzip-compressed.
+type CrawlOutput struct {
+	io.Writer
+
+	// File written to, nil when writing to stdout
+	file *atomicFile
+
+	// Uploaded to a bucket once complete, nil unless writing to s3:// or gs://
+	bucket *bucketOutput
+
+	// Compresses what is written, nil when not compressing
+	gz *gzip.Writer
+}
+
+// Returns the output writing to path, uploading to a bucket when it is an s3:// or gs:// URL,
+// or to stdout if path is empty. The output is compressed if compress is set or path ends in .gz
+func OpenOutput(path string, compress bool) (*CrawlOutput, error) {
+	out := &CrawlOutput{Writer: os.Stdout}
+	if isBucketURL(path) {
+		b, err := createBucketOutput(path)
+		if err != nil {
+			return nil, err
+		}
+		out.bucket, out.Writer = b, b
+	} else if len(path) > 0 {
+		f, err := createAtomic(path)
+		if err != nil {
+			return nil, err
+		}
+		out.file, out.Writer = f, f
+	}
+	if compress || strings.HasSuffix(path, ".gz") {
+		out.gz = gzip.NewWriter(out.Writer)
+		out.Writer = out.gz
+	}
+	return out, nil
+}
+
+// Completes the output, only then does the file replace any existing one at its path
+func (o *CrawlOutput) Commit() error {
+	if o.gz != nil {
+		if err := o.gz.Close(); err != nil {
+			o.Abort()
+			return err
+		}
+	}
+	if o.file != nil {
+		return o.file.Commit()
+	}
+	if o.bucket != nil {
+		return o.bucket.Commit()
+	}
+	return nil
+}
+
+// Discards the output file, if any, nothing is uploaded
+func (o *CrawlOutput) Abort() error {
+	if o.file != nil {
+		return o.file.Abort()
+	}
+	if o.bucket != nil {
+		return o.bucket.Abort()
+	}
+	return nil
+}
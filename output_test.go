@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test that the output only replaces the existing file once committed
+func TestAtomicFile_replacesFileOnCommit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-output-")
+	if err != nil {
+		t.Fatalf("Failed to create output directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sitemap.txt")
+	ioutil.WriteFile(path, []byte("previous crawl"), 0644)
+
+	f, err := createAtomic(path)
+	if err != nil {
+		t.Fatalf("Failed to create output: %s", err)
+	}
+	io.WriteString(f, "this crawl")
+	if content, _ := ioutil.ReadFile(path); string(content) != "previous crawl" {
+		t.Errorf("Output was replaced before commit, got (%s)", content)
+	}
+	if err := f.Commit(); err != nil {
+		t.Fatalf("Failed to commit output: %s", err)
+	}
+	if content, _ := ioutil.ReadFile(path); string(content) != "this crawl" {
+		t.Errorf("Expecting (this crawl), got (%s)", content)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Expecting the output alone in its directory, got (%d) files", len(files))
+	}
+}
+
+// Test that an aborted output leaves the existing file and no temporary file behind
+func TestAtomicFile_abortKeepsExistingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-output-")
+	if err != nil {
+		t.Fatalf("Failed to create output directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sitemap.txt")
+	ioutil.WriteFile(path, []byte("previous crawl"), 0644)
+
+	f, err := createAtomic(path)
+	if err != nil {
+		t.Fatalf("Failed to create output: %s", err)
+	}
+	io.WriteString(f, "half a crawl")
+	f.Abort()
+
+	if content, _ := ioutil.ReadFile(path); string(content) != "previous crawl" {
+		t.Errorf("Expecting (previous crawl), got (%s)", content)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Expecting the output alone in its directory, got (%d) files", len(files))
+	}
+}
+
+// Test that outputs whose name ends in .gz are compressed
+func TestOpenOutput_compressesGzFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-output-")
+	if err != nil {
+		t.Fatalf("Failed to create output directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sitemap.txt.gz")
+
+	out, err := OpenOutput(path, false)
+	if err != nil {
+		t.Fatalf("Failed to create output: %s", err)
+	}
+	io.WriteString(out, "https://monzo.com\n")
+	if err := out.Commit(); err != nil {
+		t.Fatalf("Failed to commit output: %s", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open output: %s", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Output is not gzip-compressed: %s", err)
+	}
+	if content, _ := ioutil.ReadAll(gz); string(content) != "https://monzo.com\n" {
+		t.Errorf("Expecting (https://monzo.com), got (%s)", content)
+	}
+}
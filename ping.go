@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// --------------------
+// Sitemap pings
+// --------------------
+
+// Ping URLs of search engines by name, %s is replaced by the escaped location of the sitemap
+var SITEMAP_PING_ENDPOINTS = map[string]string{
+	"google": "https://www.google.com/ping?sitemap=%s",
+	"bing":   "https://www.bing.com/ping?sitemap=%s",
+}
+
+type SitemapPingFailed struct {
+	Endpoint string
+	Status   int
+}
+
+func (e SitemapPingFailed) Error() string {
+	return fmt.Sprintf("Sitemap ping (%s) answered with status (%d)", e.Endpoint, e.Status)
+}
+
+// Returns the ping URLs of the given comma separated search engines, either names of
+// SITEMAP_PING_ENDPOINTS or URLs containing %s
+func ParsePingEndpoints(engines string) ([]string, error) {
+	var endpoints []string
+	for _, engine := range strings.Split(engines, ",") {
+		if engine = strings.TrimSpace(engine); len(engine) == 0 {
+			continue
+		}
+		if endpoint, ok := SITEMAP_PING_ENDPOINTS[strings.ToLower(engine)]; ok {
+			endpoints = append(endpoints, endpoint)
+			continue
+		}
+		if u, err := url.Parse(engine); err != nil || len(u.Host) == 0 || !strings.Contains(engine, "%s") {
+			return nil, fmt.Errorf("Unknown ping endpoint (%s), expecting one of google, bing or a URL containing %%s", engine)
+		}
+		endpoints = append(endpoints, engine)
+	}
+	return endpoints, nil
+}
+
+// Returns the location the sitemap of the site crawled is published at by default,
+// /sitemap.xml of the host the site redirected to while crawling, if any
+func (c *Crawler) SitemapURL() string {
+	return c.origin() + "/sitemap.xml"
+}
+
+// Tells each endpoint that the sitemap at the given location changed.
+// Returns the error of each endpoint that could not be pinged, by endpoint.
+func PingSitemap(client *http.Client, endpoints []string, sitemap string) map[string]error {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second, Transport: safeTransport{}}
+	}
+	errors := make(map[string]error)
+	for _, endpoint := range endpoints {
+		ping := strings.Replace(endpoint, "%s", url.QueryEscape(sitemap), 1)
+		res, err := client.Get(ping)
+		if err != nil {
+			errors[endpoint] = err
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode >= 300 {
+			errors[endpoint] = SitemapPingFailed{Endpoint: endpoint, Status: res.StatusCode}
+		}
+	}
+	return errors
+}
@@ -0,0 +1,46 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParsePingEndpoints(t *testing.T) {
+	endpoints, err := ParsePingEndpoints("google, https://search.example.com/ping?map=%s")
+	want := []string{SITEMAP_PING_ENDPOINTS["google"], "https://search.example.com/ping?map=%s"}
+	if err != nil || !reflect.DeepEqual(endpoints, want) {
+		t.Errorf("Expecting (%v), got (%v, %v)", want, endpoints, err)
+	}
+	if endpoints, err := ParsePingEndpoints(""); err != nil || len(endpoints) > 0 {
+		t.Errorf("Expecting no endpoint by default, got (%v, %v)", endpoints, err)
+	}
+	for _, engine := range []string{"altavista", "https://search.example.com/ping"} {
+		if _, err := ParsePingEndpoints(engine); err == nil {
+			t.Errorf("Expecting (%s) to be rejected", engine)
+		}
+	}
+}
+
+// Each endpoint receives the escaped location of the sitemap, failures are returned by endpoint
+func TestPingSitemap(t *testing.T) {
+	var pinged []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		pinged = append(pinged, r.URL.Query().Get("sitemap"))
+	}))
+	defer ts.Close()
+
+	sitemap := "https://monzo.com/sitemap.xml?v=2"
+	failed := PingSitemap(ts.Client(), []string{ts.URL + "/ping?sitemap=%s", ts.URL + "/down?sitemap=%s"}, sitemap)
+	if len(pinged) != 1 || pinged[0] != sitemap {
+		t.Errorf("Expecting (%s) to be pinged, got (%v)", sitemap, pinged)
+	}
+	if err, ok := failed[ts.URL+"/down?sitemap=%s"].(SitemapPingFailed); len(failed) != 1 || !ok || err.Status != http.StatusServiceUnavailable {
+		t.Errorf("Expecting the endpoint down to fail, got (%v)", failed)
+	}
+}
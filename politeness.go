@@ -0,0 +1,314 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+)
+
+// --------------------
+// Politeness profiles
+// --------------------
+
+// Profile applied to hosts whose pattern matches none of the config, if the config defines it
+const DEFAULT_POLITENESS_PROFILE = "default"
+
+// How hard a host is crawled. Zero values mean no limit, and the user agent of the fetcher.
+type PolitenessProfile struct {
+
+	// Requests per second sent to the host
+	Rate float64 `json:"rate"`
+
+	// Requests sent to the host at the same time
+	Concurrency int `json:"concurrency"`
+
+	// Time between two requests to the host, e.g. 500ms
+	Delay string `json:"delay"`
+
+	UserAgent string `json:"user_agent"`
+
+	// Bounds of a random delay added before each request to the host, e.g. 100ms and 2s.
+	// The crawl's own jitter applies when they are empty.
+	JitterMin string `json:"jitter_min"`
+	JitterMax string `json:"jitter_max"`
+
+	// Delay and jitter parsed, see interval
+	delay  time.Duration
+	jitter jitter
+}
+
+// Random delay added on top of rate limits, so that requests do not come at a fixed pace
+// that some firewalls flag as a bot. The zero value adds none.
+type jitter struct {
+	min time.Duration
+	max time.Duration
+}
+
+// Returns the jitter between the given bounds, either of which may be empty
+func parseJitter(min string, max string) (jitter, error) {
+	var j jitter
+	var err error
+	if len(min) > 0 {
+		if j.min, err = time.ParseDuration(min); err != nil {
+			return j, fmt.Errorf("Invalid minimum jitter (%s)", min)
+		}
+	}
+	if len(max) > 0 {
+		if j.max, err = time.ParseDuration(max); err != nil {
+			return j, fmt.Errorf("Invalid maximum jitter (%s)", max)
+		}
+	}
+	return j, j.validate()
+}
+
+func (j jitter) validate() error {
+	if j.min < 0 || j.max < j.min {
+		return fmt.Errorf("Invalid jitter (%s to %s), expecting 0 <= min <= max", j.min, j.max)
+	}
+	return nil
+}
+
+// Returns a random delay between the bounds of the jitter
+func (j jitter) duration() time.Duration {
+	if j.max <= 0 {
+		return 0
+	}
+	return j.min + time.Duration(rand.Int63n(int64(j.max-j.min)+1))
+}
+
+// Returns the minimum time between two requests to a host of the profile
+func (p *PolitenessProfile) interval() time.Duration {
+	interval := p.delay
+	if p.Rate > 0 {
+		if perRequest := time.Duration(float64(time.Second) / p.Rate); perRequest > interval {
+			interval = perRequest
+		}
+	}
+	return interval
+}
+
+// Host pattern mapped to a profile, e.g. {"host": "*.monzo.com", "profile": "own-cdn"}
+type HostProfile struct {
+	Host    string `json:"host"`
+	Profile string `json:"profile"`
+}
+
+// Politeness profiles of a config file and the hosts they apply to, e.g.
+//
+//	{"profiles": {"gentle": {"rate": 1, "concurrency": 1, "user_agent": "MonzoBot/1.0"},
+//	              "own-cdn": {"concurrency": 50}},
+//	 "hosts": [{"host": "api.partner.com", "profile": "gentle"}, {"host": "*.monzo.com", "profile": "own-cdn"}]}
+//
+// Hosts are matched in order with path.Match, the first match applies.
+type PolitenessConfig struct {
+	Profiles map[string]*PolitenessProfile `json:"profiles"`
+	Hosts    []HostProfile                 `json:"hosts"`
+}
+
+// Checks the profiles and patterns of the config, parsing the delays of its profiles
+func (pc *PolitenessConfig) validate() error {
+	for name, p := range pc.Profiles {
+		if p == nil {
+			return fmt.Errorf("Empty politeness profile (%s)", name)
+		}
+		if len(p.Delay) > 0 {
+			d, err := time.ParseDuration(p.Delay)
+			if err != nil {
+				return fmt.Errorf("Invalid delay (%s) of politeness profile (%s)", p.Delay, name)
+			}
+			p.delay = d
+		}
+		j, err := parseJitter(p.JitterMin, p.JitterMax)
+		if err != nil {
+			return fmt.Errorf("%s in politeness profile (%s)", err, name)
+		}
+		p.jitter = j
+	}
+	for _, h := range pc.Hosts {
+		if _, err := path.Match(h.Host, ""); err != nil {
+			return fmt.Errorf("Invalid host pattern (%s): %s", h.Host, err)
+		}
+		if _, present := pc.Profiles[h.Profile]; !present {
+			return fmt.Errorf("Unknown politeness profile (%s) for host (%s)", h.Profile, h.Host)
+		}
+	}
+	return nil
+}
+
+// Returns the politeness config read from the JSON file at path
+func LoadPolitenessConfig(path string) (*PolitenessConfig, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pc := &PolitenessConfig{}
+	if err := json.Unmarshal(content, pc); err != nil {
+		return nil, fmt.Errorf("Malformed politeness config (%s): %s", path, err)
+	}
+	return pc, pc.validate()
+}
+
+// Returns the profile of the given host, nil if none applies
+func (pc *PolitenessConfig) profile(host string) *PolitenessProfile {
+	for _, h := range pc.Hosts {
+		if matched, _ := path.Match(h.Host, host); matched {
+			return pc.Profiles[h.Profile]
+		}
+	}
+	return pc.Profiles[DEFAULT_POLITENESS_PROFILE]
+}
+
+// Requests to a host, limited by its profile
+type hostLimiter struct {
+	profile *PolitenessProfile
+
+	// Earliest time the next request may be sent
+	mu   sync.Mutex
+	next time.Time
+
+	// Held during each request, nil when the profile does not limit concurrency
+	slots chan struct{}
+}
+
+// Applies a PolitenessConfig to the requests of crawlers, which may share it so that
+// limits hold across sites. A nil politeness never limits.
+type politeness struct {
+	config *PolitenessConfig
+
+	// string --> *hostLimiter
+	// "api.partner.com" --> &hostLimiter{...}
+	hosts sync.Map
+}
+
+func newPoliteness(config *PolitenessConfig) *politeness {
+	return &politeness{config: config}
+}
+
+// Returns the limiter of the host of the given URL, nil if no profile applies
+func (p *politeness) limiter(site string) *hostLimiter {
+	if p == nil {
+		return nil
+	}
+	u, err := url.Parse(site)
+	if err != nil {
+		return nil
+	}
+	host := u.Hostname()
+	if l, present := p.hosts.Load(host); present {
+		return l.(*hostLimiter)
+	}
+	profile := p.config.profile(host)
+	if profile == nil {
+		p.hosts.Store(host, (*hostLimiter)(nil))
+		return nil
+	}
+	l := &hostLimiter{profile: profile}
+	if profile.Concurrency > 0 {
+		l.slots = make(chan struct{}, profile.Concurrency)
+	}
+	actual, _ := p.hosts.LoadOrStore(host, l)
+	return actual.(*hostLimiter)
+}
+
+// Waits until a request to the given URL is allowed by the profile of its host and for a
+// random jitter, that of the profile or the given one, on top. Returns the time waited, and
+// false if ctx was done first, in which case release must not be called. Otherwise each call
+// must be followed by release once the request is done.
+func (p *politeness) acquire(ctx context.Context, site string, fallback jitter) (time.Duration, bool) {
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	l := p.limiter(site)
+	if l == nil {
+		d := fallback.duration()
+		return d, sleepUntil(done, time.Now().Add(d))
+	}
+	start := time.Now()
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-done:
+			return time.Since(start), false
+		}
+	}
+	j := l.profile.jitter
+	if j.max <= 0 {
+		j = fallback
+	}
+
+	// The next request is spaced from this one's jittered time so that the rate still holds
+	l.mu.Lock()
+	at := time.Now()
+	if l.next.After(at) {
+		at = l.next
+	}
+	at = at.Add(j.duration())
+	l.next = at.Add(l.profile.interval())
+	l.mu.Unlock()
+	if !sleepUntil(done, at) {
+		if l.slots != nil {
+			<-l.slots
+		}
+		return time.Since(start), false
+	}
+	return time.Since(start), true
+}
+
+// Sleeps until at, returns false if done is closed first
+func sleepUntil(done <-chan struct{}, at time.Time) bool {
+	d := time.Until(at)
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (p *politeness) release(site string) {
+	if l := p.limiter(site); l != nil && l.slots != nil {
+		<-l.slots
+	}
+}
+
+// Returns the user agent of the profile of the given URL's host, empty for the fetcher's own
+func (p *politeness) userAgent(site string) string {
+	if l := p.limiter(site); l != nil {
+		return l.profile.UserAgent
+	}
+	return ""
+}
+
+// Fetcher sending the user agent of the politeness profile of each URL's host
+type politeFetcher struct {
+	p    *politeness
+	next HeaderFetcher
+}
+
+func (f *politeFetcher) Fetch(url string) (*FetchResult, error) {
+	return f.FetchWithHeader(url, nil)
+}
+
+func (f *politeFetcher) FetchWithHeader(url string, header http.Header) (*FetchResult, error) {
+	if ua := f.p.userAgent(url); len(ua) > 0 {
+		with := http.Header{"User-Agent": {ua}}
+		for name, values := range header {
+			with[name] = values
+		}
+		header = with
+	}
+	return f.next.FetchWithHeader(url, header)
+}
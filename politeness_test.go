@@ -0,0 +1,167 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadPolitenessConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-politeness-")
+	if err != nil {
+		t.Fatalf("Failed to create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "politeness.json")
+	ioutil.WriteFile(path, []byte(`{"profiles": {"gentle": {"rate": 2, "delay": "1s", "user_agent": "MonzoBot"},
+		"default": {"concurrency": 4}}, "hosts": [{"host": "*.partner.com", "profile": "gentle"}]}`), 0644)
+
+	pc, err := LoadPolitenessConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %s", err)
+	}
+	if p := pc.profile("api.partner.com"); p == nil || p.UserAgent != "MonzoBot" || p.interval() != time.Second {
+		t.Errorf("Expecting the gentle profile with a 1s interval, got (%+v)", p)
+	}
+	if p := pc.profile("monzo.com"); p == nil || p.Concurrency != 4 {
+		t.Errorf("Expecting the default profile, got (%+v)", p)
+	}
+
+	ioutil.WriteFile(path, []byte(`{"hosts": [{"host": "monzo.com", "profile": "missing"}]}`), 0644)
+	if _, err := LoadPolitenessConfig(path); err == nil {
+		t.Errorf("Expecting an error for an unknown profile")
+	}
+}
+
+// Requests to a host follow the rate, concurrency and user agent of its profile
+func TestCrawlPoliteness(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	var agents []string
+	inFlight, most := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		agents = append(agents, r.UserAgent())
+		inFlight++
+		if inFlight > most {
+			most = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		io.WriteString(w, `<html><a href="/a">A</a><a href="/b">B</a><a href="/c">C</a></html>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.respectRobots = false
+	pc := &PolitenessConfig{Profiles: map[string]*PolitenessProfile{
+		"gentle": {Rate: 20, Concurrency: 1, UserAgent: "MonzoBot"}},
+		Hosts: []HostProfile{{Host: "127.0.0.1", Profile: "gentle"}}}
+	if err := pc.validate(); err != nil {
+		t.Fatalf("Invalid config: %s", err)
+	}
+	c.politeness = newPoliteness(pc)
+	c.Run(context.Background())
+
+	if len(times) != 4 || most != 1 {
+		t.Fatalf("Expecting 4 requests one at a time, got (%d) with (%d) at once", len(times), most)
+	}
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < 45*time.Millisecond {
+			t.Errorf("Expecting at least 50ms between requests, got (%s)", gap)
+		}
+	}
+	for _, agent := range agents {
+		if agent != "MonzoBot" {
+			t.Errorf("Expecting the user agent of the profile, got (%s)", agent)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	j, err := parseJitter("10ms", "20ms")
+	if err != nil {
+		t.Fatalf("Failed to parse jitter: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		if d := j.duration(); d < 10*time.Millisecond || d > 20*time.Millisecond {
+			t.Fatalf("Expecting a jitter between 10ms and 20ms, got (%s)", d)
+		}
+	}
+	if d := (jitter{}).duration(); d != 0 {
+		t.Errorf("Expecting no jitter from the zero value, got (%s)", d)
+	}
+	if _, err := parseJitter("2s", "1s"); err == nil {
+		t.Errorf("Expecting an error for a minimum above the maximum")
+	}
+}
+
+// The jitter of a profile comes on top of its rate, the crawl's jitter applies to other hosts
+func TestPoliteness_acquireJitter(t *testing.T) {
+	pc := &PolitenessConfig{Profiles: map[string]*PolitenessProfile{
+		"gentle": {Rate: 50, JitterMin: "30ms", JitterMax: "30ms"}},
+		Hosts: []HostProfile{{Host: "partner.com", Profile: "gentle"}}}
+	if err := pc.validate(); err != nil {
+		t.Fatalf("Invalid config: %s", err)
+	}
+	p := newPoliteness(pc)
+	start := time.Now()
+	ctx := context.Background()
+	p.acquire(ctx, "https://partner.com/a", jitter{})
+	p.acquire(ctx, "https://partner.com/b", jitter{})
+	// 30ms jitter, 20ms interval, 30ms jitter
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Expecting at least 80ms for two jittered requests, got (%s)", elapsed)
+	}
+	if waited, _ := p.acquire(ctx, "https://monzo.com", jitter{min: 15 * time.Millisecond, max: 15 * time.Millisecond}); waited != 15*time.Millisecond {
+		t.Errorf("Expecting the crawl's jitter of 15ms, got (%s)", waited)
+	}
+}
+
+// A cancelled crawl stops waiting for both a slot and a delay, and gives back the slot it took
+func TestPoliteness_acquireCancelled(t *testing.T) {
+	pc := &PolitenessConfig{Profiles: map[string]*PolitenessProfile{
+		"single": {Concurrency: 1, JitterMin: "10s", JitterMax: "10s"}},
+		Hosts: []HostProfile{{Host: "partner.com", Profile: "single"}}}
+	if err := pc.validate(); err != nil {
+		t.Fatalf("Invalid config: %s", err)
+	}
+	p := newPoliteness(pc)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if _, ok := p.acquire(ctx, "https://partner.com/a", jitter{}); ok {
+		t.Errorf("Expecting the jittered wait to be cancelled")
+	}
+	if _, ok := p.acquire(ctx, "https://monzo.com", jitter{min: 10 * time.Second, max: 10 * time.Second}); ok {
+		t.Errorf("Expecting the crawl's jitter to be cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expecting the cancelled waits to return promptly, got (%s)", elapsed)
+	}
+
+	// The slot was given back, so only the held one below blocks the next request
+	l := p.limiter("https://partner.com/a")
+	if len(l.slots) != 0 {
+		t.Fatalf("Expecting the cancelled request to release its slot, got (%d) taken", len(l.slots))
+	}
+	l.slots <- struct{}{}
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, ok := p.acquire(ctx, "https://partner.com/b", jitter{}); ok {
+		t.Errorf("Expecting the wait for a slot to be cancelled")
+	}
+}
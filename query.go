@@ -0,0 +1,293 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// --------------------
+// Queries
+// --------------------
+
+// Condition on the pages of a saved crawl, parsed by ParseQuery from e.g.
+//
+//	category = "not found" and path ^= /docs and referrer ~ /blog
+//
+// Conditions compare a field of a page to a value and are combined with and, or, not and
+// parentheses. Operators are = and != (equal), ~ and !~ (contains), ^= (starts with),
+// $= (ends with), and < <= > >= comparing numbers. See queryFields for the fields.
+type Query interface {
+	Match(p streamedPage) bool
+}
+
+// Fields of a page queries can compare, as strings
+var queryFields = map[string]func(p streamedPage) string{
+	"url":      func(p streamedPage) string { return p.URL },
+	"path":     func(p streamedPage) string { return urlPath(p.URL) },
+	"host":     func(p streamedPage) string { return urlHost(p.URL) },
+	"referrer": func(p streamedPage) string { return p.Referrer },
+	"source":   func(p streamedPage) string { return p.Source },
+	"depth":    func(p streamedPage) string { return strconv.Itoa(p.Depth) },
+	"outcome":  func(p streamedPage) string { return p.outcome() },
+	"category": func(p streamedPage) string { return p.Category },
+	"error":    func(p streamedPage) string { return p.Error },
+	"skipped":  func(p streamedPage) string { return p.Skipped },
+	"children": func(p streamedPage) string { return strconv.Itoa(len(p.Children)) },
+	"external": func(p streamedPage) string { return strconv.Itoa(len(p.ExternalLinks)) },
+	"get_time": func(p streamedPage) string { return strconv.FormatFloat(p.GetTimeMs, 'f', -1, 64) },
+	"request":  func(p streamedPage) string { return p.RequestID },
+	"ttfb":     func(p streamedPage) string { return strconv.FormatFloat(p.TTFBMs, 'f', -1, 64) },
+}
+
+// Returns the path of a URL, / when it has none
+func urlPath(site string) string {
+	u, err := url.Parse(site)
+	if err != nil || len(u.Path) == 0 {
+		return "/"
+	}
+	return u.Path
+}
+
+// Returns the host of a URL, empty if it has none
+func urlHost(site string) string {
+	if u, err := url.Parse(site); err == nil {
+		return u.Host
+	}
+	return ""
+}
+
+type queryAnd [2]Query
+type queryOr [2]Query
+type queryNot struct{ q Query }
+
+func (q queryAnd) Match(p streamedPage) bool { return q[0].Match(p) && q[1].Match(p) }
+func (q queryOr) Match(p streamedPage) bool  { return q[0].Match(p) || q[1].Match(p) }
+func (q queryNot) Match(p streamedPage) bool { return !q.q.Match(p) }
+
+// Comparison of a field to a value
+type queryCondition struct {
+	field func(p streamedPage) string
+	op    string
+	value string
+}
+
+func (q queryCondition) Match(p streamedPage) bool {
+	got := q.field(p)
+	switch q.op {
+	case "=":
+		return got == q.value
+	case "!=":
+		return got != q.value
+	case "~":
+		return strings.Contains(got, q.value)
+	case "!~":
+		return !strings.Contains(got, q.value)
+	case "^=":
+		return strings.HasPrefix(got, q.value)
+	case "$=":
+		return strings.HasSuffix(got, q.value)
+	}
+	a, errA := strconv.ParseFloat(got, 64)
+	b, errB := strconv.ParseFloat(q.value, 64)
+	if errA != nil || errB != nil {
+		return false
+	}
+	switch q.op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	}
+	return a >= b
+}
+
+// Operators of conditions, longest first so that <= is not read as <
+var queryOperators = []string{"!=", "!~", "^=", "$=", "<=", ">=", "=", "~", "<", ">"}
+
+// Returns the tokens of a query: parentheses, operators, quoted strings and words
+func tokenizeQuery(query string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(query); {
+		ch := rune(query[i])
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case ch == '(' || ch == ')':
+			tokens = append(tokens, string(ch))
+			i++
+		case ch == '"' || ch == '\'':
+			end := strings.IndexRune(query[i+1:], ch)
+			if end < 0 {
+				return nil, fmt.Errorf("Unterminated string in query (%s)", query)
+			}
+			// Kept quoted so that values are never read as keywords
+			tokens = append(tokens, query[i:i+end+2])
+			i += end + 2
+		default:
+			op := ""
+			for _, o := range queryOperators {
+				if strings.HasPrefix(query[i:], o) {
+					op = o
+					break
+				}
+			}
+			if len(op) > 0 {
+				tokens = append(tokens, op)
+				i += len(op)
+				continue
+			}
+			start := i
+			for i < len(query) && !unicode.IsSpace(rune(query[i])) && !strings.ContainsRune("()\"'!~^$<>=", rune(query[i])) {
+				i++
+			}
+			if i == start {
+				return nil, fmt.Errorf("Unexpected (%c) in query (%s)", query[i], query)
+			}
+			tokens = append(tokens, query[start:i])
+		}
+	}
+	return tokens, nil
+}
+
+// Parser of the tokens of a query, by recursive descent
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+// Returns the next token without consuming it, empty at the end
+func (qp *queryParser) peek() string {
+	if qp.pos < len(qp.tokens) {
+		return qp.tokens[qp.pos]
+	}
+	return ""
+}
+
+func (qp *queryParser) next() string {
+	t := qp.peek()
+	qp.pos++
+	return t
+}
+
+// expr := term { or term }
+func (qp *queryParser) expr() (Query, error) {
+	q, err := qp.term()
+	for err == nil && strings.EqualFold(qp.peek(), "or") {
+		qp.next()
+		var right Query
+		if right, err = qp.term(); err == nil {
+			q = queryOr{q, right}
+		}
+	}
+	return q, err
+}
+
+// term := factor { and factor }
+func (qp *queryParser) term() (Query, error) {
+	q, err := qp.factor()
+	for err == nil && strings.EqualFold(qp.peek(), "and") {
+		qp.next()
+		var right Query
+		if right, err = qp.factor(); err == nil {
+			q = queryAnd{q, right}
+		}
+	}
+	return q, err
+}
+
+// factor := not factor | ( expr ) | field operator value
+func (qp *queryParser) factor() (Query, error) {
+	t := qp.next()
+	switch {
+	case strings.EqualFold(t, "not"):
+		q, err := qp.factor()
+		return queryNot{q}, err
+	case t == "(":
+		q, err := qp.expr()
+		if err == nil && qp.next() != ")" {
+			err = fmt.Errorf("Missing ) in query")
+		}
+		return q, err
+	}
+
+	field, present := queryFields[strings.ToLower(t)]
+	if !present {
+		return nil, fmt.Errorf("Unknown field (%s) in query", t)
+	}
+	op := qp.next()
+	known := false
+	for _, o := range queryOperators {
+		known = known || o == op
+	}
+	if !known {
+		return nil, fmt.Errorf("Expecting an operator after (%s), got (%s)", t, op)
+	}
+	value := qp.next()
+	if len(value) == 0 || value == "(" || value == ")" {
+		return nil, fmt.Errorf("Expecting a value after (%s %s)", t, op)
+	}
+	if value[0] == '"' || value[0] == '\'' {
+		value = value[1 : len(value)-1]
+	}
+	return queryCondition{field: field, op: op, value: value}, nil
+}
+
+// Returns the query of the given expression, see Query
+func ParseQuery(query string) (Query, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("Empty query")
+	}
+	qp := &queryParser{tokens: tokens}
+	q, err := qp.expr()
+	if err == nil && qp.pos < len(tokens) {
+		err = fmt.Errorf("Unexpected (%s) in query", qp.peek())
+	}
+	return q, err
+}
+
+// Writes the pages matching q to w, as NDJSON when asJSON is set, otherwise the given
+// comma separated fields tab separated, one page per line. Returns the number of pages written.
+func WriteQueryResults(w io.Writer, pages []streamedPage, q Query, fields string, asJSON bool) (int, error) {
+	var columns []func(p streamedPage) string
+	for _, name := range strings.Split(fields, ",") {
+		column, present := queryFields[strings.TrimSpace(name)]
+		if !present {
+			return 0, fmt.Errorf("Unknown field (%s)", name)
+		}
+		columns = append(columns, column)
+	}
+
+	enc := json.NewEncoder(w)
+	matched := 0
+	for _, p := range newCrawlGraph(pages).sorted() {
+		if !q.Match(p) {
+			continue
+		}
+		matched++
+		if asJSON {
+			if err := enc.Encode(p); err != nil {
+				return matched, err
+			}
+			continue
+		}
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			values[i] = column(p)
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(values, "\t")); err != nil {
+			return matched, err
+		}
+	}
+	return matched, nil
+}
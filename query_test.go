@@ -0,0 +1,63 @@
+package crawler
+
+import (
+	"bytes"
+	"testing"
+)
+
+var queriedPages = []streamedPage{
+	{URL: "https://monzo.com", Source: SOURCE_SEED, Children: []string{"https://monzo.com/blog/a", "https://monzo.com/docs/b"}},
+	{URL: "https://monzo.com/blog/a", Referrer: "https://monzo.com", Depth: 1,
+		Children: []string{"https://monzo.com/docs/old", "https://monzo.com/help/old"}},
+	{URL: "https://monzo.com/docs/b", Referrer: "https://monzo.com", Depth: 1, Children: []string{"https://monzo.com/docs/gone"}},
+	{URL: "https://monzo.com/docs/old", Referrer: "https://monzo.com/blog/a", Depth: 2, Error: "Failed to find", Category: "not found"},
+	{URL: "https://monzo.com/help/old", Referrer: "https://monzo.com/blog/a", Depth: 2, Error: "Failed to find", Category: "not found"},
+	{URL: "https://monzo.com/docs/gone", Referrer: "https://monzo.com/docs/b", Depth: 2, Error: "Failed to find", Category: "not found"},
+	{URL: "https://monzo.com/app.pdf", Referrer: "https://monzo.com", Depth: 1, Skipped: SKIP_SUFFIX},
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`category = "not found" and path ^= /docs and referrer ~ /blog`, "https://monzo.com/docs/old\n"},
+		{`category = 'not found' and not (path ^= /docs)`, "https://monzo.com/help/old\n"},
+		{`depth >= 2 and referrer $= /b or skipped = suffix`, "https://monzo.com/app.pdf\nhttps://monzo.com/docs/gone\n"},
+		{`children > 1 AND outcome = ok`, "https://monzo.com\nhttps://monzo.com/blog/a\n"},
+		{`url !~ monzo`, ""},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.query)
+		if err != nil {
+			t.Errorf("Failed to parse (%s): %s", test.query, err)
+			continue
+		}
+		var out bytes.Buffer
+		WriteQueryResults(&out, queriedPages, q, "url", false)
+		if out.String() != test.want {
+			t.Errorf("Expecting (%s) to match (%q), got (%q)", test.query, test.want, out.String())
+		}
+	}
+
+	for _, query := range []string{"", "colour = red", "path ^=", "(depth > 1", "path = 'docs", "depth > 1 depth"} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("Expecting (%s) to be rejected", query)
+		}
+	}
+}
+
+// Fields asked for are printed tab separated
+func TestWriteQueryResults_fields(t *testing.T) {
+	q, _ := ParseQuery("path = /docs/gone")
+	var out bytes.Buffer
+	if n, err := WriteQueryResults(&out, queriedPages, q, "url,referrer,depth", false); err != nil || n != 1 {
+		t.Fatalf("Expecting a single page, got (%d, %v)", n, err)
+	}
+	if want := "https://monzo.com/docs/gone\thttps://monzo.com/docs/b\t2\n"; out.String() != want {
+		t.Errorf("Expecting (%q), got (%q)", want, out.String())
+	}
+	if _, err := WriteQueryResults(&out, queriedPages, q, "url,colour", false); err == nil {
+		t.Errorf("Expecting an unknown field to be rejected")
+	}
+}
@@ -0,0 +1,85 @@
+package crawler
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// --------------------
+// Ramp-up
+// --------------------
+
+// Requests sent at once when a ramp-up starts and when it ends, unless told otherwise
+const DEFAULT_RAMP_FROM int = 2
+const DEFAULT_RAMP_TO int = 50
+
+// Time between two checks of the limit by requests waiting for it
+const RAMP_POLL_INTERVAL time.Duration = 20 * time.Millisecond
+
+// Limits the number of requests sent at once at the start of a crawl, from 'from' up to 'to'
+// over 'duration', so that origins with cold caches and autoscaling backends can catch up.
+// The ramp holds while the throttle is slowing requests down, and the limit is lifted once
+// it is over. The zero value never limits.
+type rampUp struct {
+	mu sync.Mutex
+
+	duration time.Duration
+	from     int
+	to       int
+
+	// Time of the ramp gone through, not counting the time spent throttled
+	progress time.Duration
+	last     time.Time
+
+	// Number of requests holding a slot
+	inFlight int
+
+	// True once the ramp is over, logged once
+	done bool
+}
+
+// Moves the ramp forward to now, unless requests are being throttled
+func (r *rampUp) advance(now time.Time, throttled bool) {
+	if !r.last.IsZero() && !throttled {
+		r.progress += now.Sub(r.last)
+	}
+	r.last = now
+	if r.progress >= r.duration && !r.done {
+		r.done = true
+		if r.duration > 0 {
+			log.Printf("Ramp-up over, no longer limiting the number of requests sent at once.\n")
+		}
+	}
+}
+
+// Returns the number of requests allowed at once, zero for no limit
+func (r *rampUp) limit() int {
+	if r.done {
+		return 0
+	}
+	return r.from + int(int64(r.to-r.from)*int64(r.progress)/int64(r.duration))
+}
+
+// Waits until a request may be sent, returns the time waited. Each call must be followed by
+// release once the request is done. throttled reports whether requests are being slowed down.
+func (r *rampUp) acquire(throttled func() bool) time.Duration {
+	start := time.Now()
+	for {
+		r.mu.Lock()
+		r.advance(time.Now(), throttled())
+		if limit := r.limit(); limit <= 0 || r.inFlight < limit {
+			r.inFlight++
+			r.mu.Unlock()
+			return time.Since(start)
+		}
+		r.mu.Unlock()
+		time.Sleep(RAMP_POLL_INTERVAL)
+	}
+}
+
+func (r *rampUp) release() {
+	r.mu.Lock()
+	r.inFlight--
+	r.mu.Unlock()
+}
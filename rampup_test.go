@@ -0,0 +1,72 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The limit grows with the time spent unthrottled, then is lifted
+func TestRampUp_limit(t *testing.T) {
+	r := rampUp{duration: time.Minute, from: 2, to: 12}
+	start := time.Now()
+	r.advance(start, false)
+	if got := r.limit(); got != 2 {
+		t.Errorf("Expecting (2) at the start, got (%d)", got)
+	}
+	r.advance(start.Add(30*time.Second), false)
+	if got := r.limit(); got != 7 {
+		t.Errorf("Expecting (7) half way through, got (%d)", got)
+	}
+	r.advance(start.Add(50*time.Second), true)
+	if got := r.limit(); got != 7 {
+		t.Errorf("Expecting the ramp to hold while throttled, got (%d)", got)
+	}
+	r.advance(start.Add(80*time.Second), false)
+	if got := r.limit(); got != 0 {
+		t.Errorf("Expecting no limit once over, got (%d)", got)
+	}
+
+	var zero rampUp
+	zero.acquire(func() bool { return false })
+	if got := zero.limit(); got != 0 {
+		t.Errorf("Expecting the zero value to never limit, got (%d)", got)
+	}
+}
+
+// No more requests than the limit are sent at once during the ramp
+func TestCrawlRampUp(t *testing.T) {
+	var mu sync.Mutex
+	var inFlight, most int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > most {
+			most = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		io.WriteString(w, `<html><a href="/a">A</a><a href="/b">B</a><a href="/c">C</a><a href="/d">D</a><a href="/e">E</a></html>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.rampUp = rampUp{duration: time.Hour, from: 2, to: 3}
+	c.Run(context.Background())
+
+	if most > 2 {
+		t.Errorf("Expecting at most (2) requests at once, got (%d)", most)
+	}
+	if pages := len(c.Result().Pages); pages != 6 {
+		t.Errorf("Expecting (6) pages crawled, got (%d)", pages)
+	}
+}
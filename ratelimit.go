@@ -0,0 +1,120 @@
+package crawler
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// --------------------
+// Rate limit
+// --------------------
+
+// Requests sent to a host at once after it was left idle, unless told otherwise, see Crawler.rateBurst
+const DEFAULT_RATE_BURST int = 1
+
+// Token bucket of a host: it holds up to burst tokens, refilled at rate per second,
+// and each request takes one
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Takes a token, returns how long to wait for it. Tokens are taken in advance so that
+// concurrent requests queue up rather than all waking up at once.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Waits until a request to the given URL is allowed by 'rate', or the crawl stops.
+// Returns the time waited.
+func (c *Crawler) waitForRate(site string) time.Duration {
+	if c.rate <= 0 {
+		return 0
+	}
+	u, err := url.Parse(site)
+	if err != nil {
+		return 0
+	}
+	b, present := c.rateBuckets.Load(u.Hostname())
+	if !present {
+		b, _ = c.rateBuckets.LoadOrStore(u.Hostname(), newTokenBucket(c.rate, c.rateBurst))
+	}
+	d := b.(*tokenBucket).reserve()
+	if d <= 0 {
+		return 0
+	}
+	var done <-chan struct{}
+	if c.ctx != nil {
+		done = c.ctx.Done()
+	}
+	start := time.Now()
+	select {
+	case <-time.After(d):
+	case <-done:
+	}
+	return time.Since(start)
+}
+
+// Waits for 'rate' ahead of fetching the given page, so that the wait is not spent holding
+// a fetch slot. The request of the page does not wait again, see rateFetcher.
+func (c *Crawler) reserveRate(site string) time.Duration {
+	if c.rate <= 0 {
+		return 0
+	}
+	d := c.waitForRate(site)
+	c.rateReserved.Store(site, true)
+	return d
+}
+
+// Fetcher waiting for the rate of the Crawler before each request, so that robots.txt,
+// sitemaps, icons, iframes and probes count towards it as much as pages do
+type rateFetcher struct {
+	c    *Crawler
+	next Fetcher
+}
+
+// Waits for 'rate' unless the request was reserved with reserveRate
+func (f *rateFetcher) wait(url string) {
+	if _, reserved := f.c.rateReserved.LoadAndDelete(url); !reserved {
+		f.c.waitForRate(url)
+	}
+}
+
+func (f *rateFetcher) Fetch(url string) (*FetchResult, error) {
+	f.wait(url)
+	return f.next.Fetch(url)
+}
+
+// Same as rateFetcher, for fetchers that can send headers
+type rateHeaderFetcher struct {
+	rateFetcher
+}
+
+func (f *rateHeaderFetcher) FetchWithHeader(url string, header http.Header) (*FetchResult, error) {
+	f.wait(url)
+	return f.next.(HeaderFetcher).FetchWithHeader(url, header)
+}
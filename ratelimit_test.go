@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(10, 2)
+	for i := 0; i < 2; i++ {
+		if d := b.reserve(); d != 0 {
+			t.Errorf("Expecting the burst to be sent at once, got a wait of (%s)", d)
+		}
+	}
+	// Each request waits for a token more than the last, 100ms apart
+	for i := 1; i <= 3; i++ {
+		want := time.Duration(i) * 100 * time.Millisecond
+		if d := b.reserve(); d < want-10*time.Millisecond || d > want {
+			t.Errorf("Expecting a wait of about (%s), got (%s)", want, d)
+		}
+	}
+}
+
+// Requests to the host are spaced by the rate, however many workers crawl it
+func TestCrawlRate(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	site := &SyntheticSite{Depth: 1, Branching: 4}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		site.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.respectRobots = false
+	c.rate = 20
+	c.Run(context.Background())
+
+	if len(times) != site.Pages() {
+		t.Fatalf("Expecting (%d) requests, got (%d)", site.Pages(), len(times))
+	}
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < 40*time.Millisecond {
+			t.Errorf("Expecting requests (%d) and (%d) to be 50ms apart, got (%s)", i-1, i, gap)
+		}
+	}
+}
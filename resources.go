@@ -0,0 +1,165 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --------------------
+// Resource probes
+// --------------------
+
+// Number of bytes http.DetectContentType looks at, enough to tell the type of most files
+const DEFAULT_PROBE_BYTES = 512
+
+// Type and size of a resource that is not crawled (pdf, png..), learnt from its first bytes
+type ResourceProbe struct {
+	URL string `json:"url"`
+
+	// Status code of the response, zero if none was received
+	Status int `json:"status,omitempty"`
+
+	// Content-Type sent by the server, and the type sniffed from the first bytes
+	ContentType string `json:"content_type,omitempty"`
+	Sniffed     string `json:"sniffed,omitempty"`
+
+	// Size of the whole resource in bytes, -1 if the server did not tell
+	Size int64 `json:"size"`
+
+	// True if the server honoured the Range request and only sent the first bytes
+	Partial bool `json:"partial"`
+
+	// Why the resource could not be probed, empty if it was
+	Error string `json:"error,omitempty"`
+}
+
+// Returns true if the resource exists but the server says it is of a different type than it is
+func (p *ResourceProbe) Mismatched() bool {
+	if len(p.ContentType) == 0 || len(p.Sniffed) == 0 || p.Sniffed == "application/octet-stream" {
+		return false
+	}
+	return mediaType(p.ContentType) != mediaType(p.Sniffed)
+}
+
+// Returns the media type of a Content-Type, without its parameters
+func mediaType(contentType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+}
+
+// Fetcher able to fetch only the first bytes of a resource
+type RangeFetcher interface {
+	FetchRange(url string, n int64) (*ResourceProbe, error)
+}
+
+// Returns the total size given by a Content-Range header, e.g. "bytes 0-511/24576", -1 if unknown
+func contentRangeSize(contentRange string) int64 {
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return -1
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(contentRange[i+1:]), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// Fetches the first n bytes of url with a Range request. Servers ignoring the range send the
+// whole resource, of which only n bytes are read before the connection is dropped.
+// Always uses net/http, fasthttp reads whole bodies.
+func (f *HTTPFetcher) FetchRange(url string, n int64) (*ResourceProbe, error) {
+	client := &http.Client{Timeout: f.Timeout, Transport: safeTransport{}}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, InvalidURL(url)
+	}
+	for name, values := range f.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", n-1))
+	resp, err := client.Do(req)
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return nil, FetchTimeout(url)
+	} else if err != nil {
+		return nil, Http404Error(url)
+	}
+	defer resp.Body.Close()
+
+	probe := &ResourceProbe{URL: url, Status: resp.StatusCode, ContentType: resp.Header.Get("Content-Type"), Size: -1}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		probe.Partial = true
+		probe.Size = contentRangeSize(resp.Header.Get("Content-Range"))
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The range starts past the end, the resource is empty
+		probe.Size = contentRangeSize(resp.Header.Get("Content-Range"))
+		return probe, nil
+	case http.StatusOK:
+		probe.Size = resp.ContentLength
+	default:
+		return probe, nil
+	}
+	start, err := ioutil.ReadAll(io.LimitReader(resp.Body, n))
+	if err != nil {
+		return probe, InvalidHTMLContent(url)
+	}
+	if len(start) > 0 {
+		probe.Sniffed = http.DetectContentType(start)
+	}
+	return probe, nil
+}
+
+// Returns the fetcher resources are probed with, nil if the Crawler's fetcher cannot fetch ranges
+func (c *Crawler) rangeFetcher() RangeFetcher {
+	var f Fetcher = c.fetcher
+	if f == nil {
+		f = &HTTPFetcher{Timeout: c.fetchTimeout, Header: c.requestHeader}
+	}
+	rf, _ := f.(RangeFetcher)
+	return rf
+}
+
+// Fetches the first 'probeBytes' of a resource skipped for its suffix to confirm its type
+// and size, once per resource. Does nothing when 'probeBytes' is zero.
+func (c *Crawler) probeResource(url string) {
+	if c.probeBytes <= 0 {
+		return
+	}
+	rf := c.rangeFetcher()
+	if rf == nil {
+		return
+	}
+	// Claimed until probed, by whichever page found it first
+	if _, present := c.resources.LoadOrStore(url, &ResourceProbe{URL: url, Size: -1}); present {
+		return
+	}
+	if c.fetchSlots != nil {
+		c.fetchSlots <- struct{}{}
+		defer func() { <-c.fetchSlots }()
+	}
+	probe, err := rf.FetchRange(url, c.probeBytes)
+	if probe == nil {
+		probe = &ResourceProbe{URL: url, Size: -1}
+	}
+	if err != nil {
+		probe.Error = errorCategory(err)
+	}
+	c.resources.Store(url, probe)
+}
+
+// Returns the resources probed, sorted by URL
+func (c *Crawler) probedResources() []ResourceProbe {
+	var probes []ResourceProbe
+	c.resources.Range(func(k, v interface{}) bool {
+		probes = append(probes, *v.(*ResourceProbe))
+		return true
+	})
+	sort.Slice(probes, func(i, j int) bool { return probes[i].URL < probes[j].URL })
+	return probes
+}
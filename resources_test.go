@@ -0,0 +1,142 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Start of a PNG file, enough for it to be sniffed
+var pngStart = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestContentRangeSize(t *testing.T) {
+	tests := []struct {
+		contentRange string
+		want         int64
+	}{
+		{"bytes 0-511/24576", 24576},
+		{"bytes */0", 0},
+		{"bytes 0-511/*", -1},
+		{"", -1},
+	}
+	for _, test := range tests {
+		if got := contentRangeSize(test.contentRange); got != test.want {
+			t.Errorf("Expecting (%s) to give (%d), got (%d)", test.contentRange, test.want, got)
+		}
+	}
+}
+
+// Only the first bytes are transferred when the server supports ranges, all of the size is reported
+func TestHTTPFetcher_FetchRange(t *testing.T) {
+	image := append(append([]byte{}, pngStart...), bytes.Repeat([]byte{0}, 10000)...)
+	var mu sync.Mutex
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/logo.png":
+			http.ServeContent(w, r, "logo.png", time.Time{}, bytes.NewReader(image))
+		case "/norange.png":
+			// Served whole, and as the wrong type
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+			w.Write(image)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	f := &HTTPFetcher{}
+	probe, err := f.FetchRange(ts.URL+"/logo.png", 64)
+	if err != nil {
+		t.Fatalf("FetchRange failed: %v", err)
+	}
+	if !probe.Partial || probe.Size != int64(len(image)) || probe.Sniffed != "image/png" || probe.Mismatched() {
+		t.Errorf("Expecting a partial png of (%d) bytes, got (%+v)", len(image), probe)
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=0-63" {
+		t.Errorf("Expecting the first 64 bytes to be asked for, got (%v)", ranges)
+	}
+
+	probe, err = f.FetchRange(ts.URL+"/norange.png", 64)
+	if err != nil {
+		t.Fatalf("FetchRange failed: %v", err)
+	}
+	if probe.Partial || probe.Size != int64(len(image)) || !probe.Mismatched() {
+		t.Errorf("Expecting a whole png served as pdf, got (%+v)", probe)
+	}
+
+	probe, _ = f.FetchRange(ts.URL+"/missing.png", 64)
+	if probe.Status != http.StatusNotFound || len(probe.Sniffed) > 0 {
+		t.Errorf("Expecting a missing resource to be reported, got (%+v)", probe)
+	}
+}
+
+// Resources skipped for their suffix are probed once when asked for, and listed in the report
+func TestRun_probesResources(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/logo.png":
+			http.ServeContent(w, r, "logo.png", time.Time{}, bytes.NewReader(pngStart))
+		case "/terms.pdf":
+			http.NotFound(w, r)
+		default:
+			io.WriteString(w, `<html><a href="/logo.png">Logo</a><a href="/terms.pdf">Terms</a><a href="/about">About</a></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.probeBytes = DEFAULT_PROBE_BYTES
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if len(res.Resources) != 2 {
+		t.Fatalf("Expecting 2 resources probed, got (%+v)", res.Resources)
+	}
+	if logo := res.Resources[0]; logo.Sniffed != "image/png" || logo.Size != int64(len(pngStart)) {
+		t.Errorf("Expecting the logo to be a png of (%d) bytes, got (%+v)", len(pngStart), logo)
+	}
+	if terms := res.Resources[1]; terms.Status != http.StatusNotFound {
+		t.Errorf("Expecting the terms to be missing, got (%+v)", terms)
+	}
+	if requests["/logo.png"] != 1 {
+		t.Errorf("Expecting the logo to be probed once, got (%d) requests", requests["/logo.png"])
+	}
+
+	var report bytes.Buffer
+	c.WriteReport(&report)
+	if !strings.Contains(report.String(), ts.URL+"/logo.png: image/png, 16 bytes") ||
+		!strings.Contains(report.String(), ts.URL+"/terms.pdf: status 404") {
+		t.Errorf("Expecting the resources in the report, got (%s)", report.String())
+	}
+
+	// Never fetched unless asked for
+	var quiet Crawler
+	quiet.Init(ts.URL)
+	quiet.probeNotFound = false
+	requests = make(map[string]int)
+	res, _ = quiet.Run(context.Background())
+	if len(res.Resources) > 0 || requests["/logo.png"] > 0 {
+		t.Errorf("Expecting no resource to be probed by default, got (%+v)", res.Resources)
+	}
+}
@@ -0,0 +1,349 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------
+// robots.txt
+// --------------------
+
+// Time a robots.txt is cached for unless told otherwise, as recommended by RFC 9309
+const DEFAULT_ROBOTS_TTL = 24 * time.Hour
+
+// Product token the groups of robots.txt are matched against, the group of * applies otherwise
+const DEFAULT_ROBOTS_AGENT = "go-web-crawler"
+
+// Rules of robots.txt for a set of user agents
+type RobotsGroup struct {
+	Agents     []string      `json:"agents"`
+	Allow      []string      `json:"allow,omitempty"`
+	Disallow   []string      `json:"disallow,omitempty"`
+	CrawlDelay time.Duration `json:"crawl_delay,omitempty"`
+}
+
+// Parsed robots.txt of a host
+type RobotsRules struct {
+
+	// URL the rules were fetched from
+	URL string `json:"url"`
+
+	FetchedAt time.Time `json:"fetched_at"`
+
+	// False when the host has no robots.txt, which allows everything
+	Found bool `json:"found"`
+
+	Groups   []RobotsGroup `json:"groups,omitempty"`
+	Sitemaps []string      `json:"sitemaps,omitempty"`
+}
+
+// Returns the rules of the given robots.txt. Lines that cannot be parsed are skipped.
+func ParseRobots(robots []byte) *RobotsRules {
+	rules := &RobotsRules{Found: true}
+	var group *RobotsGroup
+	// Consecutive User-agent lines start a single group
+	agentsDone := true
+
+	scanner := bufio.NewScanner(bytes.NewReader(robots))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			continue
+		}
+		key, value := strings.ToLower(strings.TrimSpace(line[:i])), strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			if agentsDone {
+				rules.Groups = append(rules.Groups, RobotsGroup{})
+				group = &rules.Groups[len(rules.Groups)-1]
+				agentsDone = false
+			}
+			group.Agents = append(group.Agents, strings.ToLower(value))
+			continue
+		case "sitemap":
+			// Not part of any group, see FindSitemapDirectives
+			continue
+		}
+
+		agentsDone = true
+		if group == nil {
+			// Rule before any User-agent line
+			continue
+		}
+		switch key {
+		case "allow":
+			if len(value) > 0 {
+				group.Allow = append(group.Allow, value)
+			}
+		case "disallow":
+			// An empty Disallow allows everything, same as no rule
+			if len(value) > 0 {
+				group.Disallow = append(group.Disallow, value)
+			}
+		case "crawl-delay":
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				group.CrawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+	rules.Sitemaps = FindSitemapDirectives(robots)
+	return rules
+}
+
+// Returns the group applying to the given user agent, that naming it or else that of *.
+// Nil if there is none, which allows everything.
+func (r *RobotsRules) group(agent string) *RobotsGroup {
+	agent = strings.ToLower(agent)
+	var any *RobotsGroup
+	for i := range r.Groups {
+		for _, a := range r.Groups[i].Agents {
+			switch a {
+			case agent:
+				return &r.Groups[i]
+			case "*":
+				if any == nil {
+					any = &r.Groups[i]
+				}
+			}
+		}
+	}
+	return any
+}
+
+// Returns true if the given rule matches path, from its start. * matches any characters
+// and a trailing $ the end of the path.
+func robotsRuleMatches(rule string, path string) bool {
+	anchored := strings.HasSuffix(rule, "$")
+	parts := strings.Split(strings.TrimSuffix(rule, "$"), "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	if len(parts) == 1 {
+		return !anchored || path == parts[0]
+	}
+	path = path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(path, part)
+		}
+		j := strings.Index(path, part)
+		if j < 0 {
+			return false
+		}
+		path = path[j+len(part):]
+	}
+	return true
+}
+
+// Returns true if the given user agent may fetch path, with its query. The longest rule
+// matching it applies, Allow winning over Disallow when they are as long, see RFC 9309.
+func (r *RobotsRules) Allowed(path string, agent string) bool {
+	group := r.group(agent)
+	if group == nil || path == "/robots.txt" {
+		return true
+	}
+	allowed, longest := true, -1
+	for _, rule := range group.Disallow {
+		if len(rule) > longest && robotsRuleMatches(rule, path) {
+			allowed, longest = false, len(rule)
+		}
+	}
+	for _, rule := range group.Allow {
+		if len(rule) >= longest && robotsRuleMatches(rule, path) {
+			allowed, longest = true, len(rule)
+		}
+	}
+	return allowed
+}
+
+// Returns the Crawl-delay of the given user agent, 0 if there is none
+func (r *RobotsRules) CrawlDelay(agent string) time.Duration {
+	if group := r.group(agent); group != nil {
+		return group.CrawlDelay
+	}
+	return 0
+}
+
+// Cache of the robots.txt of each host, kept in memory and in a directory when given one
+// so that successive crawls of the same hosts do not refetch them.
+type RobotsCache struct {
+	mu sync.Mutex
+
+	// Rules of each robots.txt URL
+	rules map[string]*RobotsRules
+
+	// Locks held while fetching each robots.txt URL, so that it is only fetched once
+	fetching map[string]*sync.Mutex
+
+	// Directory the rules are kept in across runs, none when empty
+	dir string
+
+	// Time rules are kept for
+	ttl time.Duration
+}
+
+// Returns a RobotsCache keeping rules for ttl, in dir if not empty
+func NewRobotsCache(dir string, ttl time.Duration) *RobotsCache {
+	return &RobotsCache{rules: make(map[string]*RobotsRules), fetching: make(map[string]*sync.Mutex), dir: dir, ttl: ttl}
+}
+
+// Returns the file the rules of the given robots.txt URL are kept in
+func (rc *RobotsCache) file(robots string) string {
+	return filepath.Join(rc.dir, siteFilename(robots)+".json")
+}
+
+// Returns the cached rules of the given robots.txt URL, nil if there are none or they expired
+func (rc *RobotsCache) cached(robots string) *RobotsRules {
+	rc.mu.Lock()
+	rules := rc.rules[robots]
+	rc.mu.Unlock()
+	if rules == nil && len(rc.dir) > 0 {
+		if content, err := ioutil.ReadFile(rc.file(robots)); err == nil {
+			rules = new(RobotsRules)
+			if json.Unmarshal(content, rules) != nil {
+				rules = nil
+			} else {
+				rc.mu.Lock()
+				rc.rules[robots] = rules
+				rc.mu.Unlock()
+			}
+		}
+	}
+	if rules == nil || time.Since(rules.FetchedAt) > rc.ttl {
+		return nil
+	}
+	return rules
+}
+
+// Keeps the given rules, on disk too if the cache has a directory
+func (rc *RobotsCache) store(rules *RobotsRules) error {
+	rc.mu.Lock()
+	rc.rules[rules.URL] = rules
+	rc.mu.Unlock()
+	if len(rc.dir) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(rc.dir, 0755); err != nil {
+		return err
+	}
+	f, err := createAtomic(rc.file(rules.URL))
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(rules); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
+
+// Returns the rules of the robots.txt at the given URL, fetched with fetcher unless cached.
+// A missing robots.txt gives rules allowing everything, other failures are not cached.
+func (rc *RobotsCache) Get(fetcher Fetcher, robots string) (*RobotsRules, error) {
+	if rules := rc.cached(robots); rules != nil {
+		return rules, nil
+	}
+
+	rc.mu.Lock()
+	lock, ok := rc.fetching[robots]
+	if !ok {
+		lock = new(sync.Mutex)
+		rc.fetching[robots] = lock
+	}
+	rc.mu.Unlock()
+	lock.Lock()
+	defer lock.Unlock()
+	// Fetched while waiting for the lock
+	if rules := rc.cached(robots); rules != nil {
+		return rules, nil
+	}
+
+	res, err := fetcher.Fetch(robots)
+	var rules *RobotsRules
+	switch err.(type) {
+	case nil:
+		rules = ParseRobots(res.Body.Bytes())
+		releaseBody(res.Body)
+	case Http404Error:
+		rules = &RobotsRules{}
+	default:
+		return nil, err
+	}
+	rules.URL, rules.FetchedAt = robots, time.Now()
+	return rules, rc.store(rules)
+}
+
+// Returns the rules of the robots.txt of the host of the given URL, fetched once per host.
+// A robots.txt that cannot be fetched gives rules allowing everything.
+func (c *Crawler) robotsRulesOf(site string) *RobotsRules {
+	u, err := url.Parse(site)
+	if err != nil || len(u.Host) == 0 {
+		return nil
+	}
+	robots := u.Scheme + "://" + u.Host + "/robots.txt"
+	if rules, present := c.robots.Load(robots); present {
+		return rules.(*RobotsRules)
+	}
+	rules, err := c.robotsCache.Get(c.fetcherOrDefault(), robots)
+	if err != nil {
+		log.Printf("Failed to fetch (%s), allowing everything: %s\n", robots, err)
+		rules = &RobotsRules{URL: robots, FetchedAt: time.Now()}
+	}
+	actual, _ := c.robots.LoadOrStore(robots, rules)
+	return actual.(*RobotsRules)
+}
+
+// Returns true if robots.txt lets 'robotsAgent' fetch the given URL
+func (c *Crawler) robotsAllow(site string) bool {
+	rules := c.robotsRulesOf(site)
+	if rules == nil {
+		return true
+	}
+	u, _ := url.Parse(site)
+	return rules.Allowed(u.RequestURI(), c.robotsAgent)
+}
+
+// Returns the rules of the robots.txt of 'baseSite', nil until the crawl has started or
+// when robots.txt is ignored
+func (c *Crawler) Robots() *RobotsRules {
+	if !c.respectRobots {
+		return nil
+	}
+	if rules, present := c.robots.Load(c.scheme + "://" + c.domain + "/robots.txt"); present {
+		return rules.(*RobotsRules)
+	}
+	return nil
+}
+
+// Spaces the requests to 'baseSite' by the Crawl-delay of its robots.txt, unless a politeness
+// config was given which then decides alone
+func (c *Crawler) applyCrawlDelay(rules *RobotsRules) {
+	delay := rules.CrawlDelay(c.robotsAgent)
+	if delay <= 0 || c.politeness != nil {
+		return
+	}
+	u, err := url.Parse(c.baseSite)
+	if err != nil {
+		return
+	}
+	c.politeness = newPoliteness(&PolitenessConfig{
+		Profiles: map[string]*PolitenessProfile{"robots": {Delay: delay.String(), delay: delay}},
+		Hosts:    []HostProfile{{Host: u.Hostname(), Profile: "robots"}},
+	})
+}
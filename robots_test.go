@@ -0,0 +1,199 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	robots := []byte(`# Rules
+Disallow: /ignored
+User-agent: Googlebot
+User-agent: bingbot
+Disallow: /private   # not for search engines
+Allow: /private/public
+Crawl-delay: 1.5
+
+Sitemap: https://monzo.com/sitemap.xml
+User-agent: *
+Disallow:
+Disallow: /admin
+`)
+	want := &RobotsRules{Found: true, Sitemaps: []string{"https://monzo.com/sitemap.xml"}, Groups: []RobotsGroup{
+		{Agents: []string{"googlebot", "bingbot"}, Allow: []string{"/private/public"}, Disallow: []string{"/private"}, CrawlDelay: 1500 * time.Millisecond},
+		{Agents: []string{"*"}, Disallow: []string{"/admin"}},
+	}}
+	if got := ParseRobots(robots); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expecting (%+v), got (%+v)", want, got)
+	}
+}
+
+// Fetcher counting its fetches, serving the same robots.txt every time
+type countingFetcher struct {
+	fetches int64
+	robots  string
+}
+
+func (f *countingFetcher) Fetch(url string) (*FetchResult, error) {
+	atomic.AddInt64(&f.fetches, 1)
+	if len(f.robots) == 0 {
+		return nil, Http404Error(url)
+	}
+	return staticFetcher(f.robots).Fetch(url)
+}
+
+func TestRobotsCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-robots-")
+	if err != nil {
+		t.Fatalf("Failed to create cache directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := &countingFetcher{robots: "User-agent: *\nDisallow: /admin\n"}
+	for i := 0; i < 3; i++ {
+		rules, err := NewRobotsCache(dir, time.Hour).Get(f, "https://monzo.com/robots.txt")
+		if err != nil || len(rules.Groups) != 1 {
+			t.Fatalf("Expecting the rules of robots.txt, got (%+v, %v)", rules, err)
+		}
+	}
+	if f.fetches != 1 {
+		t.Errorf("Expecting robots.txt to be fetched once across caches sharing a directory, got (%d)", f.fetches)
+	}
+
+	expired := NewRobotsCache(dir, 0)
+	expired.Get(f, "https://monzo.com/robots.txt")
+	if f.fetches != 2 {
+		t.Errorf("Expecting robots.txt to be fetched again once expired, got (%d) fetches", f.fetches)
+	}
+
+	missing := &countingFetcher{}
+	cache := NewRobotsCache("", time.Hour)
+	for i := 0; i < 2; i++ {
+		if rules, err := cache.Get(missing, "https://example.com/robots.txt"); err != nil || rules.Found {
+			t.Errorf("Expecting a missing robots.txt to allow everything, got (%+v, %v)", rules, err)
+		}
+	}
+	if missing.fetches != 1 {
+		t.Errorf("Expecting a missing robots.txt to be cached, got (%d) fetches", missing.fetches)
+	}
+}
+
+func TestRobotsRules_Allowed(t *testing.T) {
+	rules := ParseRobots([]byte(`User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search?
+
+User-agent: go-web-crawler
+Disallow: /admin
+Crawl-delay: 2
+`))
+	tests := []struct {
+		path    string
+		agent   string
+		allowed bool
+	}{
+		{"/", "other", true},
+		{"/private", "other", false},
+		{"/private/team", "other", false},
+		{"/private/public/team", "other", true},
+		{"/report.pdf", "other", false},
+		{"/report.pdf?v=2", "other", true},
+		{"/search", "other", true},
+		{"/search?q=monzo", "other", false},
+		{"/robots.txt", "other", true},
+		// Only the group naming the agent applies to it
+		{"/private", "Go-Web-Crawler", true},
+		{"/admin/users", "go-web-crawler", false},
+	}
+	for _, test := range tests {
+		if got := rules.Allowed(test.path, test.agent); got != test.allowed {
+			t.Errorf("Expecting (%s) allowed for (%s) to be (%t), got (%t)", test.path, test.agent, test.allowed, got)
+		}
+	}
+	if d := rules.CrawlDelay(DEFAULT_ROBOTS_AGENT); d != 2*time.Second {
+		t.Errorf("Expecting a crawl-delay of (%s), got (%s)", 2*time.Second, d)
+	}
+	if d := rules.CrawlDelay("other"); d != 0 {
+		t.Errorf("Expecting no crawl-delay for other agents, got (%s)", d)
+	}
+	if !(&RobotsRules{}).Allowed("/private", "other") {
+		t.Errorf("Expecting a missing robots.txt to allow everything")
+	}
+}
+
+func TestRun_robots(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /private\nCrawl-delay: 0.05\n")
+		case "/":
+			fmt.Fprintf(w, `<a href="/about">About</a><a href="/private">Private</a>`)
+		default:
+			fmt.Fprintf(w, "<p>%s</p>", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	start := time.Now()
+	res, _ := c.Run(context.Background())
+	if len(res.Pages) != 2 {
+		t.Errorf("Expecting (/) and (/about) to be crawled, got (%d) pages", len(res.Pages))
+	}
+	if len(res.NotCrawled) != 1 || res.NotCrawled[0].Reason != SKIP_ROBOTS {
+		t.Errorf("Expecting (/private) to be skipped for (%s), got (%+v)", SKIP_ROBOTS, res.NotCrawled)
+	}
+	if rules := c.Robots(); rules == nil || !rules.Found || rules.URL != ts.URL+"/robots.txt" {
+		t.Errorf("Expecting the rules of (%s/robots.txt), got (%+v)", ts.URL, rules)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expecting the pages to be spaced by the crawl-delay, took (%s)", elapsed)
+	}
+
+	var ignoring Crawler
+	ignoring.Init(ts.URL)
+	ignoring.probeNotFound = false
+	ignoring.respectRobots = false
+	if res, _ := ignoring.Run(context.Background()); len(res.Pages) != 3 {
+		t.Errorf("Expecting all (3) pages to be crawled when robots.txt is ignored, got (%d)", len(res.Pages))
+	}
+	if ignoring.Robots() != nil {
+		t.Errorf("Expecting no rules when robots.txt is ignored")
+	}
+}
+
+// A seed robots.txt disallows is not fetched either
+func TestRun_robotsDisallowSeed(t *testing.T) {
+	var fetched int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /private\n")
+			return
+		}
+		atomic.AddInt64(&fetched, 1)
+		fmt.Fprintf(w, `<a href="/private/team">Team</a>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL + "/private")
+	res, err := c.Run(context.Background())
+	if err != nil || len(res.Pages) != 0 || fetched != 0 {
+		t.Errorf("Expecting nothing to be fetched, got (%d) pages, (%d) requests and (%v)", len(res.Pages), fetched, err)
+	}
+	if len(res.NotCrawled) != 1 || res.NotCrawled[0].URL != ts.URL+"/private" || res.NotCrawled[0].Reason != SKIP_ROBOTS {
+		t.Errorf("Expecting the seed to be skipped for (%s), got (%+v)", SKIP_ROBOTS, res.NotCrawled)
+	}
+}
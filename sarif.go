@@ -0,0 +1,99 @@
+package crawler
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// --------------------
+// SARIF
+// --------------------
+
+// Version of SARIF written, and its schema
+const SARIF_VERSION = "2.1.0"
+const SARIF_SCHEMA = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// Rules whose findings are errors in SARIF, the others are warnings
+var sarifErrorRules = map[string]bool{RULE_BROKEN_LINK: true, RULE_SERVER_ERROR: true}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+
+	// Identifies the finding across runs, there are no source lines to derive it from
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver struct {
+			Name           string      `json:"name"`
+			InformationURI string      `json:"informationUri"`
+			Rules          []sarifRule `json:"rules"`
+		} `json:"driver"`
+	} `json:"tool"`
+	AutomationDetails struct {
+		ID string `json:"id"`
+	} `json:"automationDetails"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// Write the findings of the crawl to w as a SARIF log, so that platforms ingesting SARIF
+// (e.g. GitHub code scanning) track them across crawls. Each finding is located at its URL.
+func (c *Crawler) WriteSARIF(w io.Writer) error {
+	var run sarifRun
+	run.Tool.Driver.Name = "go-web-crawler"
+	run.Tool.Driver.InformationURI = "https://github.com/skfarhat/go-web-crawler"
+	// Findings of crawls of different sites are tracked apart
+	run.AutomationDetails.ID = "crawl/" + c.canonicalHost() + "/"
+	index := make(map[string]int, len(FINDING_RULES))
+	for i, rule := range FINDING_RULES {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: rule.ID, ShortDescription: sarifMessage{rule.Description}})
+		index[rule.ID] = i
+	}
+
+	run.Results = []sarifResult{}
+	for _, f := range c.Findings() {
+		level := "warning"
+		if sarifErrorRules[f.Rule] {
+			level = "error"
+		}
+		var loc sarifLocation
+		loc.PhysicalLocation.ArtifactLocation.URI = f.URL
+		run.Results = append(run.Results, sarifResult{RuleID: f.Rule, RuleIndex: index[f.Rule], Level: level,
+			Message: sarifMessage{f.Message}, Locations: []sarifLocation{loc},
+			PartialFingerprints: map[string]string{"ruleURL/v1": fmt.Sprintf("%x", sha1.Sum([]byte(f.Rule+" "+f.URL)))}})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{Schema: SARIF_SCHEMA, Version: SARIF_VERSION, Runs: []sarifRun{run}})
+}
@@ -0,0 +1,44 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// Each finding is a result located at its URL, with a fingerprint stable across crawls
+func TestCrawler_WriteSARIF(t *testing.T) {
+	c, ts := crawlSiteWithFindings(t)
+	defer ts.Close()
+
+	var out bytes.Buffer
+	if err := c.WritePrintMode(&out, "sarif"); err != nil {
+		t.Fatalf("WriteSARIF failed: %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("Expecting valid JSON, got (%v) (%s)", err, out.String())
+	}
+	if log.Version != SARIF_VERSION || len(log.Runs) != 1 || len(log.Runs[0].Tool.Driver.Rules) != len(FINDING_RULES) {
+		t.Fatalf("Expecting a single run declaring every rule, got (%+v)", log)
+	}
+
+	results := log.Runs[0].Results
+	if len(results) != 2 {
+		t.Fatalf("Expecting 2 results, got (%+v)", results)
+	}
+	broken := results[0]
+	if broken.RuleID != RULE_BROKEN_LINK || broken.Level != "error" ||
+		broken.Locations[0].PhysicalLocation.ArtifactLocation.URI != ts.URL+"/old" {
+		t.Errorf("Expecting (%s/old) to be a broken link, got (%+v)", ts.URL, broken)
+	}
+	if log.Runs[0].Tool.Driver.Rules[broken.RuleIndex].ID != broken.RuleID {
+		t.Errorf("Expecting the rule index to point at (%s), got (%d)", broken.RuleID, broken.RuleIndex)
+	}
+
+	var again bytes.Buffer
+	c.WriteSARIF(&again)
+	if !bytes.Equal(out.Bytes(), again.Bytes()) {
+		t.Errorf("Expecting the same findings to give the same log")
+	}
+}
@@ -0,0 +1,213 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// --------------------
+// Scope
+// --------------------
+
+// Decides whether URLs are on a domain by comparing their parsed host and port with it,
+// so that dots and other characters in the domain have no special meaning.
+type ScopeMatcher struct {
+
+	// Host matched, lowercase and without trailing dot
+	host string
+
+	// Port matched, empty for the default port of the scheme of each URL
+	port string
+
+	// When true, subdomains of host are matched too (www.monzo.com for monzo.com)
+	subdomains bool
+
+	// When true, URLs on any port of host are matched
+	anyPort bool
+
+	// When true, www.<host> and <host> are matched as the same host, see stripWWW
+	aliasWWW bool
+}
+
+// Returns a ScopeMatcher of the given domain, and its subdomains if subdomains is set.
+// The domain may have a port (localhost:8080), only URLs on that port are matched then.
+func NewScopeMatcher(domain string, subdomains bool) *ScopeMatcher {
+	u := &url.URL{Host: domain}
+	return &ScopeMatcher{host: normalizeHost(u.Hostname()), port: u.Port(), subdomains: subdomains}
+}
+
+// Returns the given host name in lowercase without trailing dot (monzo.com. is monzo.com)
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// Returns host without its www. prefix (www.monzo.com is monzo.com)
+func stripWWW(host string) string {
+	return strings.TrimPrefix(host, "www.")
+}
+
+// Returns link on 'canonicalHost' and true if it is on the other of its www and apex variants,
+// otherwise returns link as is and false
+func (c *Crawler) canonicalLink(link string) (string, bool) {
+	if !c.aliasWWW {
+		return link, false
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return link, false
+	}
+	host := strings.ToLower(stripDefaultPort(u.Scheme, u.Host))
+	canonical := c.canonicalHost()
+	if host == canonical || stripWWW(host) != stripWWW(canonical) {
+		return link, false
+	}
+	u.Host = canonical
+	return u.String(), true
+}
+
+// Returns the host the site is served from, the host of 'baseSite' unless fetching it
+// redirected to its www or apex variant
+func (c *Crawler) canonicalHost() string {
+	if host, ok := c.redirectedHost.Load().(string); ok {
+		return host
+	}
+	return strings.ToLower(stripDefaultPort(c.scheme, c.domain))
+}
+
+// Returns the scheme and host links starting with '/' are relative to, e.g. https://monzo.com
+func (c *Crawler) origin() string {
+	return c.scheme + "://" + c.canonicalHost()
+}
+
+// Makes the host of final 'canonicalHost' if 'baseSite' redirected to it and it is its www or apex variant
+func (c *Crawler) followHostRedirect(final string) {
+	u, err := url.Parse(final)
+	if err != nil || !c.aliasWWW {
+		return
+	}
+	host, canonical := strings.ToLower(stripDefaultPort(u.Scheme, u.Host)), c.canonicalHost()
+	if host != canonical && stripWWW(host) == stripWWW(canonical) {
+		c.redirectedHost.Store(host)
+	}
+}
+
+// Treats the http:// and https:// variants of URLs as the same page if 'baseSite' redirected to
+// final on its other scheme, unless 'strictScheme' is set. Returns true if it did.
+func (c *Crawler) followSchemeRedirect(final string) bool {
+	u, err := url.Parse(final)
+	if err != nil || c.strictScheme || c.ignoreScheme.Load() || u.Scheme == c.scheme {
+		return false
+	}
+	c.ignoreScheme.Store(true)
+	return true
+}
+
+// Returns the port used by default for the given scheme, empty if unknown
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+// Returns host without its port if it is the default port of scheme (monzo.com:443 is monzo.com)
+func stripDefaultPort(scheme string, host string) string {
+	if port := defaultPort(scheme); len(port) > 0 {
+		return strings.TrimSuffix(host, ":"+port)
+	}
+	return host
+}
+
+// Returns true if u is an http(s) URL on the domain of m
+func (m *ScopeMatcher) Matches(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	host, want := normalizeHost(u.Hostname()), m.host
+	if m.aliasWWW {
+		host, want = stripWWW(host), stripWWW(want)
+	}
+	if host != want && !(m.subdomains && strings.HasSuffix(host, "."+want)) {
+		return false
+	}
+	if m.anyPort {
+		return true
+	}
+	port, wantPort := u.Port(), m.port
+	if len(port) == 0 {
+		port = defaultPort(u.Scheme)
+	}
+	if len(wantPort) == 0 {
+		wantPort = defaultPort(u.Scheme)
+	}
+	return port == wantPort
+}
+
+// What is done with links leaving 'pathPrefix', such as ../ links or links to parent paths
+const (
+	ESCAPE_SKIP     = "skip"     // Not crawled, listed as not crawled with SKIP_PREFIX
+	ESCAPE_FOLLOW   = "follow"   // Crawled when linked from under the prefix, their own links leaving it are not
+	ESCAPE_EXTERNAL = "external" // Not crawled, reported with the external links of the page
+	ESCAPE_DROP     = "drop"     // Not crawled nor reported
+)
+
+// Returns the URL of the site to crawl given on the command line, https:// being assumed when
+// there is no scheme (monzo.com is https://monzo.com). Returns an error if it cannot be crawled.
+func ParseSeed(site string) (string, error) {
+	site = strings.TrimSpace(site)
+	if len(site) == 0 {
+		return "", fmt.Errorf("No URL to crawl, expecting e.g. https://monzo.com")
+	}
+	if !strings.Contains(site, "://") {
+		site = "https://" + site
+	}
+	u, err := url.Parse(site)
+	if err != nil {
+		return "", fmt.Errorf("Invalid URL (%s): %s", site, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("Invalid URL (%s), only http:// and https:// sites can be crawled", site)
+	}
+	if len(u.Hostname()) == 0 {
+		return "", fmt.Errorf("Invalid URL (%s), expecting a host", site)
+	}
+	return site, nil
+}
+
+// Returns the path prefix of the URLs under site: its path up to the last '/', or its whole
+// path as a directory when the last segment has no extension (/docs is /docs/, /docs/a.html is /docs/)
+func seedPathPrefix(site string) string {
+	u, err := url.Parse(site)
+	if err != nil || len(u.Path) == 0 {
+		return "/"
+	}
+	p := u.Path
+	if last := p[strings.LastIndex(p, "/")+1:]; strings.Contains(last, ".") {
+		return p[:len(p)-len(last)]
+	}
+	if !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	return p
+}
+
+// Returns true if the path of site starts with 'pathPrefix', or is the prefix without trailing slash.
+// Always true when there is no prefix.
+func (c *Crawler) isUnderPrefix(site string) bool {
+	if len(c.pathPrefix) <= 1 {
+		return true
+	}
+	u, err := url.Parse(site)
+	if err != nil {
+		return false
+	}
+	p, prefix := u.Path, c.pathPrefix
+	if c.ignoreCase {
+		p, prefix = strings.ToLower(p), strings.ToLower(prefix)
+	}
+	return strings.HasPrefix(p, prefix) || p == strings.TrimSuffix(prefix, "/")
+}
@@ -0,0 +1,258 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestScopeMatcher(t *testing.T) {
+	tests := []struct {
+		url        string
+		subdomains bool
+		want       bool
+	}{
+		{"https://monzo.com/about", false, true},
+		{"http://MONZO.com./about", false, true},
+		{"https://www.monzo.com", false, false},
+		{"https://www.monzo.com", true, true},
+		{"https://monzoXcom", true, false},
+		{"https://notmonzo.com", true, false},
+		{"https://monzo.com.evil.com", true, false},
+		{"https://monzo.com@evil.com/", true, false},
+		{"https://monzo.com:8080/", true, false},
+		{"https://monzo.com:443/", true, true},
+		{"http://monzo.com:80/", true, true},
+		{"http://monzo.com:443/", true, false},
+		{"ftp://monzo.com/", true, false},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		if got := NewScopeMatcher("monzo.com", test.subdomains).Matches(u); got != test.want {
+			t.Errorf("Expecting (%v) for (%s), subdomains (%v), got (%v)", test.want, test.url, test.subdomains, got)
+		}
+	}
+}
+
+func TestScopeMatcher_ports(t *testing.T) {
+	tests := []struct {
+		url     string
+		anyPort bool
+		want    bool
+	}{
+		{"http://localhost:8080/a", false, true},
+		{"https://LOCALHOST:8080/a", false, true},
+		{"http://localhost/a", false, false},
+		{"http://localhost:9090/a", false, false},
+		{"http://localhost:9090/a", true, true},
+		{"http://localhost/a", true, true},
+		{"http://127.0.0.1:8080/a", true, false},
+	}
+	for _, test := range tests {
+		m := NewScopeMatcher("localhost:8080", false)
+		m.anyPort = test.anyPort
+		u, _ := url.Parse(test.url)
+		if got := m.Matches(u); got != test.want {
+			t.Errorf("Expecting (%v) for (%s), any port (%v), got (%v)", test.want, test.url, test.anyPort, got)
+		}
+	}
+}
+
+func TestCrawler_visitKeyIgnoresDefaultPorts(t *testing.T) {
+	var c Crawler
+	c.Init("https://monzo.com")
+	if a, b := c.visitKey("https://monzo.com:443/about"), c.visitKey("https://monzo.com/about"); a != b {
+		t.Errorf("Expecting the default port not to change the page, got (%s) and (%s)", a, b)
+	}
+	if a, b := c.visitKey("https://monzo.com:8443/about"), c.visitKey("https://monzo.com/about"); a == b {
+		t.Errorf("Expecting other ports to be other pages, got (%s) for both", a)
+	}
+}
+
+func TestLinkMatcher_doesNotTreatDomainAsPattern(t *testing.T) {
+	html := []byte(`<a href="https://monzo.com/a"></a><a href="https://monzoXcom/b"></a><a href="https://blog.monzo.com/c"></a>`)
+	domain := "monzo.com"
+	want := []string{"https://monzo.com/a", "https://blog.monzo.com/c"}
+	if res := testArraysMatch(t, want, urlStrings(FindAbsoluteLinks(html, &domain))); res != 0 {
+		t.Errorf("Expecting only links to (monzo.com) and its subdomains")
+	}
+}
+
+func TestParseSeed(t *testing.T) {
+	valid := map[string]string{
+		"https://monzo.com":      "https://monzo.com",
+		"http://localhost:8080/": "http://localhost:8080/",
+		" monzo.com/docs ":       "https://monzo.com/docs",
+		"https://monzo.com/?a=b": "https://monzo.com/?a=b",
+	}
+	for site, want := range valid {
+		if got, err := ParseSeed(site); err != nil || got != want {
+			t.Errorf("Expecting (%s) for (%s), got (%s, %v)", want, site, got, err)
+		}
+	}
+	for _, site := range []string{"", "ftp://monzo.com", "https://", "https://monzo .com"} {
+		if got, err := ParseSeed(site); err == nil {
+			t.Errorf("Expecting an error for (%s), got (%s)", site, got)
+		}
+	}
+}
+
+func TestSeedPathPrefix(t *testing.T) {
+	tests := map[string]string{
+		"https://monzo.com":                  "/",
+		"https://monzo.com/":                 "/",
+		"https://monzo.com/docs":             "/docs/",
+		"https://monzo.com/docs/":            "/docs/",
+		"https://monzo.com/docs/index.html":  "/docs/",
+		"https://monzo.com/docs/api?v=2#top": "/docs/api/",
+	}
+	for site, want := range tests {
+		if got := seedPathPrefix(site); got != want {
+			t.Errorf("Expecting (%s) for (%s), got (%s)", want, site, got)
+		}
+	}
+}
+
+// Links outside the path of the first site are not followed with a prefix
+func TestRun_stayUnder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<html><a href="/docs/api">API</a><a href="/docs">Docs</a><a href="/docsearch">Search</a><a href="/blog">Blog</a></html>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL + "/docs/")
+	c.probeNotFound = false
+	c.pathPrefix = seedPathPrefix(c.baseSite)
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	crawled := make(map[string]bool)
+	for _, page := range res.Pages {
+		crawled[page.URL] = true
+	}
+	if !crawled[ts.URL+"/docs/"] || !crawled[ts.URL+"/docs/api"] || len(crawled) != 2 {
+		t.Errorf("Expecting only the pages under (/docs/) to be crawled, got (%v)", crawled)
+	}
+	for _, page := range res.NotCrawled {
+		if (page.URL == ts.URL+"/blog" || page.URL == ts.URL+"/docsearch") && page.Reason != SKIP_PREFIX {
+			t.Errorf("Expecting (%s) to be skipped for (%s), got (%s)", page.URL, SKIP_PREFIX, page.Reason)
+		}
+	}
+}
+
+// Links leaving the prefix, ../ links included, are skipped, followed once, reported as external or dropped
+func TestRun_parentLinks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/docs/":
+			io.WriteString(w, `<html><a href="./api">API</a><a href="../blog">Blog</a></html>`)
+		case "/blog":
+			io.WriteString(w, `<html><a href="/about">About</a></html>`)
+		default:
+			io.WriteString(w, `<html></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	for _, mode := range []string{ESCAPE_SKIP, ESCAPE_FOLLOW, ESCAPE_EXTERNAL, ESCAPE_DROP} {
+		var c Crawler
+		c.Init(ts.URL + "/docs/")
+		c.probeNotFound = false
+		c.pathPrefix, c.prefixEscape = "/docs/", mode
+		res, err := c.Run(context.Background())
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		crawled, skipped, external := make(map[string]bool), make(map[string]string), make(map[string]bool)
+		for _, page := range res.Pages {
+			crawled[page.URL] = true
+			for _, x := range page.ExternalLinks {
+				external[x] = true
+			}
+		}
+		for _, page := range res.NotCrawled {
+			skipped[page.URL] = page.Reason
+		}
+		if !crawled[ts.URL+"/docs/api"] {
+			t.Errorf("%s: expecting (./api) to be crawled, got (%v)", mode, crawled)
+		}
+
+		blog := ts.URL + "/blog"
+		switch mode {
+		case ESCAPE_SKIP:
+			if crawled[blog] || skipped[blog] != SKIP_PREFIX {
+				t.Errorf("%s: expecting (%s) to be skipped, got (%v, %v)", mode, blog, crawled, skipped)
+			}
+		case ESCAPE_FOLLOW:
+			if !crawled[blog] || crawled[ts.URL+"/about"] {
+				t.Errorf("%s: expecting (%s) to be crawled but not its links, got (%v)", mode, blog, crawled)
+			}
+		case ESCAPE_EXTERNAL:
+			if crawled[blog] || !external[blog] || len(skipped[blog]) > 0 {
+				t.Errorf("%s: expecting (%s) to be reported as external, got (%v, %v)", mode, blog, external, skipped)
+			}
+		case ESCAPE_DROP:
+			if crawled[blog] || external[blog] || len(skipped[blog]) > 0 {
+				t.Errorf("%s: expecting (%s) to be dropped, got (%v, %v, %v)", mode, blog, crawled, external, skipped)
+			}
+		}
+	}
+}
+
+// Fetcher of a site whose apex redirects to www, recording the URLs fetched
+type wwwFetcher struct {
+	mu      sync.Mutex
+	fetched []string
+}
+
+func (f *wwwFetcher) Fetch(url string) (*FetchResult, error) {
+	f.mu.Lock()
+	f.fetched = append(f.fetched, url)
+	f.mu.Unlock()
+	body := acquireBody()
+	if url == "https://monzo.com" {
+		body.WriteString(`<a href="/about">About</a><a href="https://monzo.com/team">Team</a>`)
+		return &FetchResult{Body: body, FinalURL: "https://www.monzo.com/"}, nil
+	}
+	return &FetchResult{Body: body}, nil
+}
+
+// Links to the apex of a site redirecting to www are followed to www and reported
+func TestRun_wwwAlias(t *testing.T) {
+	f := new(wwwFetcher)
+	var c Crawler
+	c.Init("https://monzo.com")
+	c.probeNotFound = false
+	c.respectRobots = false
+	c.fetcher = f
+	if _, err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	sort.Strings(f.fetched)
+	want := []string{"https://monzo.com", "https://www.monzo.com/about", "https://www.monzo.com/team"}
+	if !reflect.DeepEqual(f.fetched, want) {
+		t.Errorf("Expecting (%v) to be fetched, got (%v)", want, f.fetched)
+	}
+	links, _ := c.nonCanonicalLinks.Load("https://monzo.com")
+	if got, _ := links.([]string); len(got) != 1 || got[0] != "https://monzo.com/team" {
+		t.Errorf("Expecting the link to the apex to be reported, got (%v)", got)
+	}
+	if !c.isLocal("https://monzo.com/x") || c.visitKey("https://www.monzo.com/x") != c.visitKey("https://monzo.com/x") {
+		t.Errorf("Expecting www and apex to be the same site")
+	}
+
+	c.aliasWWW = false
+	if c.visitKey("https://www.monzo.com/x") == c.visitKey("https://monzo.com/x") {
+		t.Errorf("Expecting www and apex to be different sites without aliasing")
+	}
+}
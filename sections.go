@@ -0,0 +1,81 @@
+package crawler
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --------------------
+// Site sections
+// --------------------
+
+// Pages of a section of the site, those sharing the first segment of their path
+type SectionStats struct {
+
+	// First segment of the path, e.g. /blog, or / for the home page
+	Section string `json:"section"`
+
+	Pages  int `json:"pages"`
+	Errors int `json:"errors"`
+
+	// Average time taken by HTTP.GET for the pages crawled
+	AverageLatencyMs float64 `json:"average_latency_ms"`
+}
+
+// Returns the fraction of the section's pages that could not be crawled
+func (s SectionStats) ErrorRate() float64 {
+	if s.Pages+s.Errors == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Pages+s.Errors)
+}
+
+// Returns the section of the given URL, e.g. /blog for https://monzo.com/blog/2019/post
+func pathSection(site string) string {
+	u, err := url.Parse(site)
+	if err != nil {
+		return "/"
+	}
+	segment := strings.SplitN(strings.Trim(u.Path, "/"), "/", 2)[0]
+	return "/" + segment
+}
+
+// Returns the sections of the pages crawled and failed, largest first
+func (res *CrawlResult) Sections() []SectionStats {
+	bySection := make(map[string]*SectionStats)
+	latencies := make(map[string]time.Duration)
+	section := func(site string) *SectionStats {
+		name := pathSection(site)
+		s, ok := bySection[name]
+		if !ok {
+			s = &SectionStats{Section: name}
+			bySection[name] = s
+		}
+		return s
+	}
+	for _, page := range res.Pages {
+		s := section(page.URL)
+		s.Pages++
+		latencies[s.Section] += page.Stat.getTime
+	}
+	for site := range res.Errors {
+		section(site).Errors++
+	}
+
+	sections := make([]SectionStats, 0, len(bySection))
+	for name, s := range bySection {
+		if s.Pages > 0 {
+			s.AverageLatencyMs = float64(latencies[name]) / float64(s.Pages) / float64(time.Millisecond)
+		}
+		sections = append(sections, *s)
+	}
+	sort.Slice(sections, func(i, j int) bool {
+		if a, b := sections[i].Pages+sections[i].Errors, sections[j].Pages+sections[j].Errors; a != b {
+			return a > b
+		}
+		return sections[i].Section < sections[j].Section
+	})
+	return sections
+}
@@ -0,0 +1,49 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPathSection(t *testing.T) {
+	tests := map[string]string{
+		"https://monzo.com":              "/",
+		"https://monzo.com/":             "/",
+		"https://monzo.com/blog":         "/blog",
+		"https://monzo.com/blog/":        "/blog",
+		"https://monzo.com/blog/2019/hi": "/blog",
+		"https://monzo.com/legal?x=1":    "/legal",
+	}
+	for site, want := range tests {
+		if got := pathSection(site); got != want {
+			t.Errorf("Expecting (%s) for (%s), got (%s)", want, site, got)
+		}
+	}
+}
+
+func TestCrawlResult_Sections(t *testing.T) {
+	res := &CrawlResult{
+		Pages: []CrawlPage{
+			{URL: "https://monzo.com", Stat: CrawlStat{getTime: 10 * time.Millisecond}},
+			{URL: "https://monzo.com/blog/a", Stat: CrawlStat{getTime: 10 * time.Millisecond}},
+			{URL: "https://monzo.com/blog/b", Stat: CrawlStat{getTime: 30 * time.Millisecond}},
+		},
+		Errors: map[string]error{"https://monzo.com/blog/c": Http404Error("https://monzo.com/blog/c")},
+	}
+	want := []SectionStats{
+		{Section: "/blog", Pages: 2, Errors: 1, AverageLatencyMs: 20},
+		{Section: "/", Pages: 1, AverageLatencyMs: 10},
+	}
+	got := res.Sections()
+	if len(got) != len(want) {
+		t.Fatalf("Expecting (%+v), got (%+v)", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expecting (%+v), got (%+v)", want[i], got[i])
+		}
+	}
+	if rate := got[0].ErrorRate(); rate < 0.33 || rate > 0.34 {
+		t.Errorf("Expecting an error rate of 1/3 for /blog, got (%f)", rate)
+	}
+}
@@ -0,0 +1,484 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------
+// Server mode
+// --------------------
+
+// States of a crawl job
+const (
+	JOB_QUEUED    = "queued"
+	JOB_RUNNING   = "running"
+	JOB_DONE      = "done"
+	JOB_FAILED    = "failed"
+	JOB_CANCELLED = "cancelled"
+)
+
+// Crawl submitted to a JobQueue
+type Job struct {
+	ID        string     `json:"id"`
+	URL       string     `json:"url"`
+	State     string     `json:"state"`
+	Error     string     `json:"error,omitempty"`
+	Pages     int        `json:"pages"`
+	Errors    int        `json:"errors"`
+	Reason    string     `json:"reason,omitempty"`
+	Owner     string     `json:"owner,omitempty"`
+	Submitted time.Time  `json:"submitted"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+
+	// Limits of the crawl
+	quota Quota
+
+	// Crawler of the job once started, and what cancels it
+	crawler *Crawler
+	cancel  context.CancelFunc
+}
+
+// Returns true once the job will not change anymore
+func (j *Job) finished() bool {
+	return j.State == JOB_DONE || j.State == JOB_FAILED || j.State == JOB_CANCELLED
+}
+
+// Queue of crawl jobs running at most a given number of them at a time.
+// Finished jobs are forgotten once older than the retention period.
+type JobQueue struct {
+	mu      sync.Mutex
+	ready   *sync.Cond
+	jobs    map[string]*Job
+	order   []string
+	pending []*Job
+	nextID  int
+
+	// Time finished jobs are kept for, forever when zero
+	retention time.Duration
+
+	// Limits of every job, jobs can ask for lower ones but not higher
+	Quota Quota
+
+	// Options the Crawler of each job is created with, see New
+	Options []Option
+
+	// Where what happens to jobs is recorded, when not nil
+	Audit *AuditLog
+
+	// Checks the domain of each job is owned by who submits it, when not nil
+	Verifier *DomainVerifier
+
+	// Where the robots.txt of every job are fetched through
+	robots *RobotsCache
+}
+
+// Returns a JobQueue running at most maxRunning jobs at a time
+func NewJobQueue(maxRunning int, retention time.Duration) *JobQueue {
+	q := &JobQueue{jobs: make(map[string]*Job), retention: retention, robots: NewRobotsCache("", DEFAULT_ROBOTS_TTL)}
+	q.ready = sync.NewCond(&q.mu)
+	for i := 0; i < maxRunning; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// Runs queued jobs one after the other, forever
+func (q *JobQueue) work() {
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 {
+			q.ready.Wait()
+		}
+		job := q.pending[0]
+		q.pending = q.pending[1:]
+		if job.State != JOB_QUEUED {
+			// Cancelled while queued
+			q.mu.Unlock()
+			continue
+		}
+		c, err := New(job.URL, q.Options...)
+		if err != nil {
+			now := time.Now()
+			job.State, job.Error, job.Finished = JOB_FAILED, err.Error(), &now
+			q.record(AUDIT_FINISH, job.Owner, job)
+			q.mu.Unlock()
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		c.quota, c.robotsCache = job.quota, q.robots
+		// Only the domain verified may be fetched
+		c.localOnly = q.Verifier != nil
+		now := time.Now()
+		job.State, job.Started, job.crawler, job.cancel = JOB_RUNNING, &now, c, cancel
+		q.record(AUDIT_START, job.Owner, job)
+		q.mu.Unlock()
+
+		res, err := c.Run(ctx)
+		cancel()
+
+		q.mu.Lock()
+		finished := time.Now()
+		job.Finished = &finished
+		if res != nil {
+			job.Pages, job.Errors = len(res.Pages), len(res.Errors)
+		}
+		_, quota := err.(QuotaExceeded)
+		switch {
+		case err == context.Canceled:
+			job.State = JOB_CANCELLED
+		case quota:
+			job.State, job.Reason = JOB_DONE, err.Error()
+		case err != nil:
+			job.State, job.Error = JOB_FAILED, err.Error()
+		default:
+			job.State = JOB_DONE
+		}
+		q.record(AUDIT_FINISH, job.Owner, job)
+		q.mu.Unlock()
+	}
+}
+
+// Records the given action on job in the audit log, if any. Must be called with q.mu held.
+func (q *JobQueue) record(action string, key string, job *Job) {
+	if q.Audit == nil {
+		return
+	}
+	if err := q.Audit.Record(newAuditEvent(action, key, job)); err != nil {
+		log.Printf("Failed to record (%s) of job (%s) in the audit log: %s\n", action, job.ID, err)
+	}
+}
+
+// Forgets the finished jobs older than the retention period. Must be called with q.mu held.
+func (q *JobQueue) prune() {
+	if q.retention <= 0 {
+		return
+	}
+	kept := q.order[:0]
+	for _, id := range q.order {
+		job := q.jobs[id]
+		if job.finished() && time.Since(*job.Finished) > q.retention {
+			delete(q.jobs, id)
+		} else {
+			kept = append(kept, id)
+		}
+	}
+	q.order = kept
+}
+
+// Returns the lowest of the limits a and b, zero being unlimited
+func minLimit(a int64, b int64) int64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// Returns the quota asked for, lowered to the limits of the queue
+func (q *JobQueue) jobQuota(asked Quota) Quota {
+	return Quota{
+		Pages:    int(minLimit(int64(asked.Pages), int64(q.Quota.Pages))),
+		Bytes:    minLimit(asked.Bytes, q.Quota.Bytes),
+		Duration: time.Duration(minLimit(int64(asked.Duration), int64(q.Quota.Duration))),
+		Memory:   uint64(minLimit(int64(asked.Memory), int64(q.Quota.Memory))),
+	}
+}
+
+// Queues a crawl of the given site within the given quota, returns the job
+func (q *JobQueue) Submit(site string, quota Quota) (Job, error) {
+	return q.SubmitAs("", site, quota)
+}
+
+// Same as Submit, on behalf of the owner of the given API key
+func (q *JobQueue) SubmitAs(owner string, site string, quota Quota) (Job, error) {
+	if err := validateSite(site); err != nil {
+		return Job{}, err
+	}
+	if q.Verifier != nil {
+		if err := q.Verifier.Verify(owner, site); err != nil {
+			return Job{}, err
+		}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.prune()
+	q.nextID++
+	job := &Job{ID: strconv.Itoa(q.nextID), URL: site, State: JOB_QUEUED, Submitted: time.Now(),
+		Owner: owner, quota: q.jobQuota(quota)}
+	q.jobs[job.ID] = job
+	q.order = append(q.order, job.ID)
+	q.pending = append(q.pending, job)
+	q.record(AUDIT_SUBMIT, owner, job)
+	q.ready.Signal()
+	return *job, nil
+}
+
+// Returns the job with the given ID
+func (q *JobQueue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Same as Get, on behalf of the owner of the given API key. Jobs of other owners are not found.
+func (q *JobQueue) GetAs(owner string, id string) (Job, bool) {
+	job, ok := q.Get(id)
+	if !ok || job.Owner != owner {
+		return Job{}, false
+	}
+	return job, true
+}
+
+// Returns all jobs, in the order they were submitted
+func (q *JobQueue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.prune()
+	jobs := make([]Job, 0, len(q.order))
+	for _, id := range q.order {
+		jobs = append(jobs, *q.jobs[id])
+	}
+	return jobs
+}
+
+// Same as List, on behalf of the owner of the given API key. Only the jobs it submitted are listed.
+func (q *JobQueue) ListAs(owner string) []Job {
+	jobs := make([]Job, 0)
+	for _, job := range q.List() {
+		if job.Owner == owner {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// Cancels the job with the given ID, returns false if there is no such job
+func (q *JobQueue) Cancel(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return false
+	}
+	q.cancel("", job)
+	return true
+}
+
+// Same as Cancel, on behalf of the owner of the given API key. Jobs of other owners are not found.
+func (q *JobQueue) CancelAs(owner string, id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok || job.Owner != owner {
+		return false
+	}
+	q.cancel(owner, job)
+	return true
+}
+
+// Cancels job on behalf of the owner of the given API key. Must be called with q.mu held.
+func (q *JobQueue) cancel(owner string, job *Job) {
+	if !job.finished() {
+		q.record(AUDIT_CANCEL, owner, job)
+	}
+	switch job.State {
+	case JOB_QUEUED:
+		now := time.Now()
+		job.State, job.Finished = JOB_CANCELLED, &now
+		q.record(AUDIT_FINISH, job.Owner, job)
+	case JOB_RUNNING:
+		job.cancel()
+	}
+}
+
+// Returns the crawler of the job with the given ID submitted by owner, nil until the job has started
+func (q *JobQueue) crawler(owner string, id string) *Crawler {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job, ok := q.jobs[id]; ok && job.Owner == owner {
+		return job.crawler
+	}
+	return nil
+}
+
+// Returns an error if the given site cannot be crawled
+func validateSite(site string) error {
+	var c Crawler
+	return c.Init(site)
+}
+
+// Writes v as the JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Writes an error as the JSON response
+func writeJSONError(w http.ResponseWriter, status int, err string) {
+	writeJSON(w, status, map[string]string{"error": err})
+}
+
+// HTTP API of the queue:
+//
+//	POST   /jobs             {"url": "https://monzo.com"} queues a crawl, limits can be lowered with
+//	                         max_pages, max_bytes, max_duration ("10m") and max_memory_mb
+//	GET    /jobs             lists jobs
+//	GET    /jobs/ID          returns a job
+//	DELETE /jobs/ID          cancels a job
+//	GET    /jobs/ID/pages    returns pages crawled, see QueryPages (cursor, limit, status, prefix,
+//	                         min_depth, max_depth)
+//	GET    /audit            returns the audit log, see serveAudit
+//	GET    /verify?domain=D  returns how to prove ownership of D, see DomainVerifier
+//
+// Callers authenticated with an API key only see and cancel the jobs submitted with it.
+func (q *JobQueue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/audit" && r.Method == http.MethodGet {
+		q.serveAudit(w, r)
+		return
+	}
+	if r.URL.Path == "/verify" && r.Method == http.MethodGet {
+		q.serveVerify(w, r)
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs"), "/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case len(path) == 0 && r.Method == http.MethodPost:
+		var req struct {
+			URL         string `json:"url"`
+			MaxPages    int    `json:"max_pages"`
+			MaxBytes    int64  `json:"max_bytes"`
+			MaxDuration string `json:"max_duration"`
+			MaxMemoryMB uint64 `json:"max_memory_mb"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Malformed request: %s", err))
+			return
+		}
+		quota := Quota{Pages: req.MaxPages, Bytes: req.MaxBytes, Memory: req.MaxMemoryMB << 20}
+		if len(req.MaxDuration) > 0 {
+			d, err := time.ParseDuration(req.MaxDuration)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Malformed max_duration: %s", err))
+				return
+			}
+			quota.Duration = d
+		}
+		job, err := q.SubmitAs(requestKeyName(r), req.URL, quota)
+		if _, ok := err.(DomainNotVerified); ok {
+			writeJSONError(w, http.StatusForbidden, err.Error())
+			return
+		} else if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusAccepted, job)
+
+	case len(path) == 0 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, q.ListAs(requestKeyName(r)))
+
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		job, ok := q.GetAs(requestKeyName(r), parts[0])
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "No such job")
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if !q.CancelAs(requestKeyName(r), parts[0]) {
+			writeJSONError(w, http.StatusNotFound, "No such job")
+			return
+		}
+		job, _ := q.GetAs(requestKeyName(r), parts[0])
+		writeJSON(w, http.StatusOK, job)
+
+	case len(parts) == 2 && parts[1] == "pages" && r.Method == http.MethodGet:
+		c := q.crawler(requestKeyName(r), parts[0])
+		if c == nil {
+			writeJSONError(w, http.StatusNotFound, "No such job, or not started yet")
+			return
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		minDepth, _ := strconv.Atoi(r.URL.Query().Get("min_depth"))
+		maxDepth, _ := strconv.Atoi(r.URL.Query().Get("max_depth"))
+		pages, next := c.QueryPages(PageQuery{Cursor: r.URL.Query().Get("cursor"), Limit: limit,
+			Status: r.URL.Query().Get("status"), Prefix: r.URL.Query().Get("prefix"), MinDepth: minDepth, MaxDepth: maxDepth})
+		var resp struct {
+			Pages []streamedPage `json:"pages"`
+			Next  string         `json:"next,omitempty"`
+		}
+		resp.Pages, resp.Next = make([]streamedPage, 0, len(pages)), next
+		for _, page := range pages {
+			resp.Pages = append(resp.Pages, toStreamedPage(page, page.Err))
+		}
+		writeJSON(w, http.StatusOK, resp)
+
+	default:
+		writeJSONError(w, http.StatusNotFound, "No such endpoint")
+	}
+}
+
+// Serves the events of the audit log recorded for the API key of the request as a JSON array,
+// from the time given as ?since=2006-01-02T15:04:05Z if any
+func (q *JobQueue) serveAudit(w http.ResponseWriter, r *http.Request) {
+	if q.Audit == nil {
+		writeJSONError(w, http.StatusNotFound, "No audit log kept, see -audit")
+		return
+	}
+	var since time.Time
+	if s := r.URL.Query().Get("since"); len(s) > 0 {
+		var err error
+		if since, err = time.Parse(time.RFC3339, s); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Malformed since: %s", err))
+			return
+		}
+	}
+	events, err := q.Audit.Events(since)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// Other keys' submissions are none of the caller's business
+	key, own := requestKeyName(r), make([]AuditEvent, 0, len(events))
+	for _, e := range events {
+		if e.Key == key {
+			own = append(own, e)
+		}
+	}
+	writeJSON(w, http.StatusOK, own)
+}
+
+// Serves the token proving ownership of ?domain= by the API key of the request and where to put it
+func (q *JobQueue) serveVerify(w http.ResponseWriter, r *http.Request) {
+	if q.Verifier == nil {
+		writeJSONError(w, http.StatusNotFound, "Domains are not verified, see -verify")
+		return
+	}
+	domain := strings.ToLower(r.URL.Query().Get("domain"))
+	if len(domain) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "Missing domain")
+		return
+	}
+	token := q.Verifier.Token(requestKeyName(r), domain)
+	writeJSON(w, http.StatusOK, map[string]string{
+		"domain": domain,
+		"token":  token,
+		"txt":    fmt.Sprintf("_crawler-verification.%s TXT \"%s%s\"", domain, VERIFICATION_TXT_PREFIX, token),
+		"file":   fmt.Sprintf("https://%s%s", domain, VERIFICATION_FILE),
+	})
+}
@@ -0,0 +1,249 @@
+package crawler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Polls the queue until the job with the given ID is finished, fails the test after a few seconds
+func waitForJob(t *testing.T, q *JobQueue, id string) Job {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if job, _ := q.Get(id); job.finished() {
+			return job
+		}
+	}
+	t.Fatalf("Job (%s) did not finish in time", id)
+	return Job{}
+}
+
+// Test that at most the given number of jobs run at a time, the others waiting in the queue
+func TestJobQueue_limitsRunningJobs(t *testing.T) {
+	site := &SyntheticSite{Depth: 1, Branching: 2, Latency: 50 * time.Millisecond}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	q := NewJobQueue(1, 0)
+	first, _ := q.Submit(ts.URL, Quota{})
+	second, _ := q.Submit(ts.URL, Quota{})
+	time.Sleep(20 * time.Millisecond)
+	if job, _ := q.Get(second.ID); job.State != JOB_QUEUED {
+		t.Errorf("Expecting the second job to be queued while the first runs, got (%s)", job.State)
+	}
+
+	for _, id := range []string{first.ID, second.ID} {
+		if job := waitForJob(t, q, id); job.State != JOB_DONE || job.Pages != site.Pages() {
+			t.Errorf("Expecting job (%s) done with (%d) pages, got (%+v)", id, site.Pages(), job)
+		}
+	}
+	if _, err := q.Submit("not a url", Quota{}); err == nil {
+		t.Errorf("Expecting an error submitting an invalid URL")
+	}
+}
+
+// Test that queued and running jobs can be cancelled
+func TestJobQueue_cancel(t *testing.T) {
+	site := &SyntheticSite{Depth: 3, Branching: 5, Latency: 50 * time.Millisecond}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	q := NewJobQueue(1, 0)
+	running, _ := q.Submit(ts.URL, Quota{})
+	queued, _ := q.Submit(ts.URL, Quota{})
+	time.Sleep(20 * time.Millisecond)
+
+	q.Cancel(queued.ID)
+	q.Cancel(running.ID)
+	for _, id := range []string{running.ID, queued.ID} {
+		if job := waitForJob(t, q, id); job.State != JOB_CANCELLED {
+			t.Errorf("Expecting job (%s) to be cancelled, got (%s)", id, job.State)
+		}
+	}
+	if q.Cancel("404") {
+		t.Errorf("Expecting cancelling an unknown job to fail")
+	}
+}
+
+// Test that finished jobs are forgotten after the retention period
+func TestJobQueue_retention(t *testing.T) {
+	ts := httptest.NewServer(&SyntheticSite{Depth: 0, Branching: 1})
+	defer ts.Close()
+
+	q := NewJobQueue(1, 50*time.Millisecond)
+	job, _ := q.Submit(ts.URL, Quota{})
+	waitForJob(t, q, job.ID)
+	if len(q.List()) != 1 {
+		t.Errorf("Expecting the job to be kept right after finishing")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if len(q.List()) != 0 {
+		t.Errorf("Expecting the job to be forgotten after the retention period")
+	}
+}
+
+// Test the HTTP API from submission to fetching the pages crawled
+func TestJobQueue_api(t *testing.T) {
+	site := &SyntheticSite{Depth: 1, Branching: 3}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+	api := httptest.NewServer(NewJobQueue(1, 0))
+	defer api.Close()
+
+	resp, err := http.Post(api.URL+"/jobs", "application/json", strings.NewReader(`{"url": "`+ts.URL+`"}`))
+	if err != nil || resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Failed to submit job: %v %v", err, resp)
+	}
+	var job Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+
+	for start := time.Now(); !job.finished() && time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		resp, err := http.Get(api.URL + "/jobs/" + job.ID)
+		if err != nil {
+			t.Fatalf("Failed to get job: %s", err)
+		}
+		json.NewDecoder(resp.Body).Decode(&job)
+		resp.Body.Close()
+	}
+	if job.State != JOB_DONE {
+		t.Fatalf("Expecting the job to be done, got (%+v)", job)
+	}
+
+	resp, err = http.Get(api.URL + "/jobs/" + job.ID + "/pages?limit=2")
+	if err != nil {
+		t.Fatalf("Failed to get pages: %s", err)
+	}
+	defer resp.Body.Close()
+	var pages struct {
+		Pages []streamedPage `json:"pages"`
+		Next  string         `json:"next"`
+	}
+	json.NewDecoder(resp.Body).Decode(&pages)
+	if len(pages.Pages) != 2 || len(pages.Next) == 0 {
+		t.Errorf("Expecting (2) pages and a cursor, got (%+v)", pages)
+	}
+
+	resp, err = http.Get(api.URL + "/jobs/" + job.ID + "/pages?min_depth=1&max_depth=1")
+	if err != nil {
+		t.Fatalf("Failed to get pages: %s", err)
+	}
+	defer resp.Body.Close()
+	pages.Pages = nil
+	json.NewDecoder(resp.Body).Decode(&pages)
+	if len(pages.Pages) != 3 {
+		t.Errorf("Expecting the (3) pages at depth 1, got (%+v)", pages.Pages)
+	}
+	for _, page := range pages.Pages {
+		if page.Depth != 1 {
+			t.Errorf("Expecting (%s) at depth 1, got (%d)", page.URL, page.Depth)
+		}
+	}
+
+	if resp, _ := http.Get(api.URL + "/jobs/404"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expecting (404) for an unknown job, got (%d)", resp.StatusCode)
+	}
+}
+
+// Test that a job stops once its quota is exceeded, with the quota as reason
+func TestJobQueue_quota(t *testing.T) {
+	site := &SyntheticSite{Depth: 3, Branching: 5, Latency: 10 * time.Millisecond}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	q := NewJobQueue(1, 0)
+	q.Quota = Quota{Pages: 100}
+	if quota := q.jobQuota(Quota{Pages: 500, Bytes: 1000}); quota.Pages != 100 || quota.Bytes != 1000 {
+		t.Errorf("Expecting the quota to be lowered to the limits of the queue, got (%+v)", quota)
+	}
+
+	submitted, _ := q.Submit(ts.URL, Quota{Pages: 10})
+	job := waitForJob(t, q, submitted.ID)
+	if job.State != JOB_DONE || job.Reason != QuotaExceeded("pages").Error() {
+		t.Errorf("Expecting the job to be stopped by its quota, got (%+v)", job)
+	}
+	if job.Pages < 10 || job.Pages >= site.Pages() {
+		t.Errorf("Expecting about (10) pages, got (%d)", job.Pages)
+	}
+}
+
+// Test that the jobs submitted with an API key can neither be listed nor cancelled with another
+func TestJobQueue_owners(t *testing.T) {
+	site := &SyntheticSite{Depth: 3, Branching: 5, Latency: 50 * time.Millisecond}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+	q := NewJobQueue(1, 0)
+	api := httptest.NewServer(NewAuthenticator([]APIKey{{Key: "alice-key", Name: "alice"}, {Key: "bob-key", Name: "bob"}}, q))
+	defer api.Close()
+	do := func(method string, path string, key string, body string) *http.Response {
+		req, _ := http.NewRequest(method, api.URL+path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to %s (%s): %s", method, path, err)
+		}
+		return resp
+	}
+	list := func(key string) []Job {
+		resp := do(http.MethodGet, "/jobs", key, "")
+		defer resp.Body.Close()
+		var jobs []Job
+		json.NewDecoder(resp.Body).Decode(&jobs)
+		return jobs
+	}
+
+	resp := do(http.MethodPost, "/jobs", "alice-key", `{"url": "`+ts.URL+`"}`)
+	var job Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+
+	if jobs := list("bob-key"); len(jobs) != 0 {
+		t.Errorf("Expecting (bob) not to list the jobs of (alice), got (%+v)", jobs)
+	}
+	if jobs := list("alice-key"); len(jobs) != 1 || jobs[0].ID != job.ID {
+		t.Errorf("Expecting (alice) to list job (%s), got (%+v)", job.ID, jobs)
+	}
+	if resp := do(http.MethodDelete, "/jobs/"+job.ID, "bob-key", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expecting (404) when (bob) cancels the job of (alice), got (%d)", resp.StatusCode)
+	}
+	if got, _ := q.Get(job.ID); got.finished() {
+		t.Errorf("Expecting the job of (alice) not to be cancelled by (bob), got (%s)", got.State)
+	}
+	if resp := do(http.MethodDelete, "/jobs/"+job.ID, "alice-key", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expecting (alice) to cancel the job, got (%d)", resp.StatusCode)
+	}
+	if got := waitForJob(t, q, job.ID); got.State != JOB_CANCELLED {
+		t.Errorf("Expecting the job to be cancelled by (alice), got (%s)", got.State)
+	}
+}
+
+// Test that a job whose crawler cannot be initialised fails with the reason
+func TestJobQueue_initFails(t *testing.T) {
+	q := NewJobQueue(1, 0)
+	q.mu.Lock()
+	job := &Job{ID: "1", URL: "not a url", State: JOB_QUEUED, Submitted: time.Now()}
+	q.jobs[job.ID], q.order = job, append(q.order, job.ID)
+	q.pending = append(q.pending, job)
+	q.ready.Signal()
+	q.mu.Unlock()
+
+	got := waitForJob(t, q, job.ID)
+	if want := InvalidURL("not a url").Error(); got.State != JOB_FAILED || got.Error != want {
+		t.Errorf("Expecting the job to fail with (%s), got (%+v)", want, got)
+	}
+}
+
+// Test that a job keeps the time it started once finished
+func TestJobQueue_keepsStartTime(t *testing.T) {
+	ts := httptest.NewServer(&SyntheticSite{Depth: 1, Branching: 2, Latency: 20 * time.Millisecond})
+	defer ts.Close()
+
+	q := NewJobQueue(1, 0)
+	submitted, _ := q.Submit(ts.URL, Quota{})
+	job := waitForJob(t, q, submitted.ID)
+	if job.Started == nil || !job.Started.Before(*job.Finished) {
+		t.Errorf("Expecting the job to start before it finished, got (%v) and (%v)", job.Started, job.Finished)
+	}
+}
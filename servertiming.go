@@ -0,0 +1,142 @@
+package crawler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --------------------
+// Server-Timing
+// --------------------
+
+// Number of pages listed with their Server-Timing metrics in the report
+const MAX_REPORTED_SERVER_TIMINGS int = 10
+
+// Metric of a Server-Timing response header, e.g. db;desc="Database";dur=53.2
+type ServerTiming struct {
+	Name        string  `json:"name"`
+	Description string  `json:"desc,omitempty"`
+	DurationMs  float64 `json:"dur,omitempty"`
+}
+
+// Returns the metrics of the given Server-Timing headers, in order. Metrics are comma separated,
+// their parameters semicolon separated. Unknown parameters and malformed durations are ignored.
+func ParseServerTiming(values []string) []ServerTiming {
+	var metrics []ServerTiming
+	for _, value := range values {
+		for _, metric := range splitUnquoted(value, ',') {
+			params := splitUnquoted(metric, ';')
+			name := strings.TrimSpace(params[0])
+			if len(name) == 0 {
+				continue
+			}
+			m := ServerTiming{Name: name}
+			for _, param := range params[1:] {
+				i := strings.Index(param, "=")
+				if i < 0 {
+					continue
+				}
+				key, v := strings.ToLower(strings.TrimSpace(param[:i])), strings.TrimSpace(param[i+1:])
+				if unquoted, err := strconv.Unquote(v); err == nil {
+					v = unquoted
+				}
+				switch key {
+				case "desc":
+					m.Description = v
+				case "dur":
+					m.DurationMs, _ = strconv.ParseFloat(v, 64)
+				}
+			}
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+// Splits s on sep, except inside double quotes
+func splitUnquoted(s string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Returns the metrics as a single CSV field, e.g. db=53.2; app=47.0
+func serverTimingField(metrics []ServerTiming) string {
+	fields := make([]string, len(metrics))
+	for i, m := range metrics {
+		fields[i] = m.Name + "=" + strconv.FormatFloat(m.DurationMs, 'f', 1, 64)
+	}
+	return strings.Join(fields, "; ")
+}
+
+// Returns the longest duration reported. Metrics may overlap (a total including the
+// database time), so the longest is taken as the time the server spent on the request.
+func serverTimingBackend(metrics []ServerTiming) time.Duration {
+	var longest float64
+	for _, m := range metrics {
+		if m.DurationMs > longest {
+			longest = m.DurationMs
+		}
+	}
+	return time.Duration(longest * float64(time.Millisecond))
+}
+
+// Server-Timing metrics of a page along with the time it was measured to take, see serverTimings
+type pageServerTiming struct {
+	URL     string
+	Metrics []ServerTiming
+
+	// Time to first byte, or time of the whole GET when requests were not traced
+	Measured time.Duration
+}
+
+// Returns how much of the measured time the server does not account for, e.g. network and queueing
+func (p pageServerTiming) Unaccounted() time.Duration {
+	return p.Measured - serverTimingBackend(p.Metrics)
+}
+
+// Returns the n pages whose servers reported the longest durations
+func (c *Crawler) serverTimings(n int) []pageServerTiming {
+	var timings []pageServerTiming
+	c.stats.Range(func(k, v interface{}) bool {
+		stat := v.(CrawlStat)
+		if len(stat.serverTiming) == 0 {
+			return true
+		}
+		measured := stat.timing.TTFB
+		if measured == 0 {
+			measured = stat.getTime
+		}
+		timings = append(timings, pageServerTiming{URL: k.(string), Metrics: stat.serverTiming, Measured: measured})
+		return true
+	})
+	sort.Slice(timings, func(i, j int) bool {
+		if bi, bj := serverTimingBackend(timings[i].Metrics), serverTimingBackend(timings[j].Metrics); bi != bj {
+			return bi > bj
+		}
+		return timings[i].URL < timings[j].URL
+	})
+	if len(timings) > n {
+		timings = timings[:n]
+	}
+	return timings
+}
+
+// Returns a line of the report listing the Server-Timing metrics of a page
+func serverTimingLine(p pageServerTiming) string {
+	return fmt.Sprintf("%s: %s (measured %s, unaccounted %s)", p.URL, serverTimingField(p.Metrics), p.Measured, p.Unaccounted())
+}
@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseServerTiming(t *testing.T) {
+	got := ParseServerTiming([]string{`cache;desc="Cache, Read";dur=23.2, db;dur=53`, `miss, total;dur=abc`})
+	want := []ServerTiming{
+		{Name: "cache", Description: "Cache, Read", DurationMs: 23.2},
+		{Name: "db", DurationMs: 53},
+		{Name: "miss"},
+		{Name: "total"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expecting (%+v), got (%+v)", want, got)
+	}
+}
+
+// Server-Timing metrics end up in the stream and the report
+func TestCrawlServerTiming(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/db" {
+			w.Header().Set("Server-Timing", "db;dur=12.5, total;dur=20")
+		}
+		io.WriteString(w, `<html><a href="/db">DB</a></html>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.Run(context.Background())
+
+	timings := c.serverTimings(MAX_REPORTED_SERVER_TIMINGS)
+	if len(timings) != 1 || timings[0].URL != ts.URL+"/db" || len(timings[0].Metrics) != 2 {
+		t.Fatalf("Expecting the metrics of (%s), got (%+v)", ts.URL+"/db", timings)
+	}
+	var report bytes.Buffer
+	c.WriteReport(&report)
+	if !strings.Contains(report.String(), ts.URL+"/db: db=12.5; total=20.0 (measured") {
+		t.Errorf("Expecting the report to list the metrics of (%s), got (%s)", ts.URL+"/db", report.String())
+	}
+	stat, _ := c.stats.Load(ts.URL + "/db")
+	page := toStreamedPage(CrawlPage{URL: ts.URL + "/db", Stat: stat.(CrawlStat)}, nil)
+	if want := []ServerTiming{{Name: "db", DurationMs: 12.5}, {Name: "total", DurationMs: 20}}; !reflect.DeepEqual(page.ServerTiming, want) {
+		t.Errorf("Expecting (%+v) streamed, got (%+v)", want, page.ServerTiming)
+	}
+}
@@ -0,0 +1,100 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+)
+
+// --------------------
+// Session and tracking parameters
+// --------------------
+
+// Links often carry a session ID or campaign parameters that change nothing about the page
+// served, each variant of a link would otherwise be crawled and reported as a page of its own:
+//
+//	https://monzo.com/about;jsessionid=A1B2?utm_source=blog&lang=en --> https://monzo.com/about?lang=en
+//
+// They are removed from links found before they are deduplicated, unless told otherwise:
+//
+//	-stripparams ref,sessionid   remove these on top of the built-in ones
+//	-stripbuiltin=false          keep the built-in ones
+
+// Parameters removed from links unless told otherwise, see stripParams.
+// Names ending with * match any parameter starting with the rest.
+var DEFAULT_STRIPPED_PARAMS = []string{"jsessionid", "phpsessid", "utm_*", "fbclid", "gclid"}
+
+// Returns true if the parameter of the given name is one of params, case insensitive
+func isStrippedParam(name string, params []string) bool {
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		name = unescaped
+	}
+	name = strings.ToLower(name)
+	for _, p := range params {
+		if prefix := strings.TrimSuffix(p, "*"); prefix != p {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the name of the given name=value pair
+func paramName(pair string) string {
+	if i := strings.IndexByte(pair, '='); i >= 0 {
+		return pair[:i]
+	}
+	return pair
+}
+
+// Removes the parameters named in params (lowercase) from the given link, both from its query
+// (?utm_source=x) and from the path parameters of its segments (;jsessionid=x). The other
+// parameters are kept as written, in order.
+func stripParams(link string, params []string) string {
+	if len(params) == 0 {
+		return link
+	}
+	var fragment string
+	if i := strings.IndexByte(link, '#'); i >= 0 {
+		link, fragment = link[:i], link[i:]
+	}
+	var query string
+	hasQuery := false
+	if i := strings.IndexByte(link, '?'); i >= 0 {
+		link, query, hasQuery = link[:i], link[i+1:], true
+	}
+
+	if strings.IndexByte(link, ';') >= 0 {
+		segments := strings.Split(link, "/")
+		for i, segment := range segments {
+			parts := strings.Split(segment, ";")
+			kept := parts[:1]
+			for _, p := range parts[1:] {
+				if !isStrippedParam(paramName(p), params) {
+					kept = append(kept, p)
+				}
+			}
+			segments[i] = strings.Join(kept, ";")
+		}
+		link = strings.Join(segments, "/")
+	}
+
+	if hasQuery {
+		var kept []string
+		stripped := false
+		for _, pair := range strings.Split(query, "&") {
+			if isStrippedParam(paramName(pair), params) {
+				stripped = true
+			} else {
+				kept = append(kept, pair)
+			}
+		}
+		// A link ending with a bare '?' is left as is
+		if len(kept) > 0 || !stripped {
+			link += "?" + strings.Join(kept, "&")
+		}
+	}
+	return link + fragment
+}
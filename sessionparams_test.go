@@ -0,0 +1,58 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStripParams(t *testing.T) {
+	tests := map[string]string{
+		"https://monzo.com/about?utm_source=blog&lang=en&UTM_MEDIUM=x": "https://monzo.com/about?lang=en",
+		"https://monzo.com/about;jsessionid=A1B2?lang=en":              "https://monzo.com/about?lang=en",
+		"/about;jsessionid=A1B2;v=2":                                   "/about;v=2",
+		"/about?PHPSESSID=42#team":                                     "/about#team",
+		"/about?fbclid=x&gclid=y":                                      "/about",
+		"/search?q=utm_source":                                         "/search?q=utm_source",
+		"/about?":                                                      "/about?",
+		"/about":                                                       "/about",
+	}
+	for link, want := range tests {
+		if got := stripParams(link, DEFAULT_STRIPPED_PARAMS); got != want {
+			t.Errorf("Expecting (%s) for (%s), got (%s)", want, link, got)
+		}
+	}
+	if got := stripParams("/about?utm_source=blog", nil); got != "/about?utm_source=blog" {
+		t.Errorf("Expecting the link as is without params, got (%s)", got)
+	}
+	if got := stripParams("/about?ref=home&mc_cid=1&id=2", []string{"ref", "mc_*"}); got != "/about?id=2" {
+		t.Errorf("Expecting (/about?id=2), got (%s)", got)
+	}
+}
+
+// Links differing only by their tracking parameters are crawled once
+func TestCrawlStripsTrackingParams(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := "http://" + r.Host
+		io.WriteString(w, `<html><a href="`+base+`/about?utm_source=home">About</a><a href="`+base+
+			`/about?utm_source=footer&fbclid=42">About</a><a href="/about;jsessionid=A1B2">About</a></html>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.Run(context.Background())
+
+	pages := c.Result().Pages
+	if len(pages) != 2 {
+		t.Fatalf("Expecting (2) pages crawled, got (%d)", len(pages))
+	}
+	for _, page := range pages {
+		if page.URL != ts.URL && page.URL != ts.URL+"/about" {
+			t.Errorf("Expecting tracking parameters to be removed, got (%s)", page.URL)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --------------------
+// Sitemaps
+// --------------------
+
+// Maximum nesting of sitemap indexes followed, guards against indexes listing each other
+const MAX_SITEMAP_DEPTH int = 3
+
+var linkTagRe = regexp.MustCompile("(?i)<link[^>]*>")
+var relSitemapRe = regexp.MustCompile("(?i)rel\\s*=\\s*[\"']?sitemap[\"'\\s>]")
+var linkHrefRe = regexp.MustCompile("(?i)href\\s*=\\s*[\"']([^\"']+)[\"']")
+
+// Returns the URLs of the sitemaps declared with Sitemap: lines in the given robots.txt
+func FindSitemapDirectives(robots []byte) []string {
+	var sitemaps []string
+	scanner := bufio.NewScanner(bytes.NewReader(robots))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, ":"); i > 0 && strings.EqualFold(line[:i], "sitemap") {
+			if sitemap := strings.TrimSpace(line[i+1:]); len(sitemap) > 0 {
+				sitemaps = append(sitemaps, sitemap)
+			}
+		}
+	}
+	return sitemaps
+}
+
+// Returns the href of the <link rel="sitemap"> tags of the given html, as written
+func FindSitemapLinks(html []byte) []string {
+	var sitemaps []string
+	for _, tag := range linkTagRe.FindAll(html, -1) {
+		if !relSitemapRe.Match(tag) {
+			continue
+		}
+		if m := linkHrefRe.FindSubmatch(tag); m != nil {
+			sitemaps = append(sitemaps, string(m[1]))
+		}
+	}
+	return sitemaps
+}
+
+// Contents of a sitemap, either a <urlset> of pages or a <sitemapindex> of other sitemaps
+type sitemapXML struct {
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+// Returns the given sitemap uncompressed if it is gzip-compressed (sitemap.xml.gz), as is otherwise
+func decompressSitemap(content []byte) ([]byte, error) {
+	if !bytes.HasPrefix(content, []byte{0x1f, 0x8b}) {
+		return content, nil
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(gz)
+}
+
+// Parses the given sitemap, which may be gzip-compressed (sitemap.xml.gz).
+// Returns the pages it lists and the sitemaps it lists if it is an index.
+func ParseSitemap(content []byte) ([]string, []string, error) {
+	content, err := decompressSitemap(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	var s sitemapXML
+	if err := xml.Unmarshal(content, &s); err != nil {
+		return nil, nil, err
+	}
+	for i := range s.URLs {
+		s.URLs[i] = strings.TrimSpace(s.URLs[i])
+	}
+	for i := range s.Sitemaps {
+		s.Sitemaps[i] = strings.TrimSpace(s.Sitemaps[i])
+	}
+	return s.URLs, s.Sitemaps, nil
+}
+
+// Entry of a generated sitemap
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+// Generated sitemap
+type urlsetXML struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// Returns the number of crawled pages linking to each page, keyed by visitKey
+func (c *Crawler) inDegrees() map[string]int {
+	degrees := make(map[string]int)
+	c.sitemap.Range(func(k, v interface{}) bool {
+		for _, child := range v.([]string) {
+			degrees[c.visitKey(child)]++
+		}
+		return true
+	})
+	return degrees
+}
+
+// Returns the estimated <priority> of a page: pages few clicks away from the home page
+// and linked from many pages matter more.
+func sitemapPriority(depth int, inDegree int, maxInDegree int) float64 {
+	linked := 0.0
+	if maxInDegree > 0 {
+		linked = math.Log1p(float64(inDegree)) / math.Log1p(float64(maxInDegree))
+	}
+	priority := 0.7/float64(1+depth) + 0.3*linked
+	return math.Max(0.1, math.Min(1, math.Round(priority*10)/10))
+}
+
+// Returns the <changefreq> of a page changing about every interval
+func changeFreq(interval time.Duration) string {
+	switch {
+	case interval < 24*time.Hour:
+		return "daily"
+	case interval < 7*24*time.Hour:
+		return "weekly"
+	case interval < 31*24*time.Hour:
+		return "monthly"
+	}
+	return "yearly"
+}
+
+// Returns the estimated <changefreq> of a page last modified at the given time, as of now,
+// for pages without a history of changes
+func sitemapChangeFreq(modified time.Time, now time.Time) string {
+	return changeFreq(now.Sub(modified))
+}
+
+// Write a sitemap.xml of all crawled URLs to w, sorted.
+// Pages whose server sent a Last-Modified have it as <lastmod>. When 'sitemapPriorities' is set,
+// <priority> is estimated from click depth and the number of pages linking to the page, and
+// <changefreq> from how often its content changed over the crawls recorded, see PageChanges,
+// or how recently it was modified when there is no history or too short a one.
+func (c *Crawler) WriteSitemapXML(w io.Writer) error {
+	var degrees map[string]int
+	maxDegree := 0
+	if c.sitemapPriorities {
+		degrees = c.inDegrees()
+		for _, d := range degrees {
+			if d > maxDegree {
+				maxDegree = d
+			}
+		}
+	}
+
+	urlset := urlsetXML{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	c.sitemap.Range(func(k, v interface{}) bool {
+		u := sitemapURL{Loc: k.(string)}
+		t, modified := c.lastModified.Load(k)
+		if modified {
+			u.LastMod = t.(time.Time).UTC().Format(time.RFC3339)
+		}
+		if c.sitemapPriorities {
+			priority := sitemapPriority(c.discoveryOf(u.Loc).depth, degrees[c.visitKey(u.Loc)], maxDegree)
+			u.Priority = strconv.FormatFloat(priority, 'f', 1, 64)
+			changes := c.pageChanges[u.Loc]
+			if interval := changes.Interval(); interval > 0 {
+				u.ChangeFreq = changeFreq(interval)
+			} else if modified {
+				u.ChangeFreq = sitemapChangeFreq(t.(time.Time), time.Now())
+			} else if changes.Crawls > 1 {
+				// Recrawled unchanged, but too recently to tell how rarely it changes
+				u.ChangeFreq = "yearly"
+			}
+		}
+		urlset.URLs = append(urlset.URLs, u)
+		return true
+	})
+	sort.Slice(urlset.URLs, func(i, j int) bool { return urlset.URLs[i].Loc < urlset.URLs[j].Loc })
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(urlset); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Fetches the sitemaps declared in the site's robots.txt and ingests them
+func (c *Crawler) ingestRobotsSitemaps() {
+	defer c.pending.Done()
+	robots := c.scheme + "://" + c.domain + "/robots.txt"
+	rules, err := c.robotsCache.Get(c.fetcherOrDefault(), robots)
+	if err != nil {
+		return
+	}
+	c.robots.Store(robots, rules)
+	for _, sitemap := range rules.Sitemaps {
+		c.ingestSitemap(sitemap, 0)
+	}
+}
+
+// Fetches the given sitemap, unless already done, and schedules the local pages it lists
+// that have not been visited yet. Pages listed are recorded in 'sitemapPages'.
+// Sitemaps on other sites are not fetched when 'localOnly' is set.
+func (c *Crawler) ingestSitemap(sitemap string, depth int) {
+	if c.localOnly && !c.isLocal(sitemap) {
+		log.Printf("Sitemap (%s) is outside of the crawl, not fetching it.\n", sitemap)
+		return
+	}
+	if _, done := c.sitemapsFetched.LoadOrStore(sitemap, true); done || depth > MAX_SITEMAP_DEPTH {
+		return
+	}
+	res, err := c.fetcherOrDefault().Fetch(sitemap)
+	if err != nil {
+		c.fetchErrors.Store(sitemap, err)
+		return
+	}
+	pages, sitemaps, err := ParseSitemap(res.Body.Bytes())
+	releaseBody(res.Body)
+	if err != nil {
+		c.fetchErrors.Store(sitemap, InvalidHTMLContent(sitemap))
+		return
+	}
+
+	for _, page := range pages {
+		if !c.isLocal(page) {
+			continue
+		}
+		c.sitemapPages.Store(page, sitemap)
+		if _, present := c.visited.Load(c.visitKey(page)); !present {
+			if ok, reason := c.allowed(page, 1, sitemap); !ok {
+				c.skip(page, reason, discovery{referrer: sitemap, depth: 1, source: SOURCE_SITEMAP})
+				continue
+			}
+			if _, known := c.discovered.LoadOrStore(page, discovery{referrer: sitemap, depth: 1, source: SOURCE_SITEMAP}); !known {
+				c.discoveries.discover()
+			}
+			if c.claim(page) {
+				c.schedule(page)
+			}
+		}
+	}
+	for _, s := range sitemaps {
+		c.ingestSitemap(s, depth+1)
+	}
+}
+
+// Returns the pages listed in the ingested sitemaps that no crawled page links to
+func (c *Crawler) orphanPages() []string {
+	linked := make(map[string]bool)
+	c.sitemap.Range(func(k, v interface{}) bool {
+		for _, child := range v.([]string) {
+			linked[c.visitKey(child)] = true
+		}
+		return true
+	})
+	var orphans []string
+	c.sitemapPages.Range(func(k, v interface{}) bool {
+		if page := k.(string); !linked[c.visitKey(page)] && c.visitKey(page) != c.visitKey(c.baseSite) {
+			orphans = append(orphans, page)
+		}
+		return true
+	})
+	return orphans
+}
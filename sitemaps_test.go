@@ -0,0 +1,213 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindSitemapDirectives(t *testing.T) {
+	robots := []byte("User-agent: *\nDisallow: /private\nSitemap: https://monzo.com/sitemap.xml\n" +
+		"sitemap:https://monzo.com/blog/sitemap.xml.gz\n# Sitemap: https://monzo.com/commented.xml\n")
+	expected := []string{"https://monzo.com/sitemap.xml", "https://monzo.com/blog/sitemap.xml.gz"}
+	if res := testArraysMatch(t, FindSitemapDirectives(robots), expected); res != 0 {
+		t.Errorf("Sitemap directives were not found as they should.")
+	}
+}
+
+func TestFindSitemapLinks(t *testing.T) {
+	html := []byte(`<head><link rel="stylesheet" href="/style.css">` +
+		`<link rel="sitemap" type="application/xml" href="/sitemap.xml"><LINK HREF='/other.xml' REL=sitemap></head>`)
+	expected := []string{"/sitemap.xml", "/other.xml"}
+	if res := testArraysMatch(t, FindSitemapLinks(html), expected); res != 0 {
+		t.Errorf("Sitemap links were not found as they should.")
+	}
+}
+
+func TestParseSitemap(t *testing.T) {
+	urlset := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://monzo.com/</loc></url>
+  <url><loc>
+    https://monzo.com/about
+  </loc><lastmod>2020-01-01</lastmod></url>
+</urlset>`)
+	pages, sitemaps, err := ParseSitemap(urlset)
+	if err != nil {
+		t.Fatalf("Failed to parse sitemap: %s", err)
+	}
+	if res := testArraysMatch(t, pages, []string{"https://monzo.com/", "https://monzo.com/about"}); res != 0 || len(sitemaps) != 0 {
+		t.Errorf("Pages of the sitemap were not parsed as they should, got (%v) (%v)", pages, sitemaps)
+	}
+
+	// Compressed sitemap index
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	io.WriteString(w, `<sitemapindex><sitemap><loc>https://monzo.com/blog.xml</loc></sitemap></sitemapindex>`)
+	w.Close()
+	pages, sitemaps, err = ParseSitemap(gz.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to parse sitemap index: %s", err)
+	}
+	if len(pages) != 0 || len(sitemaps) != 1 || sitemaps[0] != "https://monzo.com/blog.xml" {
+		t.Errorf("Sitemaps of the index were not parsed as they should, got (%v) (%v)", pages, sitemaps)
+	}
+
+	if _, _, err := ParseSitemap([]byte("<html>not a sitemap")); err == nil {
+		t.Errorf("Expecting an error parsing malformed sitemap")
+	}
+}
+
+// Test that pages only listed in the sitemap are crawled and reported as orphans
+func TestCrawl_ingestsSitemaps(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			io.WriteString(w, "Sitemap: "+ts.URL+"/sitemap_index.xml\n")
+		case "/sitemap_index.xml":
+			io.WriteString(w, "<sitemapindex><sitemap><loc>"+ts.URL+"/sitemap.xml</loc></sitemap></sitemapindex>")
+		case "/sitemap.xml":
+			io.WriteString(w, "<urlset><url><loc>"+ts.URL+"/about</loc></url><url><loc>"+ts.URL+"/orphan</loc></url>"+
+				"<url><loc>https://elsewhere.com/page</loc></url></urlset>")
+		case "/":
+			io.WriteString(w, `<html><a href="/about">About</a></html>`)
+		default:
+			io.WriteString(w, `<html></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.ingestSitemaps = true
+	c.Start()
+	c.Wait()
+
+	if _, ok := c.sitemap.Load(ts.URL + "/orphan"); !ok {
+		t.Errorf("Sitemap does not contain (/orphan) listed in the sitemap as it should.")
+	}
+	if _, ok := c.sitemap.Load("https://elsewhere.com/page"); ok {
+		t.Errorf("Pages of other domains listed in the sitemap should not be crawled.")
+	}
+	if res := testArraysMatch(t, c.orphanPages(), []string{ts.URL + "/orphan"}); res != 0 {
+		t.Errorf("Expecting (/orphan) alone to be an orphan, got (%v)", c.orphanPages())
+	}
+}
+
+// Test that the sitemap.xml generated lists every page, with the Last-Modified as <lastmod>
+func TestWriteSitemapXML(t *testing.T) {
+	modified := map[string]time.Time{
+		"/about": time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC),
+		"/blog":  time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC),
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t, ok := modified[r.URL.Path]; ok {
+			w.Header().Set("Last-Modified", t.Format(http.TimeFormat))
+		}
+		io.WriteString(w, `<html><a href="/about">About</a><a href="/blog">Blog</a></html>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.Start()
+	c.Wait()
+
+	var out bytes.Buffer
+	if err := c.WriteSitemapXML(&out); err != nil {
+		t.Fatalf("Failed to write sitemap: %s", err)
+	}
+	pages, _, err := ParseSitemap(out.Bytes())
+	if err != nil {
+		t.Fatalf("Generated sitemap does not parse: %s", err)
+	}
+	expected := []string{ts.URL, ts.URL + "/about", ts.URL + "/blog"}
+	if res := testArraysMatch(t, pages, expected); res != 0 {
+		t.Errorf("Expecting (%v) in the sitemap, got (%v)", expected, pages)
+	}
+	if !strings.Contains(out.String(), "<lastmod>2019-05-01T10:00:00Z</lastmod>") {
+		t.Errorf("Expecting the Last-Modified of (/about) as <lastmod>, got (%s)", out.String())
+	}
+
+	stalest := c.stalestPages(1)
+	if len(stalest) != 1 || stalest[0] != ts.URL+"/blog" {
+		t.Errorf("Expecting (/blog) to be the stalest page, got (%v)", stalest)
+	}
+}
+
+func TestSitemapPriority(t *testing.T) {
+	tests := []struct {
+		depth, inDegree, maxInDegree int
+		expected                     float64
+	}{
+		{0, 10, 10, 1},
+		{2, 10, 10, 0.5},
+		{3, 0, 10, 0.2},
+		{5, 0, 10, 0.1},
+		{0, 0, 0, 0.7},
+	}
+	for _, test := range tests {
+		if p := sitemapPriority(test.depth, test.inDegree, test.maxInDegree); p != test.expected {
+			t.Errorf("Expecting priority (%.1f) for (%+v), got (%.1f)", test.expected, test, p)
+		}
+	}
+}
+
+// <changefreq> comes from how often the content of pages changed, Last-Modified only without history
+func TestWriteSitemapXML_changeFreqFromHistory(t *testing.T) {
+	recent := time.Now().Add(-time.Hour)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", recent.Format(http.TimeFormat))
+		io.WriteString(w, `<html><a href="/about">About</a><a href="/blog">Blog</a></html>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.sitemapPriorities = true
+	c.Run(context.Background())
+	first := time.Now().Add(-60 * 24 * time.Hour)
+	c.pageChanges = map[string]PageChanges{
+		ts.URL + "/about": {Crawls: 10, Changes: 0, First: first, Last: time.Now()},
+		ts.URL + "/blog":  {Crawls: 10, Changes: 6, First: first, Last: time.Now()},
+	}
+
+	var out bytes.Buffer
+	if err := c.WriteSitemapXML(&out); err != nil {
+		t.Fatalf("Failed to write sitemap: %s", err)
+	}
+	var urlset urlsetXML
+	if err := xml.Unmarshal(out.Bytes(), &urlset); err != nil {
+		t.Fatalf("Generated sitemap does not parse: %s", err)
+	}
+	want := map[string]string{ts.URL: "daily", ts.URL + "/about": "yearly", ts.URL + "/blog": "monthly"}
+	for _, u := range urlset.URLs {
+		if u.ChangeFreq != want[u.Loc] {
+			t.Errorf("Expecting (%s) for (%s), got (%s)", want[u.Loc], u.Loc, u.ChangeFreq)
+		}
+	}
+}
+
+func TestSitemapChangeFreq(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := map[time.Duration]string{
+		time.Hour:            "daily",
+		3 * 24 * time.Hour:   "weekly",
+		20 * 24 * time.Hour:  "monthly",
+		400 * 24 * time.Hour: "yearly",
+	}
+	for age, expected := range tests {
+		if freq := sitemapChangeFreq(now.Add(-age), now); freq != expected {
+			t.Errorf("Expecting (%s) for a page modified (%s) ago, got (%s)", expected, age, freq)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------
+// Streaming output
+// --------------------
+
+// Time between two syncs of a streamed file to disk
+const STREAM_SYNC_INTERVAL time.Duration = 5 * time.Second
+
+// Receives each page as soon as it has been crawled, or failed to be
+type PageSink interface {
+	WritePage(page CrawlPage, err error)
+}
+
+// A page as written to NDJSON streams
+type streamedPage struct {
+	URL           string              `json:"url"`
+	Error         string              `json:"error,omitempty"`
+	Category      string              `json:"category,omitempty"`
+	Skipped       string              `json:"skipped,omitempty"`
+	Referrer      string              `json:"referrer,omitempty"`
+	Source        string              `json:"source,omitempty"`
+	Depth         int                 `json:"depth"`
+	RequestID     string              `json:"request_id,omitempty"`
+	Children      []string            `json:"children,omitempty"`
+	ExternalLinks []string            `json:"external_links,omitempty"`
+	Outbound      map[string][]string `json:"outbound_domains,omitempty"`
+	Headers       map[string][]string `json:"headers,omitempty"`
+	Extracted     map[string][]string `json:"extracted,omitempty"`
+	GetTimeMs     float64             `json:"get_time_ms"`
+	TotalTimeMs   float64             `json:"total_time_ms"`
+	QueueTimeMs   float64             `json:"queue_time_ms"`
+	ThrottleMs    float64             `json:"throttle_time_ms"`
+	SlotTimeMs    float64             `json:"slot_time_ms"`
+	DNSMs         float64             `json:"dns_ms,omitempty"`
+	ConnectMs     float64             `json:"connect_ms,omitempty"`
+	TLSMs         float64             `json:"tls_ms,omitempty"`
+	TTFBMs        float64             `json:"ttfb_ms,omitempty"`
+	BodyMs        float64             `json:"body_ms,omitempty"`
+	ServerTiming  []ServerTiming      `json:"server_timing,omitempty"`
+	FetchedAt     *time.Time          `json:"fetched_at,omitempty"`
+}
+
+// Returns the given page, which failed with err if not nil, as written to NDJSON streams
+func toStreamedPage(page CrawlPage, err error) streamedPage {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	p := streamedPage{URL: page.URL, Children: page.Children, ExternalLinks: page.ExternalLinks, Outbound: page.OutboundDomains,
+		GetTimeMs: ms(page.Stat.getTime), TotalTimeMs: ms(page.Stat.totalTime), QueueTimeMs: ms(page.Stat.queueTime),
+		ThrottleMs: ms(page.Stat.throttleTime), SlotTimeMs: ms(page.Stat.slotTime), Headers: page.Header,
+		Extracted: page.Extracted, Skipped: page.Skipped, Referrer: page.Referrer, Source: page.Source, Depth: page.Depth,
+		RequestID: page.RequestID, DNSMs: ms(page.Stat.timing.DNS), ConnectMs: ms(page.Stat.timing.Connect),
+		TLSMs: ms(page.Stat.timing.TLS), TTFBMs: ms(page.Stat.timing.TTFB), BodyMs: ms(page.Stat.timing.Body),
+		ServerTiming: page.Stat.serverTiming}
+	if err != nil {
+		p.Error, p.Category = redactor.Redact(err.Error()), errorCategory(err)
+	}
+	if !page.Stat.fetchedAt.IsZero() {
+		p.FetchedAt = &page.Stat.fetchedAt
+	}
+	return p
+}
+
+// Columns of CSV streams
+var streamCSVHeader = []string{"url", "outcome", "children", "external_links", "get_time_ms", "total_time_ms",
+	"queue_time_ms", "throttle_time_ms", "slot_time_ms", "extracted", "referrer", "source", "depth", "request_id",
+	"dns_ms", "connect_ms", "tls_ms", "ttfb_ms", "body_ms", "server_timing"}
+
+// Returns the values extracted from a page as a single CSV field, e.g. author=Monzo; price=£5|£10
+func extractedField(extracted map[string][]string) string {
+	fields := make([]string, 0, len(extracted))
+	for _, name := range sortedKeys(extracted) {
+		fields = append(fields, name+"="+strings.Join(extracted[name], "|"))
+	}
+	return strings.Join(fields, "; ")
+}
+
+// PageSink writing pages to a file as NDJSON or CSV as they are crawled, so that the
+// results of a crawl killed half way through are not lost. Each page is written out
+// straight away and the file is synced to disk every STREAM_SYNC_INTERVAL.
+type StreamWriter struct {
+	mu       sync.Mutex
+	file     *os.File
+	w        *bufio.Writer
+	csv      *csv.Writer
+	lastSync time.Time
+
+	// First error writing the file, returned by Close
+	err error
+}
+
+// Returns a StreamWriter writing to path, as CSV if it ends in .csv and NDJSON otherwise
+func NewStreamWriter(path string) (*StreamWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &StreamWriter{file: f, w: bufio.NewWriter(f), lastSync: time.Now()}
+	if strings.HasSuffix(path, ".csv") {
+		s.csv = csv.NewWriter(s.w)
+		s.csv.Write(streamCSVHeader)
+	}
+	return s, nil
+}
+
+func (s *StreamWriter) WritePage(page CrawlPage, err error) {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	if s.csv != nil {
+		outcome := "ok"
+		if err != nil {
+			outcome = errorCategory(err)
+		} else if len(page.Skipped) > 0 {
+			outcome = "skipped: " + page.Skipped
+		}
+		s.csv.Write([]string{page.URL, outcome,
+			strconv.Itoa(len(page.Children)), strconv.Itoa(len(page.ExternalLinks)),
+			strconv.FormatFloat(ms(page.Stat.getTime), 'f', 3, 64),
+			strconv.FormatFloat(ms(page.Stat.totalTime), 'f', 3, 64),
+			strconv.FormatFloat(ms(page.Stat.queueTime), 'f', 3, 64),
+			strconv.FormatFloat(ms(page.Stat.throttleTime), 'f', 3, 64),
+			strconv.FormatFloat(ms(page.Stat.slotTime), 'f', 3, 64),
+			extractedField(page.Extracted), page.Referrer, page.Source, strconv.Itoa(page.Depth), page.RequestID,
+			strconv.FormatFloat(ms(page.Stat.timing.DNS), 'f', 3, 64),
+			strconv.FormatFloat(ms(page.Stat.timing.Connect), 'f', 3, 64),
+			strconv.FormatFloat(ms(page.Stat.timing.TLS), 'f', 3, 64),
+			strconv.FormatFloat(ms(page.Stat.timing.TTFB), 'f', 3, 64),
+			strconv.FormatFloat(ms(page.Stat.timing.Body), 'f', 3, 64),
+			serverTimingField(page.Stat.serverTiming)})
+		s.csv.Flush()
+		s.err = s.csv.Error()
+	} else {
+		s.err = json.NewEncoder(s.w).Encode(toStreamedPage(page, err))
+	}
+	if s.err == nil {
+		s.err = s.w.Flush()
+	}
+	if s.err == nil && time.Since(s.lastSync) >= STREAM_SYNC_INTERVAL {
+		s.err = s.file.Sync()
+		s.lastSync = time.Now()
+	}
+}
+
+// Flushes and syncs the file to disk, returns the first error that occured writing it if any
+func (s *StreamWriter) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = s.w.Flush()
+	}
+	if s.err == nil {
+		s.err = s.file.Sync()
+		s.lastSync = time.Now()
+	}
+	return s.err
+}
+
+// Syncs and closes the file, returns the first error that occured writing it if any
+func (s *StreamWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = s.w.Flush()
+	}
+	if s.err == nil {
+		s.err = s.file.Sync()
+	}
+	if err := s.file.Close(); s.err == nil {
+		s.err = err
+	}
+	return s.err
+}
+
+// Returns the pages of an NDJSON stream, as written by a StreamWriter, in the order written.
+// A stream cut short by a killed crawl may end with a partial line, which is ignored.
+func ReadStream(r io.Reader) ([]streamedPage, error) {
+	var pages []streamedPage
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var page streamedPage
+		if err := json.Unmarshal(scanner.Bytes(), &page); err != nil {
+			if !scanner.Scan() {
+				break
+			}
+			return nil, fmt.Errorf("Malformed stream line (%d): %s", line, err)
+		}
+		pages = append(pages, page)
+	}
+	return pages, scanner.Err()
+}
+
+// Returns the pages of the NDJSON stream at path, see ReadStream
+func LoadStream(path string) ([]streamedPage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadStream(f)
+}
@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test that every page crawled is written to the stream before Close
+func TestStreamWriter_writesPagesAsNDJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-stream-")
+	if err != nil {
+		t.Fatalf("Failed to create stream directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pages.ndjson")
+
+	site := &SyntheticSite{Depth: 2, Branching: 3}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+	sink, err := NewStreamWriter(path)
+	if err != nil {
+		t.Fatalf("Failed to create stream: %s", err)
+	}
+	var c Crawler
+	c.Init(ts.URL)
+	c.sink = sink
+	c.Start()
+	c.Wait()
+
+	// Pages are on disk without closing the stream, as if the crawler had been killed
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %s", err)
+	}
+	defer f.Close()
+	streamed := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var page streamedPage
+		if err := json.Unmarshal(scanner.Bytes(), &page); err != nil {
+			t.Errorf("Malformed line in stream (%s): %s", scanner.Text(), err)
+		}
+		if page.URL == ts.URL && len(page.Children) != site.Branching {
+			t.Errorf("Expecting (%d) children for (%s), got (%d)", site.Branching, page.URL, len(page.Children))
+		}
+		streamed++
+	}
+	if streamed != site.Pages() {
+		t.Errorf("Expecting (%d) pages in the stream, got (%d)", site.Pages(), streamed)
+	}
+	if err := sink.Close(); err != nil {
+		t.Errorf("Failed to close stream: %s", err)
+	}
+}
+
+// Test that streams ending in .csv are written as CSV, errors included
+func TestStreamWriter_writesCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-stream-")
+	if err != nil {
+		t.Fatalf("Failed to create stream directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pages.csv")
+
+	sink, err := NewStreamWriter(path)
+	if err != nil {
+		t.Fatalf("Failed to create stream: %s", err)
+	}
+	sink.WritePage(CrawlPage{URL: "https://monzo.com", Children: []string{"https://monzo.com/about"}}, nil)
+	sink.WritePage(CrawlPage{URL: "https://monzo.com/about"}, HttpServerError("https://monzo.com/about"))
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Failed to close stream: %s", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %s", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Malformed CSV stream: %s", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expecting a header and (2) pages, got (%d) records", len(records))
+	}
+	if records[1][1] != "ok" || records[1][2] != "1" {
+		t.Errorf("Expecting (ok) with (1) child, got (%v)", records[1])
+	}
+	if records[2][1] != "server error" {
+		t.Errorf("Expecting (server error), got (%v)", records[2])
+	}
+}
+
+// A partial last line, left by a killed crawl, is ignored but a malformed line in the middle is not
+func TestReadStream(t *testing.T) {
+	stream := `{"url":"https://monzo.com","children":["https://monzo.com/about"]}
+{"url":"https://monzo.com/about","referrer":"https://monzo.com","depth":1}
+{"url":"https://monzo.com/te`
+	pages, err := ReadStream(strings.NewReader(stream))
+	if err != nil || len(pages) != 2 || pages[1].Referrer != "https://monzo.com" {
+		t.Errorf("Expecting 2 pages, got (%+v, %v)", pages, err)
+	}
+	if _, err := ReadStream(strings.NewReader("{\"url\":\n{}\n")); err == nil {
+		t.Errorf("Expecting a malformed line to be an error")
+	}
+}
@@ -0,0 +1,94 @@
+package crawler
+
+import (
+	"regexp"
+	"sort"
+)
+
+// --------------------
+// Analytics and tag managers
+// --------------------
+
+// Analytics, tag manager or marketing script, recognised by the URL it is loaded from
+type trackingTag struct {
+	Name string
+	src  *regexp.Regexp
+}
+
+// Tags detected on pages, see DetectTags
+var trackingTags = []trackingTag{
+	{"Google Tag Manager", regexp.MustCompile(`googletagmanager\.com/gtm\.js`)},
+	{"Google Analytics", regexp.MustCompile(`google-analytics\.com/(analytics|ga|urchin)\.js|googletagmanager\.com/gtag/js`)},
+	{"Segment", regexp.MustCompile(`cdn\.segment\.(com|io)/`)},
+	{"Facebook Pixel", regexp.MustCompile(`connect\.facebook\.net/.*/fbevents\.js`)},
+	{"Hotjar", regexp.MustCompile(`static\.hotjar\.com/`)},
+	{"Mixpanel", regexp.MustCompile(`cdn\.mxpnl\.com/|cdn\.mixpanel\.com/`)},
+	{"Adobe Experience Platform", regexp.MustCompile(`assets\.adobedtm\.com/`)},
+	{"LinkedIn Insight", regexp.MustCompile(`snap\.licdn\.com/li\.lms-analytics/`)},
+	{"HubSpot", regexp.MustCompile(`js\.hs-scripts\.com/|js\.hs-analytics\.net/`)},
+	{"Intercom", regexp.MustCompile(`widget\.intercom\.io/`)},
+	{"Plausible", regexp.MustCompile(`plausible\.io/js/`)},
+}
+
+// Captures the src of the scripts of a page
+var scriptExtractor, _ = ParseExtractor("scripts", "script@src")
+
+// Returns the names of the tags loaded by the given page, sorted
+func DetectTags(html []byte) []string {
+	var tags []string
+	srcs := scriptExtractor.Extract(html)
+	for _, tag := range trackingTags {
+		for _, src := range srcs {
+			if tag.src.MatchString(src) {
+				tags = append(tags, tag.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Pages carrying a tag and the HTML pages crawled without it
+type TagInventory struct {
+	Tag     string   `json:"tag"`
+	Pages   []string `json:"pages"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Returns the tags found on the pages crawled, sorted by name, with the pages that carry them
+// and those that do not. Pages missing a tag most others have are often forgotten templates.
+func (c *Crawler) tagInventory() []TagInventory {
+	byTag := make(map[string]*TagInventory)
+	var pages []string
+	c.tags.Range(func(k, v interface{}) bool {
+		pages = append(pages, k.(string))
+		for _, tag := range v.([]string) {
+			inv, present := byTag[tag]
+			if !present {
+				inv = &TagInventory{Tag: tag}
+				byTag[tag] = inv
+			}
+			inv.Pages = append(inv.Pages, k.(string))
+		}
+		return true
+	})
+	sort.Strings(pages)
+
+	inventory := make([]TagInventory, 0, len(byTag))
+	for _, inv := range byTag {
+		sort.Strings(inv.Pages)
+		carrying := make(map[string]bool, len(inv.Pages))
+		for _, p := range inv.Pages {
+			carrying[p] = true
+		}
+		for _, p := range pages {
+			if !carrying[p] {
+				inv.Missing = append(inv.Missing, p)
+			}
+		}
+		inventory = append(inventory, *inv)
+	}
+	sort.Slice(inventory, func(i, j int) bool { return inventory[i].Tag < inventory[j].Tag })
+	return inventory
+}
@@ -0,0 +1,53 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectTags(t *testing.T) {
+	html := []byte(`<script async src="https://www.googletagmanager.com/gtm.js?id=GTM-X"></script>
+		<script src='https://cdn.segment.com/analytics.js/v1/key/analytics.min.js'></script>
+		<script src="/app.js"></script><a href="https://static.hotjar.com/c/hotjar.js">Not a script</a>`)
+	if got := DetectTags(html); !reflect.DeepEqual(got, []string{"Google Tag Manager", "Segment"}) {
+		t.Errorf("Expecting ([Google Tag Manager Segment]), got (%v)", got)
+	}
+	if got := DetectTags([]byte(`<script>gtag('config')</script>`)); len(got) != 0 {
+		t.Errorf("Expecting no tags, got (%v)", got)
+	}
+}
+
+// Every page but /legal carries the tag manager
+func TestCrawlTags(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path != "/legal" {
+			io.WriteString(w, `<script src="https://www.googletagmanager.com/gtm.js?id=GTM-X"></script>`)
+		}
+		io.WriteString(w, `<a href="/about">About</a><a href="/legal">Legal</a>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.respectRobots = false
+	c.Run(context.Background())
+
+	want := []TagInventory{{Tag: "Google Tag Manager", Pages: []string{ts.URL, ts.URL + "/about"}, Missing: []string{ts.URL + "/legal"}}}
+	if got := c.tagInventory(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expecting (%+v), got (%+v)", want, got)
+	}
+
+	var report bytes.Buffer
+	c.WriteReport(&report)
+	if want := "Google Tag Manager: 2 of 3 pages\n    missing on " + ts.URL + "/legal"; !strings.Contains(report.String(), want) {
+		t.Errorf("Expecting (%s) in the report, got (%s)", want, report.String())
+	}
+}
@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// --------------------
+// URL templates
+// --------------------
+
+// Maximum number of templates listed in the report
+const MAX_REPORTED_TEMPLATES int = 20
+
+var uuidSegmentRe = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+var hashSegmentRe = regexp.MustCompile("^[0-9a-fA-F]{16,}$")
+var numericSegmentRe = regexp.MustCompile("^[0-9]+$")
+
+// Number of pages sharing a URL template
+type TemplateCount struct {
+	Template string `json:"template"`
+	Pages    int    `json:"pages"`
+}
+
+// Returns the template of the given URL: its path with identifiers replaced by placeholders,
+// and the names of its query parameters without their values, e.g.
+// https://monzo.com/blog/2019/42?utm_source=x&page=2 --> /blog/{id}/{id}?page=&utm_source=
+func urlTemplate(site string) string {
+	u, err := url.Parse(site)
+	if err != nil {
+		return site
+	}
+	segments := strings.Split(u.Path, "/")
+	for i, s := range segments {
+		switch {
+		case numericSegmentRe.MatchString(s):
+			segments[i] = "{id}"
+		case uuidSegmentRe.MatchString(s):
+			segments[i] = "{uuid}"
+		case hashSegmentRe.MatchString(s):
+			segments[i] = "{hash}"
+		}
+	}
+	template := strings.Join(segments, "/")
+	if len(template) == 0 {
+		template = "/"
+	}
+
+	query := u.Query()
+	if len(query) > 0 {
+		names := make([]string, 0, len(query))
+		for name := range query {
+			names = append(names, name+"=")
+		}
+		sort.Strings(names)
+		template += "?" + strings.Join(names, "&")
+	}
+	return template
+}
+
+// Returns the templates of the pages crawled, those matching most pages first
+func (res *CrawlResult) Templates() []TemplateCount {
+	counts := make(map[string]int)
+	for _, page := range res.Pages {
+		counts[urlTemplate(page.URL)]++
+	}
+	templates := make([]TemplateCount, 0, len(counts))
+	for template, n := range counts {
+		templates = append(templates, TemplateCount{Template: template, Pages: n})
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].Pages != templates[j].Pages {
+			return templates[i].Pages > templates[j].Pages
+		}
+		return templates[i].Template < templates[j].Template
+	})
+	return templates
+}
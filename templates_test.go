@@ -0,0 +1,35 @@
+package crawler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestURLTemplate(t *testing.T) {
+	tests := map[string]string{
+		"https://monzo.com":                                             "/",
+		"https://monzo.com/about":                                       "/about",
+		"https://monzo.com/blog/2019/42":                                "/blog/{id}/{id}",
+		"https://monzo.com/u/3f2504e0-4f89-11d3-9a0c-0305e82c3301/edit": "/u/{uuid}/edit",
+		"https://monzo.com/assets/9f86d081884c7d659a2feaa0c55ad015":     "/assets/{hash}",
+		"https://monzo.com/shop?size=m&color=red":                       "/shop?color=&size=",
+		"https://monzo.com/shop?color=blue&size=l":                      "/shop?color=&size=",
+		"https://monzo.com/v2/cards":                                    "/v2/cards",
+	}
+	for site, want := range tests {
+		if got := urlTemplate(site); got != want {
+			t.Errorf("Expecting (%s) for (%s), got (%s)", want, site, got)
+		}
+	}
+}
+
+func TestCrawlResult_Templates(t *testing.T) {
+	res := &CrawlResult{Pages: []CrawlPage{
+		{URL: "https://monzo.com/blog/1"}, {URL: "https://monzo.com/blog/2"}, {URL: "https://monzo.com/about"},
+		{URL: "https://monzo.com/shop?color=red"}, {URL: "https://monzo.com/shop?color=blue"}, {URL: "https://monzo.com/blog/3"},
+	}}
+	want := []TemplateCount{{"/blog/{id}", 3}, {"/shop?color=", 2}, {"/about", 1}}
+	if got := res.Templates(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expecting (%v), got (%v)", want, got)
+	}
+}
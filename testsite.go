@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --------------------
+// Synthetic site
+// --------------------
+
+// Generated site used to load test the crawler (testsite subcommand) and in tests.
+// Pages form a tree: "/" links to "/0" .. "/<Branching-1>", "/0" links to "/0/0" .. and so on
+// down to Depth. Every page also links back to "/".
+type SyntheticSite struct {
+
+	// Number of levels below "/"
+	Depth int
+
+	// Number of children of each page above Depth
+	Branching int
+
+	// Time taken to respond to each request
+	Latency time.Duration
+
+	// Fraction of pages responding with 500. Failing pages are chosen from a hash of their
+	// path so that the same pages fail on every run.
+	ErrorRate float64
+}
+
+// Returns the total number of pages of the site
+func (s *SyntheticSite) Pages() int {
+	total, level := 0, 1
+	for d := 0; d <= s.Depth; d++ {
+		total += level
+		level *= s.Branching
+	}
+	return total
+}
+
+// Returns true if the page at the given path responds with 500
+func (s *SyntheticSite) failing(path string) bool {
+	if path == "/" || s.ErrorRate <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	io.WriteString(h, path)
+	return float64(h.Sum32()%1000) < s.ErrorRate*1000
+}
+
+// Returns the depth of the page at the given path, or -1 if the site has no such page
+func (s *SyntheticSite) depth(path string) int {
+	if path == "/" {
+		return 0
+	}
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(segments) > s.Depth {
+		return -1
+	}
+	for _, segment := range segments {
+		if i, err := strconv.Atoi(segment); err != nil || i < 0 || i >= s.Branching {
+			return -1
+		}
+	}
+	return len(segments)
+}
+
+func (s *SyntheticSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(s.Latency)
+
+	path := r.URL.Path
+	d := s.depth(path)
+	if d < 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if s.failing(path) {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	io.WriteString(w, "<html>\n<body>\n    <a href=\"/\">Home</a>\n")
+	if d < s.Depth {
+		prefix := strings.TrimSuffix(path, "/")
+		for i := 0; i < s.Branching; i++ {
+			fmt.Fprintf(w, "    <a href=\"%s/%d\">Page %d</a>\n", prefix, i, i)
+		}
+	}
+	io.WriteString(w, "</body>\n</html>")
+}
@@ -0,0 +1,89 @@
+package crawler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns the status code and body of the given path on the site
+func get(site *SyntheticSite, path string) (int, string) {
+	w := httptest.NewRecorder()
+	site.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	return w.Code, string(body)
+}
+
+// Test that the number of pages accounts for every level of the tree
+func TestSyntheticSite_Pages(t *testing.T) {
+	site := SyntheticSite{Depth: 2, Branching: 3}
+	if n := site.Pages(); n != 1+3+9 {
+		t.Errorf("Expecting (13) pages, got (%d)", n)
+	}
+}
+
+// Test that pages link to their children and back home, and that pages outside the tree are not found
+func TestSyntheticSite_servesTree(t *testing.T) {
+	site := &SyntheticSite{Depth: 2, Branching: 2}
+
+	code, body := get(site, "/1")
+	if code != http.StatusOK {
+		t.Fatalf("Expecting /1 to be found, got (%d)", code)
+	}
+	links := urlStrings(FindRelativeLinks([]byte(body)))
+	if res := testArraysMatch(t, []string{"/1/0", "/1/1"}, links); res != 0 {
+		t.Errorf("Unexpected links on /1 %v", links)
+	}
+	if !strings.Contains(body, `href="/"`) {
+		t.Errorf("Expecting /1 to link home.")
+	}
+
+	_, body = get(site, "/1/0")
+	if links := urlStrings(FindRelativeLinks([]byte(body))); len(links) != 0 {
+		t.Errorf("Expecting the deepest pages to have no children, got %v", links)
+	}
+
+	for _, path := range []string{"/2", "/1/0/0", "/abc"} {
+		if code, _ := get(site, path); code != http.StatusNotFound {
+			t.Errorf("Expecting (%s) to be not found, got (%d)", path, code)
+		}
+	}
+}
+
+// Test that the same pages fail every time, in roughly the requested proportion
+func TestSyntheticSite_injectsErrorsDeterministically(t *testing.T) {
+	site := &SyntheticSite{Depth: 3, Branching: 10, ErrorRate: 0.2}
+	failing := 0
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			path := fmt.Sprintf("/%d/%d", i, j)
+			code, _ := get(site, path)
+			if again, _ := get(site, path); again != code {
+				t.Errorf("Expecting (%s) to respond the same on every request", path)
+			}
+			if code == http.StatusInternalServerError {
+				failing++
+			}
+		}
+	}
+	if failing < 5 || failing > 40 {
+		t.Errorf("Expecting around 20 of 100 pages to fail, got (%d)", failing)
+	}
+	if code, _ := get(site, "/"); code != http.StatusOK {
+		t.Errorf("Expecting the home page to never fail, got (%d)", code)
+	}
+}
+
+// Test that the site takes at least Latency to respond
+func TestSyntheticSite_latency(t *testing.T) {
+	site := &SyntheticSite{Depth: 1, Branching: 1, Latency: 50 * time.Millisecond}
+	start := time.Now()
+	get(site, "/")
+	if elapsed := time.Since(start); elapsed < site.Latency {
+		t.Errorf("Expecting a response after at least (%s), got it after (%s)", site.Latency, elapsed)
+	}
+}
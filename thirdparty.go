@@ -0,0 +1,118 @@
+package crawler
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// --------------------
+// Third-party domains
+// --------------------
+
+// How a page references an external domain, see outboundDomains
+const (
+	REF_SCRIPT = "script" // <script src>
+	REF_IFRAME = "iframe" // <iframe src>
+	REF_LINK   = "link"   // <a href> and <link href>, stylesheets, fonts, preconnects..
+)
+
+var scriptSrcRe = regexp.MustCompile("(?i)<script[^>]*\\ssrc\\s*=\\s*[\"']([^\"']+)[\"']")
+
+// Find the src of all scripts loaded by the given html, as written in the HTML
+func FindScriptSources(html []byte) []string {
+	const captureGroup int = 1
+	var b []string
+	for _, x := range findCaptures(scriptSrcRe, html, captureGroup) {
+		b = append(b, string(x))
+	}
+	return b
+}
+
+// External domain and the pages referencing it, see Crawler.thirdPartyDomains
+type ThirdPartyDomain struct {
+	Domain string `json:"domain"`
+
+	// How it is referenced, sorted, see REF_SCRIPT and others
+	Kinds []string `json:"kinds"`
+
+	Pages int `json:"pages"`
+}
+
+// Returns the domains outside the crawl the given page references and how, sorted.
+// Scripts and iframes are loaded by browsers, links only when followed.
+// "https://monzo.com" --> {"cdn.segment.com": ["script"], "twitter.com": ["link"]}
+func (c *Crawler) outboundDomains(page string, html []byte) map[string][]string {
+	domains := make(map[string][]string)
+	add := func(kind string, link string) {
+		u, err := url.Parse(c.resolveLink(page, link))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 || c.scope.Matches(u) {
+			return
+		}
+		domain := strings.ToLower(u.Hostname())
+		for _, k := range domains[domain] {
+			if k == kind {
+				return
+			}
+		}
+		domains[domain] = append(domains[domain], kind)
+	}
+	for _, src := range FindScriptSources(html) {
+		add(REF_SCRIPT, src)
+	}
+	for _, src := range FindFrameSources(html) {
+		add(REF_IFRAME, src)
+	}
+	for _, u := range findExternalLinks(html, c.localLinks) {
+		add(REF_LINK, u.String())
+	}
+	for _, tag := range linkTagRe.FindAll(html, -1) {
+		if href := linkHrefRe.FindSubmatch(tag); href != nil {
+			add(REF_LINK, string(href[1]))
+		}
+	}
+	for _, kinds := range domains {
+		sort.Strings(kinds)
+	}
+	return domains
+}
+
+// Returns the external domains referenced by the pages crawled, those referenced by the most
+// pages first. Only crawled pages are counted, a domain referenced by all of them is likely
+// in the layout of the site.
+func (c *Crawler) thirdPartyDomains() []ThirdPartyDomain {
+	byDomain := make(map[string]*ThirdPartyDomain)
+	c.outbound.Range(func(k, v interface{}) bool {
+		for domain, kinds := range v.(map[string][]string) {
+			d, present := byDomain[domain]
+			if !present {
+				d = &ThirdPartyDomain{Domain: domain}
+				byDomain[domain] = d
+			}
+			d.Pages++
+			for _, kind := range kinds {
+				found := false
+				for _, k := range d.Kinds {
+					found = found || k == kind
+				}
+				if !found {
+					d.Kinds = append(d.Kinds, kind)
+				}
+			}
+		}
+		return true
+	})
+	domains := make([]ThirdPartyDomain, 0, len(byDomain))
+	for _, d := range byDomain {
+		sort.Strings(d.Kinds)
+		domains = append(domains, *d)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		if domains[i].Pages != domains[j].Pages {
+			return domains[i].Pages > domains[j].Pages
+		}
+		return domains[i].Domain < domains[j].Domain
+	})
+	return domains
+}
@@ -0,0 +1,57 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindScriptSources(t *testing.T) {
+	html := []byte(`<script>var x = 1</script><SCRIPT async src="https://cdn.segment.com/a.js"></SCRIPT><script src='/app.js'></script>`)
+	if got := FindScriptSources(html); !reflect.DeepEqual(got, []string{"https://cdn.segment.com/a.js", "/app.js"}) {
+		t.Errorf("Expecting ([https://cdn.segment.com/a.js /app.js]), got (%v)", got)
+	}
+}
+
+func TestCrawlThirdParties(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<html><head><script src="https://www.googletagmanager.com/gtm.js"></script>
+			<link rel="stylesheet" href="https://fonts.googleapis.com/css"><script src="/app.js"></script></head>
+			<a href="/about">About</a>`)
+		if r.URL.Path == "/about" {
+			io.WriteString(w, `<iframe src="https://www.youtube.com/embed/x"></iframe><a href="https://twitter.com/monzo">Twitter</a>`)
+		}
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.respectRobots = false
+	res, _ := c.Run(context.Background())
+
+	want := map[string][]string{"www.googletagmanager.com": {REF_SCRIPT}, "fonts.googleapis.com": {REF_LINK},
+		"www.youtube.com": {REF_IFRAME}, "twitter.com": {REF_LINK}}
+	for _, page := range res.Pages {
+		if page.URL == ts.URL+"/about" && !reflect.DeepEqual(page.OutboundDomains, want) {
+			t.Errorf("Expecting (%v), got (%v)", want, page.OutboundDomains)
+		}
+	}
+
+	domains := c.thirdPartyDomains()
+	if len(domains) != 4 || domains[0].Domain != "fonts.googleapis.com" || domains[0].Pages != 2 ||
+		domains[1].Domain != "www.googletagmanager.com" || domains[1].Pages != 2 {
+		t.Errorf("Expecting the domains of the layout first, referenced by both pages, got (%+v)", domains)
+	}
+
+	var report bytes.Buffer
+	c.WriteReport(&report)
+	if want := "www.googletagmanager.com: 2 pages (script)"; !strings.Contains(report.String(), want) {
+		t.Errorf("Expecting (%s) in the report, got (%s)", want, report.String())
+	}
+}
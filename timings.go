@@ -0,0 +1,126 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"time"
+)
+
+// --------------------
+// Request timings
+// --------------------
+
+// Number of slowest pages listed with their timings in the report
+const MAX_REPORTED_TIMINGS int = 10
+
+// Where the time of a request went, so that slow pages can be put down to the network
+// (DNS, Connect, TLS), the server (TTFB) or the size of the page (Body).
+// Phases of requests redirected are added up, those of reused connections are zero.
+type FetchTiming struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+
+	// From the request being written to the first byte of the response
+	TTFB time.Duration
+
+	// From the first byte of the response to the last
+	Body time.Duration
+}
+
+// Returns true if none of the phases were timed, e.g. the fetcher does not trace requests
+func (t FetchTiming) IsZero() bool {
+	return t == FetchTiming{}
+}
+
+// Records the phases of a request from the callbacks of an httptrace.ClientTrace
+type fetchTracer struct {
+	mu     sync.Mutex
+	timing FetchTiming
+
+	dnsStart, tlsStart, wrote, firstByte time.Time
+
+	// Connections may be dialled to several addresses at once
+	connectStart map[string]time.Time
+}
+
+// Returns the ClientTrace recording into t
+func (t *fetchTracer) clientTrace() *httptrace.ClientTrace {
+	// Runs f holding the lock, callbacks may be called from other goroutines
+	locked := func(f func()) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		f()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { locked(func() { t.dnsStart = time.Now() }) },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			locked(func() { t.timing.DNS += time.Since(t.dnsStart) })
+		},
+		ConnectStart: func(network, addr string) {
+			locked(func() { t.connectStart[network+addr] = time.Now() })
+		},
+		ConnectDone: func(network, addr string, err error) {
+			locked(func() {
+				if err == nil {
+					t.timing.Connect += time.Since(t.connectStart[network+addr])
+				}
+			})
+		},
+		TLSHandshakeStart: func() { locked(func() { t.tlsStart = time.Now() }) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			locked(func() { t.timing.TLS += time.Since(t.tlsStart) })
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { locked(func() { t.wrote = time.Now() }) },
+		GotFirstResponseByte: func() {
+			locked(func() {
+				t.firstByte = time.Now()
+				t.timing.TTFB += t.firstByte.Sub(t.wrote)
+			})
+		},
+	}
+}
+
+// Returns the timings recorded, the body of the response having been read in full
+func (t *fetchTracer) done() FetchTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.firstByte.IsZero() {
+		t.timing.Body = time.Since(t.firstByte)
+	}
+	return t.timing
+}
+
+func newFetchTracer() *fetchTracer {
+	return &fetchTracer{connectStart: make(map[string]time.Time)}
+}
+
+// Timings of a page, see slowestTimings
+type pageTiming struct {
+	URL    string
+	Timing FetchTiming
+}
+
+// Returns the n pages whose requests took the longest, with their timings
+func (c *Crawler) slowestTimings(n int) []pageTiming {
+	var timings []pageTiming
+	c.stats.Range(func(k, v interface{}) bool {
+		if stat := v.(CrawlStat); !stat.timing.IsZero() {
+			timings = append(timings, pageTiming{URL: k.(string), Timing: stat.timing})
+		}
+		return true
+	})
+	total := func(t FetchTiming) time.Duration { return t.DNS + t.Connect + t.TLS + t.TTFB + t.Body }
+	sort.Slice(timings, func(i, j int) bool {
+		if ti, tj := total(timings[i].Timing), total(timings[j].Timing); ti != tj {
+			return ti > tj
+		}
+		return timings[i].URL < timings[j].URL
+	})
+	if len(timings) > n {
+		timings = timings[:n]
+	}
+	return timings
+}
@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Time spent by the server before answering is TTFB, time spent sending the page is body
+func TestHTTPFetcher_Trace(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		io.WriteString(w, "<html>")
+		w.(http.Flusher).Flush()
+		time.Sleep(30 * time.Millisecond)
+		io.WriteString(w, "</html>")
+	}))
+	defer ts.Close()
+
+	res, err := (&HTTPFetcher{Trace: true}).Fetch(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to fetch: %s", err)
+	}
+	timing := res.Timing
+	if timing.TTFB < 30*time.Millisecond || timing.Body < 30*time.Millisecond || timing.Connect <= 0 || timing.TLS != 0 {
+		t.Errorf("Expecting TTFB and body of at least 30ms over a new plain connection, got (%+v)", timing)
+	}
+
+	res, err = (&HTTPFetcher{}).Fetch(ts.URL)
+	if err != nil || !res.Timing.IsZero() {
+		t.Errorf("Expecting no timings without Trace, got (%+v, %v)", res.Timing, err)
+	}
+}
+
+func TestCrawlTimings(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		io.WriteString(w, `<html><a href="/slow">Slow</a></html>`)
+	}))
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.traceTimings = true
+	c.Run(context.Background())
+
+	slowest := c.slowestTimings(1)
+	if len(slowest) != 1 || slowest[0].URL != ts.URL+"/slow" || slowest[0].Timing.TTFB < 50*time.Millisecond {
+		t.Fatalf("Expecting (%s) to be the slowest, got (%+v)", ts.URL+"/slow", slowest)
+	}
+	var report bytes.Buffer
+	c.WriteReport(&report)
+	if !strings.Contains(report.String(), "Slowest requests") || !strings.Contains(report.String(), ts.URL+"/slow: DNS") {
+		t.Errorf("Expecting the report to list the timings of (%s), got (%s)", ts.URL+"/slow", report.String())
+	}
+}
@@ -0,0 +1,85 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// --------------------
+// Safe crawling
+// --------------------
+
+// The crawler only ever issues GET and HEAD requests, which must not change anything on the
+// site crawled. Sites do not always honour that, so links whose URL contains an obvious
+// state-changing verb (trap words) are not followed either unless told otherwise:
+//
+//	-trapwords ""                    follow every link
+//	-trapwords logout,delete,archive replace the default words
+//	-filters scope,suffix,pattern    or drop the "trap" filter altogether
+//
+// Logged-in sessions are the ones at risk, a stray /logout ends the session and a /delete?id=
+// destroys data. URLs known to be dangerous can also be listed with -blocklist.
+
+// Words of URLs not followed unless told otherwise, see isTrap
+var DEFAULT_TRAP_WORDS = []string{"logout", "logoff", "signout", "delete", "remove", "destroy", "unsubscribe"}
+
+var urlWordSeparatorRe = regexp.MustCompile("[^a-z0-9]+")
+
+type UnsafeMethod string
+
+func (e UnsafeMethod) Error() string {
+	return fmt.Sprintf("Refusing to send a (%s) request, only GET and HEAD are allowed", string(e))
+}
+
+// RoundTripper refusing requests that may change state on the server, so that no code path
+// of the crawler can ever send one
+type safeTransport struct {
+	next http.RoundTripper
+}
+
+func (t safeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "" && req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return nil, UnsafeMethod(req.Method)
+	}
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
+
+// Returns true if the path or query of site contains one of the given words, case insensitive.
+// Words may be split by a separator, e.g. for "logout" https://monzo.com/log-out?next=/ is a trap
+// but https://monzo.com/blog/logouts-explained is not.
+func isTrap(site string, words []string) bool {
+	if len(words) == 0 {
+		return false
+	}
+	u, err := url.Parse(site)
+	if err != nil {
+		return false
+	}
+	parts := urlWordSeparatorRe.Split(strings.ToLower(u.RequestURI()), -1)
+	for i, part := range parts {
+		for _, trap := range words {
+			if part == trap || (i+1 < len(parts) && part+parts[i+1] == trap) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the lowercase words of the given comma separated list
+func parseTrapWords(words string) []string {
+	var parsed []string
+	for _, w := range strings.Split(words, ",") {
+		if w = strings.ToLower(strings.TrimSpace(w)); len(w) > 0 {
+			parsed = append(parsed, w)
+		}
+	}
+	return parsed
+}
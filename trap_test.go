@@ -0,0 +1,60 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestIsTrap(t *testing.T) {
+	tests := map[string]bool{
+		"https://monzo.com/logout":                  true,
+		"https://monzo.com/account/Log-Out?next=/":  true,
+		"https://monzo.com/cards?action=delete&id=": true,
+		"https://monzo.com/cart/remove/42":          true,
+		"https://monzo.com/blog/logouts-explained":  false,
+		"https://monzo.com/removals":                false,
+		"https://monzo.com/about":                   false,
+	}
+	for site, want := range tests {
+		if got := isTrap(site, DEFAULT_TRAP_WORDS); got != want {
+			t.Errorf("Expecting (%v) for (%s), got (%v)", want, site, got)
+		}
+	}
+	if isTrap("https://monzo.com/logout", nil) {
+		t.Errorf("Expecting no trap without words")
+	}
+	if words := parseTrapWords(" Logout, ,archive"); len(words) != 2 || words[0] != "logout" || words[1] != "archive" {
+		t.Errorf("Expecting ([logout archive]), got (%v)", words)
+	}
+}
+
+func TestSafeTransport(t *testing.T) {
+	var methods []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: safeTransport{}}
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		req, _ := http.NewRequest(method, ts.URL, nil)
+		if res, err := client.Do(req); err != nil {
+			t.Errorf("Expecting (%s) to be sent, got (%v)", method, err)
+		} else {
+			res.Body.Close()
+		}
+	}
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch} {
+		req, _ := http.NewRequest(method, ts.URL, strings.NewReader("x"))
+		_, err := client.Do(req)
+		if e, ok := err.(*url.Error); !ok || e.Err != UnsafeMethod(method) {
+			t.Errorf("Expecting (%s) to be refused, got (%v)", method, err)
+		}
+	}
+	if len(methods) != 2 {
+		t.Errorf("Expecting only GET and HEAD to reach the server, got (%v)", methods)
+	}
+}
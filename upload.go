@@ -0,0 +1,280 @@
+package crawler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --------------------
+// Bucket uploads
+// --------------------
+
+// Region of S3 buckets unless AWS_REGION or AWS_DEFAULT_REGION say otherwise
+const DEFAULT_S3_REGION = "us-east-1"
+
+// Endpoint of Google Cloud Storage, whose XML API accepts the same PUT requests as S3
+const GCS_ENDPOINT = "https://storage.googleapis.com"
+
+type UploadFailed struct {
+	Location string
+	Status   int
+	Message  string
+}
+
+func (e UploadFailed) Error() string {
+	return fmt.Sprintf("Upload to (%s) failed with status (%d): %s", e.Location, e.Status, e.Message)
+}
+
+// Uploads an output to an object of an S3 or GCS bucket, s3://bucket/key or gs://bucket/key.
+// Credentials are read from the environment, as set up for containers by their platform:
+//
+//	S3:  AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN (optional), AWS_REGION,
+//	     AWS_ENDPOINT_URL_S3 for S3 compatible stores (e.g. http://localhost:9000 for MinIO)
+//	GCS: GOOGLE_OAUTH_ACCESS_TOKEN, e.g. from gcloud auth print-access-token,
+//	     STORAGE_EMULATOR_HOST for the emulator
+type bucketUploader struct {
+	location string
+	scheme   string
+	bucket   string
+	key      string
+
+	// Base URL objects are put under as /bucket/key, empty for the default of the store
+	endpoint string
+
+	// S3 credentials, requests are signed with AWS Signature Version 4
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+
+	// GCS OAuth access token
+	token string
+
+	client *http.Client
+}
+
+// Returns true if location is an s3:// or gs:// URL
+func isBucketURL(location string) bool {
+	return strings.HasPrefix(location, "s3://") || strings.HasPrefix(location, "gs://")
+}
+
+// Returns the uploader of the object at location, reading credentials with getenv
+func newBucketUploader(location string, getenv func(string) string) (*bucketUploader, error) {
+	u, err := url.Parse(location)
+	if err != nil || len(u.Host) == 0 || len(strings.TrimPrefix(u.Path, "/")) == 0 {
+		return nil, fmt.Errorf("Invalid bucket URL (%s), expecting s3://bucket/key or gs://bucket/key", location)
+	}
+	up := &bucketUploader{location: location, scheme: u.Scheme, bucket: u.Host, key: strings.TrimPrefix(u.Path, "/"),
+		client: &http.Client{Timeout: 5 * time.Minute}}
+
+	switch u.Scheme {
+	case "s3":
+		up.accessKey, up.secretKey = getenv("AWS_ACCESS_KEY_ID"), getenv("AWS_SECRET_ACCESS_KEY")
+		if len(up.accessKey) == 0 || len(up.secretKey) == 0 {
+			return nil, fmt.Errorf("Uploading to (%s) needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY", location)
+		}
+		up.sessionToken = getenv("AWS_SESSION_TOKEN")
+		up.region = DEFAULT_S3_REGION
+		for _, name := range []string{"AWS_DEFAULT_REGION", "AWS_REGION"} {
+			if region := getenv(name); len(region) > 0 {
+				up.region = region
+			}
+		}
+		up.endpoint = strings.TrimSuffix(getenv("AWS_ENDPOINT_URL_S3"), "/")
+	case "gs":
+		if host := getenv("STORAGE_EMULATOR_HOST"); len(host) > 0 {
+			if !strings.Contains(host, "://") {
+				host = "http://" + host
+			}
+			up.endpoint = strings.TrimSuffix(host, "/")
+		} else if up.token = getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); len(up.token) == 0 {
+			return nil, fmt.Errorf("Uploading to (%s) needs GOOGLE_OAUTH_ACCESS_TOKEN", location)
+		} else {
+			up.endpoint = GCS_ENDPOINT
+		}
+	}
+	// Tokens sent in headers must never reach the logs, the secret key is only used to sign
+	if len(up.sessionToken) > 0 {
+		redactor.AddHeader("X-Amz-Security-Token", up.sessionToken)
+	}
+	if len(up.token) > 0 {
+		redactor.AddHeader("Authorization", "Bearer "+up.token)
+	}
+	return up, nil
+}
+
+// Returns the URL the object is put at
+func (up *bucketUploader) objectURL() string {
+	key := awsURIEncode(up.key, false)
+	if len(up.endpoint) > 0 {
+		return up.endpoint + "/" + up.bucket + "/" + key
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", up.bucket, up.region, key)
+}
+
+// Puts the size bytes of body in the object
+func (up *bucketUploader) Upload(body io.Reader, size int64) error {
+	req, err := http.NewRequest(http.MethodPut, up.objectURL(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	contentType := mime.TypeByExtension(path.Ext(strings.TrimSuffix(up.key, ".gz")))
+	if len(contentType) == 0 {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", contentType)
+	if strings.HasSuffix(up.key, ".gz") {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	switch {
+	case up.scheme == "s3":
+		if len(up.sessionToken) > 0 {
+			req.Header.Set("X-Amz-Security-Token", up.sessionToken)
+		}
+		// The body is streamed from disk, hashing it would mean reading it twice
+		signV4(req, "UNSIGNED-PAYLOAD", up.accessKey, up.secretKey, up.region, "s3", time.Now())
+	case len(up.token) > 0:
+		req.Header.Set("Authorization", "Bearer "+up.token)
+	}
+
+	res, err := up.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return UploadFailed{Location: up.location, Status: res.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return nil
+}
+
+// Returns s escaped as AWS expects in canonical requests: everything but unreserved
+// characters, and slashes unless encodeSlash is set
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || (ch == '/' && !encodeSlash) {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Signs req with AWS Signature Version 4, covering its host and every header it has.
+// payloadHash is the hex SHA-256 of the body, or UNSIGNED-PAYLOAD.
+func signV4(req *http.Request, payloadHash string, accessKey string, secretKey string, region string, service string, now time.Time) {
+	now = now.UTC()
+	amzDate, day := now.Format("20060102T150405Z"), now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			params = append(params, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+
+	uri := req.URL.EscapedPath()
+	if len(uri) == 0 {
+		uri = "/"
+	}
+	canonical := strings.Join([]string{req.Method, uri, strings.Join(params, "&"),
+		canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	hash := sha256.Sum256([]byte(canonical))
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// Output written to a temporary file, uploaded to its bucket on commit
+type bucketOutput struct {
+	*os.File
+	upload *bucketUploader
+}
+
+// Returns a bucketOutput uploading to location once committed
+func createBucketOutput(location string) (*bucketOutput, error) {
+	up, err := newBucketUploader(location, os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile("", "crawl-output-")
+	if err != nil {
+		return nil, err
+	}
+	return &bucketOutput{File: f, upload: up}, nil
+}
+
+// Uploads what was written, then removes the temporary file
+func (o *bucketOutput) Commit() error {
+	defer os.Remove(o.Name())
+	defer o.Close()
+	size, err := o.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = o.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = o.upload.Upload(o.File, size)
+	}
+	return err
+}
+
+// Discards what was written, nothing is uploaded
+func (o *bucketOutput) Abort() error {
+	o.Close()
+	return os.Remove(o.Name())
+}
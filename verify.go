@@ -0,0 +1,136 @@
+package crawler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------
+// Domain verification
+// --------------------
+
+// Path of the file proving ownership of a site
+const VERIFICATION_FILE = "/.well-known/crawler-verification.txt"
+
+// Prefix of the DNS TXT record proving ownership of a domain
+const VERIFICATION_TXT_PREFIX = "crawler-verification="
+
+// Time a successful verification is trusted for
+const VERIFICATION_TTL = time.Hour
+
+type DomainNotVerified string
+
+func (e DomainNotVerified) Error() string {
+	return fmt.Sprintf("Ownership of domain (%s) is not verified, see /verify?domain=%s", string(e), string(e))
+}
+
+// Checks that whoever submits a crawl owns the domain, so that a hosted server cannot be used
+// to hammer third-party sites. Owners prove it with the token of their API key for the domain,
+// either in a DNS TXT record or in a file served at VERIFICATION_FILE.
+type DomainVerifier struct {
+	mu sync.Mutex
+
+	// Secret tokens are derived from
+	secret []byte
+
+	// When each domain was last verified, by API key
+	verified map[ownedDomain]time.Time
+
+	// Looks up TXT records, net.LookupTXT unless testing
+	lookupTXT func(name string) ([]string, error)
+
+	client *http.Client
+}
+
+// Returns a DomainVerifier deriving tokens from the given secret
+func NewDomainVerifier(secret string) *DomainVerifier {
+	return &DomainVerifier{secret: []byte(secret), verified: make(map[ownedDomain]time.Time),
+		lookupTXT: net.LookupTXT, client: &http.Client{Timeout: 10 * time.Second, Transport: safeTransport{}}}
+}
+
+// Domain verified for the API key of the given name
+type ownedDomain struct {
+	key    string
+	domain string
+}
+
+// Returns the token proving ownership of domain by the API key of the given name, empty when
+// serving without keys. Each key has its own token, so that a domain proven by one key cannot be
+// crawled with another.
+func (v *DomainVerifier) Token(key string, domain string) string {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte(key))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strings.ToLower(domain)))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// Returns true if the DNS TXT records of the domain, or of _crawler-verification.<domain>, hold the token
+func (v *DomainVerifier) verifyTXT(domain string, token string) bool {
+	for _, name := range []string{"_crawler-verification." + domain, domain} {
+		records, err := v.lookupTXT(name)
+		if err != nil {
+			continue
+		}
+		for _, r := range records {
+			if strings.TrimSpace(r) == VERIFICATION_TXT_PREFIX+token {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns true if the verification file of the site holds the token.
+// Redirects are not followed, the file must be served by the site itself.
+func (v *DomainVerifier) verifyFile(u *url.URL, token string) bool {
+	client := *v.client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	res, err := client.Get(u.Scheme + "://" + u.Host + VERIFICATION_FILE)
+	if err != nil {
+		return false
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return false
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+	return err == nil && strings.TrimSpace(string(body)) == token
+}
+
+// Returns nil if ownership of the domain of site by the API key of the given name is verified,
+// DomainNotVerified otherwise
+func (v *DomainVerifier) Verify(key string, site string) error {
+	u, err := url.Parse(site)
+	if err != nil {
+		return InvalidURL(site)
+	}
+	domain := strings.ToLower(u.Hostname())
+	owned := ownedDomain{key: key, domain: domain}
+
+	v.mu.Lock()
+	at, ok := v.verified[owned]
+	v.mu.Unlock()
+	if ok && time.Since(at) < VERIFICATION_TTL {
+		return nil
+	}
+
+	token := v.Token(key, domain)
+	if !v.verifyTXT(domain, token) && !v.verifyFile(u, token) {
+		return DomainNotVerified(domain)
+	}
+	v.mu.Lock()
+	v.verified[owned] = time.Now()
+	v.mu.Unlock()
+	return nil
+}
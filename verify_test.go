@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDomainVerifier_txt(t *testing.T) {
+	v := NewDomainVerifier("secret")
+	records := map[string][]string{}
+	v.lookupTXT = func(name string) ([]string, error) {
+		if r, ok := records[name]; ok {
+			return r, nil
+		}
+		return nil, fmt.Errorf("No TXT record for (%s)", name)
+	}
+	// No verification file anywhere
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	v.client.Transport = &http.Transport{Proxy: func(*http.Request) (*url.URL, error) { return url.Parse(ts.URL) }}
+
+	if err := v.Verify("ci", "https://owned.example/page"); err != DomainNotVerified("owned.example") {
+		t.Errorf("Expecting the domain not to be verified without a record, got (%v)", err)
+	}
+	records["_crawler-verification.owned.example"] = []string{"v=spf1", VERIFICATION_TXT_PREFIX + v.Token("ci", "owned.example")}
+	if err := v.Verify("ci", "https://owned.example/page"); err != nil {
+		t.Errorf("Expecting the domain to be verified by its TXT record, got (%v)", err)
+	}
+	records["other.example"] = []string{VERIFICATION_TXT_PREFIX + v.Token("ci", "owned.example")}
+	if err := v.Verify("ci", "https://other.example"); err == nil {
+		t.Errorf("Expecting the token of another domain not to verify (other.example)")
+	}
+	// The domain is only proven for the key whose token is in the record
+	if err := v.Verify("intruder", "https://owned.example/page"); err != DomainNotVerified("owned.example") {
+		t.Errorf("Expecting the domain not to be verified for another key, got (%v)", err)
+	}
+}
+
+func TestDomainVerifier_file(t *testing.T) {
+	v := NewDomainVerifier("secret")
+	v.lookupTXT = func(name string) ([]string, error) { return nil, fmt.Errorf("No TXT record for (%s)", name) }
+	var token string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == VERIFICATION_FILE && len(token) > 0 {
+			fmt.Fprintln(w, token)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	q := NewJobQueue(1, 0)
+	q.Verifier = v
+	if _, err := q.Submit(ts.URL, Quota{}); err == nil {
+		t.Errorf("Expecting submitting an unverified domain to fail")
+	}
+	u, _ := url.Parse(ts.URL)
+	token = v.Token("ci", u.Hostname())
+	if job, err := q.SubmitAs("ci", ts.URL, Quota{}); err != nil {
+		t.Errorf("Expecting the domain to be verified by its file, got (%v)", err)
+	} else {
+		waitForJob(t, q, job.ID)
+	}
+	if _, err := q.SubmitAs("intruder", ts.URL, Quota{}); err == nil {
+		t.Errorf("Expecting the domain verified by (ci) not to be verified for (intruder)")
+	}
+}
+
+// Jobs of verified domains neither fetch the sitemaps robots.txt lists on other sites
+// nor follow redirects to them
+func TestJobQueue_verifiedStaysLocal(t *testing.T) {
+	var foreignRequests int32
+	foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&foreignRequests, 1)
+		fmt.Fprintf(w, "<urlset><url><loc>%s/page</loc></url></urlset>", "http://"+r.Host)
+	}))
+	defer foreign.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nSitemap: %s/sitemap.xml\n", foreign.URL)
+		case "/moved":
+			http.Redirect(w, r, foreign.URL+"/landing", http.StatusMovedPermanently)
+		default:
+			io.WriteString(w, `<html><a href="/moved">Moved</a></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	v := NewDomainVerifier("secret")
+	v.lookupTXT = func(name string) ([]string, error) {
+		return []string{VERIFICATION_TXT_PREFIX + v.Token("", "127.0.0.1")}, nil
+	}
+	q := NewJobQueue(1, 0)
+	q.Verifier = v
+	q.Options = []Option{WithSitemaps(true), WithProbeNotFound(false)}
+	job, err := q.Submit(ts.URL, Quota{})
+	if err != nil {
+		t.Fatalf("Expecting the domain to be verified, got (%v)", err)
+	}
+	waitForJob(t, q, job.ID)
+	if n := atomic.LoadInt32(&foreignRequests); n != 0 {
+		t.Errorf("Expecting no requests to the foreign site, got (%d)", n)
+	}
+	res := q.crawler("", job.ID).Result()
+	if _, refused := res.Errors[ts.URL+"/moved"].(OffScopeRedirect); !refused {
+		t.Errorf("Expecting the redirect of (/moved) to be refused, got (%v)", res.Errors[ts.URL+"/moved"])
+	}
+}
@@ -0,0 +1,144 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------
+// Crawl windows
+// --------------------
+
+// Time of day during which pages are fetched, e.g. 01:00-05:00 in the time zone of the site.
+// Outside of it the crawl pauses, pages found waiting in memory, and resumes when it reopens.
+// A window ending before it starts spans midnight, e.g. 22:00-02:00.
+type CrawlWindow struct {
+	// Times of day the window opens and closes, since midnight
+	Start time.Duration
+	End   time.Duration
+
+	Location *time.Location
+
+	mu sync.Mutex
+
+	// True while paused, so that the pause is logged and checkpointed once
+	paused bool
+}
+
+// Returns the time of day of a HH:MM string, since midnight
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("Invalid time of day (%s), expecting HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Returns the window of the given HH:MM-HH:MM string in the given IANA time zone, e.g. Europe/London
+func ParseCrawlWindow(window string, zone string) (*CrawlWindow, error) {
+	bounds := strings.Split(window, "-")
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("Invalid crawl window (%s), expecting HH:MM-HH:MM", window)
+	}
+	start, err := parseTimeOfDay(bounds[0])
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTimeOfDay(bounds[1])
+	if err != nil {
+		return nil, err
+	}
+	if start == end {
+		return nil, fmt.Errorf("Invalid crawl window (%s), it opens and closes at the same time", window)
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid time zone (%s): %s", zone, err)
+	}
+	return &CrawlWindow{Start: start, End: end, Location: loc}, nil
+}
+
+// Returns the time of t since midnight, in the time zone of the window
+func (w *CrawlWindow) timeOfDay(t time.Time) time.Duration {
+	t = t.In(w.Location)
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+}
+
+// Returns true if the window is open at t
+func (w *CrawlWindow) Open(t time.Time) bool {
+	day := w.timeOfDay(t)
+	if w.Start < w.End {
+		return day >= w.Start && day < w.End
+	}
+	return day >= w.Start || day < w.End
+}
+
+// Returns the next time the window opens after t, t itself if it is open
+func (w *CrawlWindow) NextOpen(t time.Time) time.Time {
+	if w.Open(t) {
+		return t
+	}
+	wait := w.Start - w.timeOfDay(t)
+	if wait < 0 {
+		wait += 24 * time.Hour
+	}
+	return t.Add(wait)
+}
+
+// Blocks until the window is open or ctx is done, returns false if it is. checkpoint is called
+// once when the crawl pauses, so that what was crawled so far is on disk during the pause.
+func (w *CrawlWindow) wait(ctx context.Context, checkpoint func()) bool {
+	for {
+		now := time.Now()
+		if w.Open(now) {
+			w.mu.Lock()
+			if w.paused {
+				w.paused = false
+				log.Printf("Crawl window open, resuming the crawl.\n")
+			}
+			w.mu.Unlock()
+			return true
+		}
+
+		w.mu.Lock()
+		if !w.paused {
+			w.paused = true
+			log.Printf("Crawl window closed, pausing the crawl until %s.\n", w.NextOpen(now).In(w.Location).Format(time.RFC3339))
+			if checkpoint != nil {
+				checkpoint()
+			}
+		}
+		w.mu.Unlock()
+
+		// Check again at least every minute, the clock may change under us (DST, suspend)
+		sleep := w.NextOpen(now).Sub(now)
+		if sleep > time.Minute {
+			sleep = time.Minute
+		}
+		if ctx == nil {
+			time.Sleep(sleep)
+			continue
+		}
+		timer := time.NewTimer(sleep)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// Syncs the stream of the crawl to disk, if any, when the crawl pauses
+func (c *Crawler) checkpoint() {
+	if s, ok := c.sink.(interface{ Sync() error }); ok {
+		if err := s.Sync(); err != nil {
+			log.Printf("Failed to sync the stream: %s\n", err)
+		}
+	}
+}
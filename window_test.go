@@ -0,0 +1,73 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCrawlWindow_Open(t *testing.T) {
+	night, err := ParseCrawlWindow("22:00-02:00", "Europe/London")
+	if err != nil {
+		t.Fatalf("Failed to parse window: %s", err)
+	}
+	tests := []struct {
+		at   string
+		open bool
+		next string
+	}{
+		{"2026-01-10T23:30:00Z", true, "2026-01-10T23:30:00Z"},
+		{"2026-01-10T01:59:00Z", true, "2026-01-10T01:59:00Z"},
+		{"2026-01-10T12:00:00Z", false, "2026-01-10T22:00:00Z"},
+		// British Summer Time, 22:00 in London is 21:00 UTC
+		{"2026-07-10T21:30:00Z", true, "2026-07-10T21:30:00Z"},
+		{"2026-07-10T01:30:00Z", false, "2026-07-10T21:00:00Z"},
+	}
+	for _, test := range tests {
+		at, _ := time.Parse(time.RFC3339, test.at)
+		next, _ := time.Parse(time.RFC3339, test.next)
+		if open := night.Open(at); open != test.open {
+			t.Errorf("Expecting the window open (%v) at (%s), got (%v)", test.open, test.at, open)
+		}
+		if got := night.NextOpen(at); !got.Equal(next) {
+			t.Errorf("Expecting the window to open at (%s) after (%s), got (%s)", test.next, test.at, got)
+		}
+	}
+
+	for _, invalid := range []string{"01:00", "25:00-02:00", "01:00-01:00"} {
+		if _, err := ParseCrawlWindow(invalid, "UTC"); err == nil {
+			t.Errorf("Expecting (%s) to be invalid", invalid)
+		}
+	}
+}
+
+// A crawl outside of its window pauses, checkpoints and stops when cancelled
+func TestCrawlWindow_pauses(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		io.WriteString(w, "<html></html>")
+	}))
+	defer ts.Close()
+
+	now := time.Now().UTC()
+	closed := &CrawlWindow{Start: time.Duration(now.Hour()+2) % 24 * time.Hour, End: time.Duration(now.Hour()+3) % 24 * time.Hour, Location: time.UTC}
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.respectRobots = false
+	c.window = closed
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c.Run(ctx)
+
+	if requests != 0 {
+		t.Errorf("Expecting no request outside of the window, got (%d)", requests)
+	}
+	if !closed.paused {
+		t.Errorf("Expecting the crawl to be paused")
+	}
+}
@@ -0,0 +1,94 @@
+package crawler
+
+import (
+	"sync"
+)
+
+// --------------------
+// Worker pool
+// --------------------
+
+// Number of pages crawled at the same time unless told otherwise, see Crawler.workers
+const DEFAULT_WORKERS int = 10
+
+// Sites waiting for a worker, in the order they were scheduled. Unlike 'urls' it never blocks
+// the workers pushing the links they find, so that they cannot all wait on each other.
+type frontierQueue struct {
+	mu    sync.Mutex
+	ready *sync.Cond
+	sites []string
+
+	// Set once the crawl is complete, workers return as soon as the queue is empty
+	closed bool
+}
+
+func newFrontierQueue() *frontierQueue {
+	q := &frontierQueue{}
+	q.ready = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *frontierQueue) push(site string) {
+	q.mu.Lock()
+	q.sites = append(q.sites, site)
+	q.mu.Unlock()
+	q.ready.Signal()
+}
+
+// Returns the next site, blocking until there is one. Returns false once the queue is
+// closed and empty.
+func (q *frontierQueue) pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.sites) == 0 && !q.closed {
+		q.ready.Wait()
+	}
+	if len(q.sites) == 0 {
+		return "", false
+	}
+	site := q.sites[0]
+	q.sites[0] = ""
+	q.sites = q.sites[1:]
+	return site, true
+}
+
+// Returns the number of sites waiting
+func (q *frontierQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.sites)
+}
+
+func (q *frontierQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.ready.Broadcast()
+}
+
+// Starts 'workers' goroutines crawling the sites of 'frontier' one after the other, and
+// closes it once the crawl is complete so that they return
+func (c *Crawler) startWorkers() {
+	for i := 0; i < c.workers; i++ {
+		go func() {
+			for {
+				site, ok := c.frontier.pop()
+				if !ok {
+					return
+				}
+				c.crawl(site)
+				c.pending.Done()
+
+				// Room was made in the frontier for spilled sites
+				select {
+				case c.slotFreed <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+	go func() {
+		c.pending.Wait()
+		c.frontier.close()
+	}()
+}
@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFrontierQueue(t *testing.T) {
+	q := newFrontierQueue()
+	q.push("https://monzo.com/a")
+	q.push("https://monzo.com/b")
+	if site, ok := q.pop(); !ok || site != "https://monzo.com/a" {
+		t.Errorf("Expecting (https://monzo.com/a) first, got (%s, %v)", site, ok)
+	}
+
+	// Closing lets the sites left be popped, then wakes up those waiting
+	q.close()
+	if site, ok := q.pop(); !ok || site != "https://monzo.com/b" {
+		t.Errorf("Expecting (https://monzo.com/b) once closed, got (%s, %v)", site, ok)
+	}
+	done := make(chan bool)
+	go func() {
+		_, ok := q.pop()
+		done <- ok
+	}()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Errorf("Expecting nothing left once closed")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expecting pop to return once closed")
+	}
+}
+
+// No more than 'workers' pages are fetched at once, however many are found
+func TestRun_workers(t *testing.T) {
+	for _, workers := range []int{1, 3} {
+		site := &SyntheticSite{Depth: 3, Branching: 5, Latency: time.Millisecond}
+		var mu sync.Mutex
+		current, peak := 0, 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			current++
+			if current > peak {
+				peak = current
+			}
+			mu.Unlock()
+			site.ServeHTTP(w, r)
+			mu.Lock()
+			current--
+			mu.Unlock()
+		}))
+
+		var c Crawler
+		c.Init(ts.URL)
+		c.probeNotFound = false
+		c.workers = workers
+		res, err := c.Run(context.Background())
+		ts.Close()
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		if len(res.Pages) != site.Pages() {
+			t.Errorf("Expecting all (%d) pages to be crawled by (%d) workers, got (%d)", site.Pages(), workers, len(res.Pages))
+		}
+		if peak > workers {
+			t.Errorf("Expecting at most (%d) pages to be fetched at once, got (%d)", workers, peak)
+		}
+
+		// Workers return once the crawl is complete
+		closed := func() bool {
+			c.frontier.mu.Lock()
+			defer c.frontier.mu.Unlock()
+			return c.frontier.closed
+		}
+		for start := time.Now(); !closed() && time.Since(start) < time.Second; {
+			time.Sleep(time.Millisecond)
+		}
+		if !closed() {
+			t.Errorf("Expecting the frontier to be closed once the crawl is complete")
+		}
+	}
+}
+
+// Records the number of sites waiting for a worker each time a page is crawled
+type frontierWatcher struct {
+	c    *Crawler
+	mu   sync.Mutex
+	peak int
+}
+
+func (w *frontierWatcher) WritePage(page CrawlPage, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.peak = max(w.peak, w.c.frontier.len())
+}
+
+// Sites found beyond 'maxGoroutines' waiting for a worker wait on disk, and are all crawled
+func TestRun_workersSpill(t *testing.T) {
+	site := &SyntheticSite{Depth: 2, Branching: 8, Latency: time.Millisecond}
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+
+	var c Crawler
+	c.Init(ts.URL)
+	c.probeNotFound = false
+	c.respectRobots = false
+	c.workers = 2
+	c.maxGoroutines = 4
+	watcher := &frontierWatcher{c: &c}
+	c.sink = watcher
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(res.Pages) != site.Pages() {
+		t.Errorf("Expecting all (%d) pages to be crawled, got (%d)", site.Pages(), len(res.Pages))
+	}
+	// Workers may each push a site past the mark before seeing it reached
+	if watcher.peak > 4+c.workers {
+		t.Errorf("Expecting at most (%d) sites to wait for a worker, got (%d)", 4+c.workers, watcher.peak)
+	}
+	if c.saturated != 0 {
+		t.Errorf("Expecting the frontier not to be saturated once done")
+	}
+}